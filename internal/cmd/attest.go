@@ -6,18 +6,120 @@ SPDX-License-Identifier: Apache-2.0
 package cmd
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/openvex/vexctl/pkg/attestation"
 	"github.com/openvex/vexctl/pkg/ctl"
 	"github.com/spf13/cobra"
 )
 
 type attestOptions struct {
-	attach bool
-	sign   bool
+	attach     bool
+	sign       bool
+	sbom       string
+	artifacts  []string
+	attachTo   []string
+	outputPath string
+	scanReport string
+	dbTime     string
+	platforms  bool
+	algorithms []string
+	replace    bool
+	documents  []string
+	notBefore  string
+	notAfter   string
+	validFor   time.Duration
+}
+
+// scanContext reads the scan context from the report
+// passed with --scan-report, if any
+func (o *attestOptions) scanContext() (*ctl.ScanContext, error) {
+	if o.scanReport == "" {
+		if o.dbTime != "" {
+			return nil, errors.New("--scanner-db-timestamp requires --scan-report")
+		}
+		return nil, nil
+	}
+	data, err := os.ReadFile(o.scanReport)
+	if err != nil {
+		return nil, fmt.Errorf("reading scan report: %w", err)
+	}
+	sc, err := ctl.ScanContextFromReport(data)
+	if err != nil {
+		return nil, fmt.Errorf("reading scan context: %w", err)
+	}
+	if o.dbTime != "" {
+		t, err := parseTime(o.dbTime)
+		if err != nil {
+			return nil, fmt.Errorf("parsing --scanner-db-timestamp: %w", err)
+		}
+		sc.DBTimestamp = &t
+	}
+	return sc, nil
+}
+
+// validity returns the validity window set with --not-before,
+// --not-after and --valid-for, if any
+func (o *attestOptions) validity() (*attestation.Validity, error) {
+	if o.notBefore == "" && o.notAfter == "" && o.validFor == 0 {
+		return nil, nil
+	}
+	if o.notAfter != "" && o.validFor != 0 {
+		return nil, errors.New("--not-after and --valid-for are mutually exclusive")
+	}
+	if o.validFor < 0 {
+		return nil, errors.New("--valid-for must be a positive duration")
+	}
+	v := &attestation.Validity{}
+	start := time.Now().UTC()
+	if o.notBefore != "" {
+		t, err := parseTime(o.notBefore)
+		if err != nil {
+			return nil, fmt.Errorf("parsing --not-before: %w", err)
+		}
+		v.NotBefore = &t
+		start = t
+	}
+	switch {
+	case o.notAfter != "":
+		t, err := parseTime(o.notAfter)
+		if err != nil {
+			return nil, fmt.Errorf("parsing --not-after: %w", err)
+		}
+		v.NotAfter = &t
+	case o.validFor != 0:
+		t := start.Add(o.validFor).Truncate(time.Second)
+		v.NotAfter = &t
+	}
+	if v.NotBefore != nil && v.NotAfter != nil && !v.NotAfter.After(*v.NotBefore) {
+		return nil, errors.New("the end of the validity window must be after its start")
+	}
+	return v, nil
+}
+
+// Validate checks the options in context with the arguments
+func (o *attestOptions) Validate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("not enough arguments")
+	}
+	if len(args) < 2 && o.sbom == "" && len(o.artifacts) == 0 {
+		return errors.New("at least one image, SBOM or artifact is required as attestation subject")
+	}
+	if o.attach && len(args) < 2 && len(o.attachTo) == 0 {
+		return errors.New("attaching the attestation requires at least one image")
+	}
+	if o.replace && !o.attach && len(o.attachTo) == 0 {
+		return errors.New("--replace requires attaching the attestation with --attach or --attach-to")
+	}
+	for _, a := range o.algorithms {
+		if _, ok := attestation.DigestAlgorithms[a]; !ok {
+			return fmt.Errorf("unsupported digest algorithm %q, must be sha256 or sha512", a)
+		}
+	}
+	return nil
 }
 
 func addAttest(parentCmd *cobra.Command) {
@@ -46,36 +148,131 @@ credentials from the user or trying to get them from the environment:
 Further positional arguments are considered to be container images and will be
 added to the attestation as subjects
 
+To bind the attestation to exactly the artifacts covered by an SBOM, pass it
+with --sbom. The digests of the artifacts described by the SBOM (SPDX or
+CycloneDX JSON) will be added as subjects:
+
+  %s attest --sbom=image.spdx.json data.vex.json
+
+Artifacts other than images, like tarballs, binaries or packages, can be
+attested with --artifact. Their SHA-256 digests are computed and added as
+subjects. The attestation can be written to a file with --output and
+attached to any OCI reference with --attach-to:
+
+  %s attest --sign --artifact=app.tar.gz --output=app.att.json data.vex.json
+
+When an image is a multi-platform index, --subject-platforms adds the digests
+of each of its platform images as subjects, besides the digest of the index.
+Artifact digests are computed with SHA-256, use --digest-algorithm to record
+SHA-512 digests too:
+
+  %s attest --subject-platforms --artifact=app.tar.gz --digest-algorithm=sha256,sha512 data.vex.json cgr.dev/image:latest
+
+When the VEX data assesses the results of a scan, pass the scanner report
+with --scan-report. The scanner name and version, the time its database was
+built and the digest of the report are recorded as annotations of the
+attached attestation, so consumers can judge the evidence behind the claims.
+Reports that do not record the database time can get it from
+--scanner-db-timestamp:
 
-`, appname, appname, appname, appname, appname, appname),
+  %s attest --attach --sign --scan-report=scan.sarif.json data.vex.json cgr.dev/image:latest
+
+Several VEX documents can be bundled in the same attestation by passing the
+others with --vex. Their statements are merged into a single predicate, so
+each image gets one attestation carrying all of them:
+
+  %s attest --attach --sign --vex=base.vex.json --vex=app.vex.json os.vex.json cgr.dev/image:latest
+
+Each attached attestation adds to the ones already on the image. To avoid
+images accumulating contradictory VEX attestations, --replace removes the
+VEX attestations already attached and records their digests in the
+dev.openvex.supersedes annotation of the new one. Attestations with other
+predicates, like SBOMs, are kept:
+
+  %s attest --attach --sign --replace data.vex.json cgr.dev/image:latest
+
+VEX claims go stale as the software and the vulnerability data evolve. To
+make them age out, record a validity window in the attestation with
+--not-before and --not-after, or --valid-for to set the end relative to the
+start. The window is part of the signed predicate. Commands reading VEX
+data from images warn about attestations used outside of their window, or
+skip them with --reject-expired:
+
+  %s attest --attach --sign --valid-for=720h data.vex.json cgr.dev/image:latest
+
+`, appname, appname, appname, appname, appname, appname, appname, appname, appname, appname, appname, appname, appname),
 		Use:           "attest",
 		SilenceUsage:  false,
 		SilenceErrors: false,
-		// PersistentPreRunE: initLogging,
+		// PersistentPreRunE: initCommand,
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			// Only the first argument is a file, the rest are images
+			if len(args) == 0 {
+				return completeVEXFiles(cmd, args, toComplete)
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) < 2 {
-				return errors.New("not enough arguments")
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
 			}
 			cmd.SilenceUsage = true
 
-			ctx := context.Background()
+			ctx := cmd.Context()
+			scanContext, err := opts.scanContext()
+			if err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			validity, err := opts.validity()
+			if err != nil {
+				return withExitCode(exitValidation, err)
+			}
 
-			vexctl := ctl.New()
-			vexctl.Options.Sign = opts.sign
+			// Open the output file before signing so that a bad path
+			// fails before anything is published
+			out := os.Stdout
+			if opts.outputPath != "" {
+				f, err := os.Create(opts.outputPath)
+				if err != nil {
+					return withExitCode(exitValidation, fmt.Errorf("opening attestation file: %w", err))
+				}
+				defer f.Close()
+				out = f
+			}
+
+			progress := newSpinner()
+			defer progress.Stop()
+			vexctl := newVexCtl(
+				ctl.WithSign(opts.sign),
+				ctl.WithSubjectSBOM(opts.sbom),
+				ctl.WithSubjectFiles(opts.artifacts),
+				ctl.WithSubjectPlatforms(opts.platforms),
+				ctl.WithSubjectDigestAlgorithms(opts.algorithms),
+				ctl.WithProgress(progress.ProgressFunc()),
+				ctl.WithScanContext(scanContext),
+				ctl.WithReplaceAttestations(opts.replace),
+				ctl.WithValidity(validity),
+			)
 
-			attestation, err := vexctl.Attest(args[0], args[1:])
+			att, err := vexctl.AttestDocuments(ctx, append([]string{args[0]}, opts.documents...), args[1:])
 			if err != nil {
 				return fmt.Errorf("generating attestation: %w", err)
 			}
 
-			if opts.attach {
-				if err := vexctl.Attach(ctx, attestation, args[1:]); err != nil {
+			if opts.attach || len(opts.attachTo) > 0 {
+				refs := args[1:]
+				if len(opts.attachTo) > 0 {
+					refs = opts.attachTo
+				}
+				progress.Start("Attaching attestation")
+				if err := vexctl.Attach(ctx, att, refs); err != nil {
 					return fmt.Errorf("attaching attestation: %w", err)
 				}
 			}
 
-			if err := attestation.ToJSON(os.Stdout); err != nil {
-				return fmt.Errorf("marshaling attestation to json")
+			progress.Stop()
+			if err := att.ToJSON(out); err != nil {
+				return fmt.Errorf("marshaling attestation to json: %w", err)
 			}
 
 			return nil
@@ -98,5 +295,96 @@ added to the attestation as subjects
 		"sign the attestation with sigstore",
 	)
 
+	generateCmd.PersistentFlags().StringVar(
+		&opts.sbom,
+		"sbom",
+		"",
+		"SBOM whose described artifacts are added as attestation subjects",
+	)
+
+	generateCmd.PersistentFlags().StringSliceVar(
+		&opts.artifacts,
+		"artifact",
+		[]string{},
+		"files to attest, their digests are added as attestation subjects",
+	)
+
+	generateCmd.PersistentFlags().BoolVar(
+		&opts.platforms,
+		"subject-platforms",
+		false,
+		"add the digests of the platform images of image indexes as subjects",
+	)
+
+	generateCmd.PersistentFlags().StringSliceVar(
+		&opts.algorithms,
+		"digest-algorithm",
+		[]string{"sha256"},
+		"algorithms to compute the digests of the attested artifacts (sha256, sha512)",
+	)
+
+	generateCmd.PersistentFlags().BoolVar(
+		&opts.replace,
+		"replace",
+		false,
+		"replace the VEX attestations already attached to the images",
+	)
+
+	generateCmd.PersistentFlags().StringSliceVar(
+		&opts.documents,
+		"vex",
+		[]string{},
+		"additional VEX documents to bundle in the attestation, merged with the first one",
+	)
+
+	generateCmd.PersistentFlags().StringSliceVar(
+		&opts.attachTo,
+		"attach-to",
+		[]string{},
+		"OCI references to attach the attestation to instead of the image arguments",
+	)
+
+	addOutputFlag(generateCmd, &opts.outputPath, "file to write the attestation (default is STDOUT)")
+
+	generateCmd.PersistentFlags().StringVar(
+		&opts.scanReport,
+		"scan-report",
+		"",
+		"scanner report assessed by the VEX data, recorded in the attestation annotations",
+	)
+
+	generateCmd.PersistentFlags().StringVar(
+		&opts.dbTime,
+		"scanner-db-timestamp",
+		"",
+		"time the scanner vulnerability database was built (RFC3339 or YYYY-MM-DD)",
+	)
+
+	generateCmd.PersistentFlags().StringVar(
+		&opts.notBefore,
+		"not-before",
+		"",
+		"start of the validity window of the attestation (RFC3339 or YYYY-MM-DD)",
+	)
+
+	generateCmd.PersistentFlags().StringVar(
+		&opts.notAfter,
+		"not-after",
+		"",
+		"end of the validity window of the attestation (RFC3339 or YYYY-MM-DD)",
+	)
+
+	generateCmd.PersistentFlags().DurationVar(
+		&opts.validFor,
+		"valid-for",
+		0,
+		"length of the validity window of the attestation, from --not-before or now",
+	)
+
+	registerFlagCompletion(generateCmd, "sbom", completeVEXFiles)
+	registerFlagCompletion(generateCmd, "vex", completeVEXFiles)
+	registerFlagCompletion(generateCmd, "digest-algorithm", completeValues([]string{"sha256", "sha512"}))
+	registerFlagCompletion(generateCmd, "scan-report", completeSARIFFiles)
+
 	parentCmd.AddCommand(generateCmd)
 }
@@ -0,0 +1,55 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// Extensions of the files offered when completing document paths
+var (
+	vexFileExtensions   = []string{"json", "yaml", "yml"}
+	sarifFileExtensions = []string{"json", "sarif"}
+)
+
+// documentFormats are the VEX formats understood by filter
+var documentFormats = []string{"vex", "yaml", "csaf", "cyclonedx"}
+
+// completeValues returns a completion function offering a fixed list of values
+func completeValues(values []string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return values, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeVEXFiles completes the paths of VEX documents
+func completeVEXFiles(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return vexFileExtensions, cobra.ShellCompDirectiveFilterFileExt
+}
+
+// completeSARIFFiles completes the paths of scanner reports
+func completeSARIFFiles(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return sarifFileExtensions, cobra.ShellCompDirectiveFilterFileExt
+}
+
+// completeStatuses completes the VEX status values
+var completeStatuses = completeValues(vex.Statuses())
+
+// completeJustifications completes the not_affected justification values
+var completeJustifications = completeValues(vex.Justifications())
+
+// registerFlagCompletion sets the completion function of a flag. The flags
+// are defined in the same file, so failing to find them is a programming
+// error.
+func registerFlagCompletion(
+	cmd *cobra.Command, flag string, f func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective),
+) {
+	if err := cmd.RegisterFlagCompletionFunc(flag, f); err != nil {
+		panic(err)
+	}
+}
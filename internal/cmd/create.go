@@ -14,11 +14,14 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/openvex/go-vex/pkg/vex"
+
+	"github.com/openvex/vexctl/pkg/ctl"
 )
 
 type createOptions struct {
 	vexDocOptions
 	vexStatementOptions
+	outputOptions
 	outFilePath string
 }
 
@@ -46,6 +49,25 @@ func (o *createOptions) Validate(args []string) error {
 		return errors.New("status can only be specified once")
 	}
 
+	return o.outputOptions.Validate()
+}
+
+// applyProjectConfig uses the defaults of the repository configuration
+// written by init for the author, role and products not set in the flags
+func (o *createOptions) applyProjectConfig(cmd *cobra.Command, args []string) error {
+	config, err := ctl.LoadProjectConfig(".")
+	if err != nil || config == nil {
+		return err
+	}
+	if !cmd.Flags().Changed("author") && config.Author != "" {
+		o.Author = config.Author
+	}
+	if !cmd.Flags().Changed("author-role") && config.AuthorRole != "" {
+		o.AuthorRole = config.AuthorRole
+	}
+	if !cmd.Flags().Changed("product") && len(args) == 0 {
+		o.Products = append(o.Products, config.Products...)
+	}
 	return nil
 }
 
@@ -60,7 +82,9 @@ from the command line. This is intended for simple use cases
 or to get a base document to get started.
 
 You can specify multiple products and customize the metadata of
-the document via the command line flags. %s will honor the
+the document via the command line flags. In a repository set up with
+'%s init', the author, role and products default to the ones in its
+configuration. %s will honor the
 SOURCE_DATE_EPOCH environment variable and use that date for 
 the document (it can be formatted in UNIX time or RFC3339).
 
@@ -90,15 +114,31 @@ Examples:
               --status="not_affected" \
               --justification="component_not_present" 
 
-`, appname, appname, appname, appname, appname, appname),
+# The document is written as indented JSON by default. Use --compact for
+# single line JSON or --output-format=yaml to write it in YAML:
+
+%s create --output-format=yaml --output=git.vex.yaml \
+              "pkg:apk/wolfi/git@2.39.0-r1?arch=x86_64" CVE-2023-12345 fixed
+
+`, appname, appname, appname, appname, appname, appname, appname, appname),
 		Use:               "create [flags] [product_id [vuln_id [status]]]",
 		Example:           fmt.Sprintf("%s create \"pkg:apk/wolfi/git@2.39.0-r1?arch=x86_64\" CVE-2022-39260 fixed ", appname),
 		SilenceUsage:      false,
 		SilenceErrors:     false,
-		PersistentPreRunE: initLogging,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			// The third positional argument is the status
+			if len(args) == 2 {
+				return completeStatuses(cmd, args, toComplete)
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.applyProjectConfig(cmd, args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
 			if err := opts.Validate(args); err != nil {
-				return err
+				return withExitCode(exitValidation, err)
 			}
 			// If we have arguments, add them
 			for i := range args {
@@ -112,6 +152,8 @@ Examples:
 				}
 			}
 			newDoc := vex.New()
+			newDoc.Author = opts.Author
+			newDoc.AuthorRole = opts.AuthorRole
 
 			statement := vex.Statement{
 				Vulnerability:   opts.Vulnerability,
@@ -125,11 +167,13 @@ Examples:
 			}
 
 			if err := statement.Validate(); err != nil {
-				return fmt.Errorf("invalid statement: %w", err)
+				return withExitCode(exitValidation, fmt.Errorf("invalid statement: %w", err))
 			}
 
 			newDoc.Statements = append(newDoc.Statements, statement)
-			if _, err := newDoc.GenerateCanonicalID(); err != nil {
+			if opts.DocumentID != "" {
+				newDoc.ID = opts.DocumentID
+			} else if _, err := newDoc.GenerateCanonicalID(); err != nil {
 				return fmt.Errorf("generating document id: %w", err)
 			}
 
@@ -144,7 +188,7 @@ Examples:
 				defer f.Close()
 			}
 
-			if err := newDoc.ToJSON(out); err != nil {
+			if err := opts.writeDocument(out, &newDoc); err != nil {
 				return fmt.Errorf("writing new VEX document: %w", err)
 			}
 
@@ -223,12 +267,13 @@ Examples:
 		"action statement for affected status",
 	)
 
-	createCmd.PersistentFlags().StringVar(
-		&opts.outFilePath,
-		"file",
-		"",
-		"file to write the document (default is STDOUT)",
-	)
+	addOutputFlag(createCmd, &opts.outFilePath, "file to write the document (default is STDOUT)", "file")
+
+	opts.outputOptions.addFlags(createCmd)
+
+	registerFlagCompletion(createCmd, "status", completeStatuses)
+	registerFlagCompletion(createCmd, "justification", completeJustifications)
+	registerFlagCompletion(createCmd, "output", completeVEXFiles)
 
 	parentCmd.AddCommand(createCmd)
 }
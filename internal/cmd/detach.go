@@ -0,0 +1,114 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/go-vex/pkg/vex"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type detachOptions struct {
+	ctl.DetachOptions
+}
+
+// Validate checks the options in context with the arguments
+func (o *detachOptions) Validate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("an image reference is required")
+	}
+	if o.Empty() {
+		return errors.New("at least one of --digest, --predicate-type or --document-id is required")
+	}
+	return nil
+}
+
+func addDetach(parentCmd *cobra.Command) {
+	opts := detachOptions{}
+	detachCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s detach: remove attestations attached to an image", appname),
+		Long: fmt.Sprintf(`%s detach: remove attestations attached to an image
+
+The detach subcommand deletes attestations from the attestation set of a
+container image. Use it to revoke VEX documents that were attached by
+mistake.
+
+Attestations are selected by the digest of their layer, their predicate
+type or the ID of the VEX document they contain. An attestation is removed
+if it matches any of the criteria. The digests of the removed attestations
+are printed to STDOUT.
+
+Examples:
+
+# Remove the attestation with a VEX document:
+%s detach --document-id=https://example.com/vex/2023-001 registry.example.com/app:latest
+
+# Remove all VEX attestations from an image:
+%s detach --predicate-type=%s registry.example.com/app:latest
+
+`, appname, appname, appname, vex.TypeURI),
+		Use:               "detach image_reference",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			progress := newSpinner()
+			defer progress.Stop()
+			vexctl := newVexCtl(ctl.WithProgress(progress.ProgressFunc()))
+			progress.Start("Detaching attestations")
+			removed, err := vexctl.Detach(cmd.Context(), args[0], opts.DetachOptions)
+			if err != nil {
+				return err
+			}
+			progress.Stop()
+
+			if len(removed) == 0 {
+				logrus.Warn("No attestations matched, the image was not modified")
+			}
+			for _, d := range removed {
+				fmt.Println(d)
+			}
+			return nil
+		},
+	}
+
+	detachCmd.PersistentFlags().StringSliceVar(
+		&opts.Digests,
+		"digest",
+		[]string{},
+		"digests of the attestations to remove (sha256:...)",
+	)
+
+	detachCmd.PersistentFlags().StringSliceVar(
+		&opts.PredicateTypes,
+		"predicate-type",
+		[]string{},
+		"remove the attestations with these predicate types",
+	)
+
+	detachCmd.PersistentFlags().StringSliceVar(
+		&opts.DocumentIDs,
+		"document-id",
+		[]string{},
+		"remove the attestations of the VEX documents with these IDs",
+	)
+
+	parentCmd.AddCommand(detachCmd)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type discoverOptions struct {
+	format   string
+	template string
+	output   string
+}
+
+// Validate checks the options in context with the arguments
+func (o *discoverOptions) Validate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("a repository is required")
+	}
+	if o.format != "text" && o.format != "json" && o.format != outputFormatTemplate {
+		return fmt.Errorf("invalid output format %q, must be text, json or template", o.format)
+	}
+	return validateTemplate(o.format, o.template)
+}
+
+func addDiscover(parentCmd *cobra.Command) {
+	opts := discoverOptions{}
+	discoverCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s discover: list the images of a repository with VEX attestations", appname),
+		Long: fmt.Sprintf(`%s discover: list the images of a repository with VEX attestations
+
+The discover subcommand walks the tags of a container image repository and
+reports, for each image digest, how many VEX attestations are attached to
+it and the authors of their documents. Images only known by the tags cosign
+stores their attestations under are listed as untagged. Platform teams can
+use it to audit the VEX coverage of the images in a registry.
+
+Attestations are verified like in the rest of %s, pass the expected
+signer with --certificate-identity and --certificate-oidc-issuer or --key.
+Images whose attestations cannot be read are reported with the error
+instead of failing the whole run.
+
+Use --output-format=json to get the list in a machine readable form or
+--output-format=template with --template to render it with a Go template.
+
+Examples:
+
+%s discover --certificate-identity=https://github.com/chainguard-images/images/.github/workflows/release.yaml@refs/heads/main \
+    --certificate-oidc-issuer=https://token.actions.githubusercontent.com cgr.dev/chainguard/nginx
+
+%s discover --output-format=json --key=cosign.pub registry.example.com/app
+
+`, appname, appname, appname, appname),
+		Use:               "discover repository",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			out, err := createOutput(opts.output)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+
+			progress := newSpinner()
+			defer progress.Stop()
+			vexctl := newVexCtl(ctl.WithProgress(progress.ProgressFunc()))
+			progress.Start("Listing tags")
+			discovery, err := vexctl.Discover(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("discovering VEX attestations: %w", err)
+			}
+			progress.Stop()
+
+			if opts.format == outputFormatTemplate {
+				return writeTemplate(out, opts.template, discovery)
+			}
+			if opts.format == "json" {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(discovery); err != nil {
+					return fmt.Errorf("encoding discovered images: %w", err)
+				}
+				return nil
+			}
+			return discovery.Write(out)
+		},
+	}
+
+	addOutputFormatFlag(
+		discoverCmd, &opts.format, "text", []string{"text", "json", outputFormatTemplate},
+		"output format, either text, json or template", "format",
+	)
+	addTemplateFlag(discoverCmd, &opts.template)
+
+	addOutputFlag(discoverCmd, &opts.output, "file to write the discovered images (default is STDOUT)")
+
+	parentCmd.AddCommand(discoverCmd)
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/go-vex/pkg/vex"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type editOptions struct {
+	vulnerability string
+	product       string
+	statement     int
+}
+
+// Validate checks the options in context with the arguments
+func (o *editOptions) Validate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("a VEX document to edit is required")
+	}
+	if (o.vulnerability == "") == (o.statement == 0) {
+		return errors.New("select the statement to edit either with --vuln or --statement")
+	}
+	if o.statement < 0 {
+		return errors.New("statement numbers start at 1")
+	}
+	return nil
+}
+
+// index returns the index of the statement selected in the options
+func (o *editOptions) index(doc *vex.VEX) (int, error) {
+	if o.statement > 0 {
+		if o.statement > len(doc.Statements) {
+			return 0, fmt.Errorf("the document has %d statements", len(doc.Statements))
+		}
+		return o.statement - 1, nil
+	}
+	return ctl.FindStatement(doc, o.vulnerability, o.product)
+}
+
+func addEdit(parentCmd *cobra.Command) {
+	opts := editOptions{}
+	editCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s edit: edit a statement of a VEX document", appname),
+		Long: fmt.Sprintf(`%s edit: edit a statement of a VEX document
+
+The edit subcommand opens a statement of a VEX document as YAML in the
+editor set in $VISUAL or $EDITOR. When the editor is closed, the statement
+is validated and written back to the document, updating the timestamps of
+the statement and the document and incrementing the document version.
+
+If the edited statement is not valid, the error is shown and the editor
+can be opened again to fix it. Leaving the statement unchanged aborts
+the edit.
+
+The statement is selected by its vulnerability, along with a product if
+the document has more than one statement about it, or by its position
+in the document starting at 1.
+
+Examples:
+
+%s edit --vuln=CVE-2023-1234 feed.vex.json
+
+%s edit --vuln=CVE-2023-1234 --product="pkg:apk/wolfi/bash@1.0.0" feed.vex.json
+
+%s edit --statement=3 feed.vex.json
+
+`, appname, appname, appname, appname),
+		Use:               "edit (--vuln vuln_id | --statement n) document.vex.json",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: completeVEXFiles,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			doc, err := vex.Load(args[0])
+			if err != nil {
+				return withExitCode(exitValidation, fmt.Errorf("loading VEX document: %w", err))
+			}
+			i, err := opts.index(doc)
+			if err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			original, err := ctl.StatementYAML(&doc.Statements[i])
+			if err != nil {
+				return err
+			}
+
+			tmp, err := os.CreateTemp("", "vexctl-statement-*.yaml")
+			if err != nil {
+				return fmt.Errorf("creating temporary file: %w", err)
+			}
+			tmp.Close()
+			defer os.Remove(tmp.Name())
+			if err := os.WriteFile(tmp.Name(), original, 0o600); err != nil {
+				return fmt.Errorf("writing statement: %w", err)
+			}
+
+			stdin := bufio.NewReader(os.Stdin)
+			for {
+				if err := runEditor(tmp.Name()); err != nil {
+					return err
+				}
+				edited, err := os.ReadFile(tmp.Name())
+				if err != nil {
+					return fmt.Errorf("reading edited statement: %w", err)
+				}
+				if bytes.Equal(edited, original) {
+					return withExitCode(exitValidation, errors.New("statement unchanged, edit aborted"))
+				}
+				newDoc, err := ctl.ReplaceStatement(doc, i, edited, time.Now())
+				if err == nil {
+					return writeDocument(args[0], newDoc)
+				}
+				fmt.Fprintf(os.Stderr, "Error: %v\nEdit the statement again? [Y/n] ", err)
+				answer, rerr := stdin.ReadString('\n')
+				if a := strings.ToLower(strings.TrimSpace(answer)); rerr != nil || (a != "" && a != "y" && a != "yes") {
+					return withExitCode(exitValidation, fmt.Errorf("edit aborted: %w", err))
+				}
+			}
+		},
+	}
+
+	editCmd.PersistentFlags().StringVar(
+		&opts.vulnerability,
+		"vuln",
+		"",
+		"vulnerability of the statement to edit",
+	)
+
+	editCmd.PersistentFlags().StringVarP(
+		&opts.product,
+		"product",
+		"p",
+		"",
+		"product of the statement to edit, when there are several about the vulnerability",
+	)
+
+	editCmd.PersistentFlags().IntVar(
+		&opts.statement,
+		"statement",
+		0,
+		"position of the statement to edit in the document, starting at 1",
+	)
+
+	parentCmd.AddCommand(editCmd)
+}
+
+// runEditor opens a file in the editor set in the environment
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := strings.Fields(editor)
+	c := exec.Command(args[0], append(args[1:], path)...) //nolint:gosec // the editor is chosen by the user
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("running editor: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type embedOptions struct {
+	ctl.EmbedOptions
+}
+
+func addEmbed(parentCmd *cobra.Command) {
+	opts := embedOptions{}
+	embedCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s embed: write a VEX document into a container image", appname),
+		Long: fmt.Sprintf(`%s embed: write a VEX document into a container image
+
+The embed subcommand injects an OpenVEX document into the contents of a
+container image instead of attaching it as a separate attestation. This
+is useful for consumers that only read the image itself.
+
+The document can be stored in two places, by default both are used:
+
+  - An image label, %s by default (--label)
+  - A new layer with the document at %s (--layer)
+
+As embedding the document changes the image contents, %s pushes a new
+image and prints its digest. By default the new image replaces the
+original tag, use --destination to push it to a different reference.
+
+Image indexes are not supported, embed the document in the image of
+each platform instead.
+
+Examples:
+
+# Embed a document as a label and a layer, replacing the original tag:
+%s embed data.vex.json registry.example.com/app:latest
+
+# Only add the layer and push the image to a new tag:
+%s embed --label=false --destination=registry.example.com/app:vex \
+    data.vex.json registry.example.com/app:latest
+
+`, appname, ctl.DefaultEmbedLabel, ctl.DefaultEmbedPath, appname, appname, appname),
+		Use:               "embed vex_document image_reference",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return completeVEXFiles(cmd, args, toComplete)
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return withExitCode(exitValidation, errors.New("a VEX document and an image reference are required"))
+			}
+			if !opts.Label && !opts.Layer {
+				return withExitCode(exitValidation, errors.New("at least one of --label or --layer must be enabled"))
+			}
+			cmd.SilenceUsage = true
+
+			progress := newSpinner()
+			defer progress.Stop()
+			vexctl := newVexCtl(ctl.WithProgress(progress.ProgressFunc()))
+			progress.Start("Embedding VEX document")
+			digest, err := vexctl.Embed(cmd.Context(), args[0], args[1], opts.EmbedOptions)
+			if err != nil {
+				return fmt.Errorf("embedding VEX document: %w", err)
+			}
+			progress.Stop()
+
+			fmt.Println(digest)
+			return nil
+		},
+	}
+
+	embedCmd.PersistentFlags().BoolVar(
+		&opts.Label,
+		"label",
+		true,
+		"store the VEX document in an image label",
+	)
+
+	embedCmd.PersistentFlags().StringVar(
+		&opts.LabelName,
+		"label-name",
+		ctl.DefaultEmbedLabel,
+		"name of the label used to store the VEX document",
+	)
+
+	embedCmd.PersistentFlags().BoolVar(
+		&opts.Layer,
+		"layer",
+		true,
+		"add a layer to the image with the VEX document",
+	)
+
+	embedCmd.PersistentFlags().StringVar(
+		&opts.Path,
+		"path",
+		ctl.DefaultEmbedPath,
+		"path of the VEX document in the new layer",
+	)
+
+	embedCmd.PersistentFlags().StringVar(
+		&opts.Destination,
+		"destination",
+		"",
+		"reference to push the new image to (defaults to the original tag)",
+	)
+
+	parentCmd.AddCommand(embedCmd)
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// errorObject is the machine readable form of an error
+// written to STDERR when --error-format=json
+type errorObject struct {
+	Code    int      `json:"code"`
+	Message string   `json:"message"`
+	Hints   []string `json:"hints"`
+}
+
+// writeError prints the error that made a command fail in the format
+// chosen by the user
+func writeError(w io.Writer, format string, err error) {
+	obj := errorObject{
+		Code:    exitCode(err),
+		Message: err.Error(),
+		Hints:   errorHints(err),
+	}
+
+	if format == "json" {
+		if jsonErr := json.NewEncoder(w).Encode(obj); jsonErr == nil {
+			return
+		}
+	}
+
+	fmt.Fprintf(w, "Error: %s\n", obj.Message)
+	for _, h := range obj.Hints {
+		fmt.Fprintf(w, "Hint: %s\n", h)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"net"
+	"net/url"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+// Exit codes returned by vexctl. They are part of the command line
+// interface: CI scripts rely on them to branch on the command outcome.
+const (
+	// exitOK is returned when the command succeeds
+	exitOK = 0
+
+	// exitFailure is returned on errors not classified below
+	exitFailure = 1
+
+	// exitValidation is returned when the input data or the
+	// options are invalid or an image fails verification
+	exitValidation = 2
+
+	// exitVulnerabilities is returned by filter when results remain
+	// after applying the VEX data and --fail-on-results is set
+	exitVulnerabilities = 3
+
+	// exitNetwork is returned when communicating with a
+	// registry or remote VEX source fails
+	exitNetwork = 4
+
+	// exitUncovered is returned by filter when results in the report
+	// have no VEX statement and --require-coverage is set
+	exitUncovered = 5
+)
+
+// codedError is an error which makes vexctl exit with a specific code
+type codedError struct {
+	code int
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+
+func (e *codedError) Unwrap() error { return e.err }
+
+// withExitCode tags an error with the code vexctl should exit with
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: code, err: err}
+}
+
+// hintError attaches a suggestion for the user to fix an error
+type hintError struct {
+	hint string
+	err  error
+}
+
+func (e *hintError) Error() string { return e.err.Error() }
+
+func (e *hintError) Unwrap() error { return e.err }
+
+// withHint attaches a hint to an error, shown to the user when
+// the error makes vexctl exit
+func withHint(err error, hint string) error {
+	if err == nil {
+		return nil
+	}
+	return &hintError{hint: hint, err: err}
+}
+
+// errorHints returns the hints attached to an error chain. If none were
+// attached, it returns a generic hint based on the exit code.
+func errorHints(err error) []string {
+	hints := []string{}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if h, ok := e.(*hintError); ok { //nolint:errorlint // the chain is walked manually
+			hints = append(hints, h.hint)
+		}
+	}
+	if len(hints) > 0 {
+		return hints
+	}
+	if errors.Is(err, ctl.ErrUnverifiedAttestations) {
+		return append(hints,
+			"pass the signer identity with --certificate-identity and --certificate-oidc-issuer or a public key with --key",
+			"to trust the attestations without verification use --insecure-skip-verify",
+		)
+	}
+	if errors.Is(err, ctl.ErrDigestMismatch) {
+		return append(hints, "the pinned document changed, review it and update the digest of the source")
+	}
+	switch exitCode(err) {
+	case exitValidation:
+		hints = append(hints, "run the command with --help to check its arguments and options")
+	case exitNetwork:
+		hints = append(hints,
+			"check your network connection and registry credentials",
+			"transient registry failures can be retried with --retries",
+		)
+	}
+	return hints
+}
+
+// exitCode returns the code vexctl exits with when a command returns err
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+
+	if errors.Is(err, ctl.ErrUnverifiedAttestations) || errors.Is(err, ctl.ErrDigestMismatch) {
+		return exitValidation
+	}
+
+	var transportErr *transport.Error
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var urlErr *url.Error
+	if errors.As(err, &transportErr) || errors.As(err, &opErr) ||
+		errors.As(err, &dnsErr) || errors.As(err, &urlErr) {
+		return exitNetwork
+	}
+
+	return exitFailure
+}
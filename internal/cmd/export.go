@@ -0,0 +1,150 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/go-vex/pkg/vex"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type exportOptions struct {
+	format      string
+	products    []string
+	author      string
+	outFilePath string
+}
+
+// Validate checks the options in context with the arguments
+func (o *exportOptions) Validate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("at least one VEX document is required")
+	}
+	if o.format != ctl.ExportFormatGrype && o.format != ctl.ExportFormatTrivy && o.format != ctl.ExportFormatSPDX3 {
+		return fmt.Errorf("invalid export format %q, must be grype, trivy or spdx3", o.format)
+	}
+	return nil
+}
+
+func addExport(parentCmd *cobra.Command) {
+	opts := exportOptions{}
+	exportCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s export: write VEX data as scanner ignore files or SPDX 3.0", appname),
+		Long: fmt.Sprintf(`%s export: write VEX data as scanner ignore files or SPDX 3.0
+
+The export subcommand turns VEX documents into the ignore files of scanners
+without native VEX support, so they honor the same decisions. The statements
+are replayed in chronological order and the vulnerabilities whose latest
+status in a product is not_affected or fixed are written as:
+
+  grype  the ignore rules of a .grype.yaml configuration file
+  trivy  the entries of a .trivyignore file
+
+grype rules are limited to the packages of products identified by package
+URLs. trivy ignores vulnerabilities regardless of the package, use --product
+to only export the statements about the scanned products.
+
+For consumers standardizing on SPDX 3.0 for both SBOM and VEX data, the
+spdx3 format writes the latest statement about each vulnerability and
+product, whatever its status, as the VEX assessment relationships of an
+SPDX 3.0 JSON-LD document. --author sets the organization recorded as its
+creator.
+
+Examples:
+
+%s export --output-format=grype vex/ > .grype.yaml
+
+%s export --output-format=trivy --product=pkg:oci/app data.vex.json > .trivyignore
+
+%s export --output-format=spdx3 --author="Example Company" vex/ > vex.spdx.json
+
+`, appname, appname, appname, appname),
+		Use:               "export --output-format (grype|trivy|spdx3) vex_document...",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: completeVEXFiles,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			vexctl := newVexCtl()
+			vexes, err := vexctl.VexesFromURIs(cmd.Context(), args)
+			if err != nil {
+				return fmt.Errorf("reading VEX data: %w", err)
+			}
+
+			var out io.Writer = os.Stdout
+			if opts.outFilePath != "" {
+				f, err := os.Create(opts.outFilePath)
+				if err != nil {
+					return fmt.Errorf("creating export file: %w", err)
+				}
+				defer f.Close()
+				out = f
+			}
+
+			if opts.format == ctl.ExportFormatSPDX3 {
+				statements, err := vexctl.LatestStatements(cmd.Context(), vexes, opts.products)
+				if err != nil {
+					return fmt.Errorf("computing latest statements: %w", err)
+				}
+				if err := ctl.WriteSPDX3(out, statements, ctl.SPDX3Options{Author: opts.author}); err != nil {
+					return fmt.Errorf("writing SPDX document: %w", err)
+				}
+				return nil
+			}
+
+			suppressed, err := vexctl.Suppressions(cmd.Context(), vexes, opts.products)
+			if err != nil {
+				return fmt.Errorf("computing suppressed vulnerabilities: %w", err)
+			}
+			if opts.format == ctl.ExportFormatGrype {
+				err = ctl.WriteGrypeIgnore(out, suppressed)
+			} else {
+				err = ctl.WriteTrivyIgnore(out, suppressed)
+			}
+			if err != nil {
+				return fmt.Errorf("writing ignore file: %w", err)
+			}
+			return nil
+		},
+	}
+
+	addOutputFormatFlag(
+		exportCmd, &opts.format, ctl.ExportFormatGrype,
+		[]string{ctl.ExportFormatGrype, ctl.ExportFormatTrivy, ctl.ExportFormatSPDX3},
+		"format of the export, either grype, trivy or spdx3", "format",
+	)
+
+	exportCmd.PersistentFlags().StringSliceVarP(
+		&opts.products,
+		"product",
+		"p",
+		[]string{},
+		"only export the statements about these products",
+	)
+
+	exportCmd.PersistentFlags().StringVar(
+		&opts.author,
+		"author",
+		vex.DefaultAuthor,
+		"organization recorded as the creator of spdx3 documents",
+	)
+
+	addOutputFlag(exportCmd, &opts.outFilePath, "file to write the export (default is STDOUT)", "file")
+
+	parentCmd.AddCommand(exportCmd)
+}
@@ -6,13 +6,16 @@ SPDX-License-Identifier: Apache-2.0
 package cmd
 
 import (
-	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 
 	"github.com/openvex/go-vex/pkg/sarif"
 	"github.com/openvex/go-vex/pkg/vex"
@@ -21,13 +24,127 @@ import (
 )
 
 type filterOptions struct {
-	reportFormat string
-	products     []string
+	reportFormat   string
+	outputPath     string
+	products       []string
+	allowPartial   bool
+	maxConcurrency int
+	stream         bool
+	failOnResults  bool
+	requireCover   bool
+	coverageReport string
+	htmlReport     string
+	patchOut       string
+	explain        []string
+	vexSources     []string
+	autodiscover   bool
+	noStore        bool
+	justifications []string
+	store          *ctl.Store
+}
+
+// checkResults returns an error if results remain in the
+// filtered report and the user asked to fail on them
+func (o *filterOptions) checkResults(remaining int) error {
+	if o.failOnResults && remaining > 0 {
+		return withExitCode(
+			exitVulnerabilities, fmt.Errorf("%d results remain after applying VEX data", remaining),
+		)
+	}
+	return nil
+}
+
+// checkCoverage returns an error if the user requires every result in
+// the report to have a VEX statement and some of them have none
+func (o *filterOptions) checkCoverage(coverage *ctl.CoverageReport) error {
+	if !o.requireCover || len(coverage.Uncovered) == 0 {
+		return nil
+	}
+	return withExitCode(exitUncovered, withHint(
+		fmt.Errorf(
+			"%d vulnerabilities in the report have no VEX statement: %s",
+			len(coverage.Uncovered), strings.Join(coverage.Uncovered, ", "),
+		),
+		fmt.Sprintf("record a statement for each of them, eg with '%s create'", appname),
+	))
+}
+
+// openStore opens the local VEX store to consult it, unless disabled with
+// --no-store or when streaming. It is not an error if there is no store.
+func (o *filterOptions) openStore() {
+	if o.noStore || o.stream {
+		return
+	}
+	store, err := openStore()
+	if err != nil {
+		logrus.Debugf("Not consulting the VEX store: %v", err)
+		return
+	}
+	if store.Exists() {
+		o.store = store
+	}
+}
+
+// storeDocuments returns the documents in the store about the products
+// selected with --product and the images recorded in the report
+func (o *filterOptions) storeDocuments(report *sarif.Report) ([]*vex.VEX, error) {
+	if o.store == nil {
+		return nil, nil
+	}
+	products := append(append([]string{}, o.products...), ctl.ReportImages(report)...)
+	if len(products) == 0 {
+		return nil, nil
+	}
+	docs, err := o.store.Documents(products)
+	if err != nil {
+		return nil, fmt.Errorf("reading VEX store: %w", err)
+	}
+	logrus.WithField("products", strings.Join(products, ", ")).Infof("Read %d documents from the VEX store", len(docs))
+	return docs, nil
+}
+
+// sources returns the path of the report and the VEX sources to apply to
+// it. When the VEX sources are passed with --vex, autodiscovered or read
+// from the store, the report argument is optional and defaults to STDIN
+// if it is piped.
+func (o *filterOptions) sources(args []string) (report string, vexSources []string, err error) {
+	if len(o.vexSources) == 0 && (len(args) >= 2 || !(o.autodiscover || o.store != nil)) {
+		if len(args) < 2 {
+			return "", nil, errors.New("not enough arguments")
+		}
+		return args[0], args[1:], nil
+	}
+
+	switch len(args) {
+	case 0:
+		if term.IsTerminal(int(os.Stdin.Fd())) { //nolint:gosec // file descriptors fit in an int
+			return "", nil, errors.New("no report file specified and nothing piped to STDIN")
+		}
+		return "-", o.vexSources, nil
+	case 1:
+		return args[0], o.vexSources, nil
+	default:
+		return "", nil, errors.New("VEX sources must be passed either as arguments or with --vex, not both")
+	}
 }
 
 func (o *filterOptions) Validate() error {
-	if o.reportFormat != "vex" && o.reportFormat != "csaf" && o.reportFormat != "cyclonedx" {
-		return errors.New("invalid vex document format (must be one of vex, cyclonedx or csaf)")
+	if o.reportFormat != "" && o.reportFormat != ctl.DocumentFormatOpenVEX &&
+		o.reportFormat != ctl.DocumentFormatYAML && o.reportFormat != ctl.DocumentFormatCSAF &&
+		o.reportFormat != ctl.DocumentFormatCycloneDX {
+		return errors.New("invalid vex document format (must be one of vex, yaml, cyclonedx or csaf)")
+	}
+	if o.stream && (o.coverageReport != "" || o.htmlReport != "" || o.patchOut != "" ||
+		o.requireCover || len(o.explain) > 0) {
+		return errors.New("coverage checks, reports, patches and explanations are not available when streaming the report")
+	}
+	if o.stream && o.autodiscover {
+		return errors.New("VEX data cannot be autodiscovered when streaming the report")
+	}
+	for _, j := range o.justifications {
+		if !vex.Justification(j).Valid() {
+			return fmt.Errorf("invalid justification %q, must be one of %s", j, strings.Join(vex.Justifications(), ", "))
+		}
 	}
 	return nil
 }
@@ -50,84 +167,451 @@ vexctl filter myreport.sarif.json data1.vex.json data2.vex.json
 # VEX a SARIF report from an atestation in an image:
 vexctl filter myreport.sarif.json cgr.dev/image@sha256:e4cf37d568d195b4b5af4c3.....
 
-VEX information can be read from CSAF, CycloneDX or our own simpler VEX
-format.
+# Filter a report piped from a scanner, only the report is written to STDOUT:
+grype -o sarif cgr.dev/image | vexctl filter --vex data1.vex.json > filtered.sarif.json
+
+Grype and trivy JSON reports are read too. They are converted to SARIF,
+keeping the location and package URL of each vulnerability, so the
+filtered report is always written as SARIF:
+
+grype -o json cgr.dev/image | vexctl filter --vex data1.vex.json > filtered.sarif.json
+trivy image -f json cgr.dev/image | vexctl filter --vex data1.vex.json > filtered.sarif.json
+
+The same goes for the output of snyk test --json, for one or all projects:
+
+snyk test --json | vexctl filter --vex data1.vex.json > filtered.sarif.json
+
+VEX information can be read from CSAF or our own simpler VEX format, in
+JSON or YAML. The format of each document is detected, use --input-format
+to override it. The filtered report is written to STDOUT or to the file set
+with --output.
+
+It can also be read from an attestation attached to a container image,
+downloaded from an HTTP(S) URL, read from all the files in a directory or
+from a git repository using the
+git+https://github.com/org/repo.git#path/to/doc.vex.json syntax.
+Documents compressed with gzip or zstd are decompressed transparently.
+Glob patterns like 'vex/**/*.openvex.json' are expanded to the files they
+match.
+
+Files and URLs can be pinned to the digest of the expected document by
+appending it to the source, eg https://example.com/app.vex.json@sha256:...
+The command fails if the content read doesn't match the digest, so upstream
+documents can't change without notice. sha256 and sha512 are supported.
+
+If the report records the scanned image, as trivy does, --autodiscover
+fetches the VEX attestations attached to it without having to specify
+the image again:
+
+trivy image -f sarif cgr.dev/image | vexctl filter --autodiscover
+
+Sources of different types can be mixed in the same run by repeating
+--vex. All the documents found are combined and applied in chronological
+order:
+
+vexctl filter --vex=vex/ --vex=https://example.com/app.vex.json \
+    --vex=cgr.dev/image@sha256:e4cf37d568d195b4b5af4c3..... myreport.sarif.json
+
+CSAF 2.0 and 2.1 documents are translated to OpenVEX resolving their product
+tree, so each statement lists the package URL or CPE of its products. By
+default the statements about all the products in the document are applied,
+to only apply those about some of them specify --product with their CSAF
+product ID or identifier.
 
-It can also be read from an attestation attached to a container image.
+Statements are matched to each result by vulnerability and, when known, by
+product: the package URL recorded by the trivy, grype and snyk converters,
+the CPE names recorded by grype and the products selected with --product. A
+statement listing the package of a result only with versions, vers ranges or
+CPE names that exclude it does not suppress the result.
 
-When dealing with CSAF files, you can specify which of the products in the
-document should be VEX'ed by specifying --product=PRODUCT_ID.
+To find out why the results about a vulnerability are kept or suppressed,
+pass its ID to --explain. For each set of products the results were found
+in, %s will print the statement applying to them in each document, in the
+order they are applied, how it matched the products and the resulting
+decision:
 
+vexctl filter --explain=CVE-2023-12345 myreport.sarif.json data1.vex.json
 
-`, appname, appname),
+By default, all not_affected statements suppress the results about their
+vulnerability. To only accept some justifications as grounds for suppression,
+list them with --allowed-justifications:
+
+vexctl filter --allowed-justifications=component_not_present,vulnerable_code_not_present \
+    myreport.sarif.json data1.vex.json
+
+To enforce that every finding has a documented disposition, pass
+--require-coverage. The filtered report is still written, but %s exits
+with code %d if any vulnerability in the report has no VEX statement at
+all, whatever its status.
+
+Documents in the local VEX store (see '%s store') about the products
+selected with --product and the images recorded in the report are applied
+too, so the VEX sources can be left out when the store holds them. Pass
+--no-store to ignore the store:
+
+vexctl filter --product=pkg:oci/app myreport.sarif.json
+
+To share the outcome with people who do not read SARIF, --html-report
+writes a standalone HTML page listing the suppressed and remaining
+vulnerabilities, the statements deciding them and the VEX documents used.
+A vulnerability suppressed only in some of its packages is listed in both:
+
+vexctl filter --html-report=report.html myreport.sarif.json data1.vex.json
+
+For audit trails, --patch-out writes an RFC 6902 JSON Patch that turns the
+original report into the filtered one. Each removed result is preceded by
+a test operation holding it, so the patch records exactly what was removed
+and can be reverted:
+
+vexctl filter --patch-out=changes.patch.json myreport.sarif.json data1.vex.json
+
+`, appname, appname, appname, appname, exitUncovered, appname),
 		Use:               "filter",
 		SilenceUsage:      false,
 		SilenceErrors:     false,
-		PersistentPreRunE: initLogging,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			// The first argument is the report, the rest are VEX documents
+			if len(args) == 0 {
+				return sarifFileExtensions, cobra.ShellCompDirectiveFilterFileExt
+			}
+			return completeVEXFiles(cmd, args, toComplete)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) < 2 {
-				fmt.Println(cmd.Long)
-				return errors.New("not enough arguments")
+			opts.openStore()
+			reportPath, vexSources, err := opts.sources(args)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, cmd.Long)
+				return withExitCode(exitValidation, err)
 			}
 			if err := opts.Validate(); err != nil {
-				return fmt.Errorf("validating options: %w", err)
+				return withExitCode(exitValidation, fmt.Errorf("validating options: %w", err))
 			}
 
-			ctx := context.Background()
-			vexctl := ctl.New()
-			vexctl.Options.Products = opts.products
-			vexctl.Options.Format = opts.reportFormat
+			ctx := cmd.Context()
+			progress := newSpinner()
+			defer progress.Stop()
+			vexctl := newVexCtl(
+				ctl.WithProducts(opts.products),
+				ctl.WithFormat(opts.reportFormat),
+				ctl.WithAllowPartial(opts.allowPartial),
+				ctl.WithMaxConcurrency(opts.maxConcurrency),
+				ctl.WithProgress(progress.ProgressFunc()),
+				ctl.WithAllowedJustifications(opts.justifications),
+			)
+
+			out, err := createOutput(opts.outputPath)
+			if err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			defer out.Close()
 
-			// TODO: Autodetect piped stdin
-			reportFileName := args[0]
-			if args[0] == "-" {
-				tmp, err := os.CreateTemp("", "tmp-*.sarif.json")
+			if opts.stream {
+				remaining, err := streamFilter(cmd, vexctl, reportPath, vexSources, out)
 				if err != nil {
-					return fmt.Errorf("creating temp sarif file")
+					return err
 				}
-				defer os.Remove(tmp.Name())
-				if _, err := io.Copy(tmp, os.Stdin); err != nil {
-					return fmt.Errorf("writing stdin: %w", err)
-				}
-				reportFileName = tmp.Name()
+				return opts.checkResults(remaining)
 			}
 
 			// Open all docs
-			report, err := sarif.Open(reportFileName)
+			progress.Start("Parsing report")
+			report, err := readReport(reportPath)
 			if err != nil {
-				return fmt.Errorf("opening sarif report")
+				return withExitCode(exitValidation, err)
 			}
-			vexes := []*vex.VEX{}
-			for i := 1; i < len(args); i++ {
-				doc, err := vexctl.VexFromURI(ctx, args[i])
-				if err != nil {
-					return fmt.Errorf("opening %s: %w", args[i], err)
+			if opts.autodiscover {
+				images := ctl.ReportImages(report)
+				if len(images) == 0 {
+					return withExitCode(exitValidation, errors.New("the report does not record the scanned image, unable to autodiscover VEX data"))
+				}
+				logrus.Infof("Autodiscovering VEX attestations of %s", strings.Join(images, ", "))
+				vexSources = append(vexSources, images...)
+			}
+			vexes, err := vexctl.VexesFromURIs(ctx, vexSources)
+			if err != nil {
+				return fmt.Errorf("opening VEX sources: %w", err)
+			}
+			stored, err := opts.storeDocuments(report)
+			if err != nil {
+				return err
+			}
+			vexes = append(vexes, stored...)
+
+			for _, vulnID := range opts.explain {
+				if err := vexctl.Explain(report, vexes, vulnID).Write(os.Stderr); err != nil {
+					return fmt.Errorf("writing explanation: %w", err)
+				}
+			}
+
+			coverage := vexctl.Coverage(report, vexes)
+			if opts.coverageReport != "" {
+				if err := writeCoverageReport(opts.coverageReport, coverage); err != nil {
+					return err
+				}
+			}
+
+			if opts.htmlReport != "" {
+				if err := writeHTMLReport(opts.htmlReport, vexctl.FilterReport(report, vexes)); err != nil {
+					return err
 				}
-				vexes = append(vexes, doc)
 			}
 
-			report, err = vexctl.Apply(report, vexes)
+			report, patch, err := vexctl.ApplyWithPatch(ctx, report, vexes)
 			if err != nil {
 				return fmt.Errorf("applying vexes to report: %w", err)
 			}
+			progress.Stop()
+
+			if opts.patchOut != "" {
+				if err := writePatch(opts.patchOut, patch); err != nil {
+					return err
+				}
+			}
 
-			return report.ToJSON(os.Stdout)
+			if err := report.ToJSON(out); err != nil {
+				return fmt.Errorf("writing report: %w", err)
+			}
+
+			remaining := 0
+			for _, run := range report.Runs {
+				remaining += len(run.Results)
+			}
+			if err := opts.checkCoverage(coverage); err != nil {
+				return err
+			}
+			return opts.checkResults(remaining)
 		},
 	}
 
+	filterCmd.PersistentFlags().StringSliceVar(
+		&opts.vexSources,
+		"vex",
+		[]string{},
+		"VEX sources to apply, makes the report argument optional to read it from STDIN",
+	)
+
+	filterCmd.PersistentFlags().BoolVar(
+		&opts.autodiscover,
+		"autodiscover",
+		false,
+		"read the VEX attestations of the image recorded in the report as scanned",
+	)
+
+	filterCmd.PersistentFlags().BoolVar(
+		&opts.noStore,
+		"no-store",
+		false,
+		"do not apply the documents in the local VEX store",
+	)
+
+	filterCmd.PersistentFlags().StringVar(
+		&opts.reportFormat,
+		"input-format",
+		"",
+		"format of the vex documents (vex | yaml | csaf | cyclonedx), detected by default",
+	)
+
+	// --format used to select the format of the VEX documents read
 	filterCmd.PersistentFlags().StringVar(
 		&opts.reportFormat,
 		"format",
-		"vex",
-		"format of the vex document (vex | csaf | cyclonedx)",
+		"",
+		"format of the vex documents (vex | yaml | csaf | cyclonedx), detected by default",
 	)
+	deprecateFlag(filterCmd, "format", "--input-format")
+
+	addOutputFlag(filterCmd, &opts.outputPath, "file to write the filtered report (default is STDOUT)")
 
 	filterCmd.PersistentFlags().StringSliceVar(
 		&opts.products,
 		"product",
 		[]string{},
-		"IDs of products in a CSAF document to VEX (defaults to first one found)",
+		"products to VEX, selects the statements of CSAF documents (defaults to all) and the documents in the store and identifies the scanned results",
+	)
+
+	filterCmd.PersistentFlags().BoolVar(
+		&opts.allowPartial,
+		"allow-partial",
+		false,
+		"skip VEX sources that fail to load instead of aborting",
+	)
+
+	filterCmd.PersistentFlags().IntVar(
+		&opts.maxConcurrency,
+		"max-concurrency",
+		4,
+		"maximum number of VEX sources to fetch in parallel",
+	)
+
+	filterCmd.PersistentFlags().BoolVar(
+		&opts.stream,
+		"stream",
+		false,
+		"process the report as a stream to bound memory use on very large reports",
+	)
+
+	filterCmd.PersistentFlags().BoolVar(
+		&opts.failOnResults,
+		"fail-on-results",
+		false,
+		fmt.Sprintf("exit with code %d if any results remain after applying the VEX data", exitVulnerabilities),
+	)
+
+	filterCmd.PersistentFlags().BoolVar(
+		&opts.requireCover,
+		"require-coverage",
+		false,
+		fmt.Sprintf("exit with code %d if any vulnerability in the report has no VEX statement", exitUncovered),
+	)
+
+	filterCmd.PersistentFlags().StringVar(
+		&opts.coverageReport,
+		"coverage-report",
+		"",
+		"write a JSON report of matched, unused and missing VEX statements to this file",
+	)
+
+	filterCmd.PersistentFlags().StringVar(
+		&opts.htmlReport,
+		"html-report",
+		"",
+		"write an HTML report of the suppressed and remaining vulnerabilities to this file",
+	)
+
+	filterCmd.PersistentFlags().StringVar(
+		&opts.patchOut,
+		"patch-out",
+		"",
+		"write an RFC 6902 JSON Patch of the changes made to the report to this file",
+	)
+
+	filterCmd.PersistentFlags().StringSliceVar(
+		&opts.explain,
+		"explain",
+		[]string{},
+		"print to STDERR why the results about a vulnerability are kept or suppressed",
+	)
+
+	filterCmd.PersistentFlags().StringSliceVar(
+		&opts.justifications,
+		"allowed-justifications",
+		[]string{},
+		"only honor not_affected statements with these justifications (default is all)",
 	)
 
+	registerFlagCompletion(filterCmd, "input-format", completeValues(documentFormats))
+	registerFlagCompletion(filterCmd, "allowed-justifications", completeJustifications)
+	registerFlagCompletion(filterCmd, "vex", completeVEXFiles)
+
 	parentCmd.AddCommand(filterCmd)
 }
+
+// writeCoverageReport writes the statement coverage report to a file
+func writeCoverageReport(path string, coverage *ctl.CoverageReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating coverage report: %w", err)
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(coverage); err != nil {
+		return fmt.Errorf("writing coverage report: %w", err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"matched":   len(coverage.Matched),
+		"unused":    len(coverage.Unused),
+		"uncovered": len(coverage.Uncovered),
+	}).Infof("Wrote statement coverage report to %s", path)
+	return nil
+}
+
+// writeHTMLReport writes the HTML report of the filter results to a file
+func writeHTMLReport(path string, fr *ctl.FilterReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating HTML report: %w", err)
+	}
+	defer f.Close()
+
+	if err := fr.WriteHTML(f); err != nil {
+		return err
+	}
+	logrus.WithFields(logrus.Fields{
+		"suppressed": len(fr.Suppressed),
+		"remaining":  len(fr.Remaining),
+	}).Infof("Wrote HTML report to %s", path)
+	return nil
+}
+
+// writePatch writes the JSON Patch of the changes made to the report
+func writePatch(path string, patch ctl.ReportPatch) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating patch file: %w", err)
+	}
+	defer f.Close()
+
+	if err := patch.WriteJSON(f); err != nil {
+		return err
+	}
+	logrus.Infof("Wrote %d patch operations to %s", len(patch), path)
+	return nil
+}
+
+// readReport reads a scanner report from a file or from STDIN
+// when path is "-", detecting its format
+func readReport(path string) (*sarif.Report, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading report: %w", err)
+	}
+	stop := commandMetrics.Track(ctl.MetricsPhaseParse)
+	var report *sarif.Report
+	if parseWarnings != nil {
+		report, err = ctl.ParseReportLenient(data, parseWarnings)
+	} else {
+		report, err = ctl.ParseReport(data)
+	}
+	stop()
+	if err != nil {
+		return nil, fmt.Errorf("parsing report: %w", err)
+	}
+	return report, nil
+}
+
+// streamFilter applies the VEX documents to the report without loading
+// it in memory, writing the results to out as they are processed. It
+// returns the number of results remaining in the report.
+func streamFilter(
+	cmd *cobra.Command, vexctl *ctl.VexCtl, reportPath string, vexSources []string, out io.Writer,
+) (int, error) {
+	vexes, err := vexctl.VexesFromURIs(cmd.Context(), vexSources)
+	if err != nil {
+		return 0, fmt.Errorf("opening VEX sources: %w", err)
+	}
+
+	in := os.Stdin
+	if reportPath != "-" {
+		f, err := os.Open(reportPath)
+		if err != nil {
+			return 0, withExitCode(exitValidation, fmt.Errorf("opening sarif report: %w", err))
+		}
+		defer f.Close()
+		in = f
+	}
+
+	remaining, err := vexctl.ApplyStream(cmd.Context(), in, out, vexes)
+	if err != nil {
+		return 0, fmt.Errorf("applying vexes to report: %w", err)
+	}
+	return remaining, nil
+}
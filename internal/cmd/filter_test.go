@@ -0,0 +1,110 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+// filteredRules returns the rules of the results in a filtered report
+func filteredRules(t *testing.T, path string) []string {
+	t.Helper()
+	report, err := sarif.Open(path)
+	require.NoError(t, err)
+	rules := []string{}
+	for _, run := range report.Runs {
+		for _, res := range run.Results {
+			rules = append(rules, *res.RuleID)
+		}
+	}
+	return rules
+}
+
+func TestFilterRequireCoverage(t *testing.T) {
+	report := writeTestFile(t, "report.sarif.json", testReport)
+	doc := writeTestFile(t, "doc.vex.json", testDocument)
+	out := filepath.Join(t.TempDir(), "out.sarif.json")
+
+	// The filtered report is written before failing on the uncovered results
+	code, _, errOutput := runCommand(t, "filter", "--require-coverage", "--output="+out, report, doc)
+	require.Equal(t, exitUncovered, code)
+	require.Contains(t, errOutput, "1 vulnerabilities in the report have no VEX statement: CVE-2023-0002")
+	require.Equal(t, []string{"CVE-2023-0002"}, filteredRules(t, out))
+
+	// A statement about every vulnerability covers the report, even
+	// when it does not suppress the results
+	covering := writeTestFile(t, "covering.vex.json", strings.Replace(
+		testDocument, `"statements": [{`,
+		`"statements": [{"vulnerability": "CVE-2023-0002", "products": ["pkg:oci/app"], "status": "affected",
+		"action_statement": "update lodash"}, {`, 1,
+	))
+	code, _, errOutput = runCommand(t, "filter", "--require-coverage", "--output="+out, report, covering)
+	require.Equal(t, exitOK, code, errOutput)
+	require.Equal(t, []string{"CVE-2023-0002"}, filteredRules(t, out))
+}
+
+func TestFilterPatchOut(t *testing.T) {
+	report := writeTestFile(t, "report.sarif.json", testReport)
+	doc := writeTestFile(t, "doc.vex.json", testDocument)
+	dir := t.TempDir()
+	patchPath := filepath.Join(dir, "report.patch.json")
+
+	code, _, errOutput := runCommand(
+		t, "filter", "--patch-out="+patchPath, "--output="+filepath.Join(dir, "out.sarif.json"), report, doc,
+	)
+	require.Equal(t, exitOK, code, errOutput)
+
+	data, err := os.ReadFile(patchPath)
+	require.NoError(t, err)
+	patch := ctl.ReportPatch{}
+	require.NoError(t, json.Unmarshal(data, &patch))
+	require.Len(t, patch, 2)
+	require.Equal(t, "test", patch[0].Op)
+	require.Equal(t, ctl.PatchOperation{Op: "remove", Path: "/runs/0/results/0"}, patch[1])
+	require.Contains(t, string(data), "CVE-2023-0001")
+
+	// Patches are not available when streaming
+	code, _, _ = runCommand(t, "filter", "--stream", "--patch-out="+patchPath, report, doc)
+	require.Equal(t, exitValidation, code)
+}
+
+func TestFilterStore(t *testing.T) {
+	report := writeTestFile(t, "report.sarif.json", testReport)
+	doc := writeTestFile(t, "doc.vex.json", testDocument)
+	store := "--store-dir=" + t.TempDir()
+	out := filepath.Join(t.TempDir(), "out.sarif.json")
+
+	// Without a store, the VEX sources are required
+	code, _, _ := runCommand(t, "filter", store, "--product=pkg:oci/app", "--output="+out, report)
+	require.Equal(t, exitValidation, code)
+
+	code, _, errOutput := runCommand(t, "store", store, "add", doc)
+	require.Equal(t, exitOK, code, errOutput)
+
+	// The documents stored about the product are applied
+	code, _, errOutput = runCommand(t, "filter", store, "--product=pkg:oci/app", "--output="+out, report)
+	require.Equal(t, exitOK, code, errOutput)
+	require.Equal(t, []string{"CVE-2023-0002"}, filteredRules(t, out))
+
+	// Documents about other products are not
+	code, _, errOutput = runCommand(t, "filter", store, "--product=pkg:oci/other", "--output="+out, report)
+	require.Equal(t, exitOK, code, errOutput)
+	require.Equal(t, []string{"CVE-2023-0001", "CVE-2023-0002"}, filteredRules(t, out))
+
+	// --no-store ignores the store
+	code, _, _ = runCommand(t, "filter", store, "--no-store", "--product=pkg:oci/app", "--output="+out, report)
+	require.Equal(t, exitValidation, code)
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/go-vex/pkg/vex"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type generateOptions struct {
+	vexDocOptions
+	vexStatementOptions
+	fromScan    string
+	outFilePath string
+}
+
+// Validate checks the options of the generate subcommand
+func (o *generateOptions) Validate() error {
+	if o.fromScan == "" {
+		return errors.New("a scanner report is required, specify it with --from-scan")
+	}
+	return nil
+}
+
+func addGenerate(parentCmd *cobra.Command) {
+	opts := generateOptions{}
+	generateCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s generate: create a VEX document from a scanner report", appname),
+		Long: fmt.Sprintf(`%s generate: create a VEX document from a scanner report
+
+The generate subcommand reads a SARIF report and writes a VEX document
+with a statement for every vulnerability found in it. All statements
+get the same status, under_investigation by default, producing an
+initial document to be refined as the vulnerabilities are triaged.
+
+The statements can be given a different status with --status. Note that
+not_affected statements require a justification or impact statement and
+affected ones an action statement.
+
+When the report records the scanned image, as trivy does, the statements
+list the OCI package URL of the image, eg
+pkg:oci/nginx@sha256%%3Ae4cf...?repository_url=cgr.dev/chainguard/nginx
+Use --product to list other product identifiers instead.
+
+Examples:
+
+# Generate an initial document for all the vulnerabilities in a scan:
+%s generate --from-scan=scan.sarif.json --product="pkg:oci/nginx"
+
+# List the scanned image recorded in the report as product:
+trivy image -f sarif -o scan.sarif.json cgr.dev/chainguard/nginx
+%s generate --from-scan=scan.sarif.json
+
+# Mark every vulnerability as not affecting the product:
+%s generate --from-scan=scan.sarif.json --product="pkg:oci/nginx" \
+    --status=not_affected --justification=component_not_present
+
+`, appname, appname, appname, appname),
+		Use:               "generate --from-scan report.sarif.json [--product product_id]",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			report, err := readReport(opts.fromScan)
+			if err != nil {
+				return withExitCode(exitValidation, fmt.Errorf("opening sarif report: %w", err))
+			}
+
+			if vex.Status(opts.Status) != vex.StatusAffected && opts.ActionStatement == vex.NoActionStatementMsg {
+				opts.ActionStatement = ""
+			}
+
+			newDoc, err := newVexCtl().GenerateFromReport(report, &ctl.GenerateOptions{
+				DocumentID:      opts.DocumentID,
+				Author:          opts.Author,
+				AuthorRole:      opts.AuthorRole,
+				Products:        opts.Products,
+				Status:          vex.Status(opts.Status),
+				Justification:   vex.Justification(opts.Justification),
+				ImpactStatement: opts.ImpactStatement,
+				ActionStatement: opts.ActionStatement,
+			})
+			if err != nil {
+				return withExitCode(exitValidation, fmt.Errorf("generating document: %w", err))
+			}
+
+			out := os.Stdout
+			if opts.outFilePath != "" {
+				f, err := os.Create(opts.outFilePath)
+				if err != nil {
+					return fmt.Errorf("opening VEX file to write document: %w", err)
+				}
+				out = f
+				defer f.Close()
+			}
+
+			if err := newDoc.ToJSON(out); err != nil {
+				return fmt.Errorf("writing new VEX document: %w", err)
+			}
+
+			if opts.outFilePath != "" {
+				fmt.Fprintf(os.Stderr, " > VEX document with %d statements written to %s\n", len(newDoc.Statements), opts.outFilePath)
+			}
+			return nil
+		},
+	}
+
+	generateCmd.PersistentFlags().StringVar(
+		&opts.fromScan,
+		"from-scan",
+		"",
+		"SARIF report to read the vulnerabilities from",
+	)
+
+	generateCmd.PersistentFlags().StringVar(
+		&opts.DocumentID,
+		"id",
+		"",
+		"ID for the new VEX document (default will be computed)",
+	)
+
+	generateCmd.PersistentFlags().StringVar(
+		&opts.Author,
+		"author",
+		vex.DefaultAuthor,
+		"author to record in the new document",
+	)
+
+	generateCmd.PersistentFlags().StringVar(
+		&opts.AuthorRole,
+		"author-role",
+		vex.DefaultRole,
+		"author role to record in the new document",
+	)
+
+	generateCmd.PersistentFlags().StringSliceVarP(
+		&opts.Products,
+		"product",
+		"p",
+		[]string{},
+		"list of products to list in the statements (default is the scanned image recorded in the report)",
+	)
+
+	generateCmd.PersistentFlags().StringVarP(
+		&opts.Status,
+		"status",
+		"s",
+		string(vex.StatusUnderInvestigation),
+		"status to assign to all the statements",
+	)
+
+	generateCmd.PersistentFlags().StringVarP(
+		&opts.Justification,
+		"justification",
+		"j",
+		"",
+		"justification for not_affected status",
+	)
+
+	generateCmd.PersistentFlags().StringVar(
+		&opts.ImpactStatement,
+		"impact-statement",
+		"",
+		"impact statement for not_affected status",
+	)
+
+	generateCmd.PersistentFlags().StringVarP(
+		&opts.ActionStatement,
+		"action-statement",
+		"a",
+		vex.NoActionStatementMsg,
+		"action statement for affected status",
+	)
+
+	addOutputFlag(generateCmd, &opts.outFilePath, "file to write the document (default is STDOUT)", "file")
+
+	registerFlagCompletion(generateCmd, "from-scan", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return sarifFileExtensions, cobra.ShellCompDirectiveFilterFileExt
+	})
+	registerFlagCompletion(generateCmd, "status", completeStatuses)
+	registerFlagCompletion(generateCmd, "justification", completeJustifications)
+	registerFlagCompletion(generateCmd, "output", completeVEXFiles)
+
+	parentCmd.AddCommand(generateCmd)
+}
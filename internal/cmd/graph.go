@@ -0,0 +1,118 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type graphOptions struct {
+	ctl.MergeOptions
+	format string
+	output string
+}
+
+// Validate checks the options in context with the arguments
+func (o *graphOptions) Validate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("at least one VEX document is required")
+	}
+	if o.format != "dot" && o.format != "mermaid" {
+		return fmt.Errorf("invalid graph format %q, must be dot or mermaid", o.format)
+	}
+	return nil
+}
+
+func addGraph(parentCmd *cobra.Command) {
+	opts := graphOptions{}
+	graphCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s graph: visualize the lineage of a merged VEX document", appname),
+		Long: fmt.Sprintf(`%s graph: visualize the lineage of a merged VEX document
+
+The graph subcommand merges one or more VEX documents, the same way the merge
+subcommand does, and draws a graph showing which statements of the source
+documents made it into the merged document. Statements about the same
+vulnerability and product are linked in chronological order, showing which
+statement supersedes which.
+
+The graph is written to STDOUT in graphviz DOT format or, with
+--output-format=mermaid, as a mermaid flowchart.
+
+Examples:
+
+%s graph document1.vex.json document2.vex.json | dot -Tsvg > lineage.svg
+
+%s graph --output-format=mermaid --product="pkg:apk/wolfi/bash@1.0" vex/
+
+`, appname, appname, appname),
+		Use:               "graph vex_document...",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: completeVEXFiles,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			out, err := createOutput(opts.output)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+
+			vexctl := newVexCtl()
+			vexes, err := vexctl.VexesFromURIs(cmd.Context(), args)
+			if err != nil {
+				return fmt.Errorf("reading VEX data: %w", err)
+			}
+			merged, err := vexctl.Merge(cmd.Context(), &opts.MergeOptions, vexes)
+			if err != nil {
+				return fmt.Errorf("merging documents: %w", err)
+			}
+
+			lineage := vexctl.Lineage(vexes, merged)
+			if opts.format == "mermaid" {
+				err = lineage.WriteMermaid(out)
+			} else {
+				err = lineage.WriteDOT(out)
+			}
+			if err != nil {
+				return fmt.Errorf("writing graph: %w", err)
+			}
+			return nil
+		},
+	}
+
+	addOutputFormatFlag(
+		graphCmd, &opts.format, "dot", []string{"dot", "mermaid"},
+		"graph format, either dot or mermaid", "format",
+	)
+
+	addOutputFlag(graphCmd, &opts.output, "file to write the graph (default is STDOUT)")
+
+	graphCmd.PersistentFlags().StringSliceVar(
+		&opts.Vulnerabilities,
+		"vuln",
+		[]string{},
+		"list of vulnerabilities to include in the merged document",
+	)
+
+	graphCmd.PersistentFlags().StringSliceVar(
+		&opts.Products,
+		"product",
+		[]string{},
+		"list of products to include in the merged document",
+	)
+
+	parentCmd.AddCommand(graphCmd)
+}
@@ -0,0 +1,394 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/openvex/go-vex/pkg/vex"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type grypeImportOptions struct {
+	vexDocOptions
+	products      []string
+	status        string
+	justification string
+	outFilePath   string
+}
+
+// Validate checks the options in context with the arguments
+func (o *grypeImportOptions) Validate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("a grype configuration file is required")
+	}
+	if o.status != "" && !vex.Status(o.status).Valid() {
+		return fmt.Errorf("invalid status %q, must be one of %s", o.status, strings.Join(vex.Statuses(), ", "))
+	}
+	if o.justification != "" && !vex.Justification(o.justification).Valid() {
+		return fmt.Errorf("invalid justification %q, must be one of %s", o.justification, strings.Join(vex.Justifications(), ", "))
+	}
+	return nil
+}
+
+// decide returns the function asking for the status of rules without
+// one. The status and justification in the flags are used if set,
+// otherwise the user is prompted when running in a terminal.
+func (o *grypeImportOptions) decide() func(*ctl.GrypeIgnoreRule) (vex.Status, vex.Justification, error) {
+	if o.status != "" {
+		return func(*ctl.GrypeIgnoreRule) (vex.Status, vex.Justification, error) {
+			return vex.Status(o.status), vex.Justification(o.justification), nil
+		}
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) { //nolint:gosec // file descriptors fit in an int
+		return nil
+	}
+	stdin := bufio.NewReader(os.Stdin)
+	ask := func(question string, valid func(string) bool) (string, error) {
+		for {
+			fmt.Fprint(os.Stderr, question)
+			answer, err := stdin.ReadString('\n')
+			if err != nil {
+				return "", fmt.Errorf("reading answer: %w", err)
+			}
+			if answer = strings.TrimSpace(answer); valid(answer) {
+				return answer, nil
+			}
+		}
+	}
+	return func(r *ctl.GrypeIgnoreRule) (vex.Status, vex.Justification, error) {
+		fmt.Fprintf(os.Stderr, "\nIgnore rule for %s", r.Vulnerability)
+		if r.Package.Name != "" {
+			fmt.Fprintf(os.Stderr, " in %s %s", r.Package.Name, r.Package.Version)
+		}
+		if r.Reason != "" {
+			fmt.Fprintf(os.Stderr, " (%s)", r.Reason)
+		}
+		fmt.Fprintln(os.Stderr)
+		status, err := ask(
+			fmt.Sprintf("Status (%s): ", strings.Join(vex.Statuses(), ", ")),
+			func(s string) bool { return vex.Status(s).Valid() },
+		)
+		if err != nil || vex.Status(status) != vex.StatusNotAffected {
+			return vex.Status(status), "", err
+		}
+		justification, err := ask(
+			fmt.Sprintf("Justification (%s): ", strings.Join(vex.Justifications(), ", ")),
+			func(s string) bool { return (s == "" && r.Reason != "") || vex.Justification(s).Valid() },
+		)
+		return vex.Status(status), vex.Justification(justification), err
+	}
+}
+
+type githubImportOptions struct {
+	vexDocOptions
+	products     []string
+	apiURL       string
+	dependabot   bool
+	codeScanning bool
+	outFilePath  string
+}
+
+// Validate checks the options in context with the arguments
+func (o *githubImportOptions) Validate(args []string) error {
+	if len(args) != 1 || strings.Count(args[0], "/") != 1 {
+		return errors.New("a repository is required, as owner/name")
+	}
+	if !o.dependabot && !o.codeScanning {
+		return errors.New("at least one of --dependabot or --code-scanning has to be enabled")
+	}
+	return nil
+}
+
+func addImport(parentCmd *cobra.Command) {
+	importCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s import: convert other suppression formats into VEX", appname),
+		Long: fmt.Sprintf(`%s import: convert other suppression formats into VEX
+
+The import subcommands turn the suppressions recorded for other tools into
+VEX documents, to migrate from ad-hoc suppression to VEX.
+`, appname),
+		Use:               "import",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+	}
+
+	addImportGrypeIgnore(importCmd)
+	addImportGitHubDismissals(importCmd)
+	parentCmd.AddCommand(importCmd)
+}
+
+func addImportGrypeIgnore(parentCmd *cobra.Command) {
+	opts := grypeImportOptions{}
+	grypeCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s import grype-ignore: convert grype ignore rules into VEX", appname),
+		Long: fmt.Sprintf(`%s import grype-ignore: convert grype ignore rules into VEX
+
+Reads the ignore rules of a grype configuration file and writes a VEX
+document with a statement for each of them. Rules that identify a package
+by type and name apply to its package URL, the rest apply to the products
+passed with --product.
+
+Rules recording a vex-status and vex-justification are converted as they
+are. For the rest, %s asks for their status and justification when run in
+a terminal, or uses the ones passed with --status and --justification.
+The reason of each rule is kept in the statement.
+
+Examples:
+
+%s import grype-ignore .grype.yaml > grype.vex.json
+
+%s import grype-ignore --product=pkg:oci/app --status=not_affected \
+    --justification=vulnerable_code_not_in_execute_path .grype.yaml
+
+`, appname, appname, appname, appname),
+		Use:               "grype-ignore grype_config.yaml",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: completeVEXFiles,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("reading grype configuration: %w", err)
+			}
+			rules, err := ctl.ParseGrypeIgnore(data)
+			if err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			if len(rules) == 0 {
+				return withExitCode(exitValidation, fmt.Errorf("no ignore rules found in %s", args[0]))
+			}
+
+			statements, err := newVexCtl().ImportGrypeIgnore(rules, ctl.GrypeImportOptions{
+				Products: opts.products,
+				Decide:   opts.decide(),
+			})
+			if err != nil {
+				return withExitCode(exitValidation, err)
+			}
+
+			doc := vex.New()
+			doc.Author = opts.Author
+			doc.AuthorRole = opts.AuthorRole
+			doc.Statements = statements
+			if opts.DocumentID != "" {
+				doc.ID = opts.DocumentID
+			} else if _, err := doc.GenerateCanonicalID(); err != nil {
+				return fmt.Errorf("generating document id: %w", err)
+			}
+
+			if opts.outFilePath != "" {
+				return writeDocument(opts.outFilePath, &doc)
+			}
+			if err := doc.ToJSON(os.Stdout); err != nil {
+				return fmt.Errorf("writing VEX document: %w", err)
+			}
+			return nil
+		},
+	}
+
+	grypeCmd.PersistentFlags().StringVar(
+		&opts.DocumentID,
+		"id",
+		"",
+		"ID for the new VEX document (default will be computed)",
+	)
+
+	grypeCmd.PersistentFlags().StringVar(
+		&opts.Author,
+		"author",
+		vex.DefaultAuthor,
+		"author to record in the new document",
+	)
+
+	grypeCmd.PersistentFlags().StringVar(
+		&opts.AuthorRole,
+		"author-role",
+		vex.DefaultRole,
+		"author role to record in the new document",
+	)
+
+	grypeCmd.PersistentFlags().StringSliceVarP(
+		&opts.products,
+		"product",
+		"p",
+		[]string{},
+		"products of the statements for rules that do not identify a package",
+	)
+
+	grypeCmd.PersistentFlags().StringVarP(
+		&opts.status,
+		"status",
+		"s",
+		"",
+		"status of the statements for rules without a vex-status (prompted by default)",
+	)
+
+	grypeCmd.PersistentFlags().StringVarP(
+		&opts.justification,
+		"justification",
+		"j",
+		"",
+		"justification of the statements for rules without a vex-status",
+	)
+
+	addOutputFlag(grypeCmd, &opts.outFilePath, "file to write the document (default is STDOUT)", "file")
+
+	registerFlagCompletion(grypeCmd, "status", completeStatuses)
+	registerFlagCompletion(grypeCmd, "justification", completeJustifications)
+	registerFlagCompletion(grypeCmd, "output", completeVEXFiles)
+
+	parentCmd.AddCommand(grypeCmd)
+}
+
+func addImportGitHubDismissals(parentCmd *cobra.Command) {
+	opts := githubImportOptions{}
+	githubCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s import github-dismissals: convert dismissed GitHub alerts into VEX", appname),
+		Long: fmt.Sprintf(`%s import github-dismissals: convert dismissed GitHub alerts into VEX
+
+Fetches the dismissed Dependabot and code scanning alerts of a repository
+through the GitHub API and writes a VEX document with a statement for each
+of them. The dismissal reason sets the status of the statement:
+
+  not_used, used in tests        not_affected (vulnerable_code_not_in_execute_path)
+  inaccurate, false positive     not_affected
+  tolerable_risk, no_bandwidth,
+  fix_started, won't fix         affected
+
+The statements are timestamped with the time of the dismissal and record
+who dismissed the alert, and their comment, in the status notes. They apply
+to the repository (pkg:github/owner/name) unless products are passed with
+--product. Statements of Dependabot alerts list the vulnerable dependency
+as a subcomponent.
+
+The API token is read from the GITHUB_TOKEN environment variable or, when
+it is not set, from the secret stored for the API URL in the OS keychain
+(see --credential-helper).
+
+Examples:
+
+GITHUB_TOKEN=... %s import github-dismissals openvex/vexctl > github.vex.json
+
+%s import github-dismissals --code-scanning=false --product=pkg:oci/app example/app
+
+`, appname, appname, appname),
+		Use:               "github-dismissals owner/repository",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			statements, err := newVexCtl().ImportGitHubDismissals(cmd.Context(), ctl.GitHubImportOptions{
+				Repository:   args[0],
+				Token:        os.Getenv("GITHUB_TOKEN"),
+				APIURL:       opts.apiURL,
+				Products:     opts.products,
+				Dependabot:   opts.dependabot,
+				CodeScanning: opts.codeScanning,
+			})
+			if err != nil {
+				return fmt.Errorf("importing dismissed alerts: %w", err)
+			}
+
+			doc := vex.New()
+			doc.Author = opts.Author
+			doc.AuthorRole = opts.AuthorRole
+			doc.Statements = statements
+			if opts.DocumentID != "" {
+				doc.ID = opts.DocumentID
+			} else if _, err := doc.GenerateCanonicalID(); err != nil {
+				return fmt.Errorf("generating document id: %w", err)
+			}
+
+			if opts.outFilePath != "" {
+				return writeDocument(opts.outFilePath, &doc)
+			}
+			if err := doc.ToJSON(os.Stdout); err != nil {
+				return fmt.Errorf("writing VEX document: %w", err)
+			}
+			return nil
+		},
+	}
+
+	githubCmd.PersistentFlags().StringVar(
+		&opts.DocumentID,
+		"id",
+		"",
+		"ID for the new VEX document (default will be computed)",
+	)
+
+	githubCmd.PersistentFlags().StringVar(
+		&opts.Author,
+		"author",
+		vex.DefaultAuthor,
+		"author to record in the new document",
+	)
+
+	githubCmd.PersistentFlags().StringVar(
+		&opts.AuthorRole,
+		"author-role",
+		vex.DefaultRole,
+		"author role to record in the new document",
+	)
+
+	githubCmd.PersistentFlags().StringSliceVarP(
+		&opts.products,
+		"product",
+		"p",
+		[]string{},
+		"products of the statements (default is the repository purl)",
+	)
+
+	githubCmd.PersistentFlags().BoolVar(
+		&opts.dependabot,
+		"dependabot",
+		true,
+		"import the dismissed Dependabot alerts",
+	)
+
+	githubCmd.PersistentFlags().BoolVar(
+		&opts.codeScanning,
+		"code-scanning",
+		true,
+		"import the dismissed code scanning alerts",
+	)
+
+	githubCmd.PersistentFlags().StringVar(
+		&opts.apiURL,
+		"api-url",
+		ctl.DefaultGitHubAPIURL,
+		"URL of the GitHub API, for GitHub Enterprise Server",
+	)
+
+	addOutputFlag(githubCmd, &opts.outFilePath, "file to write the document (default is STDOUT)", "file")
+
+	registerFlagCompletion(githubCmd, "output", completeVEXFiles)
+
+	parentCmd.AddCommand(githubCmd)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/go-vex/pkg/vex"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type initOptions struct {
+	ctl.ProjectConfig
+}
+
+// Validate checks the options in context with the arguments
+func (o *initOptions) Validate(args []string) error {
+	if len(args) > 1 {
+		return errors.New("only one repository directory can be initialized")
+	}
+	if o.Author == "" {
+		return errors.New("the author of the VEX documents is required")
+	}
+	return nil
+}
+
+func addInit(parentCmd *cobra.Command) {
+	opts := initOptions{}
+	initCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s init: set up VEX authoring in a repository", appname),
+		Long: fmt.Sprintf(`%s init: set up VEX authoring in a repository
+
+The init subcommand prepares a repository to publish VEX data. It creates a
+%s directory with a starter OpenVEX document and a %s file
+recording the author and the products of the project.
+
+The author, role and products in the configuration are used as defaults by
+the create subcommand when run from the repository root.
+
+Examples:
+
+%s init --author="Chainguard" --product="pkg:oci/app"
+
+%s init --author="Chainguard" path/to/repo
+
+`, appname, ctl.ProjectDir, ctl.ProjectConfigFile, appname, appname),
+		Use:               "init [directory]",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+			return nil, cobra.ShellCompDirectiveFilterDirs
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			docPath, err := newVexCtl().InitProject(dir, &opts.ProjectConfig)
+			if err != nil {
+				return fmt.Errorf("initializing repository: %w", err)
+			}
+			if !commandLineOpts.quiet {
+				fmt.Fprintf(os.Stderr, "Initialized VEX authoring, the starter document is %s\n", docPath)
+			}
+			return nil
+		},
+	}
+
+	initCmd.PersistentFlags().StringVar(
+		&opts.Author,
+		"author",
+		"",
+		"author of the VEX documents of the project",
+	)
+
+	initCmd.PersistentFlags().StringVar(
+		&opts.AuthorRole,
+		"author-role",
+		vex.DefaultRole,
+		"role of the author of the VEX documents",
+	)
+
+	initCmd.PersistentFlags().StringSliceVarP(
+		&opts.Products,
+		"product",
+		"p",
+		[]string{},
+		"products of the project, used by default in new statements",
+	)
+
+	parentCmd.AddCommand(initCmd)
+}
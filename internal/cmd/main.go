@@ -6,19 +6,36 @@ SPDX-License-Identifier: Apache-2.0
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"sigs.k8s.io/release-utils/log"
 	"sigs.k8s.io/release-utils/version"
+
+	"github.com/openvex/go-vex/pkg/vex"
+
+	"github.com/openvex/vexctl/pkg/ctl"
 )
 
 const appname = "vexctl"
 
-var rootCmd = &cobra.Command{
-	Short: "A tool for working with VEX data",
-	Long: `A tool for working with VEX data
+// newRootCmd builds the vexctl command tree. The options of the commands
+// are bound to their flags, so each tree starts from the default values.
+func newRootCmd() *cobra.Command {
+	rootCmd := &cobra.Command{
+		Short: "A tool for working with VEX data",
+		Long: `A tool for working with VEX data
 
 vexctl is a tool to work with VEX (Vulnerability Exploitability eXchange)
 data and to use it to interpret security scanner results.
@@ -29,19 +46,27 @@ vulnerabilities apply to their project.
 
 For more information see the --attest and --filter subcomands
 
-`,
-	Use:               appname,
-	SilenceUsage:      false,
-	PersistentPreRunE: initLogging,
-}
+Exit codes:
 
-type commandLineOptions struct {
-	logLevel string
-}
+  0  the command completed successfully
+  1  the command failed with an unclassified error
+  2  invalid input data or options, or an image failed verification
+  3  results remain in the report after filtering (filter --fail-on-results)
+  4  a network or registry operation failed
+  5  results have no VEX statement (filter --require-coverage)
 
-var commandLineOpts = commandLineOptions{}
+Attestations read from container images are only trusted after verifying
+their signatures. Pass the identity that signed them with
+--certificate-identity and --certificate-oidc-issuer, or a public key with
+--key. Use --insecure-skip-verify to read them without verification.
+
+`,
+		Use:               appname,
+		SilenceUsage:      false,
+		SilenceErrors:     true, // Execute prints errors in the format set by --error-format
+		PersistentPreRunE: initCommand,
+	}
 
-func init() {
 	rootCmd.PersistentFlags().StringVar(
 		&commandLineOpts.logLevel,
 		"log-level",
@@ -49,13 +74,219 @@ func init() {
 		fmt.Sprintf("the logging verbosity, either %s", log.LevelNames()),
 	)
 
+	rootCmd.PersistentFlags().StringVar(
+		&commandLineOpts.logFormat,
+		"log-format",
+		"text",
+		"format of the log output written to stderr, either text or json",
+	)
+
+	rootCmd.PersistentFlags().BoolVarP(
+		&commandLineOpts.quiet,
+		"quiet",
+		"q",
+		false,
+		"suppress informational output, only errors are written to stderr",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&commandLineOpts.errorFormat,
+		"error-format",
+		"text",
+		"format of the error written to stderr when a command fails, either text or json",
+	)
+
+	rootCmd.PersistentFlags().DurationVar(
+		&commandLineOpts.timeout,
+		"timeout",
+		0,
+		"maximum time to wait for the command to complete (eg 5m), 0 means no limit",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&commandLineOpts.cacheDir,
+		"cache-dir",
+		"",
+		"directory to cache registry lookups (defaults to the user cache directory)",
+	)
+
+	rootCmd.PersistentFlags().DurationVar(
+		&commandLineOpts.cacheTTL,
+		"cache-ttl",
+		0,
+		"time to cache image digests and attestations (eg 1h), 0 disables the cache",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&commandLineOpts.storeDir,
+		"store-dir",
+		"",
+		"directory of the local VEX store (defaults to vexctl/store in the user data directory)",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&commandLineOpts.metricsOut,
+		"metrics-out",
+		"",
+		"file to write the phase timings, document counts and cache hit rate of the command as JSON",
+	)
+
+	rootCmd.PersistentFlags().BoolVar(
+		&commandLineOpts.lenient,
+		"lenient",
+		false,
+		"skip malformed statements and results in the documents and reports read, with warnings, instead of failing",
+	)
+
+	rootCmd.PersistentFlags().BoolVar(
+		&commandLineOpts.rejectExpired,
+		"reject-expired",
+		false,
+		"skip the image attestations outside of their validity window instead of warning about them",
+	)
+
+	rootCmd.PersistentFlags().IntVar(
+		&commandLineOpts.retries,
+		"retries",
+		3,
+		"number of times to attempt registry operations failing with transient errors",
+	)
+
+	rootCmd.PersistentFlags().DurationVar(
+		&commandLineOpts.retryBackoff,
+		"retry-backoff",
+		time.Second,
+		"time to wait before retrying a registry operation, doubled after each failure",
+	)
+
+	rootCmd.PersistentFlags().IntSliceVar(
+		&commandLineOpts.retryStatusCodes,
+		"retry-status-codes",
+		ctl.DefaultRetryStatusCodes,
+		"HTTP status codes from the registry considered transient",
+	)
+
+	rootCmd.PersistentFlags().StringToStringVar(
+		&commandLineOpts.registryMirrors,
+		"registry-mirror",
+		map[string]string{},
+		"mirror to use instead of a registry, as registry=mirror (eg gcr.io=registry.internal/gcr)",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&commandLineOpts.credentialHelper,
+		"credential-helper",
+		ctl.DefaultCredentialHelper(),
+		"docker credential helper reading the credentials missing from the environment and docker config from the OS keychain, empty to disable",
+	)
+
+	rootCmd.PersistentFlags().StringSliceVar(
+		&commandLineOpts.caCertificates,
+		"cacert",
+		[]string{},
+		"PEM file with CA certificates trusted in addition to the system roots for all connections (repeatable)",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&commandLineOpts.verification.CertificateIdentity,
+		"certificate-identity",
+		"",
+		"identity expected in the certificate signing the attestations read from images",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&commandLineOpts.verification.CertificateOIDCIssuer,
+		"certificate-oidc-issuer",
+		"",
+		"OIDC issuer expected in the certificate signing the attestations read from images",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&commandLineOpts.verification.Key,
+		"key",
+		"",
+		"public key to verify the attestations read from images (file, URL or KMS reference)",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&commandLineOpts.verification.RekorURL,
+		"rekor-url",
+		"",
+		"transparency log used to verify the attestations read from images",
+	)
+
+	rootCmd.PersistentFlags().BoolVar(
+		&commandLineOpts.verification.Insecure,
+		"insecure-skip-verify",
+		false,
+		"trust the attestations read from images without verifying their signatures (insecure)",
+	)
+
 	addFilter(rootCmd)
 	addAttest(rootCmd)
 	addMerge(rootCmd)
+	addPrune(rootCmd)
 	addCreate(rootCmd)
+	addGenerate(rootCmd)
+	addRecommend(rootCmd)
+	addVerify(rootCmd)
+	addEmbed(rootCmd)
+	addDetach(rootCmd)
+	addShow(rootCmd)
+	addStats(rootCmd)
+	addGraph(rootCmd)
+	addTouch(rootCmd)
+	addInit(rootCmd)
+	addEdit(rootCmd)
+	addImport(rootCmd)
+	addExport(rootCmd)
+	addWatch(rootCmd)
+	addRender(rootCmd)
+	addStore(rootCmd)
+	addDiscover(rootCmd)
 	rootCmd.AddCommand(version.WithFont("doom"))
+
+	// Unknown or malformed flags are invalid options
+	rootCmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return withExitCode(exitValidation, err)
+	})
+	return rootCmd
+}
+
+type commandLineOptions struct {
+	logLevel    string
+	logFormat   string
+	quiet       bool
+	errorFormat string
+	timeout     time.Duration
+	cacheDir    string
+	cacheTTL    time.Duration
+	storeDir    string
+	metricsOut  string
+
+	retries          int
+	retryBackoff     time.Duration
+	retryStatusCodes []int
+
+	verification     ctl.AttestationVerification
+	registryMirrors  map[string]string
+	credentialHelper string
+	caCertificates   []string
+	lenient          bool
+	rejectExpired    bool
 }
 
+var commandLineOpts = commandLineOptions{}
+
+// commandMetrics records the metrics of the command when --metrics-out is set
+var commandMetrics *ctl.Metrics
+
+// parseWarnings collects the malformed records skipped with --lenient
+var parseWarnings *ctl.ParseWarnings
+
+// cancelTimeout releases the resources of the --timeout context
+var cancelTimeout context.CancelFunc = func() {}
+
 type vexDocOptions struct {
 	DocumentID string
 	Author     string
@@ -73,13 +304,306 @@ type vexStatementOptions struct {
 	Subcomponents   []string
 }
 
+// outputOptions control the serialization of the documents written
+type outputOptions struct {
+	ctl.SerializeOptions
+	template string
+}
+
+// Validate checks the output format and style
+func (o *outputOptions) Validate() error {
+	if o.Format != ctl.OutputFormatJSON && o.Format != ctl.OutputFormatYAML && o.Format != outputFormatTemplate {
+		return fmt.Errorf(
+			"invalid output format %q, must be one of %s",
+			o.Format, strings.Join(append(ctl.OutputFormats, outputFormatTemplate), ", "),
+		)
+	}
+	if o.Compact && o.Format != ctl.OutputFormatJSON {
+		return errors.New("--compact only applies to JSON output")
+	}
+	return validateTemplate(o.Format, o.template)
+}
+
+// addFlags registers the output flags in a command writing documents
+func (o *outputOptions) addFlags(cmd *cobra.Command) {
+	formats := append(append([]string{}, ctl.OutputFormats...), outputFormatTemplate)
+	addOutputFormatFlag(
+		cmd, &o.Format, ctl.OutputFormatJSON, formats,
+		fmt.Sprintf("serialization of the document written (%s)", strings.Join(formats, ", ")),
+	)
+	addTemplateFlag(cmd, &o.template)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.Compact,
+		"compact",
+		false,
+		"write JSON in a single line instead of indented",
+	)
+}
+
+// writeDocument writes a VEX document in the output format
+func (o *outputOptions) writeDocument(w io.Writer, doc *vex.VEX) error {
+	if o.Format == outputFormatTemplate {
+		return writeTemplate(w, o.template, doc)
+	}
+	return ctl.SerializeDocument(w, doc, o.SerializeOptions)
+}
+
+// Every command names its output flags the same way: --output (-o) is the
+// file the output is written to and --output-format how it is rendered.
+// The names used before are kept as deprecated aliases.
+
+// addOutputFlag registers --output in a command, with the
+// legacy names of the flag as deprecated aliases
+func addOutputFlag(cmd *cobra.Command, path *string, usage string, legacy ...string) {
+	cmd.PersistentFlags().StringVarP(path, "output", "o", "", usage)
+	for _, name := range legacy {
+		cmd.PersistentFlags().StringVar(path, name, "", usage)
+		deprecateFlag(cmd, name, "--output")
+	}
+}
+
+// addOutputFormatFlag registers --output-format in a command, completed
+// with the formats it supports and with the legacy names of the flag as
+// deprecated aliases
+func addOutputFormatFlag(
+	cmd *cobra.Command, format *string, value string, formats []string, usage string, legacy ...string,
+) {
+	cmd.PersistentFlags().StringVar(format, "output-format", value, usage)
+	registerFlagCompletion(cmd, "output-format", completeValues(formats))
+	for _, name := range legacy {
+		cmd.PersistentFlags().StringVar(format, name, value, usage)
+		deprecateFlag(cmd, name, "--output-format")
+	}
+}
+
+// outputFormatTemplate is the output format rendering the output of a
+// command with the Go template set with --template
+const outputFormatTemplate = "template"
+
+// addTemplateFlag registers --template in a command supporting the
+// template output format
+func addTemplateFlag(cmd *cobra.Command, text *string) {
+	cmd.PersistentFlags().StringVar(
+		text,
+		"template",
+		"",
+		"Go template to render the output with --output-format=template",
+	)
+}
+
+// validateTemplate checks that a template is set with, and only with,
+// the template output format and that it parses
+func validateTemplate(format, text string) error {
+	if format != outputFormatTemplate {
+		if text != "" {
+			return errors.New("--template only applies to --output-format=template")
+		}
+		return nil
+	}
+	if text == "" {
+		return errors.New("--output-format=template requires a template set with --template")
+	}
+	if _, err := parseTemplate(text); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseTemplate parses a Go template set with --template. Besides the
+// builtin functions, templates can use json to write a value as JSON
+// and join to join a list with a separator.
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("output").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"join": func(sep string, v []interface{}) string {
+			s := make([]string, 0, len(v))
+			for _, e := range v {
+				s = append(s, fmt.Sprint(e))
+			}
+			return strings.Join(s, sep)
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing output template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// writeTemplate renders data with a Go template. The template sees the
+// data as it is written with --output-format=json, so its fields are
+// addressed with the JSON field names, eg {{.statements}}.
+func writeTemplate(w io.Writer, text string, data interface{}) error {
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("encoding template data: %w", err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return fmt.Errorf("decoding template data: %w", err)
+	}
+	if err := tmpl.Execute(w, value); err != nil {
+		return fmt.Errorf("rendering output template: %w", err)
+	}
+	return nil
+}
+
+// deprecateFlag marks a flag replaced by another one as deprecated
+func deprecateFlag(cmd *cobra.Command, name, replacement string) {
+	if err := cmd.PersistentFlags().MarkDeprecated(name, "use "+replacement+" instead"); err != nil {
+		panic(err)
+	}
+}
+
+// createOutput returns the file set with --output to write the output
+// of a command to, or STDOUT if none was set
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating output file: %w", err)
+	}
+	return f, nil
+}
+
+// nopCloser keeps STDOUT open when the output is closed
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// newVexCtl returns a vexctl client configured with the global
+// command line options and any additional options passed
+func newVexCtl(opts ...ctl.OptionFunc) *ctl.VexCtl {
+	return ctl.New(append([]ctl.OptionFunc{
+		ctl.WithCache(commandLineOpts.cacheDir, commandLineOpts.cacheTTL),
+		ctl.WithRetry(commandLineOpts.retries, commandLineOpts.retryBackoff, commandLineOpts.retryStatusCodes),
+		ctl.WithAttestationVerification(commandLineOpts.verification),
+		ctl.WithRegistryMirrors(commandLineOpts.registryMirrors),
+		ctl.WithMetrics(commandMetrics),
+		ctl.WithCredentialHelper(commandLineOpts.credentialHelper),
+		ctl.WithCACertificates(commandLineOpts.caCertificates),
+		ctl.WithLenient(parseWarnings),
+		ctl.WithRejectExpired(commandLineOpts.rejectExpired),
+	}, opts...)...)
+}
+
+// initCommand sets up logging and the command context
+func initCommand(cmd *cobra.Command, args []string) error {
+	if commandLineOpts.metricsOut != "" {
+		commandMetrics = ctl.NewMetrics()
+	}
+	if commandLineOpts.lenient {
+		parseWarnings = &ctl.ParseWarnings{}
+	}
+	if commandLineOpts.timeout > 0 {
+		ctx, cancel := context.WithTimeout(cmd.Context(), commandLineOpts.timeout)
+		cmd.SetContext(ctx)
+		cancelTimeout = cancel
+	}
+	return initLogging(cmd, args)
+}
+
+// initLogging configures the global logger. Logs are always written to
+// stderr so that stdout remains clean for pipeable output.
 func initLogging(*cobra.Command, []string) error {
-	return log.SetupGlobalLogger(commandLineOpts.logLevel)
+	if err := log.SetupGlobalLogger(commandLineOpts.logLevel); err != nil {
+		return err
+	}
+	if commandLineOpts.quiet {
+		logrus.SetLevel(logrus.ErrorLevel)
+	}
+	logrus.SetOutput(os.Stderr)
+	switch commandLineOpts.logFormat {
+	case "text":
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return withExitCode(exitValidation, fmt.Errorf(
+			"invalid log format %q, must be text or json", commandLineOpts.logFormat,
+		))
+	}
+	if commandLineOpts.errorFormat != "text" && commandLineOpts.errorFormat != "json" {
+		return withExitCode(exitValidation, fmt.Errorf(
+			"invalid error format %q, must be text or json", commandLineOpts.errorFormat,
+		))
+	}
+	return nil
 }
 
-// Execute builds the command
+// Execute builds the command. Interrupting vexctl (eg with Ctrl-C)
+// cancels the command context, aborting any running registry operations.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		logrus.Fatal(err)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := execute(ctx, newRootCmd(), os.Stderr)
+	cancel()
+	if code != exitOK {
+		os.Exit(code)
+	}
+}
+
+// execute runs a command tree and returns the code vexctl exits with. The
+// error that made the command fail is written to stderr in the format set
+// with --error-format.
+func execute(ctx context.Context, rootCmd *cobra.Command, stderr io.Writer) int {
+	commandMetrics, parseWarnings = nil, nil
+	err := rootCmd.ExecuteContext(ctx)
+	cancelTimeout()
+	if warnings := parseWarnings.Warnings(); len(warnings) > 0 {
+		for _, w := range warnings {
+			logrus.Warn(w)
+		}
+		logrus.Warnf("Skipped %d malformed records", len(warnings))
+	}
+	if commandMetrics != nil {
+		// Metrics are written even if the command failed, to
+		// track the performance of the jobs that time out
+		if merr := writeMetrics(commandLineOpts.metricsOut, commandMetrics); merr != nil {
+			logrus.Error(merr)
+		}
+	}
+	if err != nil {
+		writeError(stderr, commandLineOpts.errorFormat, err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// writeMetrics writes the metrics recorded to a JSON file
+func writeMetrics(path string, m *ctl.Metrics) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating metrics file: %w", err)
+	}
+	defer f.Close()
+	if err := m.WriteJSON(f); err != nil {
+		return fmt.Errorf("writing metrics: %w", err)
+	}
+	return nil
+}
+
+// parseTime parses a time from the command line, either in RFC3339
+// format or as a date. An empty string returns the zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339 or YYYY-MM-DD", s)
 	}
+	return t, nil
 }
@@ -0,0 +1,246 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testReport is a SARIF report with results about two vulnerabilities
+const testReport = `{
+  "version": "2.1.0",
+  "$schema": "https://json.schemastore.org/sarif-2.1.0-rtm.5.json",
+  "runs": [{
+    "tool": {"driver": {"name": "test-scanner"}},
+    "results": [
+      {"ruleId": "CVE-2023-0001", "message": {"text": "lodash"}, "properties": {"purl": "pkg:npm/lodash@2.3.0"}},
+      {"ruleId": "CVE-2023-0002", "message": {"text": "lodash"}, "properties": {"purl": "pkg:npm/lodash@2.3.0"}}
+    ]
+  }]
+}`
+
+// testDocument is a VEX document suppressing the first
+// vulnerability of testReport
+const testDocument = `{
+  "@context": "https://openvex.dev/ns",
+  "@id": "https://example.com/vex-1",
+  "author": "Example Security",
+  "timestamp": "2023-01-01T00:00:00Z",
+  "version": "1",
+  "statements": [{
+    "vulnerability": "CVE-2023-0001",
+    "products": ["pkg:oci/app"],
+    "status": "not_affected",
+    "justification": "component_not_present"
+  }]
+}`
+
+// writeTestFile writes a file in a temporary directory and returns its path
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// runCommand runs vexctl with the arguments passed, with an empty VEX
+// store unless another one is passed with --store-dir. It returns the exit code, what the commands printed to stderr,
+// like usage and deprecation warnings, and the error written on failure.
+func runCommand(t *testing.T, args ...string) (code int, output, errOutput string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs(append([]string{"--quiet", "--retries=1", "--store-dir=" + t.TempDir()}, args...))
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&out)
+	code = execute(context.Background(), rootCmd, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestExitCodes(t *testing.T) {
+	report := writeTestFile(t, "report.sarif.json", testReport)
+	doc := writeTestFile(t, "doc.vex.json", testDocument)
+	bundle := writeTestFile(t, "doc.bundle.json", `{"mediaType": "application/vnd.dev.sigstore.bundle+json;version=0.1"}`)
+
+	for name, tc := range map[string]struct {
+		args []string
+		code int
+	}{
+		"success": {
+			[]string{"filter", "--output=" + filepath.Join(t.TempDir(), "out.sarif.json"), report, doc},
+			exitOK,
+		},
+		"verify failure": {
+			[]string{"verify", "--bundle=" + bundle, doc},
+			exitValidation,
+		},
+		"coverage failure": {
+			[]string{"filter", "--require-coverage", "--output=" + filepath.Join(t.TempDir(), "out.sarif.json"), report, doc},
+			exitUncovered,
+		},
+		"remaining results": {
+			[]string{"filter", "--fail-on-results", "--output=" + filepath.Join(t.TempDir(), "out.sarif.json"), report, doc},
+			exitVulnerabilities,
+		},
+		"unknown flag": {
+			[]string{"filter", "--no-such-flag", report, doc},
+			exitValidation,
+		},
+		"missing arguments": {
+			[]string{"filter", report},
+			exitValidation,
+		},
+		"fetch error": {
+			[]string{"filter", "--output=" + filepath.Join(t.TempDir(), "out.sarif.json"), report, "http://127.0.0.1:1/doc.vex.json"},
+			exitNetwork,
+		},
+	} {
+		code, _, errOutput := runCommand(t, tc.args...)
+		require.Equal(t, tc.code, code, "%s: %s", name, errOutput)
+	}
+}
+
+func TestErrorFormat(t *testing.T) {
+	report := writeTestFile(t, "report.sarif.json", testReport)
+	doc := writeTestFile(t, "doc.vex.json", testDocument)
+	invalid := writeTestFile(t, "invalid.vex.json", `{"statements": 5}`)
+	output := "--output=" + filepath.Join(t.TempDir(), "out.sarif.json")
+
+	// Each class of error is written as the JSON object documented
+	// in the README: {"code":4,"message":"...","hints":["..."]}
+	for _, tc := range []struct {
+		args []string
+		code int
+		hint string
+	}{
+		{[]string{"stats", invalid}, exitFailure, ""},
+		{[]string{"filter", "--no-such-flag", report, doc}, exitValidation, "--help"},
+		{[]string{"filter", "--fail-on-results", output, report, doc}, exitVulnerabilities, ""},
+		{[]string{"filter", output, report, "http://127.0.0.1:1/doc.vex.json"}, exitNetwork, "--retries"},
+		{[]string{"filter", "--require-coverage", output, report, doc}, exitUncovered, "create"},
+	} {
+		// The format goes before the flags, those after an unknown one are not parsed
+		code, _, errOutput := runCommand(t, append([]string{"--error-format=json"}, tc.args...)...)
+		require.Equal(t, tc.code, code, errOutput)
+
+		fields := map[string]json.RawMessage{}
+		require.NoError(t, json.Unmarshal([]byte(errOutput), &fields), errOutput)
+		require.Len(t, fields, 3, errOutput)
+
+		obj := struct {
+			Code    int      `json:"code"`
+			Message string   `json:"message"`
+			Hints   []string `json:"hints"`
+		}{}
+		dec := json.NewDecoder(strings.NewReader(errOutput))
+		dec.DisallowUnknownFields()
+		require.NoError(t, dec.Decode(&obj))
+		require.Equal(t, tc.code, obj.Code)
+		require.NotEmpty(t, obj.Message)
+		require.NotNil(t, obj.Hints, "hints must be a list, even when empty")
+		if tc.hint != "" {
+			require.Contains(t, strings.Join(obj.Hints, "\n"), tc.hint)
+		}
+	}
+
+	// The text format keeps the message and hints readable
+	code, _, errOutput := runCommand(t, "filter", "--no-such-flag", report, doc)
+	require.Equal(t, exitValidation, code)
+	require.True(t, strings.HasPrefix(errOutput, "Error: unknown flag: --no-such-flag\n"), errOutput)
+	require.Contains(t, errOutput, "Hint: ")
+}
+
+func TestDeprecatedFlags(t *testing.T) {
+	for _, tc := range []struct {
+		command []string
+		legacy  string
+		flag    string
+		value   string
+	}{
+		{[]string{"create"}, "file", "output", "doc.vex.json"},
+		{[]string{"generate"}, "file", "output", "doc.vex.json"},
+		{[]string{"import", "grype-ignore"}, "file", "output", "doc.vex.json"},
+		{[]string{"import", "github-dismissals"}, "file", "output", "doc.vex.json"},
+		{[]string{"export"}, "file", "output", "grype.yaml"},
+		{[]string{"export"}, "format", "output-format", "trivy"},
+		{[]string{"prune"}, "file", "output", "doc.vex.json"},
+		{[]string{"render"}, "file", "output", "summary.md"},
+		{[]string{"render"}, "markdown", "output-format", "markdown"},
+		{[]string{"touch"}, "file", "output", "doc.vex.json"},
+		{[]string{"stats"}, "format", "output-format", "json"},
+		{[]string{"discover"}, "format", "output-format", "json"},
+		{[]string{"store", "list"}, "format", "output-format", "json"},
+		{[]string{"graph"}, "format", "output-format", "mermaid"},
+		{[]string{"filter"}, "format", "input-format", "csaf"},
+	} {
+		name := strings.Join(tc.command, " ") + " --" + tc.legacy
+		var b bytes.Buffer
+		rootCmd := newRootCmd()
+		rootCmd.SetOut(&b)
+		rootCmd.SetErr(&b)
+		cmd, _, err := rootCmd.Find(tc.command)
+		require.NoError(t, err, name)
+
+		arg := "--" + tc.legacy + "=" + tc.value
+		if tc.legacy == "markdown" {
+			arg = "--markdown"
+		}
+		require.NoError(t, cmd.ParseFlags([]string{arg}), name)
+		require.Equal(t, tc.value, cmd.Flags().Lookup(tc.flag).Value.String(), name)
+		require.Contains(t, b.String(), "Flag --"+tc.legacy+" has been deprecated, use --"+tc.flag, name)
+	}
+}
+
+func TestTemplateOutput(t *testing.T) {
+	doc := writeTestFile(t, "doc.vex.json", testDocument)
+	dir := t.TempDir()
+
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{
+			[]string{"stats", "--template={{.documents}} {{.statements}} {{json .statuses}}"},
+			`1 1 {"not_affected":1}`,
+		},
+		{
+			[]string{"merge", "--template={{range .statements}}{{.vulnerability}} {{.status}} {{join \",\" .products}}{{end}}"},
+			"CVE-2023-0001 not_affected pkg:oci/app",
+		},
+		{
+			[]string{"create", "--product=pkg:oci/app", "--vuln=CVE-2023-0002", "--status=fixed", "--template={{.author}}: {{(index .statements 0).status}}"},
+			"Unknown Author: fixed",
+		},
+	} {
+		output := filepath.Join(dir, tc.args[0]+".out")
+		args := append(tc.args, "--output-format=template", "--output="+output)
+		if tc.args[0] != "create" {
+			args = append(args, doc)
+		}
+		code, _, errOutput := runCommand(t, args...)
+		require.Equal(t, exitOK, code, errOutput)
+		data, err := os.ReadFile(output)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, string(data), tc.args[0])
+	}
+
+	for _, args := range [][]string{
+		{"stats", "--output-format=template", doc},
+		{"stats", "--output-format=json", "--template={{.statements}}", doc},
+		{"merge", "--output-format=template", "--template={{.statements", doc},
+	} {
+		code, _, errOutput := runCommand(t, args...)
+		require.Equal(t, exitValidation, code, errOutput)
+	}
+}
@@ -6,9 +6,8 @@ SPDX-License-Identifier: Apache-2.0
 package cmd
 
 import (
-	"context"
+	"errors"
 	"fmt"
-	"os"
 
 	"github.com/spf13/cobra"
 
@@ -19,6 +18,29 @@ import (
 
 type mergeOptions struct {
 	ctl.MergeOptions
+	outputOptions
+	since        string
+	until        string
+	allowPartial bool
+	output       string
+}
+
+// Validate checks the merge options and parses the time range
+func (o *mergeOptions) Validate() error {
+	var err error
+	if o.Since, err = parseTime(o.since); err != nil {
+		return fmt.Errorf("parsing --since: %w", err)
+	}
+	if o.Until, err = parseTime(o.until); err != nil {
+		return fmt.Errorf("parsing --until: %w", err)
+	}
+	if !o.Since.IsZero() && !o.Until.IsZero() && o.Until.Before(o.Since) {
+		return errors.New("--until must be later than --since")
+	}
+	if o.ConsolidateWindow < 0 {
+		return errors.New("--consolidate-window cannot be negative")
+	}
+	return o.outputOptions.Validate()
 }
 
 func addMerge(parentCmd *cobra.Command) {
@@ -31,6 +53,23 @@ When composing VEX data out of multiple sources it may be necessary to mix
 all statements into a single doc. The merge subcommand mixes the statements
 from one or more vex documents into a single, new one.
 
+Documents can be read from files and directories as well as from published
+locations such as HTTP(S) URLs, git repositories and the attestations of
+container images, so aggregated feeds can be built straight from them.
+Glob patterns are expanded by %s, a ** segment matches any number of
+directories.
+
+While merging, %s replays the statements in time order and warns about
+status changes not expected as vulnerabilities are assessed, for example
+moving from fixed back to affected. These changes are accepted when they
+come from a newer version of the document that made the previous claim.
+Use --strict-transitions to fail instead of warning.
+
+Merging documents about many products can produce many statements that only
+differ in their product. --consolidate combines them into a single statement
+listing all the products, as long as their timestamps are no more than
+--consolidate-window apart.
+
 Examples:
 
 # Merge two documents into one
@@ -42,18 +81,46 @@ Examples:
 # Merge vulnerability data from two documents into one
 %s merge --vulnerability=CVE-2022-3294 document1.vex.json document2.vex.json 
 
-`, appname, appname, appname, appname),
-		Use:               "merge",
+# Merge the documents of a fleet, combining the statements issued the same day
+%s merge --consolidate --consolidate-window=24h vex/
+
+# Merge all the OpenVEX documents in a tree, quoting the pattern for the shell
+%s merge './vex/**/*.openvex.json'
+
+# Merge a local document with a published one and the attestations of an image
+%s merge local.vex.json https://example.com/app.vex.json cgr.dev/image@sha256:e4cf37d568d195b4...
+
+# Merge only the statements published by the vendor
+%s merge --from-author="Chainguard" vendor.vex.json thirdparty.vex.json
+
+# Merge the statements issued during the first quarter of 2023
+%s merge --since=2023-01-01 --until=2023-03-31T23:59:59Z feed.vex.json
+
+# Merge into a YAML document, for repositories keeping their VEX data in YAML
+%s merge --output-format=yaml document1.vex.json document2.vex.json > merged.vex.yaml
+
+`, appname, appname, appname, appname, appname, appname, appname, appname, appname, appname, appname, appname),
+		Use:               "merge vex_source...",
 		SilenceUsage:      false,
 		SilenceErrors:     false,
-		PersistentPreRunE: initLogging,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: completeVEXFiles,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			vexctl := ctl.New()
-			newVex, err := vexctl.MergeFiles(context.Background(), &opts.MergeOptions, args)
+			if err := opts.Validate(); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			out, err := createOutput(opts.output)
+			if err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			defer out.Close()
+
+			vexctl := newVexCtl(ctl.WithAllowPartial(opts.allowPartial))
+			newVex, err := vexctl.MergeURIs(cmd.Context(), &opts.MergeOptions, args)
 			if err != nil {
 				return fmt.Errorf("merging documents: %w", err)
 			}
-			if err := newVex.ToJSON(os.Stdout); err != nil {
+			if err := opts.writeDocument(out, newVex); err != nil {
 				return fmt.Errorf("writing new vex document: %w", err)
 			}
 			return nil
@@ -95,5 +162,65 @@ Examples:
 		"list of products to merge, all others will be ignored",
 	)
 
+	mergeCmd.PersistentFlags().StringSliceVar(
+		&opts.SourceAuthors,
+		"from-author",
+		[]string{},
+		"only merge statements from documents issued by these authors",
+	)
+
+	mergeCmd.PersistentFlags().StringSliceVar(
+		&opts.SourceRoles,
+		"from-role",
+		[]string{},
+		"only merge statements from documents issued by authors with these roles",
+	)
+
+	mergeCmd.PersistentFlags().StringVar(
+		&opts.since,
+		"since",
+		"",
+		"only merge statements issued at or after this time (RFC3339 or YYYY-MM-DD)",
+	)
+
+	mergeCmd.PersistentFlags().StringVar(
+		&opts.until,
+		"until",
+		"",
+		"only merge statements issued at or before this time (RFC3339 or YYYY-MM-DD)",
+	)
+
+	mergeCmd.PersistentFlags().BoolVar(
+		&opts.StrictTransitions,
+		"strict-transitions",
+		false,
+		"fail if a status change is not allowed by the VEX status graph",
+	)
+
+	mergeCmd.PersistentFlags().BoolVar(
+		&opts.Consolidate,
+		"consolidate",
+		false,
+		"combine statements that only differ in their products into one",
+	)
+
+	mergeCmd.PersistentFlags().DurationVar(
+		&opts.ConsolidateWindow,
+		"consolidate-window",
+		0,
+		"maximum time between statements combined by --consolidate (eg 24h)",
+	)
+
+	mergeCmd.PersistentFlags().BoolVar(
+		&opts.allowPartial,
+		"allow-partial",
+		false,
+		"skip VEX sources that fail to load instead of aborting",
+	)
+
+	opts.outputOptions.addFlags(mergeCmd)
+	addOutputFlag(mergeCmd, &opts.output, "file to write the merged document (default is STDOUT)")
+	registerFlagCompletion(mergeCmd, "output", completeVEXFiles)
+
 	parentCmd.AddCommand(mergeCmd)
 }
@@ -0,0 +1,92 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// spinner draws a progress indicator on STDERR while a long operation
+// runs. It is disabled when STDERR is not a terminal so that piped
+// output and CI logs are not polluted with control characters.
+type spinner struct {
+	mutex   sync.Mutex
+	message string
+	enabled bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// newSpinner returns a spinner, enabled only when STDERR is
+// a terminal and vexctl is not running in quiet mode
+func newSpinner() *spinner {
+	return &spinner{
+		enabled: !commandLineOpts.quiet &&
+			term.IsTerminal(int(os.Stderr.Fd())), //nolint:gosec // file descriptors fit in an int
+		done: make(chan struct{}),
+	}
+}
+
+// Start begins drawing the spinner with an initial message
+func (s *spinner) Start(message string) {
+	s.Update(message)
+	if !s.enabled {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			select {
+			case <-s.done:
+				fmt.Fprint(os.Stderr, "\r\033[2K")
+				return
+			case <-ticker.C:
+				s.mutex.Lock()
+				fmt.Fprintf(os.Stderr, "\r\033[2K%s %s", spinnerFrames[i%len(spinnerFrames)], s.message)
+				s.mutex.Unlock()
+			}
+		}
+	}()
+}
+
+// Update changes the message shown next to the spinner
+func (s *spinner) Update(message string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.message = message
+}
+
+// Stop clears the spinner from the terminal
+func (s *spinner) Stop() {
+	if !s.enabled {
+		return
+	}
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	s.wg.Wait()
+}
+
+// ProgressFunc returns a function to feed vexctl progress into the spinner
+func (s *spinner) ProgressFunc() ctl.ProgressFunc {
+	return func(operation string, current, total int) {
+		s.Update(fmt.Sprintf("%s (%d/%d)", operation, current, total))
+	}
+}
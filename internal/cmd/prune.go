@@ -0,0 +1,115 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+type pruneOptions struct {
+	products    []string
+	outFilePath string
+}
+
+// Validate checks the options of the prune subcommand
+func (o *pruneOptions) Validate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("a VEX document to prune is required")
+	}
+	if len(o.products) == 0 {
+		return errors.New("at least one product to prune is required")
+	}
+	return nil
+}
+
+func addPrune(parentCmd *cobra.Command) {
+	opts := pruneOptions{}
+	pruneCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s prune: remove the statements about products from a document", appname),
+		Long: fmt.Sprintf(`%s prune: remove the statements about products from a document
+
+The prune subcommand removes all statements about one or more products
+from a VEX document, for example to drop retired products from a large
+merged feed. Statements that also apply to other products are kept but
+the pruned products are removed from them.
+
+The pruned document is written to STDOUT or to the file set with --output
+and a report of the removed and modified statements is printed to STDERR.
+If anything was removed, the document version is incremented.
+
+Examples:
+
+# Remove the statements about an old release:
+%s prune --product="pkg:apk/wolfi/bash@1.0.0" feed.vex.json > new.vex.json
+
+`, appname, appname),
+		Use:               "prune --product product_id document.vex.json",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: completeVEXFiles,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			doc, err := vex.Load(args[0])
+			if err != nil {
+				return withExitCode(exitValidation, fmt.Errorf("loading VEX document: %w", err))
+			}
+
+			newDoc, report := newVexCtl().Prune(doc, opts.products)
+
+			out := os.Stdout
+			if opts.outFilePath != "" {
+				f, err := os.Create(opts.outFilePath)
+				if err != nil {
+					return fmt.Errorf("opening VEX file to write document: %w", err)
+				}
+				out = f
+				defer f.Close()
+			}
+			if err := newDoc.ToJSON(out); err != nil {
+				return fmt.Errorf("writing pruned VEX document: %w", err)
+			}
+
+			if commandLineOpts.quiet {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "Removed %d statements:\n", len(report.Removed))
+			for _, s := range report.Removed {
+				fmt.Fprintf(os.Stderr, "  - %s (%s) %s\n", s.Vulnerability, s.Status, strings.Join(s.Products, ", "))
+			}
+			fmt.Fprintf(os.Stderr, "Modified %d statements:\n", len(report.Modified))
+			for _, s := range report.Modified {
+				fmt.Fprintf(os.Stderr, "  - %s (%s) now applies to %s\n", s.Vulnerability, s.Status, strings.Join(s.Products, ", "))
+			}
+			return nil
+		},
+	}
+
+	pruneCmd.PersistentFlags().StringSliceVarP(
+		&opts.products,
+		"product",
+		"p",
+		[]string{},
+		"products to remove from the document",
+	)
+
+	addOutputFlag(pruneCmd, &opts.outFilePath, "file to write the pruned document (default is STDOUT)", "file")
+
+	registerFlagCompletion(pruneCmd, "output", completeVEXFiles)
+
+	parentCmd.AddCommand(pruneCmd)
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type recommendOptions struct {
+	format   string
+	template string
+	output   string
+}
+
+// Validate checks the options in context with the arguments
+func (o *recommendOptions) Validate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("a grype JSON report is required")
+	}
+	if o.format != "text" && o.format != "json" && o.format != outputFormatTemplate {
+		return fmt.Errorf("invalid output format %q, must be text, json or template", o.format)
+	}
+	return validateTemplate(o.format, o.template)
+}
+
+func addRecommend(parentCmd *cobra.Command) {
+	opts := recommendOptions{}
+	recommendCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s recommend: suggest justifications for the matches of a grype report", appname),
+		Long: fmt.Sprintf(`%s recommend: suggest justifications for the matches of a grype report
+
+The recommend subcommand reads a grype JSON report and suggests a likely
+justification for the matches whose match data hints that the image is not
+affected, to speed up triage and keep the decisions consistent:
+
+  - Matches found only by CPE may identify another component than the
+    package: component_not_present is suggested.
+  - Matches of a distro package found only through its source package may
+    be about code not built into it: vulnerable_code_not_present is
+    suggested.
+
+Matches found on the package itself are not listed. The suggestions are
+heuristics, confirm them before issuing statements, eg with %s create.
+Other report formats do not record how vulnerabilities were matched and
+are not supported. Pass - to read the report from STDIN.
+
+Examples:
+
+grype -o json cgr.dev/chainguard/nginx | %s recommend -
+
+%s recommend --output-format=json nginx.grype.json
+
+`, appname, appname, appname, appname),
+		Use:               "recommend grype_report",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: completeSARIFFiles,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			var data []byte
+			var err error
+			if args[0] == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				return fmt.Errorf("reading report: %w", err)
+			}
+			recommendations, err := ctl.RecommendJustifications(data)
+			if err != nil {
+				return withExitCode(exitValidation, fmt.Errorf("recommending justifications: %w", err))
+			}
+
+			out, err := createOutput(opts.output)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+
+			switch opts.format {
+			case outputFormatTemplate:
+				return writeTemplate(out, opts.template, recommendations)
+			case "json":
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(recommendations); err != nil {
+					return fmt.Errorf("encoding recommendations: %w", err)
+				}
+				return nil
+			}
+			w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "VULNERABILITY\tPACKAGE\tJUSTIFICATION\tREASON")
+			for i := range recommendations {
+				r := &recommendations[i]
+				fmt.Fprintf(w, "%s\t%s %s\t%s\t%s\n", r.Vulnerability, r.Package, r.Version, r.Justification, r.Reason)
+			}
+			return w.Flush()
+		},
+	}
+
+	addOutputFormatFlag(
+		recommendCmd, &opts.format, "text", []string{"text", "json", outputFormatTemplate},
+		"output format, either text, json or template",
+	)
+	addTemplateFlag(recommendCmd, &opts.template)
+
+	addOutputFlag(recommendCmd, &opts.output, "file to write the recommendations (default is STDOUT)")
+
+	parentCmd.AddCommand(recommendCmd)
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type renderOptions struct {
+	format      string
+	markdown    bool
+	products    []string
+	title       string
+	outFilePath string
+}
+
+// Validate checks the options in context with the arguments
+func (o *renderOptions) Validate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("at least one VEX document is required")
+	}
+	if o.format != "markdown" {
+		return fmt.Errorf("invalid output format %q, only markdown is supported", o.format)
+	}
+	return nil
+}
+
+func addRender(parentCmd *cobra.Command) {
+	opts := renderOptions{}
+	renderCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s render: summarize VEX documents for people", appname),
+		Long: fmt.Sprintf(`%s render: summarize VEX documents for people
+
+The render subcommand merges one or more VEX documents and writes a summary
+of the latest statement about each vulnerability and product, meant to be
+pasted into release notes or advisories.
+
+The summary is written in markdown. It starts with a table of the status of each
+vulnerability, followed by a section per vulnerability explaining its
+justification in prose, the impact and action statements and the products
+it applies to. Use --product to only summarize some products.
+
+Examples:
+
+%s render --title="Security notes for v1.2.0" release.vex.json > SECURITY.md
+
+%s render --product=pkg:oci/app vex/
+
+`, appname, appname, appname),
+		Use:               "render vex_document...",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: completeVEXFiles,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			vexctl := newVexCtl()
+			vexes, err := vexctl.VexesFromURIs(cmd.Context(), args)
+			if err != nil {
+				return fmt.Errorf("reading VEX data: %w", err)
+			}
+			statements, err := vexctl.LatestStatements(cmd.Context(), vexes, opts.products)
+			if err != nil {
+				return fmt.Errorf("merging documents: %w", err)
+			}
+
+			out, err := createOutput(opts.outFilePath)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+			if err := ctl.WriteMarkdown(out, opts.title, statements); err != nil {
+				return fmt.Errorf("writing summary: %w", err)
+			}
+			if opts.outFilePath != "" {
+				logrus.Infof("Wrote VEX summary to %s", opts.outFilePath)
+			}
+			return nil
+		},
+	}
+
+	addOutputFormatFlag(
+		renderCmd, &opts.format, "markdown", []string{"markdown"},
+		"format of the summary, only markdown is supported",
+	)
+
+	// Markdown used to have to be selected explicitly
+	renderCmd.PersistentFlags().BoolVar(
+		&opts.markdown,
+		"markdown",
+		false,
+		"write the summary in markdown",
+	)
+	deprecateFlag(renderCmd, "markdown", "--output-format=markdown")
+
+	renderCmd.PersistentFlags().StringSliceVarP(
+		&opts.products,
+		"product",
+		"p",
+		[]string{},
+		"list of products to summarize (default is all)",
+	)
+
+	renderCmd.PersistentFlags().StringVar(
+		&opts.title,
+		"title",
+		"VEX summary",
+		"title of the summary",
+	)
+
+	addOutputFlag(renderCmd, &opts.outFilePath, "file to write the summary (default is STDOUT)", "file")
+
+	parentCmd.AddCommand(renderCmd)
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type showOptions struct {
+	color   string
+	resolve bool
+}
+
+// Validate checks the options in context with the arguments
+func (o *showOptions) Validate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("a VEX document is required")
+	}
+	if o.color != "auto" && o.color != "always" && o.color != "never" {
+		return fmt.Errorf("invalid color mode %q, must be auto, always or never", o.color)
+	}
+	return nil
+}
+
+// useColor returns true if the output should be colored
+func (o *showOptions) useColor() bool {
+	switch o.color {
+	case "always":
+		return true
+	case "never":
+		return false
+	default:
+		return term.IsTerminal(int(os.Stdout.Fd())) //nolint:gosec // file descriptors fit in an int
+	}
+}
+
+func addShow(parentCmd *cobra.Command) {
+	opts := showOptions{}
+	showCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s show: print a VEX document in human readable form", appname),
+		Long: fmt.Sprintf(`%s show: print a VEX document in human readable form
+
+The show subcommand renders a VEX document for review. The statements are
+grouped by product and their statuses are colored when writing to a
+terminal. Timestamps are shown relative to the current time.
+
+The document can be read from any source supported by %s: a local
+file, an HTTP(S) URL, a git repository or the attestations of an image.
+When a source has more than one document, all of them are shown.
+
+With --resolve, the upstream advisories and source documents referenced by
+URL in the statements (in their vulnerability ID, description, notes, impact
+or action statements) are fetched and summarized below each statement: the
+statements of OpenVEX documents, the summary or title of OSV and CSAF
+advisories and the title of web pages. Fetched documents are kept in the
+registry cache when enabled with --cache-ttl.
+
+Examples:
+
+%s show data.vex.json
+
+# Force colors when paging the output:
+%s show --color=always data.vex.json | less -R
+
+# Fetch the documents referenced by the statements, caching them for a day:
+%s show --resolve --cache-ttl=24h data.vex.json
+
+`, appname, appname, appname, appname, appname),
+		Use:               "show vex_document",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: completeVEXFiles,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			vexctl := newVexCtl()
+			vexes, err := vexctl.VexesFromURI(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("reading VEX data: %w", err)
+			}
+
+			showOpts := ctl.ShowOptions{Color: opts.useColor()}
+			if opts.resolve {
+				showOpts.References, err = vexctl.ResolveReferences(cmd.Context(), vexes)
+				if err != nil {
+					return fmt.Errorf("resolving references: %w", err)
+				}
+			}
+
+			for i, doc := range vexes {
+				if i > 0 {
+					fmt.Println()
+				}
+				if err := ctl.WriteDocument(os.Stdout, doc, showOpts); err != nil {
+					return fmt.Errorf("writing document: %w", err)
+				}
+			}
+			return nil
+		},
+	}
+
+	showCmd.PersistentFlags().StringVar(
+		&opts.color,
+		"color",
+		"auto",
+		"color the statuses: auto, always or never",
+	)
+
+	showCmd.PersistentFlags().BoolVar(
+		&opts.resolve,
+		"resolve",
+		false,
+		"fetch and summarize the documents referenced by the statements",
+	)
+
+	registerFlagCompletion(showCmd, "color", completeValues([]string{"auto", "always", "never"}))
+
+	parentCmd.AddCommand(showCmd)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type statsOptions struct {
+	format   string
+	template string
+	output   string
+}
+
+// Validate checks the options in context with the arguments
+func (o *statsOptions) Validate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("at least one VEX document is required")
+	}
+	if o.format != "text" && o.format != "json" && o.format != outputFormatTemplate {
+		return fmt.Errorf("invalid output format %q, must be text, json or template", o.format)
+	}
+	return validateTemplate(o.format, o.template)
+}
+
+func addStats(parentCmd *cobra.Command) {
+	opts := statsOptions{}
+	statsCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s stats: print summary metrics of VEX documents", appname),
+		Long: fmt.Sprintf(`%s stats: print summary metrics of VEX documents
+
+The stats subcommand reads one or more VEX documents and reports the number
+of statements by status, justification, product and author, how old the
+statements are and the size of the documents. Tracking these metrics over
+time helps to keep an eye on the health of a VEX program.
+
+Documents can be read from any source supported by %s. Use
+--output-format=json to get the metrics in a machine readable form, or
+--output-format=template to render them with the Go template set with
+--template, which addresses the fields by their JSON names.
+
+Examples:
+
+%s stats vex/
+
+%s stats --output-format=json data1.vex.json data2.vex.json
+
+%s stats --output-format=template --template='{{.statements}}{{"\n"}}' vex/
+
+`, appname, appname, appname, appname, appname),
+		Use:               "stats vex_document...",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: completeVEXFiles,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			out, err := createOutput(opts.output)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+
+			progress := newSpinner()
+			defer progress.Stop()
+			vexctl := newVexCtl()
+			progress.Start("Reading VEX data")
+			vexes, err := vexctl.VexesFromURIs(cmd.Context(), args)
+			if err != nil {
+				return fmt.Errorf("reading VEX data: %w", err)
+			}
+			progress.Stop()
+
+			stats, err := vexctl.Stats(vexes, time.Now())
+			if err != nil {
+				return fmt.Errorf("computing statistics: %w", err)
+			}
+
+			if opts.format == outputFormatTemplate {
+				return writeTemplate(out, opts.template, stats)
+			}
+			if opts.format == "json" {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(stats); err != nil {
+					return fmt.Errorf("encoding statistics: %w", err)
+				}
+				return nil
+			}
+			return stats.Write(out)
+		},
+	}
+
+	addOutputFormatFlag(
+		statsCmd, &opts.format, "text", []string{"text", "json", outputFormatTemplate},
+		"output format, either text, json or template", "format",
+	)
+	addTemplateFlag(statsCmd, &opts.template)
+
+	addOutputFlag(statsCmd, &opts.output, "file to write the statistics (default is STDOUT)")
+
+	parentCmd.AddCommand(statsCmd)
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type storeListOptions struct {
+	products []string
+	format   string
+	template string
+	output   string
+}
+
+// Validate checks the options of store list
+func (o *storeListOptions) Validate() error {
+	if o.format != "text" && o.format != "json" && o.format != outputFormatTemplate {
+		return fmt.Errorf("invalid output format %q, must be text, json or template", o.format)
+	}
+	return validateTemplate(o.format, o.template)
+}
+
+// openStore returns the store configured with --store-dir
+func openStore() (*ctl.Store, error) {
+	store, err := ctl.NewStore(commandLineOpts.storeDir)
+	if err != nil {
+		return nil, fmt.Errorf("opening VEX store: %w", err)
+	}
+	return store, nil
+}
+
+// storeEntryName returns the name a stored document is shown with
+func storeEntryName(e *ctl.StoreEntry) string {
+	if e.ID == "" {
+		return "(no id)"
+	}
+	return e.ID
+}
+
+func addStore(parentCmd *cobra.Command) {
+	storeCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s store: manage a local store of VEX documents", appname),
+		Long: fmt.Sprintf(`%s store: manage a local store of VEX documents
+
+The store subcommands manage a local directory of VEX documents indexed by
+the products of their statements, a lightweight personal or team VEX
+database. Documents are kept in $XDG_DATA_HOME/vexctl/store (by default
+~/.local/share/vexctl/store), use --store-dir to keep them somewhere else,
+for example in a shared directory.
+
+%s filter consults the store automatically, adding the stored documents
+about the products selected with --product and the images recorded as
+scanned in the report to the VEX data applied.
+
+Examples:
+
+%s store add vendor.vex.json https://example.com/app.vex.json
+
+%s store list --product=pkg:oci/app
+
+%s store rm https://openvex.dev/docs/public/vex-2e67563e128250cbcb3e98930df948dd053e43271d70dc50cfa22d57e03fe96f
+
+`, appname, appname, appname, appname, appname),
+		Use:               "store",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+	}
+
+	addStoreAdd(storeCmd)
+	addStoreList(storeCmd)
+	addStoreRemove(storeCmd)
+	parentCmd.AddCommand(storeCmd)
+}
+
+func addStoreAdd(parentCmd *cobra.Command) {
+	addCmd := &cobra.Command{
+		Short: "add VEX documents to the store",
+		Long: fmt.Sprintf(`%s store add: add VEX documents to the store
+
+Documents can be read from any source supported by %s filter: files,
+directories, HTTP(S) URLs, git repositories and image attestations. Adding
+a document already stored updates its entry.
+`, appname, appname),
+		Use:               "add vex_source...",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: completeVEXFiles,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return withExitCode(exitValidation, errors.New("at least one VEX source is required"))
+			}
+			cmd.SilenceUsage = true
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			vexctl := newVexCtl()
+			for _, source := range args {
+				docs, err := vexctl.VexesFromURIs(cmd.Context(), []string{source})
+				if err != nil {
+					return fmt.Errorf("reading VEX data: %w", err)
+				}
+				for _, doc := range docs {
+					entry, added, err := store.Add(doc, source)
+					if err != nil {
+						return fmt.Errorf("adding %s to the store: %w", source, err)
+					}
+					action := "Updated"
+					if added {
+						action = "Added"
+					}
+					logrus.WithFields(logrus.Fields{
+						"key":      entry.Key[:12],
+						"products": len(entry.Products),
+					}).Infof("%s %s in the VEX store", action, storeEntryName(&entry))
+				}
+			}
+			return nil
+		},
+	}
+	parentCmd.AddCommand(addCmd)
+}
+
+func addStoreList(parentCmd *cobra.Command) {
+	opts := storeListOptions{}
+	listCmd := &cobra.Command{
+		Short:             "list the documents in the store",
+		Use:               "list",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			out, err := createOutput(opts.output)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			entries, err := store.List(opts.products)
+			if err != nil {
+				return fmt.Errorf("listing the VEX store: %w", err)
+			}
+
+			if opts.format == outputFormatTemplate {
+				return writeTemplate(out, opts.template, entries)
+			}
+			if opts.format == "json" {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(entries); err != nil {
+					return fmt.Errorf("writing store entries: %w", err)
+				}
+				return nil
+			}
+			w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\tDOCUMENT\tSTATEMENTS\tPRODUCTS")
+			for i := range entries {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\n",
+					entries[i].Key[:12], storeEntryName(&entries[i]), entries[i].Statements, strings.Join(entries[i].Products, ", "),
+				)
+			}
+			return w.Flush()
+		},
+	}
+
+	listCmd.PersistentFlags().StringSliceVarP(
+		&opts.products,
+		"product",
+		"p",
+		[]string{},
+		"only list the documents with statements about these products",
+	)
+
+	addOutputFormatFlag(
+		listCmd, &opts.format, "text", []string{"text", "json", outputFormatTemplate},
+		"output format, either text, json or template", "format",
+	)
+	addTemplateFlag(listCmd, &opts.template)
+
+	addOutputFlag(listCmd, &opts.output, "file to write the list of documents (default is STDOUT)")
+
+	parentCmd.AddCommand(listCmd)
+}
+
+func addStoreRemove(parentCmd *cobra.Command) {
+	rmCmd := &cobra.Command{
+		Short:             "remove documents from the store by document ID or key",
+		Use:               "rm document_id_or_key...",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return withExitCode(exitValidation, errors.New("at least one document ID or key is required"))
+			}
+			cmd.SilenceUsage = true
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			removed, err := store.Remove(args)
+			if err != nil {
+				return fmt.Errorf("removing documents from the store: %w", err)
+			}
+			if len(removed) == 0 {
+				return withHint(
+					errors.New("no stored document matches the IDs or keys"),
+					fmt.Sprintf("list the stored documents with '%s store list'", appname),
+				)
+			}
+			for i := range removed {
+				logrus.Infof("Removed %s from the VEX store", storeEntryName(&removed[i]))
+			}
+			return nil
+		},
+	}
+	parentCmd.AddCommand(rmCmd)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/go-vex/pkg/vex"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type touchOptions struct {
+	ctl.TouchOptions
+	outFilePath string
+}
+
+// Validate checks the options of the touch subcommand
+func (o *touchOptions) Validate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("a VEX document to update is required")
+	}
+	return nil
+}
+
+func addTouch(parentCmd *cobra.Command) {
+	opts := touchOptions{}
+	touchCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s touch: update the timestamps of statements in a document", appname),
+		Long: fmt.Sprintf(`%s touch: update the timestamps of statements in a document
+
+The touch subcommand sets the timestamp of the statements in a VEX document
+to the current time, to re-affirm them after a periodic review without
+editing the document by hand. Statements can be selected by vulnerability
+with --vuln and by product with --product. Without them, all statements
+are updated.
+
+When any statement is updated, the document timestamp is updated as well
+and its version is incremented. The document is rewritten in place, use
+--output to write it somewhere else.
+
+Examples:
+
+# Re-affirm all the statements about a vulnerability:
+%s touch --vuln=CVE-2023-1234 feed.vex.json
+
+# Re-affirm the statements about a product into a new file:
+%s touch --product="pkg:apk/wolfi/bash@1.0.0" --output=new.vex.json feed.vex.json
+
+`, appname, appname, appname),
+		Use:               "touch [--vuln vuln_id] [--product product_id] document.vex.json",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		ValidArgsFunction: completeVEXFiles,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			doc, err := vex.Load(args[0])
+			if err != nil {
+				return withExitCode(exitValidation, fmt.Errorf("loading VEX document: %w", err))
+			}
+
+			newDoc, touched := newVexCtl().Touch(doc, opts.TouchOptions)
+			if touched == 0 {
+				return withExitCode(exitValidation, errors.New("no statements match the vulnerabilities and products"))
+			}
+
+			path := args[0]
+			if opts.outFilePath != "" {
+				path = opts.outFilePath
+			}
+			if err := writeDocument(path, newDoc); err != nil {
+				return err
+			}
+
+			if !commandLineOpts.quiet {
+				fmt.Fprintf(os.Stderr, "Updated %d statements in %s\n", touched, path)
+			}
+			return nil
+		},
+	}
+
+	touchCmd.PersistentFlags().StringSliceVar(
+		&opts.Vulnerabilities,
+		"vuln",
+		[]string{},
+		"only update the statements about these vulnerabilities",
+	)
+
+	touchCmd.PersistentFlags().StringSliceVarP(
+		&opts.Products,
+		"product",
+		"p",
+		[]string{},
+		"only update the statements about these products",
+	)
+
+	addOutputFlag(touchCmd, &opts.outFilePath, "file to write the updated document (default is to update it in place)", "file")
+
+	registerFlagCompletion(touchCmd, "output", completeVEXFiles)
+
+	parentCmd.AddCommand(touchCmd)
+}
@@ -0,0 +1,386 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/go-vex/pkg/vex"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type verifyOptions struct {
+	minCoverage        float64
+	outputDir          string
+	outputPath         string
+	bundle             string
+	trustedRoots       string
+	rekorPublicKey     string
+	requirements       string
+	requirementsResult string
+}
+
+// loadRequirements reads the requirements passed with --requirements, if any
+func (o *verifyOptions) loadRequirements() (*ctl.Requirements, error) {
+	if o.requirements == "" {
+		if o.requirementsResult != "" {
+			return nil, errors.New("--requirements-result requires --requirements")
+		}
+		return nil, nil
+	}
+	return ctl.LoadRequirements(o.requirements)
+}
+
+// checkRequirements evaluates the verified VEX documents against the
+// requirements, prints the violations and writes the result when requested
+func checkRequirements(
+	opts *verifyOptions, reqs *ctl.Requirements, docs []*vex.VEX, signers []string,
+) (*ctl.RequirementsResult, error) {
+	res := reqs.Evaluate(docs, signers, time.Now())
+	if res.Passed {
+		fmt.Printf("Requirements:      passed (%s)\n", opts.requirements)
+	} else {
+		fmt.Printf("Requirements:      %d violations (%s)\n", len(res.Violations), opts.requirements)
+		for _, v := range res.Violations {
+			fmt.Printf("  - %s\n", v.String())
+		}
+	}
+	if opts.requirementsResult == "" {
+		return res, nil
+	}
+	f, err := os.Create(opts.requirementsResult)
+	if err != nil {
+		return nil, fmt.Errorf("creating requirements result file: %w", err)
+	}
+	defer f.Close()
+	if err := res.WriteJSON(f); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func addVerify(parentCmd *cobra.Command) {
+	opts := verifyOptions{}
+	verifyCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s verify: check an image has correlated SBOM and VEX attestations", appname),
+		Long: fmt.Sprintf(`%s verify: check an image has correlated SBOM and VEX attestations
+
+The verify subcommand fetches the SBOM and VEX attestations attached to
+a container image and checks that they describe the same artifact:
+
+  - The image has at least one SBOM and one VEX attestation
+  - Each VEX attestation has a subject matching the image digest, or
+    the digest of one of its platforms for an index. Other subjects,
+    like the artifacts of an SBOM or files, are listed for information
+  - The subcomponents referenced in the VEX statements are listed
+    in the SBOM
+
+%s prints a short report including how many of the VEX subcomponents
+were found in the SBOM and exits with code 2 if any check fails. Use
+--min-coverage to tolerate VEX subcomponents missing from the SBOM.
+VEX attestations outside of their validity window are listed as expired,
+with --reject-expired they are left out of the checks.
+
+Admission controllers and CI gates can also check the VEX data against a
+fixed set of requirements. This is not a policy language: pass a YAML or
+JSON file with --requirements listing the identities allowed to sign the
+VEX attestations, the maximum age of the statements and the not_affected
+justifications that are not accepted. Signers are
+checked against the verified signature: the identity in the signing
+certificate, or key:<reference> for attestations verified with --key.
+The author written in the documents is not trusted:
+
+  signers:
+    - https://github.com/example/app/.github/workflows/release.yaml@refs/heads/main
+  maxStatementAge: 720h
+  disallowedJustifications:
+    - inline_mitigations_already_exist
+
+Every violation is printed with its reason and %s exits with code 2 if
+there is any. --requirements-result writes the outcome as JSON.
+
+When the image passes verification, the VEX documents extracted from its
+attestations can be written to disk so that later steps can work with
+plain files: --output-dir writes one file per attestation and --output
+merges all of them into a single document.
+
+Examples:
+
+%s verify cgr.dev/chainguard/nginx@sha256:e4cf37d568d195b4b5af4c3...
+
+# Write the verified VEX data to a file for the next pipeline steps:
+%s verify --output=nginx.vex.json cgr.dev/chainguard/nginx@sha256:e4cf37d568d195b4b5af4c3...
+
+Published VEX documents can also be verified without network access from
+the sigstore bundle of their attestation, as written by
+cosign attest-blob --bundle. With --bundle, %s checks the DSSE signature,
+the signing certificate chain and the transparency log proof recorded in
+the bundle, and that the attestation is about the document passed as
+argument. The signer is checked against --certificate-identity and
+--certificate-oidc-issuer, or --key for bundles signed with a key.
+
+The certificate authorities and the transparency log key of the sigstore
+public good instance are read from the local TUF metadata. For air-gapped
+systems, pass them as PEM files with --trusted-roots and --rekor-public-key:
+
+%s verify --bundle=app.vex.bundle.json \
+    --certificate-identity=https://github.com/example/app/.github/workflows/release.yaml@refs/heads/main \
+    --certificate-oidc-issuer=https://token.actions.githubusercontent.com \
+    --trusted-roots=fulcio.pem --rekor-public-key=rekor.pub app.vex.json
+
+`, appname, appname, appname, appname, appname, appname, appname),
+		Use:               "verify (image_reference | --bundle bundle.json vex_document)",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.bundle != "" {
+				return verifyBundle(cmd, &opts, args)
+			}
+			if len(args) != 1 {
+				return withExitCode(exitValidation, errors.New("an image reference is required"))
+			}
+			reqs, err := opts.loadRequirements()
+			if err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			progress := newSpinner()
+			defer progress.Stop()
+			vexctl := newVexCtl(ctl.WithProgress(progress.ProgressFunc()))
+			progress.Start("Fetching attestations")
+			res, err := vexctl.VerifyImage(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("verifying image: %w", err)
+			}
+			progress.Stop()
+
+			fmt.Printf("Image:             %s\n", res.Image)
+			fmt.Printf("Digest:            %s\n", res.Digest)
+			fmt.Printf("SBOM attestations: %d\n", res.SBOMs)
+			fmt.Printf("VEX attestations:  %d\n", res.VEXDocuments)
+			if len(res.SubjectMismatches) == 0 {
+				fmt.Println("VEX subjects:      match image digest")
+			} else {
+				fmt.Printf("VEX subjects:      %d attestations do not match image digest\n", len(res.SubjectMismatches))
+				for _, s := range res.SubjectMismatches {
+					fmt.Printf("  - %s\n", s)
+				}
+			}
+			if len(res.ExtraSubjects) > 0 {
+				fmt.Printf("Other subjects:    %d (information only)\n", len(res.ExtraSubjects))
+				for _, s := range res.ExtraSubjects {
+					fmt.Printf("  - %s\n", s)
+				}
+			}
+			fmt.Printf(
+				"Subcomponents:     %d/%d found in SBOM (%.1f%%)\n",
+				len(res.Subcomponents)-len(res.MissingSubcomponents),
+				len(res.Subcomponents), res.Coverage(),
+			)
+			for _, s := range res.MissingSubcomponents {
+				fmt.Printf("  - missing: %s\n", s)
+			}
+			if len(res.Expired) > 0 {
+				verb := "warned"
+				if commandLineOpts.rejectExpired {
+					verb = "rejected"
+				}
+				fmt.Printf("Expired VEX:       %d outside of their validity window (%s)\n", len(res.Expired), verb)
+				for _, s := range res.Expired {
+					fmt.Printf("  - %s\n", s)
+				}
+			}
+
+			requirementsPassed := true
+			if reqs != nil {
+				reqsRes, err := checkRequirements(&opts, reqs, res.Documents, res.Signers)
+				if err != nil {
+					return err
+				}
+				requirementsPassed = reqsRes.Passed
+			}
+
+			if !res.PassedWithCoverage(opts.minCoverage) {
+				return withExitCode(exitValidation, errors.New("image failed SBOM/VEX verification"))
+			}
+			if !requirementsPassed {
+				return withExitCode(exitValidation, errors.New("image VEX data failed the requirements"))
+			}
+
+			if opts.outputDir != "" {
+				if err := writeVerifiedDocuments(opts.outputDir, res); err != nil {
+					return err
+				}
+			}
+			if opts.outputPath != "" {
+				doc, err := vexctl.Merge(cmd.Context(), &ctl.MergeOptions{}, res.Documents)
+				if err != nil {
+					return fmt.Errorf("merging verified documents: %w", err)
+				}
+				if err := writeDocument(opts.outputPath, doc); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	verifyCmd.PersistentFlags().Float64Var(
+		&opts.minCoverage,
+		"min-coverage",
+		100,
+		"minimum percentage of VEX subcomponents that must be listed in the SBOM",
+	)
+
+	verifyCmd.PersistentFlags().StringVar(
+		&opts.outputDir,
+		"output-dir",
+		"",
+		"directory to write the verified VEX documents to, one file per attestation",
+	)
+
+	addOutputFlag(verifyCmd, &opts.outputPath, "file to write the verified VEX documents to, merged into one document")
+
+	verifyCmd.PersistentFlags().StringVar(
+		&opts.bundle,
+		"bundle",
+		"",
+		"sigstore bundle to verify the VEX document passed as argument offline",
+	)
+
+	verifyCmd.PersistentFlags().StringVar(
+		&opts.trustedRoots,
+		"trusted-roots",
+		"",
+		"PEM file with the certificate authorities trusted to issue signing certificates",
+	)
+
+	verifyCmd.PersistentFlags().StringVar(
+		&opts.rekorPublicKey,
+		"rekor-public-key",
+		"",
+		"PEM file with the public key of the transparency log recorded in bundles",
+	)
+
+	verifyCmd.PersistentFlags().StringVar(
+		&opts.requirements,
+		"requirements",
+		"",
+		"YAML or JSON file with the requirements the verified VEX documents must meet",
+	)
+
+	verifyCmd.PersistentFlags().StringVar(
+		&opts.requirementsResult,
+		"requirements-result",
+		"",
+		"file to write the result of the requirements check to as JSON",
+	)
+
+	registerFlagCompletion(verifyCmd, "output", completeVEXFiles)
+	registerFlagCompletion(verifyCmd, "bundle", completeVEXFiles)
+
+	parentCmd.AddCommand(verifyCmd)
+}
+
+// verifyBundle verifies a VEX document from the sigstore bundle of its
+// attestation, without network access
+func verifyBundle(cmd *cobra.Command, opts *verifyOptions, args []string) error {
+	if len(args) != 1 {
+		return withExitCode(exitValidation, errors.New("the VEX document signed in the bundle is required"))
+	}
+	if opts.outputDir != "" {
+		return withExitCode(exitValidation, errors.New("--output-dir is not supported when verifying a bundle"))
+	}
+	reqs, err := opts.loadRequirements()
+	if err != nil {
+		return withExitCode(exitValidation, err)
+	}
+	cmd.SilenceUsage = true
+
+	bundleData, err := os.ReadFile(opts.bundle)
+	if err != nil {
+		return withExitCode(exitValidation, fmt.Errorf("reading bundle: %w", err))
+	}
+	docData, err := os.ReadFile(args[0])
+	if err != nil {
+		return withExitCode(exitValidation, fmt.Errorf("reading VEX document: %w", err))
+	}
+
+	res, err := newVexCtl().VerifyBundle(cmd.Context(), &ctl.BundleVerification{
+		AttestationVerification: commandLineOpts.verification,
+		TrustedRoots:            opts.trustedRoots,
+		RekorPublicKey:          opts.rekorPublicKey,
+	}, bundleData, docData)
+	if err != nil {
+		return withExitCode(exitValidation, fmt.Errorf("verifying bundle: %w", err))
+	}
+
+	fmt.Printf("Document:          %s\n", args[0])
+	fmt.Printf("Signer:            %s\n", res.Signer)
+	if !res.IntegratedTime.IsZero() {
+		fmt.Printf("Transparency log:  entry %d, %s\n", res.LogIndex, res.IntegratedTime.Format(time.RFC3339))
+	}
+	fmt.Printf("Statements:        %d\n", len(res.Document.Statements))
+
+	if reqs != nil {
+		reqsRes, err := checkRequirements(opts, reqs, []*vex.VEX{res.Document}, []string{res.Signer})
+		if err != nil {
+			return err
+		}
+		if !reqsRes.Passed {
+			return withExitCode(exitValidation, errors.New("VEX document failed the requirements"))
+		}
+	}
+
+	if opts.outputPath != "" {
+		return writeDocument(opts.outputPath, res.Document)
+	}
+	return nil
+}
+
+// writeVerifiedDocuments writes each VEX document found in the
+// attestations of an image to its own file in dir
+func writeVerifiedDocuments(dir string, res *ctl.ImageVerification) error {
+	if err := os.MkdirAll(dir, os.FileMode(0o755)); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	prefix := strings.TrimPrefix(res.Digest, "sha256:")
+	if len(prefix) > 12 {
+		prefix = prefix[:12]
+	}
+	for i, doc := range res.Documents {
+		path := filepath.Join(dir, fmt.Sprintf("%s-%d.vex.json", prefix, i+1))
+		if err := writeDocument(path, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDocument writes a VEX document to a file
+func writeDocument(path string, doc *vex.VEX) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating VEX file: %w", err)
+	}
+	defer f.Close()
+	if err := doc.ToJSON(f); err != nil {
+		return fmt.Errorf("writing VEX document: %w", err)
+	}
+	logrus.Infof("Wrote VEX document to %s", path)
+	return nil
+}
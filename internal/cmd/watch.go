@@ -0,0 +1,122 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+type watchOptions struct {
+	interval time.Duration
+	hook     string
+}
+
+// Validate checks the options in context with the arguments
+func (o *watchOptions) Validate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("an image reference is required")
+	}
+	if o.interval < time.Second {
+		return errors.New("the polling interval must be at least one second")
+	}
+	return nil
+}
+
+// runHook runs the hook command with the event in its environment. A
+// failing hook is logged and does not stop the watch.
+func (o *watchOptions) runHook(event *ctl.WatchEvent) {
+	c := exec.Command("sh", "-c", o.hook) //nolint:gosec // the hook is chosen by the user
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	c.Env = append(os.Environ(),
+		"VEXCTL_IMAGE="+event.Image,
+		"VEXCTL_DIGEST="+event.Digest,
+		"VEXCTL_ATTESTATIONS="+strings.Join(event.Attestations, ","),
+		"VEXCTL_ADDED="+strings.Join(event.Added, ","),
+		"VEXCTL_REMOVED="+strings.Join(event.Removed, ","),
+	)
+	if err := c.Run(); err != nil {
+		logrus.Warnf("Running hook: %v", err)
+	}
+}
+
+func addWatch(parentCmd *cobra.Command) {
+	opts := watchOptions{}
+	watchCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s watch: watch an image for new VEX attestations", appname),
+		Long: fmt.Sprintf(`%s watch: watch an image for new VEX attestations
+
+The watch subcommand polls a container image every --interval and prints a
+line each time VEX attestations are attached to or removed from it, or the
+image reference moves to a new digest. Watching stops on interrupt.
+
+To re-evaluate downstream artifacts automatically, pass a shell command
+with --exec. It runs on each change with these environment variables:
+
+  VEXCTL_IMAGE          the image reference being watched
+  VEXCTL_DIGEST         the digest the reference resolves to
+  VEXCTL_ATTESTATIONS   digests of the VEX attestations on the image
+  VEXCTL_ADDED          digests of the attestations attached since the last check
+  VEXCTL_REMOVED        digests of the attestations removed since the last check
+
+Changes are detected from the attestation digests only. Hooks that read
+the new VEX data should do it with verification, eg with %s filter.
+
+Examples:
+
+%s watch --interval=10m --exec='make rescan' cgr.dev/chainguard/nginx:latest
+
+`, appname, appname, appname),
+		Use:               "watch image_reference",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initCommand,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Validate(args); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+			cmd.SilenceUsage = true
+
+			return newVexCtl().Watch(cmd.Context(), args[0], opts.interval, func(event *ctl.WatchEvent) error {
+				fmt.Printf(
+					"%s %s@%s: %d VEX attestations (%d added, %d removed)\n",
+					time.Now().UTC().Format(time.RFC3339), event.Image, event.Digest,
+					len(event.Attestations), len(event.Added), len(event.Removed),
+				)
+				if opts.hook != "" {
+					opts.runHook(event)
+				}
+				return nil
+			})
+		},
+	}
+
+	watchCmd.PersistentFlags().DurationVar(
+		&opts.interval,
+		"interval",
+		5*time.Minute,
+		"time between checks of the image attestations",
+	)
+
+	watchCmd.PersistentFlags().StringVar(
+		&opts.hook,
+		"exec",
+		"",
+		"shell command to run when the VEX attestations change",
+	)
+
+	parentCmd.AddCommand(watchCmd)
+}
@@ -8,25 +8,82 @@ package attestation
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/crane"
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	ovattest "github.com/openvex/go-vex/pkg/attestation"
+	"github.com/openvex/go-vex/pkg/vex"
 	"github.com/sigstore/cosign/cmd/cosign/cli/options"
 	"github.com/sigstore/cosign/cmd/cosign/cli/sign"
 	"github.com/sigstore/sigstore/pkg/signature/dsse"
 	signatureoptions "github.com/sigstore/sigstore/pkg/signature/options"
+
+	"github.com/openvex/vexctl/pkg/sbom"
 )
 
 type Attestation struct {
 	signedData []byte `json:"-"`
 	ovattest.Attestation
 	Signed bool `json:"-"`
+
+	// Annotations are added to the attestation when it is attached to an image
+	Annotations map[string]string `json:"-"`
+
+	// Validity is the time window the VEX claims are valid in. It is
+	// recorded in the predicate so it is covered by the signature.
+	Validity *Validity `json:"-"`
+}
+
+// Predicate is the predicate of a VEX attestation: the OpenVEX document
+// and the validity window of the attestation, a member OpenVEX consumers
+// unaware of it ignore
+type Predicate struct {
+	vex.VEX
+	Validity *Validity `json:"validity,omitempty"`
+}
+
+// MarshalJSON encodes the in-toto statement with the validity
+// window in the predicate
+func (att Attestation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		intoto.StatementHeader
+		Predicate Predicate `json:"predicate"`
+	}{
+		StatementHeader: att.StatementHeader,
+		Predicate:       Predicate{VEX: att.Predicate, Validity: att.Validity},
+	})
+}
+
+// Validity limits the time an attestation is considered valid. A nil
+// bound leaves the window open on that side.
+type Validity struct {
+	NotBefore *time.Time `json:"notBefore,omitempty"`
+	NotAfter  *time.Time `json:"notAfter,omitempty"`
+}
+
+// Check returns an error when t falls outside the validity window
+func (v *Validity) Check(t time.Time) error {
+	if v == nil {
+		return nil
+	}
+	if v.NotBefore != nil && t.Before(*v.NotBefore) {
+		return fmt.Errorf("not valid before %s", v.NotBefore.Format(time.RFC3339))
+	}
+	if v.NotAfter != nil && t.After(*v.NotAfter) {
+		return fmt.Errorf("expired on %s", v.NotAfter.Format(time.RFC3339))
+	}
+	return nil
 }
 
 func New() *Attestation {
@@ -37,9 +94,7 @@ func New() *Attestation {
 }
 
 // Sign the attestation
-func (att *Attestation) Sign() error {
-	ctx := context.Background()
-	var timeout time.Duration /// TODO move to options
+func (att *Attestation) Sign(ctx context.Context) error {
 	var certPath, certChainPath string
 	ko := options.KeyOpts{
 		// KeyRef:     s.options.PrivateKeyPath,
@@ -54,12 +109,6 @@ func (att *Attestation) Sign() error {
 		// FulcioAuthFlow:           "",
 	}
 
-	if timeout != 0 {
-		var cancelFn context.CancelFunc
-		ctx, cancelFn = context.WithTimeout(ctx, timeout)
-		defer cancelFn()
-	}
-
 	sv, err := sign.SignerFromKeyOpts(ctx, certPath, certChainPath, ko)
 	if err != nil {
 		return fmt.Errorf("getting signer: %w", err)
@@ -86,6 +135,21 @@ func (att *Attestation) Sign() error {
 	return nil
 }
 
+// ImageSubject returns the subject identifying an image by the digest
+// its reference resolved to
+func ImageSubject(refString, digest string) intoto.Subject {
+	return intoto.Subject{
+		Name:   refString,
+		Digest: map[string]string{"sha256": strings.TrimPrefix(digest, "sha256:")},
+	}
+}
+
+// AddImageSubjects adds images as subjects, resolving their digests
+// directly from the registry.
+//
+// Deprecated: registry mirrors and credentials are not honored, use
+// ImageSubject with the digests resolved by the client and AddSubjects,
+// or ctl.VexCtl.AttestDocuments.
 func (att *Attestation) AddImageSubjects(imageRefs []string) error {
 	subs := []intoto.Subject{}
 	for _, refString := range imageRefs {
@@ -93,18 +157,79 @@ func (att *Attestation) AddImageSubjects(imageRefs []string) error {
 		if err != nil {
 			return fmt.Errorf("getting image digest: %w", err)
 		}
-		s := intoto.Subject{
-			Name:   refString,
-			Digest: map[string]string{"sha256": strings.TrimPrefix(digest, "sha256:")},
-		}
-
-		subs = append(subs, s)
+		subs = append(subs, ImageSubject(refString, digest))
 	}
-
 	if err := att.AddSubjects(subs); err != nil {
 		return fmt.Errorf("adding image subjects to attestation: %w", err)
 	}
+	return nil
+}
 
+// AddSBOMSubjects adds the artifacts described by an SBOM as subjects
+func (att *Attestation) AddSBOMSubjects(s *sbom.SBOM) error {
+	if len(s.Described) == 0 {
+		return errors.New("SBOM does not describe any artifacts with digests")
+	}
+	subs := []intoto.Subject{}
+	for _, a := range s.Described {
+		subs = append(subs, intoto.Subject{
+			Name:   a.Name,
+			Digest: a.Digests,
+		})
+	}
+	if err := att.AddSubjects(subs); err != nil {
+		return fmt.Errorf("adding SBOM subjects to attestation: %w", err)
+	}
+	return nil
+}
+
+// DigestAlgorithms are the algorithms supported to compute subject digests
+var DigestAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// AddFileSubjects adds files as subjects, identified by their digests
+// computed with the algorithms passed. Without algorithms, only their
+// SHA-256 digest is recorded.
+func (att *Attestation) AddFileSubjects(paths []string, algorithms ...string) error {
+	if len(algorithms) == 0 {
+		algorithms = []string{"sha256"}
+	}
+	for _, a := range algorithms {
+		if _, ok := DigestAlgorithms[a]; !ok {
+			return fmt.Errorf("unsupported digest algorithm %q", a)
+		}
+	}
+	subs := []intoto.Subject{}
+	for _, path := range paths {
+		hashes := map[string]hash.Hash{}
+		writers := []io.Writer{}
+		for _, a := range algorithms {
+			hashes[a] = DigestAlgorithms[a]()
+			writers = append(writers, hashes[a])
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("opening artifact: %w", err)
+		}
+		_, err = io.Copy(io.MultiWriter(writers...), f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("hashing %s: %w", path, err)
+		}
+		digests := map[string]string{}
+		for a, h := range hashes {
+			digests[a] = fmt.Sprintf("%x", h.Sum(nil))
+		}
+		subs = append(subs, intoto.Subject{
+			Name:   filepath.Base(path),
+			Digest: digests,
+		})
+	}
+	if err := att.AddSubjects(subs); err != nil {
+		return fmt.Errorf("adding file subjects to attestation: %w", err)
+	}
 	return nil
 }
 
@@ -112,7 +237,16 @@ func (att *Attestation) AddImageSubjects(imageRefs []string) error {
 // writes the signed data to io.Writer w instead of the original attestation.
 func (att *Attestation) ToJSON(w io.Writer) error {
 	if !att.Signed {
-		return att.Attestation.ToJSON(w)
+		// The statement is encoded here rather than by the openvex
+		// attestation so that the validity window is included
+		// in the predicate
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(att); err != nil {
+			return fmt.Errorf("encoding attestation: %w", err)
+		}
+		return nil
 	}
 	if len(att.signedData) == 0 {
 		return errors.New("consistency error: attestation is signed but data is empty")
@@ -0,0 +1,337 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/openvex/go-vex/pkg/vex"
+	ssldsse "github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/sigstore/cosign/cmd/cosign/cli/fulcio"
+	"github.com/sigstore/cosign/pkg/cosign"
+	sigs "github.com/sigstore/cosign/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/dsse"
+)
+
+// BundleVerification configures the offline verification of a VEX
+// attestation from a sigstore bundle. The trusted material defaults to the
+// sigstore public good instance, read from the local TUF metadata.
+type BundleVerification struct {
+	AttestationVerification
+
+	// TrustedRoots is a PEM file with the certificate authorities
+	// trusted to issue the signing certificates
+	TrustedRoots string
+
+	// RekorPublicKey is a PEM file with the public key of the
+	// transparency log that signed the bundle entries
+	RekorPublicKey string
+}
+
+// BundleResult describes a verified VEX attestation bundle
+type BundleResult struct {
+	Document       *vex.VEX  // VEX document attested in the bundle
+	Signer         string    // Identity in the signing certificate, or key:<reference> when verified with a key
+	IntegratedTime time.Time // Time the attestation was recorded in the transparency log
+	LogIndex       int64     // Index of the transparency log entry
+}
+
+// rekorIntotoBody holds the fields of an intoto transparency log entry
+// used to tie it to the signed envelope
+type rekorIntotoBody struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Content struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"content"`
+	} `json:"spec"`
+}
+
+// VerifyBundle verifies the DSSE signature, signing certificate and
+// transparency log proof of a VEX attestation recorded in a bundle, as
+// written by cosign attest-blob --bundle, without contacting any service.
+// The attestation has to be about the VEX document in docData, either
+// embedding it as its predicate or listing its digest as a subject.
+func (vexctl *VexCtl) VerifyBundle(
+	ctx context.Context, bv *BundleVerification, bundleData, docData []byte,
+) (*BundleResult, error) {
+	if bv.Insecure {
+		return nil, errors.New("bundles cannot be verified insecurely")
+	}
+	if err := bv.Validate(); err != nil {
+		return nil, err
+	}
+
+	bundle := cosign.LocalSignedPayload{}
+	if err := json.Unmarshal(bundleData, &bundle); err != nil {
+		return nil, fmt.Errorf("parsing bundle: %w", err)
+	}
+	envelopeData, err := base64.StdEncoding.DecodeString(bundle.Base64Signature)
+	if err != nil {
+		return nil, fmt.Errorf("decoding signed envelope: %w", err)
+	}
+	env := ssldsse.Envelope{}
+	if err := json.Unmarshal(envelopeData, &env); err != nil {
+		return nil, fmt.Errorf("parsing signed envelope: %w", err)
+	}
+	if env.PayloadType != IntotoPayloadType {
+		return nil, fmt.Errorf("signed envelope does not contain an in-toto attestation (%s)", env.PayloadType)
+	}
+
+	res := &BundleResult{}
+	var cert *x509.Certificate
+	var verifier signature.Verifier
+	if bv.Key != "" {
+		verifier, err = sigs.PublicKeyFromKeyRef(ctx, bv.Key)
+		if err != nil {
+			return nil, fmt.Errorf("loading public key: %w", err)
+		}
+	} else {
+		cert, err = bundleCertificate(bundle.Cert)
+		if err != nil {
+			return nil, err
+		}
+		co := &cosign.CheckOpts{
+			CertIdentity:   bv.CertificateIdentity,
+			CertOidcIssuer: bv.CertificateOIDCIssuer,
+		}
+		if co.RootCerts, co.IntermediateCerts, err = bv.certPools(); err != nil {
+			return nil, err
+		}
+		verifier, err = cosign.ValidateAndUnpackCert(cert, co)
+		if err != nil {
+			return nil, fmt.Errorf("verifying signing certificate: %w", err)
+		}
+	}
+	res.Signer = bv.signerIdentity(cert)
+
+	dssev, err := ssldsse.NewEnvelopeVerifier(&dsse.VerifierAdapter{SignatureVerifier: verifier})
+	if err != nil {
+		return nil, fmt.Errorf("creating envelope verifier: %w", err)
+	}
+	if _, err := dssev.Verify(&env); err != nil {
+		return nil, fmt.Errorf("verifying envelope signature: %w", err)
+	}
+
+	// Certificates are short lived, the transparency log proves
+	// the signature was made while the certificate was valid
+	switch {
+	case bundle.Bundle != nil:
+		if err := bv.verifyRekorBundle(ctx, &bundle, envelopeData, cert, res); err != nil {
+			return nil, err
+		}
+	case cert != nil:
+		return nil, errors.New("the bundle has no transparency log entry to verify the certificate with")
+	}
+
+	res.Document, err = bundleDocument(env, docData)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// certPools returns the root and intermediate certificate authorities
+// trusted to issue signing certificates
+func (bv *BundleVerification) certPools() (roots, intermediates *x509.CertPool, err error) {
+	if bv.TrustedRoots == "" {
+		if roots, err = fulcio.GetRoots(); err != nil {
+			return nil, nil, fmt.Errorf("getting fulcio roots: %w", err)
+		}
+		if intermediates, err = fulcio.GetIntermediates(); err != nil {
+			return nil, nil, fmt.Errorf("getting fulcio intermediates: %w", err)
+		}
+		return roots, intermediates, nil
+	}
+
+	data, err := os.ReadFile(bv.TrustedRoots)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading trusted roots: %w", err)
+	}
+	certs, err := cryptoutils.UnmarshalCertificatesFromPEM(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing trusted roots: %w", err)
+	}
+	roots = x509.NewCertPool()
+	intermediates = x509.NewCertPool()
+	for _, c := range certs {
+		if c.CheckSignatureFrom(c) == nil {
+			roots.AddCert(c)
+		} else {
+			intermediates.AddCert(c)
+		}
+	}
+	return roots, intermediates, nil
+}
+
+// rekorPublicKeys returns the public keys of the transparency logs
+// trusted to sign bundle entries, keyed by log ID
+func (bv *BundleVerification) rekorPublicKeys(ctx context.Context) (map[string]*ecdsa.PublicKey, error) {
+	keys := map[string]*ecdsa.PublicKey{}
+	if bv.RekorPublicKey == "" {
+		pubs, err := cosign.GetRekorPubs(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("getting rekor public keys: %w", err)
+		}
+		for id, pub := range pubs {
+			keys[id] = pub.PubKey
+		}
+		return keys, nil
+	}
+
+	data, err := os.ReadFile(bv.RekorPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("reading rekor public key: %w", err)
+	}
+	pub, err := cosign.PemToECDSAKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing rekor public key: %w", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling rekor public key: %w", err)
+	}
+	id := sha256.Sum256(der)
+	keys[hex.EncodeToString(id[:])] = pub
+	return keys, nil
+}
+
+// verifyRekorBundle checks the signed entry timestamp of the transparency
+// log entry in the bundle and that the entry records the signed envelope
+func (bv *BundleVerification) verifyRekorBundle(
+	ctx context.Context, bundle *cosign.LocalSignedPayload, envelopeData []byte, cert *x509.Certificate, res *BundleResult,
+) error {
+	keys, err := bv.rekorPublicKeys(ctx)
+	if err != nil {
+		return err
+	}
+	pub, ok := keys[bundle.Bundle.Payload.LogID]
+	if !ok {
+		return fmt.Errorf("transparency log %s is not trusted", bundle.Bundle.Payload.LogID)
+	}
+	if err := cosign.VerifySET(bundle.Bundle.Payload, bundle.Bundle.SignedEntryTimestamp, pub); err != nil {
+		return fmt.Errorf("verifying transparency log entry: %w", err)
+	}
+
+	encodedBody, ok := bundle.Bundle.Payload.Body.(string)
+	if !ok {
+		return errors.New("invalid transparency log entry body")
+	}
+	bodyData, err := base64.StdEncoding.DecodeString(encodedBody)
+	if err != nil {
+		return fmt.Errorf("decoding transparency log entry: %w", err)
+	}
+	body := rekorIntotoBody{}
+	if err := json.Unmarshal(bodyData, &body); err != nil {
+		return fmt.Errorf("parsing transparency log entry: %w", err)
+	}
+	hash := sha256.Sum256(envelopeData)
+	if body.Kind != "intoto" || body.Spec.Content.Hash.Algorithm != "sha256" ||
+		body.Spec.Content.Hash.Value != hex.EncodeToString(hash[:]) {
+		return errors.New("the transparency log entry does not record the signed envelope")
+	}
+
+	res.IntegratedTime = time.Unix(bundle.Bundle.Payload.IntegratedTime, 0).UTC()
+	res.LogIndex = bundle.Bundle.Payload.LogIndex
+	if cert != nil {
+		if err := cosign.CheckExpiry(cert, res.IntegratedTime); err != nil {
+			return fmt.Errorf("checking certificate validity: %w", err)
+		}
+	}
+	return nil
+}
+
+// bundleCertificate parses the signing certificate of a bundle, which
+// cosign stores as base64 encoded PEM
+func bundleCertificate(data string) (*x509.Certificate, error) {
+	if data == "" {
+		return nil, errors.New("the bundle has no signing certificate, verify it with --key")
+	}
+	pem := []byte(data)
+	if !strings.HasPrefix(data, "-----BEGIN") {
+		var err error
+		if pem, err = base64.StdEncoding.DecodeString(data); err != nil {
+			return nil, fmt.Errorf("decoding signing certificate: %w", err)
+		}
+	}
+	certs, err := cryptoutils.UnmarshalCertificatesFromPEM(pem)
+	if err != nil {
+		return nil, fmt.Errorf("parsing signing certificate: %w", err)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no signing certificate found in the bundle")
+	}
+	return certs[0], nil
+}
+
+// bundleDocument checks that the attestation in a verified envelope is
+// about the VEX document and returns it
+func bundleDocument(env ssldsse.Envelope, docData []byte) (*vex.VEX, error) {
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("decoding attestation: %w", err)
+	}
+	statement := struct {
+		intoto.StatementHeader
+		Predicate json.RawMessage `json:"predicate"`
+	}{}
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return nil, fmt.Errorf("parsing attestation: %w", err)
+	}
+
+	doc := &vex.VEX{}
+	if err := json.Unmarshal(docData, doc); err != nil {
+		return nil, fmt.Errorf("parsing VEX document: %w", err)
+	}
+
+	// The document can be attested as a file subject, eg by cosign attest-blob
+	digest := sha256.Sum256(docData)
+	for _, s := range statement.Subject {
+		if s.Digest["sha256"] == hex.EncodeToString(digest[:]) {
+			return doc, nil
+		}
+	}
+
+	// or be the predicate of the attestation
+	if statement.PredicateType != vex.TypeURI {
+		return nil, errors.New("the attestation is not about the VEX document")
+	}
+	// Both are compared once normalized, as the JSON formatting differs
+	predicate := &vex.VEX{}
+	if err := json.Unmarshal(statement.Predicate, predicate); err != nil {
+		return nil, fmt.Errorf("parsing VEX predicate: %w", err)
+	}
+	predicateData, err := json.Marshal(predicate)
+	if err != nil {
+		return nil, fmt.Errorf("normalizing VEX predicate: %w", err)
+	}
+	normalizedDoc, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("normalizing VEX document: %w", err)
+	}
+	if !bytes.Equal(predicateData, normalizedDoc) {
+		return nil, errors.New("the attested VEX data does not match the document")
+	}
+	return doc, nil
+}
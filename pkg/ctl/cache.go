@@ -0,0 +1,114 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// registryCache is a persistent cache of registry lookups. Entries are
+// stored as JSON files in a directory and expire after a TTL.
+type registryCache struct {
+	dir     string
+	ttl     time.Duration
+	metrics *Metrics
+}
+
+type cacheEntry struct {
+	Created time.Time       `json:"created"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// newRegistryCache returns a cache configured from the options or
+// nil if caching is disabled
+func newRegistryCache(opts Options) *registryCache {
+	if opts.CacheTTL <= 0 {
+		return nil
+	}
+	dir := opts.CacheDir
+	if dir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			logrus.Warnf("Unable to determine cache directory, caching disabled: %v", err)
+			return nil
+		}
+		dir = filepath.Join(userCache, "vexctl")
+	}
+	return &registryCache{dir: dir, ttl: opts.CacheTTL, metrics: opts.Metrics}
+}
+
+func (c *registryCache) path(key string) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(key))))
+}
+
+// get reads a cached value into v. It returns false if the
+// entry does not exist or has expired.
+func (c *registryCache) get(key string, v interface{}) bool {
+	if c == nil {
+		return false
+	}
+	hit := false
+	defer func() { c.metrics.cacheLookup(hit) }()
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return false
+	}
+	entry := cacheEntry{}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return false
+	}
+	if time.Since(entry.Created) > c.ttl {
+		return false
+	}
+	if err := json.Unmarshal(entry.Data, v); err != nil {
+		return false
+	}
+	logrus.WithField("key", key).Debug("Registry cache hit")
+	hit = true
+	return true
+}
+
+// set stores v in the cache. Failing to write the cache is not
+// fatal, errors are only logged.
+func (c *registryCache) set(key string, v interface{}) {
+	if c == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		logrus.Warnf("Unable to serialize cache entry: %v", err)
+		return
+	}
+	entry, err := json.Marshal(cacheEntry{Created: time.Now(), Data: data})
+	if err != nil {
+		logrus.Warnf("Unable to serialize cache entry: %v", err)
+		return
+	}
+	if err := os.MkdirAll(c.dir, os.FileMode(0o755)); err != nil {
+		logrus.Warnf("Unable to create cache directory: %v", err)
+		return
+	}
+	if err := os.WriteFile(c.path(key), entry, os.FileMode(0o644)); err != nil {
+		logrus.Warnf("Unable to write cache entry: %v", err)
+	}
+}
+
+// invalidate removes an entry from the cache
+func (c *registryCache) invalidate(key string) {
+	if c == nil {
+		return
+	}
+	if err := os.Remove(c.path(key)); err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("Unable to remove cache entry: %v", err)
+	}
+}
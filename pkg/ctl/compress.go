@@ -0,0 +1,93 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+)
+
+// maxDecompressedSize limits the size of decompressed VEX documents
+const maxDecompressedSize = 1 << 30
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompressedPath returns the path of a file with the contents of path
+// decompressed. Gzip and zstd files are detected by their magic bytes or
+// their extension. If the file is not compressed, path is returned as is.
+// The returned function removes any temporary file created.
+func decompressedPath(path string) (string, func(), error) {
+	noop := func() {}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", noop, fmt.Errorf("opening file: %w", err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	header, err := br.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", noop, fmt.Errorf("reading file header: %w", err)
+	}
+
+	var r io.Reader
+	switch {
+	case bytes.HasPrefix(header, gzipMagic) || strings.HasSuffix(path, ".gz"):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return "", noop, fmt.Errorf("opening gzip stream: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	case bytes.HasPrefix(header, zstdMagic) || strings.HasSuffix(path, ".zst"):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return "", noop, fmt.Errorf("opening zstd stream: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return path, noop, nil
+	}
+
+	// Keep the original extension so that the document format can
+	// still be inferred from the file name
+	base := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".gz"), ".zst")
+	tmp, err := os.CreateTemp("", "vex-*-"+base)
+	if err != nil {
+		return "", noop, fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer tmp.Close()
+	cleanup := func() { os.Remove(tmp.Name()) }
+
+	n, err := io.Copy(tmp, io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		cleanup()
+		return "", noop, fmt.Errorf("decompressing %s: %w", path, err)
+	}
+	if n > maxDecompressedSize {
+		cleanup()
+		return "", noop, fmt.Errorf("decompressed %s exceeds the maximum size of %d bytes", path, maxDecompressedSize)
+	}
+	logrus.WithFields(logrus.Fields{
+		"path": path,
+		"size": n,
+	}).Debug("Decompressed VEX document")
+	return tmp.Name(), cleanup, nil
+}
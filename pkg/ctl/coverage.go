@@ -0,0 +1,91 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"sort"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// StatementRef identifies a statement in a VEX document
+type StatementRef struct {
+	Document      string     `json:"document"`
+	Vulnerability string     `json:"vulnerability"`
+	Status        vex.Status `json:"status"`
+	Products      []string   `json:"products"`
+}
+
+// CoverageReport relates the statements in a set of VEX documents to the
+// results of a scanner report, to find dead or missing statements
+type CoverageReport struct {
+	// Matched are the statements about vulnerabilities found in the report
+	Matched []StatementRef `json:"matched"`
+
+	// Unused are the statements about vulnerabilities not in the report
+	Unused []StatementRef `json:"unused"`
+
+	// Uncovered are the vulnerabilities in the report without statements
+	Uncovered []string `json:"uncovered"`
+}
+
+// Coverage computes which statements of the VEX documents match results in
+// a report, which ones are unused and which results have no statement. It
+// has to be called before applying the documents, as Apply removes the
+// suppressed results from the report.
+func (vexctl *VexCtl) Coverage(report *sarif.Report, vexDocs []*vex.VEX) *CoverageReport {
+	found := reportVulnerabilities(report)
+
+	coverage := &CoverageReport{
+		Matched:   []StatementRef{},
+		Unused:    []StatementRef{},
+		Uncovered: []string{},
+	}
+	covered := map[string]struct{}{}
+	for _, doc := range vexDocs {
+		for i := range doc.Statements {
+			s := &doc.Statements[i]
+			ref := StatementRef{
+				Document:      doc.ID,
+				Vulnerability: s.Vulnerability,
+				Status:        s.Status,
+				Products:      s.Products,
+			}
+			if _, ok := found[s.Vulnerability]; ok {
+				coverage.Matched = append(coverage.Matched, ref)
+				covered[s.Vulnerability] = struct{}{}
+			} else {
+				coverage.Unused = append(coverage.Unused, ref)
+			}
+		}
+	}
+
+	for id := range found {
+		if _, ok := covered[id]; !ok {
+			coverage.Uncovered = append(coverage.Uncovered, id)
+		}
+	}
+	sort.Strings(coverage.Uncovered)
+	return coverage
+}
+
+// reportVulnerabilities returns the IDs of the
+// vulnerabilities with results in a report
+func reportVulnerabilities(report *sarif.Report) map[string]struct{} {
+	found := map[string]struct{}{}
+	for _, run := range report.Runs {
+		for _, res := range run.Results {
+			if res.RuleID == nil {
+				continue
+			}
+			if m := cveRegexp.FindStringSubmatch(*res.RuleID); len(m) == 2 {
+				found[m[1]] = struct{}{}
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"net/url"
+	"strings"
+)
+
+// cpeAttributes is the number of attributes in a CPE name:
+// part, vendor, product, version, update, edition, language,
+// sw_edition, target_sw, target_hw and other
+const cpeAttributes = 11
+
+// parseCPE splits a CPE name, either a CPE 2.3 formatted string
+// (cpe:2.3:a:vendor:product:version:...) or a CPE 2.2 URI
+// (cpe:/a:vendor:product:version), into its attributes. Attributes
+// missing from the name are returned as the ANY value "*". It returns
+// false if the string is not a CPE name.
+func parseCPE(s string) ([]string, bool) {
+	var attrs []string
+	switch {
+	case strings.HasPrefix(s, "cpe:2.3:"):
+		attrs = splitCPE(strings.TrimPrefix(s, "cpe:2.3:"))
+		if len(attrs) != cpeAttributes {
+			return nil, false
+		}
+	case strings.HasPrefix(s, "cpe:/"):
+		attrs = strings.Split(strings.TrimPrefix(s, "cpe:/"), ":")
+		if len(attrs) > 7 {
+			return nil, false
+		}
+		for i := range attrs {
+			attrs[i], _ = url.PathUnescape(attrs[i])
+			if attrs[i] == "" {
+				attrs[i] = "*"
+			}
+		}
+	default:
+		return nil, false
+	}
+	for len(attrs) < cpeAttributes {
+		attrs = append(attrs, "*")
+	}
+	for i := range attrs {
+		attrs[i] = strings.ToLower(attrs[i])
+	}
+	if attrs[0] == "*" {
+		return nil, false
+	}
+	return attrs, true
+}
+
+// splitCPE splits a CPE 2.3 formatted string on the colons not
+// escaped with a backslash, removing the escaping
+func splitCPE(s string) []string {
+	attrs := []string{}
+	var sb strings.Builder
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			sb.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ':':
+			attrs = append(attrs, sb.String())
+			sb.Reset()
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return append(attrs, sb.String())
+}
+
+// cpeMatches returns true if a CPE name in a statement applies to the
+// CPE name of a product. Each attribute of the statement CPE has to be
+// ANY ("*") or equal to the one in the product, ignoring case.
+func cpeMatches(statementCPE, productCPE []string) bool {
+	for i := range statementCPE {
+		if statementCPE[i] != "*" && statementCPE[i] != productCPE[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,371 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// csafDocument holds the parts of a CSAF 2.0 or 2.1 document needed
+// to translate its vulnerabilities to OpenVEX statements
+type csafDocument struct {
+	Document struct {
+		CSAFVersion string `json:"csaf_version"`
+		Publisher   struct {
+			Category string `json:"category"`
+			Name     string `json:"name"`
+		} `json:"publisher"`
+		Tracking struct {
+			ID                 string `json:"id"`
+			CurrentReleaseDate string `json:"current_release_date"`
+			Version            string `json:"version"`
+		} `json:"tracking"`
+	} `json:"document"`
+	ProductTree struct {
+		Branches         []csafBranch       `json:"branches"`
+		FullProductNames []csafProduct      `json:"full_product_names"`
+		Relationships    []csafRelationship `json:"relationships"`
+		ProductGroups    []struct {
+			GroupID    string   `json:"group_id"`
+			ProductIDs []string `json:"product_ids"`
+		} `json:"product_groups"`
+	} `json:"product_tree"`
+	Vulnerabilities []csafVulnerability `json:"vulnerabilities"`
+}
+
+type csafBranch struct {
+	Product  *csafProduct `json:"product"`
+	Branches []csafBranch `json:"branches"`
+}
+
+type csafProduct struct {
+	ProductID string `json:"product_id"`
+	Name      string `json:"name"`
+	Helper    *struct {
+		PURL  string   `json:"purl"`
+		PURLs []string `json:"purls"` // CSAF 2.1
+		CPE   string   `json:"cpe"`
+	} `json:"product_identification_helper"`
+}
+
+type csafRelationship struct {
+	ProductReference          string      `json:"product_reference"`
+	RelatesToProductReference string      `json:"relates_to_product_reference"`
+	FullProductName           csafProduct `json:"full_product_name"`
+}
+
+// csafProductRefs are the lists of products and
+// product groups flags, threats and remediations apply to
+type csafProductRefs struct {
+	ProductIDs []string `json:"product_ids"`
+	GroupIDs   []string `json:"group_ids"`
+}
+
+type csafVulnerability struct {
+	CVE string `json:"cve"`
+	IDs []struct {
+		Text string `json:"text"`
+	} `json:"ids"`
+	ProductStatus map[string][]string `json:"product_status"`
+	Flags         []struct {
+		csafProductRefs
+		Label string `json:"label"`
+	} `json:"flags"`
+	Threats []struct {
+		csafProductRefs
+		Category string `json:"category"`
+		Details  string `json:"details"`
+	} `json:"threats"`
+	Remediations []struct {
+		csafProductRefs
+		Details string `json:"details"`
+	} `json:"remediations"`
+}
+
+// csafStatuses maps the product status groups of CSAF to OpenVEX
+// statuses, in the order they are translated. Recommended products
+// are not translated as the group does not assess the vulnerability.
+var csafStatuses = []struct {
+	group  string
+	status vex.Status
+}{
+	{"known_not_affected", vex.StatusNotAffected},
+	{"fixed", vex.StatusFixed},
+	{"first_fixed", vex.StatusFixed},
+	{"known_affected", vex.StatusAffected},
+	{"first_affected", vex.StatusAffected},
+	{"last_affected", vex.StatusAffected},
+	{"under_investigation", vex.StatusUnderInvestigation},
+}
+
+// identifier returns the identifier used for a product in OpenVEX
+// statements: its package URL or CPE if known, otherwise its CSAF ID
+func (p *csafProduct) identifier() string {
+	if p.Helper != nil {
+		switch {
+		case p.Helper.PURL != "":
+			return p.Helper.PURL
+		case len(p.Helper.PURLs) > 0:
+			return p.Helper.PURLs[0]
+		case p.Helper.CPE != "":
+			return p.Helper.CPE
+		}
+	}
+	return p.ProductID
+}
+
+// csafResolvedProduct is a CSAF product ID resolved through the
+// product tree. Products defined by a relationship, like a component
+// shipped in a platform, are the platform with the component as
+// subcomponent.
+type csafResolvedProduct struct {
+	ids          []string // CSAF IDs that select the product
+	product      string
+	subcomponent string
+}
+
+// csafResolver resolves the product IDs and groups of a CSAF document
+type csafResolver struct {
+	products map[string]*csafResolvedProduct
+	groups   map[string][]string
+}
+
+func newCSAFResolver(doc *csafDocument) *csafResolver {
+	r := &csafResolver{
+		products: map[string]*csafResolvedProduct{},
+		groups:   map[string][]string{},
+	}
+	add := func(p *csafProduct) {
+		if p.ProductID != "" {
+			r.products[p.ProductID] = &csafResolvedProduct{ids: []string{p.ProductID}, product: p.identifier()}
+		}
+	}
+	var walk func([]csafBranch)
+	walk = func(branches []csafBranch) {
+		for i := range branches {
+			if branches[i].Product != nil {
+				add(branches[i].Product)
+			}
+			walk(branches[i].Branches)
+		}
+	}
+	walk(doc.ProductTree.Branches)
+	for i := range doc.ProductTree.FullProductNames {
+		add(&doc.ProductTree.FullProductNames[i])
+	}
+
+	for _, rel := range doc.ProductTree.Relationships {
+		id := rel.FullProductName.ProductID
+		if id == "" {
+			continue
+		}
+		rp := &csafResolvedProduct{
+			ids:          []string{id, rel.RelatesToProductReference},
+			product:      rel.RelatesToProductReference,
+			subcomponent: rel.ProductReference,
+		}
+		if platform, ok := r.products[rel.RelatesToProductReference]; ok {
+			rp.product = platform.product
+		}
+		if component, ok := r.products[rel.ProductReference]; ok {
+			rp.subcomponent = component.product
+		}
+		r.products[id] = rp
+	}
+
+	for _, g := range doc.ProductTree.ProductGroups {
+		r.groups[g.GroupID] = g.ProductIDs
+	}
+	return r
+}
+
+// resolve returns the product a CSAF product ID refers to
+func (r *csafResolver) resolve(id string) *csafResolvedProduct {
+	if p, ok := r.products[id]; ok {
+		return p
+	}
+	return &csafResolvedProduct{ids: []string{id}, product: id}
+}
+
+// appliesTo returns true if a list of products and groups includes a product ID
+func (r *csafResolver) appliesTo(refs *csafProductRefs, id string) bool {
+	for _, pid := range refs.ProductIDs {
+		if pid == id {
+			return true
+		}
+	}
+	for _, gid := range refs.GroupIDs {
+		for _, pid := range r.groups[gid] {
+			if pid == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selected returns true if a product is one of the products selected,
+// by its CSAF ID or by its identifier. All products are selected when
+// the list is empty.
+func (p *csafResolvedProduct) selected(products []string) bool {
+	if len(products) == 0 {
+		return true
+	}
+	for _, s := range products {
+		if productMatches(p.product, s) {
+			return true
+		}
+		for _, id := range p.ids {
+			if id == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseCSAF translates a CSAF 2.0 or 2.1 VEX document to OpenVEX. The
+// product IDs in its product status groups are resolved through the
+// product tree to their package URLs or CPEs, and the justifications,
+// impact and action statements are read from the flags, threats and
+// remediations of each product. Statements that only differ in their
+// products are combined. If products are passed, either as CSAF IDs or
+// identifiers, only the statements about them are translated.
+func ParseCSAF(data []byte, products []string) (*vex.VEX, error) {
+	return parseCSAF(data, products, nil)
+}
+
+// ParseCSAFLenient translates a CSAF document like ParseCSAF, skipping
+// the vulnerabilities that are malformed or have no identifier and
+// recording them in warnings
+func ParseCSAFLenient(data []byte, products []string, warnings *ParseWarnings) (*vex.VEX, error) {
+	return parseCSAF(data, products, warnings)
+}
+
+// parseCSAF translates a CSAF document, in lenient mode when warnings is set
+func parseCSAF(data []byte, products []string, warnings *ParseWarnings) (*vex.VEX, error) {
+	doc := &csafDocument{}
+	if warnings == nil {
+		if err := json.Unmarshal(data, doc); err != nil {
+			return nil, fmt.Errorf("parsing CSAF document: %w", err)
+		}
+	} else {
+		raw := struct {
+			csafDocument
+			Vulnerabilities []json.RawMessage `json:"vulnerabilities"`
+		}{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("parsing CSAF document: %w", err)
+		}
+		*doc = raw.csafDocument
+		for i, rv := range raw.Vulnerabilities {
+			vuln := csafVulnerability{}
+			if err := json.Unmarshal(rv, &vuln); err != nil {
+				warnings.Add("%s: skipped vulnerability %d: %v", doc.Document.Tracking.ID, i, err)
+				continue
+			}
+			doc.Vulnerabilities = append(doc.Vulnerabilities, vuln)
+		}
+	}
+	switch doc.Document.CSAFVersion {
+	case "2.0", "2.1":
+	case "":
+		return nil, errors.New("document is not a CSAF document")
+	default:
+		return nil, fmt.Errorf("unsupported CSAF version %s", doc.Document.CSAFVersion)
+	}
+
+	v := vex.New()
+	v.ID = doc.Document.Tracking.ID
+	v.Author = doc.Document.Publisher.Name
+	v.AuthorRole = doc.Document.Publisher.Category
+	v.Version = doc.Document.Tracking.Version
+	if doc.Document.Tracking.CurrentReleaseDate != "" {
+		ts, err := time.Parse(time.RFC3339, doc.Document.Tracking.CurrentReleaseDate)
+		if err != nil {
+			return nil, fmt.Errorf("parsing document release date: %w", err)
+		}
+		v.Timestamp = &ts
+	}
+
+	resolver := newCSAFResolver(doc)
+	for i := range doc.Vulnerabilities {
+		vuln := &doc.Vulnerabilities[i]
+		id := vuln.CVE
+		if id == "" && len(vuln.IDs) > 0 {
+			id = vuln.IDs[0].Text
+		}
+		if id == "" {
+			if warnings != nil {
+				warnings.Add("%s: skipped vulnerability %d: no identifier", doc.Document.Tracking.ID, i)
+				continue
+			}
+			return nil, fmt.Errorf("vulnerability %d has no identifier", i)
+		}
+
+		statements := map[string]int{}
+		for _, group := range csafStatuses {
+			for _, pid := range vuln.ProductStatus[group.group] {
+				product := resolver.resolve(pid)
+				if !product.selected(products) {
+					continue
+				}
+				s := vex.Statement{Vulnerability: id, Status: group.status}
+				if product.subcomponent != "" {
+					s.Subcomponents = []string{product.subcomponent}
+				}
+				switch group.status {
+				case vex.StatusNotAffected:
+					for _, f := range vuln.Flags {
+						if resolver.appliesTo(&f.csafProductRefs, pid) {
+							s.Justification = vex.Justification(f.Label)
+						}
+					}
+					for _, t := range vuln.Threats {
+						if t.Category == "impact" && resolver.appliesTo(&t.csafProductRefs, pid) {
+							s.ImpactStatement = t.Details
+						}
+					}
+				case vex.StatusAffected:
+					for _, r := range vuln.Remediations {
+						if s.ActionStatement == "" && resolver.appliesTo(&r.csafProductRefs, pid) {
+							s.ActionStatement = r.Details
+						}
+					}
+					if s.ActionStatement == "" {
+						s.ActionStatement = vex.NoActionStatementMsg
+					}
+				}
+
+				// Statements only differing in their products are combined
+				key := fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%v", s.Status, s.Justification, s.ImpactStatement, s.ActionStatement, s.Subcomponents)
+				if j, ok := statements[key]; ok {
+					v.Statements[j].Products = appendMissing(v.Statements[j].Products, product.product)
+					continue
+				}
+				s.Products = []string{product.product}
+				statements[key] = len(v.Statements)
+				v.Statements = append(v.Statements, s)
+			}
+		}
+	}
+	return &v, nil
+}
+
+// openCSAF reads a CSAF document from a file and translates it to OpenVEX
+func openCSAF(path string, products []string, warnings *ParseWarnings) (*vex.VEX, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading CSAF document: %w", err)
+	}
+	return parseCSAF(data, products, warnings)
+}
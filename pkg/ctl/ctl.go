@@ -7,49 +7,316 @@ package ctl
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/sirupsen/logrus"
 
 	"github.com/openvex/go-vex/pkg/sarif"
 	"github.com/openvex/go-vex/pkg/vex"
 
 	"github.com/openvex/vexctl/pkg/attestation"
+	"github.com/openvex/vexctl/pkg/sbom"
 )
 
+// VexCtl is the vexctl client. It exposes the operations of the vexctl
+// command line tool (apply, merge, attest, etc) to other Go programs.
 type VexCtl struct {
 	impl    Implementation
 	Options Options
 }
 
+// Options control the behavior of the VexCtl client
 type Options struct {
-	Products []string // List of products to match in CSAF docs
-	Format   string   // Firmat of the vex documents
-	Sign     bool     // When true, attestations will be signed before attaching
+	Products       []string // List of products to match in CSAF docs and scan results
+	Format         string   // Firmat of the vex documents
+	Sign           bool     // When true, attestations will be signed before attaching
+	AllowPartial   bool     // When true, sources that fail to load are skipped
+	MaxConcurrency int      // Maximum number of VEX sources fetched in parallel
+
+	CacheDir string        // Directory to store the registry cache
+	CacheTTL time.Duration // Time registry lookups are cached, zero disables the cache
+
+	Progress ProgressFunc // Function called to report the progress of long operations
+
+	RetryAttempts    int           // Number of times registry operations are attempted
+	RetryBackoff     time.Duration // Initial wait between attempts, doubled on each retry
+	RetryStatusCodes []int         // HTTP status codes considered transient
+
+	SubjectSBOM  string   // SBOM whose described artifacts are added as attestation subjects
+	SubjectFiles []string // Files whose digests are added as attestation subjects
+
+	// SubjectPlatforms adds the digests of the per-platform images of
+	// image indexes as subjects, besides the digest of the index
+	SubjectPlatforms bool
+
+	// SubjectDigestAlgorithms are the algorithms used to compute the
+	// digests of the SubjectFiles, defaults to sha256
+	SubjectDigestAlgorithms []string
+
+	Verification AttestationVerification // How attestations read from images are verified
+
+	// RegistryMirrors maps registries to the mirrors used to reach
+	// them, eg gcr.io to registry.internal/gcr
+	RegistryMirrors map[string]string
+
+	// CredentialHelper is the docker credential helper (the name of a
+	// docker-credential-<name> program) used to read the registry and API
+	// credentials from the OS keychain when they are not set otherwise
+	CredentialHelper string
+
+	// CACertificates are PEM files with the certificates of the CAs
+	// trusted, in addition to the system roots, in all connections
+	CACertificates []string
+
+	// ParseWarnings, when set, makes the parsers skip the malformed
+	// statements and results in documents and reports, collecting
+	// them instead of failing
+	ParseWarnings *ParseWarnings
+
+	// ScanContext describes the scan behind the VEX data, it is recorded
+	// in the annotations of the generated attestations
+	ScanContext *ScanContext
+
+	// AllowedJustifications, when set, limits the not_affected statements
+	// honored when applying VEX data to those with these justifications
+	AllowedJustifications []string
+
+	// ReplaceAttestations makes attached attestations supersede the VEX
+	// attestations already on the image instead of adding to them
+	ReplaceAttestations bool
+
+	// Validity is the time window recorded in the generated attestations
+	Validity *attestation.Validity
+
+	// RejectExpired skips the image attestations read outside of their
+	// validity window instead of only warning about them
+	RejectExpired bool
+
+	Metrics *Metrics // Records the timings and counters of the operations
+}
+
+// ProgressFunc is called to report the progress of long running operations
+// such as fetching attestations or attaching them to several images. current
+// is the number of items processed so far out of total.
+type ProgressFunc func(operation string, current, total int)
+
+// reportProgress calls the progress function, if one is set
+func (vexctl *VexCtl) reportProgress(operation string, current, total int) {
+	if vexctl.Options.Progress != nil {
+		vexctl.Options.Progress(operation, current, total)
+	}
+}
+
+// defaultMaxConcurrency is the number of sources fetched in parallel
+// when Options.MaxConcurrency is not set
+const defaultMaxConcurrency = 4
+
+// OptionFunc is a function that modifies the client options
+type OptionFunc func(*VexCtl)
+
+// WithMetrics records the timings and counters of the operations in m
+func WithMetrics(m *Metrics) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.Metrics = m
+	}
+}
+
+// WithProducts sets the list of products to match in CSAF documents
+// and the scan results VEX data is applied to
+func WithProducts(products []string) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.Products = products
+	}
+}
+
+// WithFormat sets the format of the VEX documents to read
+func WithFormat(format string) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.Format = format
+	}
+}
+
+// WithSign makes the client sign the attestations it generates
+func WithSign(sign bool) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.Sign = sign
+	}
+}
+
+// WithAllowPartial makes the client skip VEX sources that fail to load
+func WithAllowPartial(allowPartial bool) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.AllowPartial = allowPartial
+	}
+}
+
+// WithMaxConcurrency sets the number of VEX sources fetched in parallel
+func WithMaxConcurrency(maxConcurrency int) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.MaxConcurrency = maxConcurrency
+	}
+}
+
+// WithCache enables the persistent registry cache. Image digests and
+// attestations are stored in dir for ttl. If dir is empty, the cache
+// is stored in the user's cache directory.
+func WithCache(dir string, ttl time.Duration) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.CacheDir = dir
+		vexctl.Options.CacheTTL = ttl
+	}
+}
+
+// WithProgress sets a function to report the progress of long operations
+func WithProgress(fn ProgressFunc) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.Progress = fn
+	}
+}
+
+// WithRetry configures how registry operations are retried when they fail
+// with one of the transient HTTP status codes. The wait between attempts
+// starts at backoff and doubles after each failure.
+func WithRetry(attempts int, backoff time.Duration, statusCodes []int) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.RetryAttempts = attempts
+		vexctl.Options.RetryBackoff = backoff
+		vexctl.Options.RetryStatusCodes = statusCodes
+	}
+}
+
+// WithSubjectSBOM adds the artifacts described by an SBOM
+// as subjects of the generated attestations
+func WithSubjectSBOM(path string) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.SubjectSBOM = path
+	}
+}
+
+// WithSubjectFiles adds the digests of files as subjects
+// of the generated attestations
+func WithSubjectFiles(paths []string) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.SubjectFiles = paths
+	}
+}
+
+// WithSubjectPlatforms adds the per-platform digests of
+// image indexes as attestation subjects
+func WithSubjectPlatforms(platforms bool) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.SubjectPlatforms = platforms
+	}
+}
+
+// WithSubjectDigestAlgorithms sets the algorithms used to
+// compute the digests of the files attested
+func WithSubjectDigestAlgorithms(algorithms []string) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.SubjectDigestAlgorithms = algorithms
+	}
+}
+
+// WithAttestationVerification sets how the signatures of the
+// attestations read from images are verified
+func WithAttestationVerification(v AttestationVerification) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.Verification = v
+	}
+}
+
+// WithRegistryMirrors sets mirrors used instead of the original
+// registries in all OCI operations
+func WithRegistryMirrors(mirrors map[string]string) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.RegistryMirrors = mirrors
+	}
+}
+
+// WithCredentialHelper reads the credentials missing from the environment
+// and docker configuration with a docker credential helper
+func WithCredentialHelper(name string) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.CredentialHelper = name
+	}
 }
 
-func New() *VexCtl {
-	return &VexCtl{
+// WithCACertificates trusts the certificates in the PEM files, in
+// addition to the system roots, when connecting to registries, the
+// transparency log and HTTP servers
+func WithCACertificates(paths []string) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.CACertificates = paths
+	}
+}
+
+// WithValidity records a validity window in the generated attestations
+func WithValidity(v *attestation.Validity) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.Validity = v
+	}
+}
+
+// WithRejectExpired skips the image attestations outside of their validity
+// window instead of warning about them
+func WithRejectExpired(reject bool) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.RejectExpired = reject
+	}
+}
+
+// WithLenient makes the client skip malformed records when parsing
+// documents and reports, collecting them in warnings
+func WithLenient(warnings *ParseWarnings) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.ParseWarnings = warnings
+	}
+}
+
+// WithImplementation replaces the implementation backing the client,
+// mostly useful to mock vexctl in tests
+func WithImplementation(impl Implementation) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.impl = impl
+	}
+}
+
+// New returns a new VexCtl client configured with the passed options
+func New(opts ...OptionFunc) *VexCtl {
+	vexctl := &VexCtl{
 		impl: &defaultVexCtlImplementation{},
 	}
+	for _, opt := range opts {
+		opt(vexctl)
+	}
+	return vexctl
 }
 
 // ApplyFiles takes a list of paths to vex files and applies them to a report
-func (vexctl *VexCtl) ApplyFiles(r *sarif.Report, files []string) (*sarif.Report, error) {
-	vexes, err := vexctl.impl.OpenVexData(vexctl.Options, files)
+func (vexctl *VexCtl) ApplyFiles(ctx context.Context, r *sarif.Report, files []string) (*sarif.Report, error) {
+	vexes, err := vexctl.impl.OpenVexData(ctx, vexctl.Options, files)
 	if err != nil {
 		return nil, fmt.Errorf("opening vex data: %w", err)
 	}
 
-	return vexctl.Apply(r, vexes)
+	return vexctl.Apply(ctx, r, vexes)
 }
 
 // Apply takes a sarif report and applies one or more vex documents
-func (vexctl *VexCtl) Apply(r *sarif.Report, vexDocs []*vex.VEX) (finalReport *sarif.Report, err error) {
+func (vexctl *VexCtl) Apply(ctx context.Context, r *sarif.Report, vexDocs []*vex.VEX) (finalReport *sarif.Report, err error) {
+	defer vexctl.Options.Metrics.Track(MetricsPhaseApply)()
 	// Sort the docs by date
-	vexDocs = vexctl.impl.Sort(vexDocs)
+	vexDocs = vexctl.impl.Sort(vexctl.honoredDocuments(vexDocs))
 
 	// Apply the sorted documents to the report
+	finalReport = r
 	for i, doc := range vexDocs {
-		finalReport, err = vexctl.impl.ApplySingleVEX(r, doc)
+		finalReport, err = vexctl.impl.ApplySingleVEX(ctx, vexctl.Options, r, doc)
 		if err != nil {
 			return nil, fmt.Errorf("applying vex document #%d: %w", i, err)
 		}
@@ -59,22 +326,78 @@ func (vexctl *VexCtl) Apply(r *sarif.Report, vexDocs []*vex.VEX) (finalReport *s
 }
 
 // Generate an attestation from a VEX
-func (vexctl *VexCtl) Attest(vexDataPath string, imageRefs []string) (*attestation.Attestation, error) {
-	doc, err := vexctl.impl.OpenVexData(vexctl.Options, []string{vexDataPath})
+func (vexctl *VexCtl) Attest(ctx context.Context, vexDataPath string, imageRefs []string) (*attestation.Attestation, error) {
+	return vexctl.AttestDocuments(ctx, []string{vexDataPath}, imageRefs)
+}
+
+// AttestDocuments generates a single attestation bundling several VEX
+// documents. The documents are merged into one predicate carrying all
+// their statements, so each image gets one attestation instead of one
+// per document. A single document is attested as is.
+func (vexctl *VexCtl) AttestDocuments(ctx context.Context, vexDataPaths, imageRefs []string) (*attestation.Attestation, error) {
+	docs, err := vexctl.impl.OpenVexData(ctx, vexctl.Options, vexDataPaths)
 	if err != nil {
 		return nil, fmt.Errorf("opening vex data: %w", err)
 	}
+	if len(docs) == 0 {
+		return nil, errors.New("at least one VEX document is required")
+	}
+	predicate := docs[0]
+	if len(docs) > 1 {
+		predicate, err = vexctl.Merge(ctx, bundleMergeOptions(docs), docs)
+		if err != nil {
+			return nil, fmt.Errorf("bundling documents: %w", err)
+		}
+	}
 
 	// Generate the attestation
 	att := attestation.New()
-	att.Predicate = *doc[0]
-	if err := att.AddImageSubjects(imageRefs); err != nil {
-		return nil, fmt.Errorf("adding image references to attestation")
+	att.Predicate = *predicate
+	att.Validity = vexctl.Options.Validity
+	if vexctl.Options.ScanContext != nil {
+		att.Annotations = vexctl.Options.ScanContext.Annotations()
+	}
+	// Image digests are resolved by the client so that
+	// registry mirrors are honored
+	subjects := []intoto.Subject{}
+	for _, ref := range imageRefs {
+		digest, err := vexctl.impl.ResolveImageDigest(ctx, vexctl.Options, ref)
+		if err != nil {
+			return nil, fmt.Errorf("getting image digest: %w", err)
+		}
+		subjects = append(subjects, attestation.ImageSubject(ref, digest))
+		if !vexctl.Options.SubjectPlatforms {
+			continue
+		}
+		platformDigests, err := vexctl.impl.ResolvePlatformDigests(ctx, vexctl.Options, ref)
+		if err != nil {
+			return nil, fmt.Errorf("getting platform digests: %w", err)
+		}
+		for _, d := range platformDigests {
+			subjects = append(subjects, attestation.ImageSubject(ref, d))
+		}
+	}
+	if err := att.AddSubjects(subjects); err != nil {
+		return nil, fmt.Errorf("adding image references to attestation: %w", err)
+	}
+
+	if vexctl.Options.SubjectSBOM != "" {
+		s, err := sbom.Open(vexctl.Options.SubjectSBOM)
+		if err != nil {
+			return nil, fmt.Errorf("opening SBOM: %w", err)
+		}
+		if err := att.AddSBOMSubjects(s); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := att.AddFileSubjects(vexctl.Options.SubjectFiles, vexctl.Options.SubjectDigestAlgorithms...); err != nil {
+		return nil, err
 	}
 
 	// Sign the attestation
 	if vexctl.Options.Sign {
-		if err := att.Sign(); err != nil {
+		if err := att.Sign(ctx); err != nil {
 			return att, fmt.Errorf("signing attestation: %w", err)
 		}
 	}
@@ -82,46 +405,166 @@ func (vexctl *VexCtl) Attest(vexDataPath string, imageRefs []string) (*attestati
 	return att, nil
 }
 
+// bundleMergeOptions returns the options to merge the documents bundled
+// in an attestation. The author and role are kept when all the documents
+// share them, otherwise the default author is recorded.
+func bundleMergeOptions(docs []*vex.VEX) *MergeOptions {
+	opts := &MergeOptions{Author: docs[0].Author, AuthorRole: docs[0].AuthorRole}
+	for _, doc := range docs[1:] {
+		if doc.Author != opts.Author || doc.AuthorRole != opts.AuthorRole {
+			return &MergeOptions{Author: vex.DefaultAuthor, AuthorRole: vex.DefaultRole}
+		}
+	}
+	return opts
+}
+
 // Attach attaches an attestation to a list of images
 func (vexctl *VexCtl) Attach(ctx context.Context, att *attestation.Attestation, imageRefs []string) (err error) {
-	for _, ref := range imageRefs {
-		if err := vexctl.impl.Attach(ctx, att, ref); err != nil {
+	defer vexctl.Options.Metrics.Track(MetricsPhasePush)()
+	for i, ref := range imageRefs {
+		vexctl.reportProgress("Attaching attestation", i, len(imageRefs))
+		if err := vexctl.impl.Attach(ctx, vexctl.Options, att, ref); err != nil {
 			return fmt.Errorf("attaching attestation: %w", err)
 		}
 	}
+	vexctl.reportProgress("Attaching attestation", len(imageRefs), len(imageRefs))
 
 	return nil
 }
 
-// VexFromURI return a vex doc from a path, image ref or URI
+// VexFromURI return a vex doc from a path, image ref or URI. If the source
+// has more than one document, only the first one is returned.
 func (vexctl *VexCtl) VexFromURI(ctx context.Context, uri string) (vexData *vex.VEX, err error) {
-	sourceType, err := vexctl.impl.SourceType(uri)
+	vexes, err := vexctl.VexesFromURI(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	return vexes[0], nil
+}
+
+// VexesFromURI returns all the VEX documents found in a path, directory,
+// image reference or URI
+func (vexctl *VexCtl) VexesFromURI(ctx context.Context, uri string) ([]*vex.VEX, error) {
+	source, err := vexctl.ResolveSource(uri)
 	if err != nil {
 		return nil, fmt.Errorf("resolving VEX source: %w", err)
 	}
-	var vexes []*vex.VEX
-	switch sourceType {
-	case "file":
-		vexes, err = vexctl.impl.OpenVexData(vexctl.Options, []string{uri})
-		if err == nil {
-			vexData = vexes[0]
-		}
-	case "image":
-		vexes, err = vexctl.impl.ReadImageAttestations(ctx, vexctl.Options, uri)
-		if err == nil {
-			if len(vexes) == 0 {
-				return nil, fmt.Errorf("no attestations found in image")
+
+	vexes, err := source.Read(ctx, vexctl.Options, uri)
+	if err != nil {
+		return nil, fmt.Errorf("opening vex data from %s: %w", uri, err)
+	}
+	if len(vexes) == 0 {
+		return nil, fmt.Errorf("no VEX data found in %s", uri)
+	}
+	logrus.WithFields(logrus.Fields{
+		"source":    uri,
+		"provider":  source.Name(),
+		"documents": len(vexes),
+	}).Info("Read VEX data")
+	return vexes, nil
+}
+
+// VexesFromURIs fetches VEX documents from a list of paths, directories, image
+// references or URIs. The sources can be of different types, each one is read
+// by its provider and all the documents are combined in a single set. Sources
+// are fetched concurrently and the documents are returned in the same order
+// as the URIs. If Options.AllowPartial is set, sources that
+// fail to load are logged and skipped instead of failing the whole set.
+func (vexctl *VexCtl) VexesFromURIs(ctx context.Context, uris []string) ([]*vex.VEX, error) {
+	uris, err := ExpandGlobs(uris)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([][]*vex.VEX, len(uris))
+	if err := vexctl.fetchSources(ctx, uris, func(i int, d []*vex.VEX) error {
+		docs[i] = d
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	vexes := []*vex.VEX{}
+	for i := range docs {
+		vexes = append(vexes, docs[i]...)
+	}
+	return vexes, nil
+}
+
+// fetchSources reads the documents of the sources concurrently, passing
+// those of each source to handle along with its index. handle is called
+// from the fetching goroutines, once per source. Sources failing to load
+// are skipped if Options.AllowPartial is set.
+func (vexctl *VexCtl) fetchSources(
+	ctx context.Context, uris []string, handle func(i int, docs []*vex.VEX) error,
+) error {
+	defer vexctl.Options.Metrics.Track(MetricsPhaseFetch)()
+	maxConcurrency := vexctl.Options.MaxConcurrency
+	if maxConcurrency <= 0 {
+		maxConcurrency = defaultMaxConcurrency
+	}
+
+	errs := make([]error, len(uris))
+	sem := make(chan struct{}, maxConcurrency)
+	var wg sync.WaitGroup
+	var progressMutex sync.Mutex
+	completed := 0
+	vexctl.reportProgress("Fetching VEX data", 0, len(uris))
+	for i := range uris {
+		// The slot is taken before starting the goroutine so that large
+		// source sets don't spawn a goroutine per source at once
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			logrus.Infof("[%d/%d] Fetching VEX data from %s", i+1, len(uris), uris[i])
+			docs, err := vexctl.VexesFromURI(ctx, uris[i])
+			if err == nil {
+				vexctl.Options.Metrics.AddDocuments(docs)
+				err = handle(i, docs)
+			}
+			errs[i] = err
+			progressMutex.Lock()
+			completed++
+			vexctl.reportProgress("Fetching VEX data", completed, len(uris))
+			progressMutex.Unlock()
+			if err != nil {
+				logrus.Warnf("[%d/%d] Failed to fetch %s: %v", i+1, len(uris), uris[i], err)
+				return
+			}
+			statements := 0
+			for _, doc := range docs {
+				statements += len(doc.Statements)
+			}
+			logrus.Infof(
+				"[%d/%d] Read %d statements in %d documents from %s",
+				i+1, len(uris), statements, len(docs), uris[i],
+			)
+		}(i)
+	}
+	wg.Wait()
+
+	failed := []string{}
+	var firstErr error
+	for i := range uris {
+		if errs[i] != nil {
+			failed = append(failed, uris[i])
+			if firstErr == nil {
+				firstErr = errs[i]
 			}
-			vexData = vexes[0]
 		}
-	default:
-		return nil, fmt.Errorf("unable to resolve source type (file or image)")
 	}
 
-	if err != nil {
-		return nil, fmt.Errorf("opening vex data from %s: %w", uri, err)
+	if len(failed) > 0 {
+		if !vexctl.Options.AllowPartial {
+			return fmt.Errorf(
+				"unable to fetch %d of %d VEX sources (%s): %w",
+				len(failed), len(uris), strings.Join(failed, ", "), firstErr,
+			)
+		}
+		logrus.Warnf("Skipped %d of %d VEX sources that failed to load", len(failed), len(uris))
 	}
-	return vexData, err
+	return nil
 }
 
 // Merge combines several documents into one
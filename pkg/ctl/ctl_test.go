@@ -6,13 +6,61 @@ SPDX-License-Identifier: Apache-2.0
 package ctl
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/klauspost/compress/zstd"
+	gosarif "github.com/owenrumney/go-sarif/sarif"
+	"github.com/sigstore/cosign/pkg/oci"
+	"github.com/sigstore/cosign/pkg/oci/mutate"
+	ociremote "github.com/sigstore/cosign/pkg/oci/remote"
+	"github.com/sigstore/cosign/pkg/oci/static"
+	"github.com/sigstore/cosign/pkg/types"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/dsse"
 	"github.com/stretchr/testify/require"
 
 	"github.com/openvex/go-vex/pkg/sarif"
 	"github.com/openvex/go-vex/pkg/vex"
+
+	"github.com/openvex/vexctl/pkg/attestation"
+	"github.com/openvex/vexctl/pkg/formats"
+	"github.com/openvex/vexctl/pkg/formats/snykjson"
+	"github.com/openvex/vexctl/pkg/formats/trivyjson"
+	"github.com/openvex/vexctl/pkg/sbom"
 )
 
 func TestVexReport(t *testing.T) {
@@ -28,7 +76,7 @@ func TestVexReport(t *testing.T) {
 	require.Len(t, report.Runs[0].Results, 123)
 
 	impl := defaultVexCtlImplementation{}
-	newReport, err := impl.ApplySingleVEX(report, vexDoc)
+	newReport, err := impl.ApplySingleVEX(context.Background(), Options{}, report, vexDoc)
 	require.NoError(t, err)
 	require.Len(t, newReport.Runs, 1)
 	require.Len(t, newReport.Runs[0].Results, 122)
@@ -75,6 +123,61 @@ func TestMerge(t *testing.T) {
 			},
 			shouldErr: false,
 		},
+		// Filtering by vulnerability
+		{
+			opts: MergeOptions{Vulnerabilities: []string{"CVE-1234-5678"}},
+			docs: []*vex.VEX{doc1, doc2},
+			expectedDoc: &vex.VEX{
+				Statements: []vex.Statement{
+					doc1.Statements[0],
+					doc2.Statements[0],
+				},
+			},
+			shouldErr: false,
+		},
+		// Filtering by document author
+		{
+			opts: MergeOptions{SourceAuthors: []string{"Jane Doe"}},
+			docs: []*vex.VEX{doc1, doc2},
+			expectedDoc: &vex.VEX{
+				Statements: []vex.Statement{},
+			},
+			shouldErr: false,
+		},
+		{
+			opts: MergeOptions{SourceAuthors: []string{"John Doe"}, SourceRoles: []string{"vex issuer"}},
+			docs: []*vex.VEX{doc1, doc2},
+			expectedDoc: &vex.VEX{
+				Statements: []vex.Statement{
+					doc1.Statements[0],
+					doc2.Statements[0],
+				},
+			},
+			shouldErr: false,
+		},
+		// Statements outside of the time window are skipped
+		{
+			opts: MergeOptions{Since: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+			docs: []*vex.VEX{doc1, doc2},
+			expectedDoc: &vex.VEX{
+				Statements: []vex.Statement{},
+			},
+			shouldErr: false,
+		},
+		{
+			opts: MergeOptions{
+				Since: time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC),
+				Until: time.Date(2022, 12, 31, 0, 0, 0, 0, time.UTC),
+			},
+			docs: []*vex.VEX{doc1, doc2},
+			expectedDoc: &vex.VEX{
+				Statements: []vex.Statement{
+					doc1.Statements[0],
+					doc2.Statements[0],
+				},
+			},
+			shouldErr: false,
+		},
 	} {
 		doc, err := impl.Merge(ctx, &tc.opts, tc.docs)
 		if tc.shouldErr {
@@ -87,3 +190,2638 @@ func TestMerge(t *testing.T) {
 		require.Equal(t, doc.Statements, tc.expectedDoc.Statements)
 	}
 }
+
+func TestVerifyStatements(t *testing.T) {
+	digest := "sha256:e4cf37d568d195b4b5af4c36a8e7ad0e3a7d9fa0ad1dc4d5a5e0b71d5cf6a2f1"
+	vexPredicate := []byte(`{"statements":[{"vulnerability":"CVE-2023-12345","status":"fixed",` +
+		`"products":["pkg:oci/nginx"],"subcomponents":["pkg:apk/wolfi/bash@1.0.0?arch=x86_64","pkg:apk/wolfi/git@2.39.0-r1"]}]}`)
+	sbomPredicate := []byte(`{"spdxVersion":"SPDX-2.3","packages":[{"SPDXID":"SPDXRef-bash",` +
+		`"externalRefs":[{"referenceType":"purl","referenceLocator":"pkg:apk/wolfi/bash@1.0.0"}]}]}`)
+
+	vexStatement := &ImageStatement{Predicate: vexPredicate}
+	vexStatement.PredicateType = vex.TypeURI
+	vexStatement.Subject = []intoto.Subject{{Name: "nginx", Digest: map[string]string{"sha256": digest[7:]}}}
+	sbomStatement := &ImageStatement{Predicate: sbomPredicate}
+	sbomStatement.PredicateType = intoto.PredicateSPDX
+
+	res, err := verifyStatements(Options{}, "nginx", digest, nil, []*ImageStatement{vexStatement, sbomStatement}, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, res.SBOMs)
+	require.Equal(t, 1, res.VEXDocuments)
+	require.Len(t, res.Documents, 1)
+	require.Empty(t, res.SubjectMismatches)
+	require.Len(t, res.Subcomponents, 2)
+	require.Equal(t, []string{"pkg:apk/wolfi/git@2.39.0-r1"}, res.MissingSubcomponents)
+	require.Equal(t, float64(50), res.Coverage())
+	require.False(t, res.Passed())
+}
+
+func TestNewWithOptions(t *testing.T) {
+	vexctl := New(
+		WithProducts([]string{"pkg:apk/wolfi/bash@1.0.0"}),
+		WithFormat("csaf"),
+		WithSign(true),
+		WithAllowPartial(true),
+		WithMaxConcurrency(8),
+	)
+	require.Equal(t, []string{"pkg:apk/wolfi/bash@1.0.0"}, vexctl.Options.Products)
+	require.Equal(t, "csaf", vexctl.Options.Format)
+	require.True(t, vexctl.Options.Sign)
+	require.True(t, vexctl.Options.AllowPartial)
+	require.Equal(t, 8, vexctl.Options.MaxConcurrency)
+	require.IsType(t, &defaultVexCtlImplementation{}, vexctl.impl)
+}
+
+type testSource struct{}
+
+func (ts *testSource) Name() string            { return "test" }
+func (ts *testSource) Handles(uri string) bool { return strings.HasPrefix(uri, "test://") }
+func (ts *testSource) Read(context.Context, Options, string) ([]*vex.VEX, error) {
+	return []*vex.VEX{{Metadata: vex.Metadata{ID: "test-doc"}}}, nil
+}
+
+func TestGitSourcePaths(t *testing.T) {
+	gs := &gitSource{impl: &defaultVexCtlImplementation{}}
+	marker := filepath.Join(t.TempDir(), "pwned")
+	_, err := gs.Read(context.Background(), Options{}, "git+--upload-pack=touch "+marker+"#vex.json")
+	require.Error(t, err)
+	require.NoFileExists(t, marker)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "vex.json"), []byte("{}"), 0o600))
+	require.NoError(t, os.Symlink("/etc/passwd", filepath.Join(dir, "link.json")))
+
+	path, err := clonedPath(dir, "vex.json")
+	require.NoError(t, err)
+	require.Equal(t, "vex.json", filepath.Base(path))
+	for _, p := range []string{"../../etc/passwd", "/../../etc/passwd", "link.json"} {
+		_, err := clonedPath(dir, p)
+		require.Error(t, err, p)
+	}
+}
+
+func TestResolveSource(t *testing.T) {
+	RegisterSource(&testSource{})
+	vexctl := New()
+	for uri, expected := range map[string]string{
+		"testdata/test.vex.json":                       "file",
+		"testdata":                                     "directory",
+		"https://example.com/data.vex.json":            "http",
+		"git+https://github.com/org/repo.git#vex.json": "git",
+		"cgr.dev/chainguard/nginx:latest":              "image",
+		"test://doc":                                   "test",
+	} {
+		sourceType, err := vexctl.SourceType(uri)
+		require.NoError(t, err)
+		require.Equal(t, expected, sourceType, uri)
+	}
+
+	doc, err := vexctl.VexFromURI(context.Background(), "test://doc")
+	require.NoError(t, err)
+	require.Equal(t, "test-doc", doc.ID)
+
+	_, err = vexctl.SourceType("Not A Valid Source")
+	require.Error(t, err)
+
+	// Sources of different types are combined in a single set
+	dir := t.TempDir()
+	for _, f := range []string{"document1.vex.json", "document2.vex.json"} {
+		data, err := os.ReadFile("testdata/" + f)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(dir+"/"+f, data, os.FileMode(0o644)))
+	}
+	require.NoError(t, os.WriteFile(dir+"/notes.txt", []byte("not VEX"), os.FileMode(0o644)))
+	vexes, err := vexctl.VexesFromURIs(context.Background(), []string{dir, "testdata/test.vex.json", "test://doc"})
+	require.NoError(t, err)
+	require.Len(t, vexes, 4)
+	require.Equal(t, "test-doc", vexes[3].ID)
+}
+
+func TestRegistryCache(t *testing.T) {
+	require.Nil(t, newRegistryCache(Options{}))
+
+	cache := newRegistryCache(Options{CacheDir: t.TempDir(), CacheTTL: time.Hour})
+	require.NotNil(t, cache)
+
+	var value string
+	require.False(t, cache.get("digest:nginx:latest", &value))
+	cache.set("digest:nginx:latest", "sha256:abc")
+	require.True(t, cache.get("digest:nginx:latest", &value))
+	require.Equal(t, "sha256:abc", value)
+
+	cache.invalidate("digest:nginx:latest")
+	require.False(t, cache.get("digest:nginx:latest", &value))
+
+	expired := newRegistryCache(Options{CacheDir: cache.dir, CacheTTL: time.Nanosecond})
+	expired.set("key", "value")
+	time.Sleep(time.Millisecond)
+	require.False(t, expired.get("key", &value))
+}
+
+func TestApplyStream(t *testing.T) {
+	vexDoc, err := vex.OpenJSON("testdata/test.vex.json")
+	require.NoError(t, err)
+
+	f, err := os.Open("testdata/nginx.sarif.json")
+	require.NoError(t, err)
+	defer f.Close()
+
+	var b bytes.Buffer
+	remaining, err := New().ApplyStream(context.Background(), f, &b, []*vex.VEX{vexDoc})
+	require.NoError(t, err)
+	require.Equal(t, 122, remaining)
+
+	report := sarif.New()
+	require.NoError(t, json.Unmarshal(b.Bytes(), report))
+	require.Len(t, report.Runs, 1)
+	require.Len(t, report.Runs[0].Results, 122)
+	require.Equal(t, "Trivy", report.Runs[0].Tool.Driver.Name)
+
+	// Fields unknown to the SARIF library are preserved
+	require.Contains(t, b.String(), `"originalUriBaseIds"`)
+}
+
+func TestWithRetry(t *testing.T) {
+	ctx := context.Background()
+	opts := Options{RetryAttempts: 3, RetryBackoff: time.Millisecond}
+
+	// Transient errors are retried until the operation succeeds
+	calls := 0
+	require.NoError(t, withRetry(ctx, opts, "test", func() error {
+		calls++
+		if calls < 3 {
+			return &transport.Error{StatusCode: http.StatusTooManyRequests}
+		}
+		return nil
+	}))
+	require.Equal(t, 3, calls)
+
+	// Attempts are limited
+	calls = 0
+	require.Error(t, withRetry(ctx, opts, "test", func() error {
+		calls++
+		return &transport.Error{StatusCode: http.StatusServiceUnavailable}
+	}))
+	require.Equal(t, 3, calls)
+
+	// Other errors fail immediately
+	calls = 0
+	require.Error(t, withRetry(ctx, opts, "test", func() error {
+		calls++
+		return &transport.Error{StatusCode: http.StatusNotFound}
+	}))
+	require.Equal(t, 1, calls)
+}
+
+func TestEmbed(t *testing.T) {
+	reg := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer reg.Close()
+
+	ref, err := name.ParseReference(strings.TrimPrefix(reg.URL, "http://") + "/test/image:latest")
+	require.NoError(t, err)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	digest, err := New().Embed(context.Background(), "testdata/document1.vex.json", ref.String(), EmbedOptions{
+		Label: true,
+		Layer: true,
+	})
+	require.NoError(t, err)
+
+	newImg, err := remote.Image(ref)
+	require.NoError(t, err)
+	newDigest, err := newImg.Digest()
+	require.NoError(t, err)
+	require.Equal(t, digest, newDigest.String())
+
+	cfg, err := newImg.ConfigFile()
+	require.NoError(t, err)
+	require.Contains(t, cfg.Config.Labels[DefaultEmbedLabel], "CVE-1234-5678")
+
+	layers, err := newImg.Layers()
+	require.NoError(t, err)
+	require.Len(t, layers, 2)
+
+	// Embedding to a digest without a destination tag fails
+	_, err = New().Embed(context.Background(), "testdata/document1.vex.json", ref.Context().Digest(digest).String(), EmbedOptions{
+		Label: true,
+	})
+	require.Error(t, err)
+}
+
+func TestGenerateFromReport(t *testing.T) {
+	report, err := sarif.Open("testdata/nginx.sarif.json")
+	require.NoError(t, err)
+
+	doc, err := New().GenerateFromReport(report, &GenerateOptions{Products: []string{"pkg:oci/nginx"}})
+	require.NoError(t, err)
+	require.NotEmpty(t, doc.ID)
+	require.NotEmpty(t, doc.Statements)
+	seen := map[string]struct{}{}
+	for _, s := range doc.Statements {
+		require.Equal(t, vex.StatusUnderInvestigation, s.Status)
+		require.Equal(t, []string{"pkg:oci/nginx"}, s.Products)
+		require.NotContains(t, seen, s.Vulnerability)
+		seen[s.Vulnerability] = struct{}{}
+	}
+
+	// not_affected statements require a justification
+	_, err = New().GenerateFromReport(report, &GenerateOptions{
+		Products: []string{"pkg:oci/nginx"},
+		Status:   vex.StatusNotAffected,
+	})
+	require.Error(t, err)
+
+	// Products are required
+	_, err = New().GenerateFromReport(report, &GenerateOptions{})
+	require.Error(t, err)
+}
+
+func TestValidateTransitions(t *testing.T) {
+	t1 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	newDoc := func(id, version string, ts time.Time, status vex.Status) *vex.VEX {
+		return &vex.VEX{
+			Metadata: vex.Metadata{ID: id, Version: version, Timestamp: &ts},
+			Statements: []vex.Statement{
+				{Vulnerability: "CVE-2023-12345", Products: []string{"pkg:oci/test"}, Status: status},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		docs       []*vex.VEX
+		violations int
+	}{
+		// Assessment progressing as expected
+		{[]*vex.VEX{
+			newDoc("doc1", "1", t1, vex.StatusUnderInvestigation),
+			newDoc("doc2", "1", t2, vex.StatusFixed),
+		}, 0},
+		// Regression from fixed to affected in another document
+		{[]*vex.VEX{
+			newDoc("doc2", "1", t2, vex.StatusAffected),
+			newDoc("doc1", "1", t1, vex.StatusFixed),
+		}, 1},
+		// Regression published in a new version of the document
+		{[]*vex.VEX{
+			newDoc("doc1", "1", t1, vex.StatusFixed),
+			newDoc("doc1", "2", t2, vex.StatusAffected),
+		}, 0},
+	} {
+		require.Len(t, ValidateTransitions(tc.docs), tc.violations)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	doc := &vex.VEX{
+		Metadata: vex.Metadata{ID: "feed", Version: "3"},
+		Statements: []vex.Statement{
+			{Vulnerability: "CVE-2023-00001", Products: []string{"pkg:oci/old"}, Status: vex.StatusFixed},
+			{Vulnerability: "CVE-2023-00002", Products: []string{"pkg:oci/old", "pkg:oci/new"}, Status: vex.StatusFixed},
+			{Vulnerability: "CVE-2023-00003", Products: []string{"pkg:oci/new"}, Status: vex.StatusFixed},
+		},
+	}
+
+	newDoc, report := New().Prune(doc, []string{"pkg:oci/old"})
+	require.Len(t, newDoc.Statements, 2)
+	require.Equal(t, []string{"pkg:oci/new"}, newDoc.Statements[0].Products)
+	require.Len(t, report.Removed, 1)
+	require.Equal(t, "CVE-2023-00001", report.Removed[0].Vulnerability)
+	require.Len(t, report.Modified, 1)
+	require.Equal(t, "4", newDoc.Version)
+
+	// The original document is not modified
+	require.Len(t, doc.Statements, 3)
+	require.Len(t, doc.Statements[1].Products, 2)
+
+	// Nothing to prune keeps the version
+	newDoc, report = New().Prune(doc, []string{"pkg:oci/other"})
+	require.False(t, report.Changed())
+	require.Equal(t, "3", newDoc.Version)
+}
+
+func TestCoverage(t *testing.T) {
+	report, err := sarif.Open("testdata/nginx.sarif.json")
+	require.NoError(t, err)
+	doc := &vex.VEX{
+		Metadata: vex.Metadata{ID: "test"},
+		Statements: []vex.Statement{
+			{Vulnerability: "CVE-2011-3374", Status: vex.StatusNotAffected},
+			{Vulnerability: "CVE-1900-00000", Status: vex.StatusFixed},
+		},
+	}
+
+	coverage := New().Coverage(report, []*vex.VEX{doc})
+	require.Len(t, coverage.Matched, 1)
+	require.Equal(t, "CVE-2011-3374", coverage.Matched[0].Vulnerability)
+	require.Len(t, coverage.Unused, 1)
+	require.Equal(t, "CVE-1900-00000", coverage.Unused[0].Vulnerability)
+	require.NotContains(t, coverage.Uncovered, "CVE-2011-3374")
+	require.NotEmpty(t, coverage.Uncovered)
+}
+
+func TestExplain(t *testing.T) {
+	vexDoc, err := vex.OpenJSON("testdata/test.vex.json")
+	require.NoError(t, err)
+	report, err := sarif.Open("testdata/nginx.sarif.json")
+	require.NoError(t, err)
+
+	exp := New().Explain(report, []*vex.VEX{vexDoc}, "CVE-2009-4487")
+	require.Equal(t, 1, exp.Results)
+	require.True(t, exp.Suppressed)
+	require.Len(t, exp.Groups, 1)
+	require.Len(t, exp.Groups[0].Decisions, 1)
+	require.NotNil(t, exp.Groups[0].Decisions[0].Statement)
+
+	exp = New().Explain(report, []*vex.VEX{vexDoc}, "CVE-2011-3374")
+	require.False(t, exp.Suppressed)
+	require.Nil(t, exp.Groups[0].Decisions[0].Statement)
+
+	var b bytes.Buffer
+	require.NoError(t, exp.Write(&b))
+	require.Contains(t, b.String(), "KEPT")
+
+	// The documents of the caller are not reordered
+	older := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := &vex.VEX{Metadata: vex.Metadata{ID: "newer", Timestamp: vexDoc.Timestamp}}
+	second := &vex.VEX{Metadata: vex.Metadata{ID: "older", Timestamp: &older}}
+	docs := []*vex.VEX{first, second}
+	exp = New().Explain(report, docs, "CVE-2009-4487")
+	require.Equal(t, "older", exp.Groups[0].Decisions[0].Document)
+	require.Equal(t, []*vex.VEX{first, second}, docs)
+}
+
+func TestExplainProducts(t *testing.T) {
+	doc := vex.New()
+	doc.Statements = []vex.Statement{
+		{
+			Vulnerability: "CVE-2023-0001", Status: vex.StatusNotAffected,
+			Justification: vex.VulnerableCodeNotPresent,
+			Products:      []string{"pkg:npm/lodash@vers:npm/<2.4.7"},
+		},
+	}
+	products := []string{"pkg:npm/lodash@2.4.7", "pkg:npm/lodash@2.4.7", "pkg:npm/lodash@2.3.0"}
+
+	// The vulnerability matches but the product does not, both agree
+	// on keeping the results
+	exp := New().Explain(productReport("CVE-2023-0001", products[0]), []*vex.VEX{&doc}, "CVE-2023-0001")
+	report, err := New().Apply(context.Background(), productReport("CVE-2023-0001", products[0]), []*vex.VEX{&doc})
+	require.NoError(t, err)
+	require.Len(t, report.Runs[0].Results, 1)
+	require.False(t, exp.Suppressed)
+	require.Zero(t, exp.SuppressedResults)
+	require.Len(t, exp.Groups, 1)
+	d := exp.Groups[0].Decisions[0]
+	require.Nil(t, d.Statement)
+	require.False(t, d.Suppresses)
+	require.Contains(t, d.Match, "does not match pkg:npm/lodash@2.4.7")
+
+	// Results of several products are resolved separately
+	exp = New().Explain(productReport("CVE-2023-0001", products...), []*vex.VEX{&doc}, "CVE-2023-0001")
+	report, err = New().Apply(context.Background(), productReport("CVE-2023-0001", products...), []*vex.VEX{&doc})
+	require.NoError(t, err)
+	require.Len(t, exp.Groups, 2)
+	require.Equal(t, 2, exp.Groups[0].Results)
+	require.False(t, exp.Groups[0].Suppressed)
+	require.True(t, exp.Groups[1].Suppressed)
+	require.Contains(t, exp.Groups[1].Decisions[0].Match, "matches pkg:npm/lodash@2.3.0")
+	require.False(t, exp.Suppressed)
+	require.Equal(t, len(report.Runs[0].Results), exp.Results-exp.SuppressedResults)
+
+	var b bytes.Buffer
+	require.NoError(t, exp.Write(&b))
+	require.Contains(t, b.String(), "PARTIALLY SUPPRESSED, 2 of 3 results kept")
+
+	// Statements rejected for their justification are reported as such
+	opts := WithAllowedJustifications([]string{string(vex.ComponentNotPresent)})
+	exp = New(opts).Explain(productReport("CVE-2023-0001", products[2]), []*vex.VEX{&doc}, "CVE-2023-0001")
+	report, err = New(opts).Apply(context.Background(), productReport("CVE-2023-0001", products[2]), []*vex.VEX{&doc})
+	require.NoError(t, err)
+	require.Len(t, report.Runs[0].Results, 1)
+	require.False(t, exp.Suppressed)
+	require.Contains(t, exp.Groups[0].Decisions[0].Reason, "is not allowed")
+}
+
+func TestFilterReport(t *testing.T) {
+	vexDoc, err := vex.OpenJSON("testdata/test.vex.json")
+	require.NoError(t, err)
+	report, err := sarif.Open("testdata/nginx.sarif.json")
+	require.NoError(t, err)
+
+	fr := New().FilterReport(report, []*vex.VEX{vexDoc})
+	require.NotEmpty(t, fr.Suppressed)
+	require.NotEmpty(t, fr.Remaining)
+	require.Equal(t, "CVE-2009-4487", fr.Suppressed[0].Vulnerability)
+	require.NotNil(t, fr.Suppressed[0].Statement)
+	require.Equal(t, "https://nvd.nist.gov/vuln/detail/CVE-2009-4487", fr.Suppressed[0].URL)
+
+	var b bytes.Buffer
+	require.NoError(t, fr.WriteHTML(&b))
+	require.Contains(t, b.String(), `<a href="https://nvd.nist.gov/vuln/detail/CVE-2009-4487">CVE-2009-4487</a>`)
+	require.Contains(t, b.String(), "CVE-2011-3374")
+}
+
+func TestFilterReportMatchesApply(t *testing.T) {
+	vexDoc, err := vex.OpenJSON("testdata/test.vex.json")
+	require.NoError(t, err)
+	nginx, err := sarif.Open("testdata/nginx.sarif.json")
+	require.NoError(t, err)
+	rangeDoc := vex.New()
+	rangeDoc.Statements = []vex.Statement{
+		{
+			Vulnerability: "CVE-2023-0001", Status: vex.StatusNotAffected,
+			Justification: vex.VulnerableCodeNotPresent,
+			Products:      []string{"pkg:npm/lodash@vers:npm/<2.4.7"},
+		},
+	}
+
+	for name, tc := range map[string]struct {
+		report *sarif.Report
+		docs   []*vex.VEX
+	}{
+		"nginx": {nginx, []*vex.VEX{vexDoc}},
+		"products": {
+			productReport("CVE-2023-0001", "pkg:npm/lodash@2.4.7", "pkg:npm/lodash@2.3.0", ""),
+			[]*vex.VEX{&rangeDoc},
+		},
+	} {
+		total := 0
+		for _, run := range tc.report.Runs {
+			total += len(run.Results)
+		}
+		fr := New().FilterReport(tc.report, tc.docs)
+		filtered, err := New().Apply(context.Background(), tc.report, tc.docs)
+		require.NoError(t, err, name)
+
+		kept := map[string]int{}
+		for _, run := range filtered.Runs {
+			for _, res := range run.Results {
+				kept[cveRegexp.FindStringSubmatch(*res.RuleID)[1]]++
+			}
+		}
+		remaining := map[string]int{}
+		for _, e := range fr.Remaining {
+			remaining[e.Vulnerability] = e.Results
+		}
+		require.Equal(t, kept, remaining, name)
+
+		suppressed := 0
+		for _, e := range fr.Suppressed {
+			require.NotNil(t, e.Statement, name)
+			suppressed += e.Results
+		}
+		require.Equal(t, total-len(filtered.Runs[0].Results), suppressed, name)
+	}
+}
+
+func TestSerializeDocument(t *testing.T) {
+	doc := vex.New()
+	doc.ID = "test"
+	doc.Statements = []vex.Statement{
+		{Vulnerability: "CVE-2023-12345", Products: []string{"pkg:apk/wolfi/git"}, Status: vex.StatusFixed},
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, SerializeDocument(&b, &doc, SerializeOptions{Compact: true}))
+	require.Equal(t, 1, strings.Count(b.String(), "\n"))
+	require.Contains(t, b.String(), `"status":"fixed"`)
+
+	b.Reset()
+	require.NoError(t, SerializeDocument(&b, &doc, SerializeOptions{Format: OutputFormatYAML}))
+	require.Contains(t, b.String(), "'@id': test\n")
+	require.Contains(t, b.String(), "  - vulnerability: CVE-2023-12345\n")
+	format, err := DetectDocumentFormat(b.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, DocumentFormatYAML, format)
+
+	require.Error(t, SerializeDocument(&b, &doc, SerializeOptions{Format: "xml"}))
+}
+
+func TestSBOMSubjects(t *testing.T) {
+	spdx := []byte(`{"spdxVersion":"SPDX-2.3","SPDXID":"SPDXRef-DOCUMENT","documentDescribes":["SPDXRef-app"],` +
+		`"packages":[{"SPDXID":"SPDXRef-app","name":"app.tar.gz","checksums":[{"algorithm":"SHA256","checksumValue":"abc123"}]},` +
+		`{"SPDXID":"SPDXRef-dep","name":"dep","checksums":[{"algorithm":"SHA256","checksumValue":"def456"}]}]}`)
+	cdx := []byte(`{"bomFormat":"CycloneDX","metadata":{"component":{"name":"nginx",` +
+		`"purl":"pkg:oci/nginx@sha256%3Ae4cf37d5?repository_url=cgr.dev/chainguard/nginx"}}}`)
+
+	for _, tc := range []struct {
+		data     []byte
+		expected []intoto.Subject
+	}{
+		{spdx, []intoto.Subject{{Name: "app.tar.gz", Digest: map[string]string{"sha256": "abc123"}}}},
+		{cdx, []intoto.Subject{{Name: "nginx", Digest: map[string]string{"sha256": "e4cf37d5"}}}},
+	} {
+		s, err := sbom.Parse(tc.data)
+		require.NoError(t, err)
+		att := attestation.New()
+		require.NoError(t, att.AddSBOMSubjects(s))
+		require.Equal(t, tc.expected, att.Subject)
+	}
+
+	s, err := sbom.Parse([]byte(`{"bomFormat":"CycloneDX","components":[]}`))
+	require.NoError(t, err)
+	require.Error(t, attestation.New().AddSBOMSubjects(s))
+}
+
+func TestAttestFiles(t *testing.T) {
+	att, err := New(WithSubjectFiles([]string{"testdata/document2.vex.json"})).Attest(
+		context.Background(), "testdata/document1.vex.json", nil,
+	)
+	require.NoError(t, err)
+	require.Len(t, att.Subject, 1)
+	require.Equal(t, "document2.vex.json", att.Subject[0].Name)
+	require.Len(t, att.Subject[0].Digest["sha256"], 64)
+
+	att, err = New(
+		WithSubjectFiles([]string{"testdata/document2.vex.json"}),
+		WithSubjectDigestAlgorithms([]string{"sha256", "sha512"}),
+	).Attest(context.Background(), "testdata/document1.vex.json", nil)
+	require.NoError(t, err)
+	require.Len(t, att.Subject[0].Digest["sha256"], 64)
+	require.Len(t, att.Subject[0].Digest["sha512"], 128)
+
+	_, err = New(
+		WithSubjectFiles([]string{"testdata/document2.vex.json"}),
+		WithSubjectDigestAlgorithms([]string{"md5"}),
+	).Attest(context.Background(), "testdata/document1.vex.json", nil)
+	require.Error(t, err)
+}
+
+func TestAttestDocuments(t *testing.T) {
+	doc1, err := vex.OpenJSON("testdata/document1.vex.json")
+	require.NoError(t, err)
+	doc2, err := vex.OpenJSON("testdata/document2.vex.json")
+	require.NoError(t, err)
+
+	att, err := New(WithSubjectFiles([]string{"testdata/test.vex.json"})).AttestDocuments(
+		context.Background(), []string{"testdata/document1.vex.json", "testdata/document2.vex.json"}, nil,
+	)
+	require.NoError(t, err)
+	require.Len(t, att.Subject, 1)
+	require.Len(t, att.Predicate.Statements, len(doc1.Statements)+len(doc2.Statements))
+	require.NotEqual(t, doc1.ID, att.Predicate.ID)
+
+	// A single document is attested as is
+	att, err = New().AttestDocuments(context.Background(), []string{"testdata/document1.vex.json"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, doc1.ID, att.Predicate.ID)
+}
+
+func TestAttestPlatforms(t *testing.T) {
+	reg := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer reg.Close()
+	ref, err := name.ParseReference(strings.TrimPrefix(reg.URL, "http://") + "/test/index:latest")
+	require.NoError(t, err)
+	idx, err := random.Index(64, 1, 2)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(ref, idx))
+
+	att, err := New().Attest(context.Background(), "testdata/document1.vex.json", []string{ref.String()})
+	require.NoError(t, err)
+	require.Len(t, att.Subject, 1)
+
+	att, err = New(WithSubjectPlatforms(true)).Attest(
+		context.Background(), "testdata/document1.vex.json", []string{ref.String()},
+	)
+	require.NoError(t, err)
+	require.Len(t, att.Subject, 3)
+}
+
+func TestAddImageSubjects(t *testing.T) {
+	reg := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer reg.Close()
+	ref, digest := pushTestImage(t, reg.URL)
+
+	// The deprecated helper records the same subject as attesting
+	att := attestation.New()
+	require.NoError(t, att.AddImageSubjects([]string{ref.String()}))
+	require.Equal(t, []intoto.Subject{attestation.ImageSubject(ref.String(), digest.DigestStr())}, att.Subject)
+
+	attested, err := New().Attest(context.Background(), "testdata/document1.vex.json", []string{ref.String()})
+	require.NoError(t, err)
+	require.Equal(t, att.Subject, attested.Subject)
+}
+
+func TestVerifyAttestedSubjects(t *testing.T) {
+	reg := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer reg.Close()
+	ref, err := name.ParseReference(strings.TrimPrefix(reg.URL, "http://") + "/test/index:latest")
+	require.NoError(t, err)
+	idx, err := random.Index(64, 1, 2)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(ref, idx))
+
+	// The SBOM describes an artifact identified by its SHA-512 digest only
+	sbomData := []byte(`{"spdxVersion":"SPDX-2.3","SPDXID":"SPDXRef-DOCUMENT","documentDescribes":["SPDXRef-app"],` +
+		`"packages":[{"SPDXID":"SPDXRef-app","name":"app","checksums":[{"algorithm":"SHA512","checksumValue":"` +
+		strings.Repeat("ab", 64) + `"}]}]}`)
+	sbomPath := filepath.Join(t.TempDir(), "app.spdx.json")
+	require.NoError(t, os.WriteFile(sbomPath, sbomData, 0o600))
+
+	ctx := context.Background()
+	att, err := New(
+		WithSubjectPlatforms(true),
+		WithSubjectSBOM(sbomPath),
+		WithSubjectFiles([]string{"testdata/test.vex.json"}),
+	).AttestDocuments(ctx, []string{"testdata/document1.vex.json"}, []string{ref.String()})
+	require.NoError(t, err)
+	require.Len(t, att.Subject, 5)
+
+	data, err := json.Marshal(att)
+	require.NoError(t, err)
+	vexStatement := &ImageStatement{}
+	require.NoError(t, json.Unmarshal(data, vexStatement))
+	sbomStatement := &ImageStatement{Predicate: sbomData}
+	sbomStatement.PredicateType = intoto.PredicateSPDX
+	statements := []*ImageStatement{vexStatement, sbomStatement}
+
+	impl := &defaultVexCtlImplementation{}
+	digest, err := impl.ResolveImageDigest(ctx, Options{}, ref.String())
+	require.NoError(t, err)
+	platforms, err := impl.ResolvePlatformDigests(ctx, Options{}, ref.String())
+	require.NoError(t, err)
+	require.Len(t, platforms, 2)
+
+	// The SBOM and file subjects are listed for information only
+	res, err := verifyStatements(Options{}, ref.String(), digest, platforms, statements, time.Now())
+	require.NoError(t, err)
+	require.True(t, res.Passed())
+	require.Empty(t, res.SubjectMismatches)
+	require.Len(t, res.ExtraSubjects, 2)
+
+	// Verifying one of the platform images passes too
+	res, err = verifyStatements(Options{}, ref.String(), platforms[0], nil, statements, time.Now())
+	require.NoError(t, err)
+	require.True(t, res.Passed())
+	require.Len(t, res.ExtraSubjects, 4)
+
+	// Attestations without a subject matching the image do not
+	other := "sha256:" + strings.Repeat("0", 64)
+	res, err = verifyStatements(Options{}, ref.String(), other, nil, statements, time.Now())
+	require.NoError(t, err)
+	require.False(t, res.Passed())
+	require.Len(t, res.SubjectMismatches, 1)
+}
+
+// pushTestImage pushes a random image to the registry and attaches three
+// unsigned attestations to it, two of them with VEX documents
+func pushTestImage(t *testing.T, registryURL string) (name.Reference, name.Digest) {
+	ref, err := name.ParseReference(strings.TrimPrefix(registryURL, "http://") + "/test/image:latest")
+	require.NoError(t, err)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	hash, err := img.Digest()
+	require.NoError(t, err)
+	digest := ref.Context().Digest(hash.String())
+
+	se, err := ociremote.SignedEntity(digest)
+	require.NoError(t, err)
+	for _, s := range []struct{ predicateType, id string }{
+		{vex.TypeURI, "doc-1"},
+		{vex.TypeURI, "doc-2"},
+		{"https://slsa.dev/provenance/v0.2", ""},
+	} {
+		se, err = mutate.AttachAttestationToEntity(se, testAttestation(t, s.predicateType, s.id))
+		require.NoError(t, err)
+	}
+	require.NoError(t, ociremote.WriteAttestations(digest.Repository, se))
+	return ref, digest
+}
+
+// testAttestation returns an unsigned attestation with a
+// predicate of the type, identified by id
+func testAttestation(t *testing.T, predicateType, id string, opts ...static.Option) oci.Signature {
+	statement, err := json.Marshal(map[string]interface{}{
+		"_type":         intoto.StatementInTotoV01,
+		"predicateType": predicateType,
+		"predicate":     map[string]string{"@id": id},
+	})
+	require.NoError(t, err)
+	env, err := json.Marshal(map[string]interface{}{
+		"payloadType": IntotoPayloadType,
+		"payload":     base64.StdEncoding.EncodeToString(statement),
+		"signatures":  []interface{}{},
+	})
+	require.NoError(t, err)
+	att, err := static.NewAttestation(env, append([]static.Option{static.WithLayerMediaType(types.DssePayloadType)}, opts...)...)
+	require.NoError(t, err)
+	return att
+}
+
+func TestReadImageAttestations(t *testing.T) {
+	reg := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer reg.Close()
+	ref, _ := pushTestImage(t, reg.URL)
+
+	// The provenance attestation is skipped
+	impl := &defaultVexCtlImplementation{}
+	opts := Options{Verification: AttestationVerification{Insecure: true}}
+	vexes, err := impl.ReadImageAttestations(context.Background(), opts, ref.String())
+	require.NoError(t, err)
+	require.Len(t, vexes, 2)
+	for _, doc := range vexes {
+		require.NotNil(t, doc)
+	}
+}
+
+func TestDetach(t *testing.T) {
+	reg := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer reg.Close()
+	ref, digest := pushTestImage(t, reg.URL)
+
+	remaining := func() int {
+		se, err := ociremote.SignedEntity(digest)
+		require.NoError(t, err)
+		atts, err := se.Attestations()
+		require.NoError(t, err)
+		list, err := atts.Get()
+		require.NoError(t, err)
+		return len(list)
+	}
+	require.Equal(t, 3, remaining())
+
+	// Options without criteria are rejected
+	_, err := New().Detach(context.Background(), ref.String(), DetachOptions{})
+	require.Error(t, err)
+
+	removed, err := New().Detach(context.Background(), ref.String(), DetachOptions{DocumentIDs: []string{"doc-1"}})
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	require.Equal(t, 2, remaining())
+
+	// Nothing matches, nothing is removed
+	removed, err = New().Detach(context.Background(), ref.String(), DetachOptions{DocumentIDs: []string{"doc-1"}})
+	require.NoError(t, err)
+	require.Empty(t, removed)
+
+	removed, err = New().Detach(context.Background(), ref.String(), DetachOptions{PredicateTypes: []string{vex.TypeURI}})
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	require.Equal(t, 1, remaining())
+}
+
+func TestSupersedeAttestations(t *testing.T) {
+	reg := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer reg.Close()
+	_, digest := pushTestImage(t, reg.URL)
+
+	se, err := ociremote.SignedEntity(digest)
+	require.NoError(t, err)
+	superseded, err := vexAttestationDigests(se)
+	require.NoError(t, err)
+	require.Len(t, superseded, 2)
+
+	annotations := supersedeAnnotations(map[string]string{AnnotationScannerName: "grype"}, superseded)
+	att := testAttestation(t, vex.TypeURI, "doc-3", static.WithAnnotations(annotations))
+	se, err = mutate.AttachAttestationToEntity(se, att, mutate.WithReplaceOp(&supersedeOp{DetachOptions{Digests: superseded}}))
+	require.NoError(t, err)
+	require.NoError(t, ociremote.WriteAttestations(digest.Repository, se))
+
+	// The provenance attestation is kept next to the new VEX attestation
+	se, err = ociremote.SignedEntity(digest)
+	require.NoError(t, err)
+	atts, err := se.Attestations()
+	require.NoError(t, err)
+	current, err := atts.Get()
+	require.NoError(t, err)
+	require.Len(t, current, 2)
+
+	remaining, err := vexAttestationDigests(se)
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	for _, a := range current {
+		d, err := a.Digest()
+		require.NoError(t, err)
+		if d.String() != remaining[0] {
+			continue
+		}
+		got, err := a.Annotations()
+		require.NoError(t, err)
+		require.Equal(t, strings.Join(superseded, ","), got[AnnotationSupersedes])
+		require.Equal(t, "grype", got[AnnotationScannerName])
+	}
+}
+
+func TestAttestationVerification(t *testing.T) {
+	for _, tc := range []struct {
+		opts       AttestationVerification
+		shouldErr  bool
+		unverified bool
+	}{
+		{AttestationVerification{}, true, true},
+		{AttestationVerification{Insecure: true}, false, false},
+		{AttestationVerification{Key: "cosign.pub"}, false, false},
+		{AttestationVerification{CertificateIdentity: "me@example.com", CertificateOIDCIssuer: "https://accounts.google.com"}, false, false},
+		{AttestationVerification{CertificateIdentity: "me@example.com"}, true, false},
+		{AttestationVerification{Key: "cosign.pub", CertificateIdentity: "me@example.com"}, true, false},
+	} {
+		err := tc.opts.Validate()
+		if !tc.shouldErr {
+			require.NoError(t, err)
+			continue
+		}
+		require.Error(t, err)
+		require.Equal(t, tc.unverified, errors.Is(err, ErrUnverifiedAttestations))
+	}
+
+	// Reading attestations without verification options fails before
+	// trusting anything attached to the image
+	reg := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer reg.Close()
+	ref, err := name.ParseReference(strings.TrimPrefix(reg.URL, "http://") + "/test/image:latest")
+	require.NoError(t, err)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	_, err = New().VexFromURI(context.Background(), ref.String())
+	require.ErrorIs(t, err, ErrUnverifiedAttestations)
+}
+
+func TestVerifyBundle(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	// Certificate authority and signing certificate
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test-ca"},
+		NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "roots.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o600))
+
+	signerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2), EmailAddresses: []string{"me@example.com"},
+		NotBefore: now.Add(-time.Minute), NotAfter: now.Add(10 * time.Minute),
+		KeyUsage: x509.KeyUsageDigitalSignature, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}, Value: []byte("https://issuer.example.com")}},
+	}, caCert, &signerKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	// Attestation of the document, signed in a DSSE envelope
+	docData, err := os.ReadFile("testdata/test.vex.json")
+	require.NoError(t, err)
+	doc := vex.VEX{}
+	require.NoError(t, json.Unmarshal(docData, &doc))
+	att := attestation.New()
+	att.Predicate = doc
+	var b bytes.Buffer
+	require.NoError(t, att.ToJSON(&b))
+	sv, err := signature.LoadECDSASignerVerifier(signerKey, crypto.SHA256)
+	require.NoError(t, err)
+	envelope, err := dsse.WrapSigner(sv, IntotoPayloadType).SignMessage(bytes.NewReader(b.Bytes()))
+	require.NoError(t, err)
+
+	// Transparency log entry recording the envelope
+	rekorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rekorDER, err := x509.MarshalPKIXPublicKey(&rekorKey.PublicKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rekor.pub"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rekorDER}), 0o600))
+	logID := sha256.Sum256(rekorDER)
+	envelopeHash := sha256.Sum256(envelope)
+	body := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(
+		`{"apiVersion":"0.0.1","kind":"intoto","spec":{"content":{"hash":{"algorithm":"sha256","value":"%s"}}}}`,
+		hex.EncodeToString(envelopeHash[:]),
+	)))
+	entry := map[string]interface{}{
+		"body": body, "integratedTime": now.Unix(), "logIndex": 42, "logID": hex.EncodeToString(logID[:]),
+	}
+	canonical, err := json.Marshal(entry)
+	require.NoError(t, err)
+	entryHash := sha256.Sum256(canonical)
+	set, err := ecdsa.SignASN1(rand.Reader, rekorKey, entryHash[:])
+	require.NoError(t, err)
+
+	bundleData, err := json.Marshal(map[string]interface{}{
+		"base64Signature": base64.StdEncoding.EncodeToString(envelope),
+		"cert":            base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})),
+		"rekorBundle":     map[string]interface{}{"SignedEntryTimestamp": set, "Payload": entry},
+	})
+	require.NoError(t, err)
+
+	bv := &BundleVerification{
+		AttestationVerification: AttestationVerification{
+			CertificateIdentity: "me@example.com", CertificateOIDCIssuer: "https://issuer.example.com",
+		},
+		TrustedRoots:   filepath.Join(dir, "roots.pem"),
+		RekorPublicKey: filepath.Join(dir, "rekor.pub"),
+	}
+	res, err := New().VerifyBundle(context.Background(), bv, bundleData, docData)
+	require.NoError(t, err)
+	require.Equal(t, "me@example.com", res.Signer)
+	require.Equal(t, int64(42), res.LogIndex)
+	require.Len(t, res.Document.Statements, 2)
+
+	// A different document is not accepted
+	otherDoc := bytes.Replace(docData, []byte("CVE-2021-44228"), []byte("CVE-2021-45046"), 1)
+	_, err = New().VerifyBundle(context.Background(), bv, bundleData, otherDoc)
+	require.Error(t, err)
+
+	// Nor another signer
+	other := *bv
+	other.CertificateIdentity = "someone@example.com"
+	_, err = New().VerifyBundle(context.Background(), &other, bundleData, docData)
+	require.Error(t, err)
+
+	// Nor a tampered log entry
+	entry["logIndex"] = 43
+	tampered, err := json.Marshal(map[string]interface{}{
+		"base64Signature": base64.StdEncoding.EncodeToString(envelope),
+		"cert":            base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})),
+		"rekorBundle":     map[string]interface{}{"SignedEntryTimestamp": set, "Payload": entry},
+	})
+	require.NoError(t, err)
+	_, err = New().VerifyBundle(context.Background(), bv, tampered, docData)
+	require.Error(t, err)
+}
+
+func TestWatch(t *testing.T) {
+	reg := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer reg.Close()
+	ref, digest := pushTestImage(t, reg.URL)
+
+	ctx := context.Background()
+	w := New().newImageWatcher(ref.String())
+	event, err := w.poll(ctx)
+	require.NoError(t, err)
+	require.Nil(t, event)
+	event, err = w.poll(ctx)
+	require.NoError(t, err)
+	require.Nil(t, event)
+
+	// Attaching a VEX attestation triggers an event, other predicates do not
+	se, err := ociremote.SignedEntity(digest)
+	require.NoError(t, err)
+	se, err = mutate.AttachAttestationToEntity(se, testAttestation(t, "https://spdx.dev/Document", ""))
+	require.NoError(t, err)
+	require.NoError(t, ociremote.WriteAttestations(digest.Repository, se))
+	event, err = w.poll(ctx)
+	require.NoError(t, err)
+	require.Nil(t, event)
+
+	se, err = mutate.AttachAttestationToEntity(se, testAttestation(t, vex.TypeURI, "doc-3"))
+	require.NoError(t, err)
+	require.NoError(t, ociremote.WriteAttestations(digest.Repository, se))
+	event, err = w.poll(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	require.Equal(t, digest.DigestStr(), event.Digest)
+	require.Len(t, event.Attestations, 3)
+	require.Len(t, event.Added, 1)
+	require.Empty(t, event.Removed)
+
+	// Detached attestations are reported as removed
+	removed, err := New().Detach(ctx, ref.String(), DetachOptions{DocumentIDs: []string{"doc-1"}})
+	require.NoError(t, err)
+	event, err = w.poll(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	require.Equal(t, removed, event.Removed)
+
+	require.Error(t, New().Watch(ctx, ref.String(), 0, nil))
+}
+
+func TestRegistryMirrors(t *testing.T) {
+	reg := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer reg.Close()
+	mirror := strings.TrimPrefix(reg.URL, "http://")
+
+	opts := Options{RegistryMirrors: map[string]string{
+		"gcr.io":    mirror + "/gcr",
+		"docker.io": mirror,
+	}}
+	for ref, expected := range map[string]string{
+		"gcr.io/project/app:v1":  mirror + "/gcr/project/app:v1",
+		"nginx:latest":           mirror + "/library/nginx:latest",
+		"quay.io/org/app:latest": "quay.io/org/app:latest",
+		"gcr.io/project/app@sha256:e4cf37d568d195b4b5af4c36a80e4d5bb7a7ea8e5bc91a7bb3e9b89f05e8a38d": mirror +
+			"/gcr/project/app@sha256:e4cf37d568d195b4b5af4c36a80e4d5bb7a7ea8e5bc91a7bb3e9b89f05e8a38d",
+	} {
+		res, err := parseReference(opts, ref)
+		require.NoError(t, err)
+		require.Equal(t, expected, res.String())
+	}
+
+	// Digests are resolved through the mirror
+	mirrored, err := name.ParseReference(mirror + "/gcr/project/app:v1")
+	require.NoError(t, err)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(mirrored, img))
+	hash, err := img.Digest()
+	require.NoError(t, err)
+
+	digest, err := (&defaultVexCtlImplementation{}).ResolveImageDigest(context.Background(), opts, "gcr.io/project/app:v1")
+	require.NoError(t, err)
+	require.Equal(t, hash.String(), digest)
+}
+
+func TestParseReport(t *testing.T) {
+	data, err := os.ReadFile("testdata/nginx.sarif.json")
+	require.NoError(t, err)
+	format, err := DetectReportFormat(data)
+	require.NoError(t, err)
+	require.Equal(t, ReportFormatSARIF, format)
+	report, err := ParseReport(data)
+	require.NoError(t, err)
+	require.NotEmpty(t, report.Runs)
+
+	for data, expected := range map[string]string{
+		`{"matches":[],"descriptor":{"name":"grype"}}`: ReportFormatGrype,
+		`{"SchemaVersion":2,"Results":[]}`:             ReportFormatTrivy,
+	} {
+		format, err := DetectReportFormat([]byte(data))
+		require.NoError(t, err)
+		require.Equal(t, expected, format)
+	}
+
+	_, err = DetectReportFormat([]byte(`{"hello":"world"}`))
+	require.Error(t, err)
+}
+
+func TestReportImages(t *testing.T) {
+	report, err := sarif.Open("testdata/nginx.sarif.json")
+	require.NoError(t, err)
+	require.Empty(t, ReportImages(report))
+
+	report.Runs[0].Properties = map[string]interface{}{
+		"imageName":   "cgr.dev/chainguard/nginx:latest",
+		"repoDigests": []interface{}{"cgr.dev/chainguard/nginx@sha256:e4cf37d568d195b4b5af4c36a"},
+	}
+	require.Equal(t, []string{"cgr.dev/chainguard/nginx@sha256:e4cf37d568d195b4b5af4c36a"}, ReportImages(report))
+
+	report.Runs[0].Properties = map[string]interface{}{"imageName": "cgr.dev/chainguard/nginx:latest"}
+	require.Equal(t, []string{"cgr.dev/chainguard/nginx:latest"}, ReportImages(report))
+}
+
+func TestCompressedDocuments(t *testing.T) {
+	data, err := os.ReadFile("testdata/document1.vex.json")
+	require.NoError(t, err)
+	dir := t.TempDir()
+
+	var gz bytes.Buffer
+	gzw := gzip.NewWriter(&gz)
+	_, err = gzw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+	require.NoError(t, os.WriteFile(dir+"/document1.vex.json.gz", gz.Bytes(), os.FileMode(0o644)))
+
+	zw, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	// Without the extension, zstd data is detected by its magic bytes
+	require.NoError(t, os.WriteFile(dir+"/document1", zw.EncodeAll(data, nil), os.FileMode(0o644)))
+
+	impl := &defaultVexCtlImplementation{}
+	for _, path := range []string{dir + "/document1.vex.json.gz", dir + "/document1"} {
+		vexes, err := impl.OpenVexData(context.Background(), Options{}, []string{path})
+		require.NoError(t, err)
+		require.Len(t, vexes, 1)
+		require.NotEmpty(t, vexes[0].Statements)
+
+		vexes, err = impl.LoadFiles(context.Background(), []string{path})
+		require.NoError(t, err)
+		require.NotEmpty(t, vexes[0].Statements)
+	}
+}
+
+func TestDetectDocumentFormat(t *testing.T) {
+	for data, expected := range map[string]string{
+		`{"@context": "https://openvex.dev/ns", "statements": []}`:       DocumentFormatOpenVEX,
+		"\n  {\"statements\": []}":                                       DocumentFormatOpenVEX,
+		"id: my-vexdoc\nstatements:\n  - vulnerability: CVE-1234-5678\n": DocumentFormatYAML,
+		`{"document": {"csaf_version": "2.0"}}`:                          DocumentFormatCSAF,
+		`{"bomFormat": "CycloneDX", "vulnerabilities": []}`:              DocumentFormatCycloneDX,
+	} {
+		format, err := DetectDocumentFormat([]byte(data))
+		require.NoError(t, err)
+		require.Equal(t, expected, format, data)
+	}
+	_, err := DetectDocumentFormat([]byte("  "))
+	require.Error(t, err)
+
+	// YAML documents are read without specifying the format
+	path := t.TempDir() + "/doc.vex.yaml"
+	require.NoError(t, os.WriteFile(
+		path, []byte("id: my-vexdoc\nstatements:\n  - vulnerability: CVE-1234-5678\n    status: fixed\n"),
+		os.FileMode(0o644),
+	))
+	vexes, err := (&defaultVexCtlImplementation{}).OpenVexData(context.Background(), Options{}, []string{path})
+	require.NoError(t, err)
+	require.Len(t, vexes[0].Statements, 1)
+	require.Equal(t, "CVE-1234-5678", vexes[0].Statements[0].Vulnerability)
+}
+
+func TestWriteDocument(t *testing.T) {
+	now := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	issued := now.Add(-3 * 24 * time.Hour)
+	doc := vex.New()
+	doc.ID = "my-vexdoc"
+	doc.Timestamp = &issued
+	doc.Statements = []vex.Statement{
+		{Vulnerability: "CVE-2023-0002", Status: vex.StatusFixed, Products: []string{"pkg:oci/app"}, Timestamp: &issued},
+		{
+			Vulnerability: "CVE-2023-0001", Status: vex.StatusNotAffected, Products: []string{"pkg:oci/app", "pkg:oci/lib"},
+			Justification: vex.VulnerableCodeNotPresent, ImpactStatement: "the code is not compiled in",
+		},
+		{Vulnerability: "CVE-2023-0003", Status: vex.StatusAffected},
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, WriteDocument(&b, &doc, ShowOptions{Now: now}))
+	out := b.String()
+	require.Contains(t, out, "Document:   my-vexdoc")
+	require.Contains(t, out, "(3 days ago)")
+	require.Contains(t, out, "pkg:oci/app\n  ├─ CVE-2023-0001  not_affected  vulnerable_code_not_present\n")
+	require.Contains(t, out, "  │    impact: the code is not compiled in\n  └─ CVE-2023-0002  fixed  (3 days ago)\n")
+	require.Contains(t, out, "(no product)\n  └─ CVE-2023-0003  affected\n")
+	require.NotContains(t, out, "\033[")
+
+	b.Reset()
+	require.NoError(t, WriteDocument(&b, &doc, ShowOptions{Now: now, Color: true}))
+	require.Contains(t, b.String(), "\033[31maffected\033[0m")
+
+	require.Equal(t, "1 year ago", relativeTime(now.Add(-400*24*time.Hour), now))
+	require.Equal(t, "2 hours from now", relativeTime(now.Add(2*time.Hour), now))
+}
+
+func TestStats(t *testing.T) {
+	now := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	recent := now.Add(-24 * time.Hour)
+	old := now.Add(-100 * 24 * time.Hour)
+	doc := vex.New()
+	doc.Author = "Chainguard"
+	doc.Timestamp = &old
+	doc.Statements = []vex.Statement{
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed, Products: []string{"pkg:oci/app"}, Timestamp: &recent},
+		{
+			Vulnerability: "CVE-2023-0002", Status: vex.StatusNotAffected, Products: []string{"pkg:oci/app", "pkg:oci/lib"},
+			Justification: vex.VulnerableCodeNotPresent,
+		},
+	}
+
+	stats, err := New().Stats([]*vex.VEX{&doc}, now)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Documents)
+	require.Equal(t, 2, stats.Statements)
+	require.Positive(t, stats.Size)
+	require.Equal(t, map[string]int{"fixed": 1, "not_affected": 1}, stats.Statuses)
+	require.Equal(t, map[string]int{"vulnerable_code_not_present": 1}, stats.Justifications)
+	require.Equal(t, map[string]int{"pkg:oci/app": 2, "pkg:oci/lib": 1}, stats.Products)
+	require.Equal(t, map[string]int{"Chainguard": 2}, stats.Authors)
+	require.Equal(t, map[string]int{"<7d": 1, "90-365d": 1}, stats.Ages)
+
+	var b bytes.Buffer
+	require.NoError(t, stats.Write(&b))
+	require.Contains(t, b.String(), "Statements: 2")
+}
+
+func TestLineage(t *testing.T) {
+	early := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(4 * time.Hour)
+	doc1 := vex.New()
+	doc1.ID = "doc-1"
+	doc1.Timestamp = &early
+	doc1.Statements = []vex.Statement{
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusUnderInvestigation, Products: []string{"pkg:oci/app"}},
+		{Vulnerability: "CVE-2023-0002", Status: vex.StatusAffected, Products: []string{"pkg:oci/app"}},
+	}
+	doc2 := vex.New()
+	doc2.ID = "doc-2"
+	doc2.Timestamp = &late
+	doc2.Statements = []vex.Statement{
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed, Products: []string{"pkg:oci/app"}},
+	}
+
+	vexctl := New()
+	sources := []*vex.VEX{&doc1, &doc2}
+	merged, err := vexctl.Merge(context.Background(), &MergeOptions{Vulnerabilities: []string{"CVE-2023-0001"}}, sources)
+	require.NoError(t, err)
+
+	lineage := vexctl.Lineage(sources, merged)
+	require.Len(t, lineage.Statements, 3)
+	require.True(t, lineage.Statements[0].Merged)
+	require.False(t, lineage.Statements[1].Merged)
+	require.True(t, lineage.Statements[2].Merged)
+	require.Equal(t, []int{0}, lineage.Statements[2].Supersedes)
+	require.Empty(t, lineage.Statements[0].Supersedes)
+
+	var b bytes.Buffer
+	require.NoError(t, lineage.WriteDOT(&b))
+	require.Contains(t, b.String(), "s0 -> s2 [style=dashed, label=\"superseded by\"]")
+	b.Reset()
+	require.NoError(t, lineage.WriteMermaid(&b))
+	require.True(t, strings.HasPrefix(b.String(), "flowchart LR\n"))
+}
+
+func TestTouch(t *testing.T) {
+	old := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	doc := vex.New()
+	doc.Timestamp = &old
+	doc.Version = "3"
+	doc.Statements = []vex.Statement{
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed, Products: []string{"pkg:oci/app"}, Timestamp: &old},
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed, Products: []string{"pkg:oci/lib"}, Timestamp: &old},
+		{Vulnerability: "CVE-2023-0002", Status: vex.StatusFixed, Products: []string{"pkg:oci/app"}, Timestamp: &old},
+	}
+
+	newDoc, touched := New().Touch(&doc, TouchOptions{
+		Vulnerabilities: []string{"CVE-2023-0001"}, Products: []string{"pkg:oci/app"}, Now: now,
+	})
+	require.Equal(t, 1, touched)
+	require.Equal(t, now, *newDoc.Statements[0].Timestamp)
+	require.Equal(t, old, *newDoc.Statements[1].Timestamp)
+	require.Equal(t, old, *newDoc.Statements[2].Timestamp)
+	require.Equal(t, now, *newDoc.Timestamp)
+	require.Equal(t, "4", newDoc.Version)
+	require.Equal(t, old, *doc.Statements[0].Timestamp)
+
+	_, touched = New().Touch(&doc, TouchOptions{Products: []string{"pkg:oci/other"}, Now: now})
+	require.Zero(t, touched)
+}
+
+func TestVersProductMatching(t *testing.T) {
+	for _, tc := range []struct {
+		product  string
+		expected bool
+	}{
+		{"pkg:npm/lodash@2.0.0", true},
+		{"pkg:npm/lodash@2.4.6", true},
+		{"pkg:npm/lodash@2.4.7", false},
+		{"pkg:npm/lodash@2.10.0", false},
+		{"pkg:npm/lodash@1.9.9", false},
+		{"pkg:npm/lodash@3.1.0", true},
+		{"pkg:npm/lodash@3.2.0", false},
+		{"pkg:npm/lodash", false},
+		{"pkg:npm/underscore@2.1.0", false},
+	} {
+		require.Equal(t, tc.expected,
+			productMatches("pkg:npm/lodash@vers:npm/>=2.0.0|<2.4.7|3.1.0", tc.product), tc.product)
+	}
+	require.True(t, productMatches("pkg:npm/lodash@vers:npm%2F%3E%3D2.0.0%7C%3C2.4.7", "pkg:npm/lodash@2.1.0"))
+	require.True(t, productMatches("pkg:npm/lodash@vers:npm/*", "pkg:npm/lodash@9.0.0"))
+	require.False(t, productMatches("pkg:npm/lodash@vers:npm/!=2.0.0", "pkg:npm/lodash@2.0.0"))
+
+	doc := vex.New()
+	doc.Statements = []vex.Statement{
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed, Products: []string{"pkg:npm/lodash@vers:npm/>=2.0.0|<2.4.7"}},
+		{Vulnerability: "CVE-2023-0002", Status: vex.StatusFixed, Products: []string{"pkg:npm/lodash@2.5.0"}},
+	}
+	merged, err := New().Merge(context.Background(), &MergeOptions{Products: []string{"pkg:npm/lodash@2.3.0"}}, []*vex.VEX{&doc})
+	require.NoError(t, err)
+	require.Len(t, merged.Statements, 1)
+	require.Equal(t, "CVE-2023-0001", merged.Statements[0].Vulnerability)
+}
+
+// productReport returns a report with a result about a vulnerability
+// for each of the products, set as the purl property of the result
+func productReport(vulnID string, products ...string) *sarif.Report {
+	report := sarif.New()
+	run := gosarif.NewRun("test-scanner", "https://example.com")
+	for _, p := range products {
+		res := run.AddResult(vulnID)
+		if p != "" {
+			res.WithProperties(gosarif.Properties{"purl": p})
+		}
+	}
+	report.AddRun(run)
+	return report
+}
+
+func TestApplyVersRanges(t *testing.T) {
+	doc := vex.New()
+	doc.Statements = []vex.Statement{
+		{
+			Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed,
+			Products: []string{"pkg:npm/lodash@vers:npm/>=2.0.0|<2.4.7"},
+		},
+	}
+	products := []string{"pkg:npm/lodash@2.3.0?arch=noarch", "pkg:npm/lodash@2.4.7", "pkg:npm/underscore@2.4.7", ""}
+
+	// The result of the version outside the range is kept
+	report, err := New().Apply(context.Background(), productReport("CVE-2023-0001", products...), []*vex.VEX{&doc})
+	require.NoError(t, err)
+	require.Len(t, report.Runs[0].Results, 1)
+	require.Equal(t, "pkg:npm/lodash@2.4.7", report.Runs[0].Results[0].Properties["purl"])
+
+	data, err := json.Marshal(productReport("CVE-2023-0001", products...))
+	require.NoError(t, err)
+	var b bytes.Buffer
+	remaining, err := New().ApplyStream(context.Background(), bytes.NewReader(data), &b, []*vex.VEX{&doc})
+	require.NoError(t, err)
+	require.Equal(t, 1, remaining)
+	require.Contains(t, b.String(), "pkg:npm/lodash@2.4.7")
+
+	// Results without a package URL are identified with --product
+	report, err = New(WithProducts([]string{"pkg:npm/lodash@3.0.0"})).Apply(
+		context.Background(), productReport("CVE-2023-0001", ""), []*vex.VEX{&doc},
+	)
+	require.NoError(t, err)
+	require.Len(t, report.Runs[0].Results, 1)
+
+	// Statements about the image the package was found in still apply
+	doc.Statements[0].Products = []string{"pkg:oci/app"}
+	doc.Statements[0].Subcomponents = []string{"pkg:npm/lodash@vers:npm/<2.4.7"}
+	report, err = New().Apply(context.Background(), productReport("CVE-2023-0001", products...), []*vex.VEX{&doc})
+	require.NoError(t, err)
+	require.Len(t, report.Runs[0].Results, 1)
+	doc.Statements[0].Subcomponents = nil
+	report, err = New().Apply(context.Background(), productReport("CVE-2023-0001", products...), []*vex.VEX{&doc})
+	require.NoError(t, err)
+	require.Empty(t, report.Runs[0].Results)
+}
+
+func TestCPEProductMatching(t *testing.T) {
+	for _, tc := range []struct {
+		statementProduct string
+		product          string
+		expected         bool
+	}{
+		{"cpe:2.3:a:apache:log4j:2.14.1:*:*:*:*:*:*:*", "cpe:2.3:a:apache:log4j:2.14.1:*:*:*:*:*:*:*", true},
+		{"cpe:2.3:a:apache:log4j:*:*:*:*:*:*:*:*", "cpe:2.3:a:apache:log4j:2.14.1:-:*:*:*:*:*:*", true},
+		{"cpe:2.3:a:apache:log4j:2.14.1:*:*:*:*:*:*:*", "cpe:2.3:a:apache:log4j:2.15.0:*:*:*:*:*:*:*", false},
+		{"cpe:/a:apache:log4j:2.14.1", "cpe:2.3:a:Apache:Log4j:2.14.1:*:*:*:*:*:*:*", true},
+		{"cpe:2.3:a:apache:log4j:2.14.1:*:*:*:*:*:*:*", "cpe:/a:apache:log4j", false},
+		{"cpe:2.3:a:vendor:app\\:ext:1.0:*:*:*:*:*:*:*", "cpe:/a:vendor:app%3aext:1.0", true},
+		{"cpe:2.3:a:apache:log4j:*:*:*:*:*:*:*:*", "pkg:maven/org.apache.logging.log4j/log4j-core@2.14.1", false},
+		{"cpe:2.3:a:apache:log4j", "cpe:2.3:a:apache:log4j", true},
+		{"cpe:2.3:a:apache:log4j", "cpe:2.3:a:apache:log4j:2.14.1:*:*:*:*:*:*:*", false},
+	} {
+		require.Equal(t, tc.expected, productMatches(tc.statementProduct, tc.product), tc.statementProduct+" "+tc.product)
+	}
+}
+
+func TestApplyCPEs(t *testing.T) {
+	data, err := os.ReadFile("testdata/nginx.grype.json")
+	require.NoError(t, err)
+	doc := vex.New()
+	doc.Statements = []vex.Statement{
+		{
+			Vulnerability: "CVE-2009-4487", Status: vex.StatusNotAffected,
+			Justification: vex.VulnerableCodeNotInExecutePath,
+			Products:      []string{"cpe:2.3:a:nginx:nginx:1.20.0:*:*:*:*:*:*:*"},
+		},
+	}
+
+	// The CPE recorded by grype is of another version
+	report, err := ParseReport(data)
+	require.NoError(t, err)
+	report, err = New().Apply(context.Background(), report, []*vex.VEX{&doc})
+	require.NoError(t, err)
+	require.Len(t, report.Runs[0].Results, 2)
+
+	doc.Statements[0].Products = []string{"cpe:/a:nginx:nginx:1.22.1-1~bullseye"}
+	report, err = ParseReport(data)
+	require.NoError(t, err)
+	report, err = New().Apply(context.Background(), report, []*vex.VEX{&doc})
+	require.NoError(t, err)
+	require.Len(t, report.Runs[0].Results, 1)
+	require.Equal(t, "CVE-2022-27664", *report.Runs[0].Results[0].RuleID)
+
+	// Results without CPEs are identified with --product
+	doc.Statements[0].Products = []string{"cpe:2.3:a:nginx:nginx:*:*:*:*:*:*:*:*"}
+	doc.Statements[0].Vulnerability = "CVE-2023-0001"
+	report, err = New(WithProducts([]string{"cpe:2.3:a:nginx:nginx:1.25.0:*:*:*:*:*:*:*"})).Apply(
+		context.Background(), productReport("CVE-2023-0001", ""), []*vex.VEX{&doc},
+	)
+	require.NoError(t, err)
+	require.Empty(t, report.Runs[0].Results)
+	doc.Statements[0].Products = []string{"cpe:2.3:a:nginx:nginx:1.24.0:*:*:*:*:*:*:*"}
+	report, err = New(WithProducts([]string{"cpe:2.3:a:nginx:nginx:1.25.0:*:*:*:*:*:*:*"})).Apply(
+		context.Background(), productReport("CVE-2023-0001", ""), []*vex.VEX{&doc},
+	)
+	require.NoError(t, err)
+	require.Len(t, report.Runs[0].Results, 1)
+}
+
+func TestParseCSAF(t *testing.T) {
+	data, err := os.ReadFile("testdata/csaf.json")
+	require.NoError(t, err)
+
+	doc, err := ParseCSAF(data, nil)
+	require.NoError(t, err)
+	require.Equal(t, "EXAMPLE-VEX-2023-0001", doc.ID)
+	require.Equal(t, "Example Company", doc.Author)
+	require.Equal(t, "2", doc.Version)
+	require.Equal(t, time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC), *doc.Timestamp)
+	require.Len(t, doc.Statements, 4)
+
+	require.Equal(t, "CVE-2023-0001", doc.Statements[0].Vulnerability)
+	require.Equal(t, vex.StatusNotAffected, doc.Statements[0].Status)
+	require.Equal(t, vex.VulnerableCodeNotInExecutePath, doc.Statements[0].Justification)
+	require.Equal(t, []string{
+		"pkg:oci/platform@sha256%3A0001", "cpe:2.3:a:example:platform:2.0:*:*:*:*:*:*:*",
+	}, doc.Statements[0].Products)
+
+	require.Equal(t, vex.StatusAffected, doc.Statements[1].Status)
+	require.Equal(t, []string{"TOOL"}, doc.Statements[1].Products)
+	require.Equal(t, "Update to Example Tool 1.1", doc.Statements[1].ActionStatement)
+
+	require.Equal(t, "GHSA-xxxx-yyyy-zzzz", doc.Statements[2].Vulnerability)
+	require.Equal(t, vex.StatusFixed, doc.Statements[2].Status)
+	require.Equal(t, []string{"pkg:oci/platform@sha256%3A0001"}, doc.Statements[2].Products)
+	require.Equal(t, []string{"pkg:apk/wolfi/openssl@3.0.7"}, doc.Statements[2].Subcomponents)
+	for i := range doc.Statements {
+		require.NoError(t, doc.Statements[i].Validate())
+	}
+
+	doc, err = ParseCSAF(data, []string{"PLATFORM-1.0"})
+	require.NoError(t, err)
+	require.Len(t, doc.Statements, 2)
+	doc, err = ParseCSAF(data, []string{"cpe:2.3:a:example:platform:2.0:*:*:*:*:*:*:*"})
+	require.NoError(t, err)
+	require.Len(t, doc.Statements, 2)
+	require.Equal(t, vex.StatusUnderInvestigation, doc.Statements[1].Status)
+
+	_, err = ParseCSAF([]byte(`{"document": {"csaf_version": "3.0"}}`), nil)
+	require.Error(t, err)
+}
+
+func TestStore(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	require.False(t, store.Exists())
+
+	app := vex.New()
+	app.ID = "app"
+	app.Statements = []vex.Statement{
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed, Products: []string{"pkg:npm/app@vers:npm/>=1.0.0|<2.0.0"}},
+	}
+	lib := vex.New()
+	lib.ID = "lib"
+	lib.Statements = []vex.Statement{
+		{Vulnerability: "CVE-2023-0002", Status: vex.StatusFixed, Products: []string{"pkg:npm/lib@1.0.0"}},
+	}
+
+	entry, added, err := store.Add(&app, "app.vex.json")
+	require.NoError(t, err)
+	require.True(t, added)
+	require.Equal(t, []string{"pkg:npm/app@vers:npm/>=1.0.0|<2.0.0"}, entry.Products)
+	_, added, err = store.Add(&app, "app.vex.json")
+	require.NoError(t, err)
+	require.False(t, added)
+	_, _, err = store.Add(&lib, "lib.vex.json")
+	require.NoError(t, err)
+	require.True(t, store.Exists())
+
+	entries, err := store.List(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	docs, err := store.Documents([]string{"pkg:npm/app@1.2.0"})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, "app", docs[0].ID)
+
+	removed, err := store.Remove([]string{"app"})
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	entries, err = store.List(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "lib", entries[0].ID)
+}
+
+func TestMergeURIs(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer srv.Close()
+
+	doc, err := New().MergeURIs(context.Background(), &MergeOptions{}, []string{
+		"testdata/document1.vex.json", srv.URL + "/document2.vex.json",
+	})
+	require.NoError(t, err)
+	require.Len(t, doc.Statements, 2)
+	require.Equal(t, vex.StatusUnderInvestigation, doc.Statements[0].Status)
+	require.Equal(t, vex.StatusAffected, doc.Statements[1].Status)
+}
+
+func TestMergeConsolidate(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+	t2 := t0.Add(48 * time.Hour)
+	docs := []*vex.VEX{}
+	for i, s := range []vex.Statement{
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed, Products: []string{"pkg:oci/app"}, Timestamp: &t0},
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed, Products: []string{"pkg:oci/lib", "pkg:oci/app"}, Timestamp: &t1},
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed, Products: []string{"pkg:oci/cli"}, Timestamp: &t2},
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusAffected, Products: []string{"pkg:oci/web"}, Timestamp: &t0},
+	} {
+		doc := vex.New()
+		doc.ID = "doc-" + strconv.Itoa(i)
+		doc.Timestamp = &t0
+		doc.Statements = []vex.Statement{s}
+		docs = append(docs, &doc)
+	}
+
+	merged, err := New().Merge(context.Background(), &MergeOptions{
+		Consolidate: true, ConsolidateWindow: 24 * time.Hour,
+	}, docs)
+	require.NoError(t, err)
+	require.Len(t, merged.Statements, 3)
+	for _, s := range merged.Statements {
+		switch {
+		case s.Status == vex.StatusAffected:
+			require.Equal(t, []string{"pkg:oci/web"}, s.Products)
+		case s.Timestamp.Equal(t0):
+			require.Equal(t, []string{"pkg:oci/app", "pkg:oci/lib"}, s.Products)
+		default:
+			require.Equal(t, []string{"pkg:oci/cli"}, s.Products)
+		}
+	}
+
+	merged, err = New().Merge(context.Background(), &MergeOptions{}, docs)
+	require.NoError(t, err)
+	require.Len(t, merged.Statements, 4)
+}
+
+func TestConsolidateSubcomponents(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	ss := consolidateStatements([]vex.Statement{
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed, Products: []string{"pkg:oci/a"}, Subcomponents: []string{"pkg:apk/x", "pkg:apk/z"}, Timestamp: &t0},
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed, Products: []string{"pkg:oci/b"}, Subcomponents: []string{"pkg:apk/y"}, Timestamp: &t0},
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed, Products: []string{"pkg:oci/c"}, Subcomponents: []string{"pkg:apk/z", "pkg:apk/x"}, Timestamp: &t0},
+	}, time.Hour)
+
+	// Only the products with the same subcomponents are combined
+	require.Len(t, ss, 2)
+	require.Equal(t, []string{"pkg:oci/a", "pkg:oci/c"}, ss[0].Products)
+	require.Equal(t, []string{"pkg:apk/x", "pkg:apk/z"}, ss[0].Subcomponents)
+	require.Equal(t, []string{"pkg:oci/b"}, ss[1].Products)
+	require.Equal(t, []string{"pkg:apk/y"}, ss[1].Subcomponents)
+}
+
+func TestAllowedJustifications(t *testing.T) {
+	for _, tc := range []struct {
+		allowed  []string
+		expected int
+	}{
+		{nil, 122},
+		{[]string{"vulnerable_code_not_in_execute_path"}, 122},
+		{[]string{"component_not_present"}, 123},
+	} {
+		vexDoc, err := vex.OpenJSON("testdata/test.vex.json")
+		require.NoError(t, err)
+		report, err := sarif.Open("testdata/nginx.sarif.json")
+		require.NoError(t, err)
+
+		vexctl := New(WithAllowedJustifications(tc.allowed))
+		newReport, err := vexctl.Apply(context.Background(), report, []*vex.VEX{vexDoc})
+		require.NoError(t, err)
+		require.Len(t, newReport.Runs[0].Results, tc.expected)
+		require.Len(t, vexDoc.Statements, 2)
+	}
+}
+
+func TestScanContext(t *testing.T) {
+	data, err := os.ReadFile("testdata/nginx.sarif.json")
+	require.NoError(t, err)
+	sc, err := ScanContextFromReport(data)
+	require.NoError(t, err)
+	require.Equal(t, "Trivy", sc.Scanner)
+	require.True(t, strings.HasPrefix(sc.ReportDigest, "sha256:"))
+
+	sc, err = ScanContextFromReport([]byte(
+		`{"matches": [], "descriptor": {"name": "grype", "version": "0.55.0", "db": {"built": "2023-01-10T08:13:21Z"}}}`,
+	))
+	require.NoError(t, err)
+	ann := sc.Annotations()
+	require.Equal(t, "grype", ann[AnnotationScannerName])
+	require.Equal(t, "0.55.0", ann[AnnotationScannerVersion])
+	require.Equal(t, "2023-01-10T08:13:21Z", ann[AnnotationScannerDBTime])
+	require.Contains(t, ann, AnnotationReportDigest)
+}
+
+func TestInitProject(t *testing.T) {
+	dir := t.TempDir()
+	config, err := LoadProjectConfig(dir)
+	require.NoError(t, err)
+	require.Nil(t, config)
+
+	docPath, err := New().InitProject(dir, &ProjectConfig{
+		Author: "Chainguard", AuthorRole: "Maintainer", Products: []string{"pkg:oci/app"},
+	})
+	require.NoError(t, err)
+	doc, err := vex.Load(docPath)
+	require.NoError(t, err)
+	require.Equal(t, "Chainguard", doc.Author)
+	require.Empty(t, doc.Statements)
+
+	config, err = LoadProjectConfig(dir)
+	require.NoError(t, err)
+	require.Equal(t, &ProjectConfig{
+		Author: "Chainguard", AuthorRole: "Maintainer", Products: []string{"pkg:oci/app"},
+	}, config)
+
+	_, err = New().InitProject(dir, config)
+	require.Error(t, err)
+}
+
+func TestEditStatement(t *testing.T) {
+	doc := vex.New()
+	doc.Statements = []vex.Statement{
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed, Products: []string{"pkg:oci/app"}},
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusAffected, Products: []string{"pkg:oci/lib"}},
+	}
+	_, err := FindStatement(&doc, "CVE-2023-0001", "")
+	require.Error(t, err)
+	i, err := FindStatement(&doc, "CVE-2023-0001", "pkg:oci/lib")
+	require.NoError(t, err)
+	require.Equal(t, 1, i)
+
+	data, err := StatementYAML(&doc.Statements[i])
+	require.NoError(t, err)
+	require.Equal(t, "vulnerability: CVE-2023-0001\nproducts:\n  - pkg:oci/lib\nstatus: affected\n", string(data))
+
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	edited := strings.Replace(string(data), "status: affected", "status: not_affected", 1)
+	_, err = ReplaceStatement(&doc, i, []byte(edited), now)
+	require.Error(t, err, "not_affected requires a justification")
+	_, err = ReplaceStatement(&doc, i, []byte(edited+"unknown: field\n"), now)
+	require.Error(t, err)
+
+	newDoc, err := ReplaceStatement(&doc, i, []byte(edited+"justification: component_not_present\n"), now)
+	require.NoError(t, err)
+	require.Equal(t, vex.StatusNotAffected, newDoc.Statements[1].Status)
+	require.Equal(t, now, *newDoc.Statements[1].Timestamp)
+	require.Equal(t, "2", newDoc.Version)
+	require.Equal(t, vex.StatusAffected, doc.Statements[1].Status)
+}
+
+func TestImportGrypeIgnore(t *testing.T) {
+	rules, err := ParseGrypeIgnore([]byte(`
+ignore:
+  - vulnerability: CVE-2023-0001
+    package:
+      name: curl
+      version: 8.0.0
+      type: apk
+    reason: the vulnerable feature is disabled
+  - vulnerability: CVE-2023-0002
+    vex-status: not_affected
+    vex-justification: component_not_present
+`))
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+
+	_, err = New().ImportGrypeIgnore(rules, GrypeImportOptions{})
+	require.Error(t, err)
+
+	decided := 0
+	statements, err := New().ImportGrypeIgnore(rules, GrypeImportOptions{
+		Products: []string{"pkg:oci/app"},
+		Decide: func(*GrypeIgnoreRule) (vex.Status, vex.Justification, error) {
+			decided++
+			return vex.StatusNotAffected, vex.InlineMitigationsAlreadyExist, nil
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, decided)
+	require.Len(t, statements, 2)
+	require.Equal(t, []string{"pkg:apk/curl@8.0.0"}, statements[0].Products)
+	require.Equal(t, vex.InlineMitigationsAlreadyExist, statements[0].Justification)
+	require.Equal(t, "the vulnerable feature is disabled", statements[0].ImpactStatement)
+	require.Equal(t, []string{"pkg:oci/app"}, statements[1].Products)
+	require.Equal(t, vex.ComponentNotPresent, statements[1].Justification)
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	doc := vex.New()
+	doc.Timestamp = &t0
+	doc.Statements = []vex.Statement{
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusNotAffected, Justification: vex.VulnerableCodeNotInExecutePath, Products: []string{"pkg:oci/app", "pkg:oci/worker"}},
+		{Vulnerability: "CVE-2023-0002", Status: vex.StatusAffected, ActionStatement: "Upgrade to 1.2.3 | 1.3.0", Products: []string{"pkg:oci/app"}},
+		{Vulnerability: "CVE-2023-0002", Status: vex.StatusFixed, Products: []string{"pkg:oci/worker"}},
+	}
+
+	statements, err := New().LatestStatements(context.Background(), []*vex.VEX{&doc}, nil)
+	require.NoError(t, err)
+	require.Len(t, statements, 4)
+
+	var b bytes.Buffer
+	require.NoError(t, WriteMarkdown(&b, "Release notes", statements))
+	md := b.String()
+	require.True(t, strings.HasPrefix(md, "# Release notes\n"))
+	require.Contains(t, md, "| [CVE-2023-0001](#cve-2023-0001) | Not affected | 2 |")
+	require.Contains(t, md, "The vulnerable code cannot be executed by the product.")
+	require.Contains(t, md, "Recommended action: Upgrade to 1.2.3 | 1.3.0")
+	require.Contains(t, md, "| [CVE-2023-0002](#cve-2023-0002) | Fixed | 1 |")
+	require.Equal(t, 2, strings.Count(md, "\n## "))
+
+	b.Reset()
+	require.NoError(t, WriteMarkdown(&b, "Release notes", nil))
+	require.Contains(t, b.String(), "No vulnerabilities")
+}
+
+func TestImportGitHubDismissals(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "dismissed", r.URL.Query().Get("state"))
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch {
+		case r.URL.Path == "/repos/example/app/dependabot/alerts" && r.URL.Query().Get("page") == "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?state=dismissed&page=2>; rel="next"`, server.URL, r.URL.Path))
+			fmt.Fprint(w, `[{"number": 1, "dismissed_at": "2023-01-01T00:00:00Z", "dismissed_by": {"login": "octocat"},
+				"dismissed_reason": "not_used", "security_advisory": {"ghsa_id": "GHSA-aaaa-bbbb-cccc", "cve_id": "CVE-2023-0001"},
+				"dependency": {"package": {"ecosystem": "npm", "name": "lodash"}}}]`)
+		case r.URL.Path == "/repos/example/app/dependabot/alerts":
+			fmt.Fprint(w, `[{"number": 2, "dismissed_reason": "tolerable_risk", "dismissed_comment": "only used offline",
+				"security_advisory": {"ghsa_id": "GHSA-dddd-eeee-ffff"}}]`)
+		case r.URL.Path == "/repos/example/app/code-scanning/alerts":
+			fmt.Fprint(w, `[{"number": 3, "dismissed_reason": "false positive", "rule": {"id": "go/sql-injection"}}]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	statements, err := New().ImportGitHubDismissals(context.Background(), GitHubImportOptions{
+		Repository: "example/app", Token: "token", APIURL: server.URL, Dependabot: true, CodeScanning: true,
+	})
+	require.NoError(t, err)
+	require.Len(t, statements, 3)
+
+	require.Equal(t, "CVE-2023-0001", statements[0].Vulnerability)
+	require.Equal(t, []string{"pkg:github/example/app"}, statements[0].Products)
+	require.Equal(t, []string{"pkg:npm/lodash"}, statements[0].Subcomponents)
+	require.Equal(t, vex.VulnerableCodeNotInExecutePath, statements[0].Justification)
+	require.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), statements[0].Timestamp.UTC())
+	require.Contains(t, statements[0].StatusNotes, "@octocat")
+
+	require.Equal(t, "GHSA-dddd-eeee-ffff", statements[1].Vulnerability)
+	require.Equal(t, vex.StatusAffected, statements[1].Status)
+	require.Equal(t, "only used offline", statements[1].ActionStatement)
+
+	require.Equal(t, "go/sql-injection", statements[2].Vulnerability)
+	require.Equal(t, vex.StatusNotAffected, statements[2].Status)
+	for i := range statements {
+		require.NoError(t, statements[i].Validate())
+	}
+
+	_, err = New().ImportGitHubDismissals(context.Background(), GitHubImportOptions{
+		Repository: "example/missing", Token: "token", APIURL: server.URL, Dependabot: true,
+	})
+	require.Error(t, err)
+}
+
+func TestExportIgnoreFiles(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+	doc := vex.New()
+	doc.Timestamp = &t0
+	doc.Statements = []vex.Statement{
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusUnderInvestigation, Products: []string{"pkg:apk/wolfi/curl@8.0.0"}, Timestamp: &t0},
+		{Vulnerability: "CVE-2023-0001", Status: vex.StatusFixed, Products: []string{"pkg:apk/wolfi/curl@8.0.0"}, Timestamp: &t1},
+		{Vulnerability: "CVE-2023-0002", Status: vex.StatusNotAffected, Justification: vex.ComponentNotPresent, Products: []string{"pkg:oci/app"}, Timestamp: &t0},
+		{Vulnerability: "CVE-2023-0003", Status: vex.StatusFixed, Products: []string{"pkg:oci/app"}, Timestamp: &t0},
+		{Vulnerability: "CVE-2023-0003", Status: vex.StatusAffected, ActionStatement: "upgrade", Products: []string{"pkg:oci/app"}, Timestamp: &t1},
+	}
+
+	suppressed, err := New().Suppressions(context.Background(), []*vex.VEX{&doc}, nil)
+	require.NoError(t, err)
+	require.Len(t, suppressed, 2)
+
+	var b bytes.Buffer
+	require.NoError(t, WriteGrypeIgnore(&b, suppressed))
+	rules, err := ParseGrypeIgnore(b.Bytes())
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	require.Equal(t, GrypeIgnorePackage{Name: "curl", Version: "8.0.0", Type: "apk"}, rules[0].Package)
+	require.Equal(t, "not_affected (component_not_present)", rules[1].Reason)
+
+	b.Reset()
+	require.NoError(t, WriteTrivyIgnore(&b, suppressed))
+	require.Equal(t, "# pkg:apk/wolfi/curl@8.0.0: fixed\nCVE-2023-0001\n# pkg:oci/app: not_affected (component_not_present)\nCVE-2023-0002\n", b.String())
+
+	suppressed, err = New().Suppressions(context.Background(), []*vex.VEX{&doc}, []string{"pkg:oci/app"})
+	require.NoError(t, err)
+	require.Len(t, suppressed, 1)
+}
+
+func TestWriteSPDX3(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	statements := []ProductStatement{
+		{Product: "pkg:apk/wolfi/curl@8.0.0", Statement: vex.Statement{
+			Vulnerability: "CVE-2023-0001", Status: vex.StatusNotAffected, Justification: vex.ComponentNotPresent, Timestamp: &t0,
+		}},
+		{Product: "cpe:2.3:a:example:app:1.0:*:*:*:*:*:*:*", Statement: vex.Statement{
+			Vulnerability: "CVE-2023-0001", Status: vex.StatusAffected, ActionStatement: "upgrade", Timestamp: &t0,
+		}},
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, WriteSPDX3(&b, statements, SPDX3Options{Author: "Example", Created: t0}))
+	doc := struct {
+		Context string                   `json:"@context"`
+		Graph   []map[string]interface{} `json:"@graph"`
+	}{}
+	require.NoError(t, json.Unmarshal(b.Bytes(), &doc))
+	require.Equal(t, "https://spdx.org/rdf/3.0.1/spdx-context.jsonld", doc.Context)
+
+	types := map[string]map[string]interface{}{}
+	for _, e := range doc.Graph {
+		if _, ok := types[e["type"].(string)]; !ok {
+			types[e["type"].(string)] = e
+		}
+	}
+	require.Contains(t, types, "security_Vulnerability")
+	require.Equal(t, "curl", types["software_Package"]["name"])
+	notAffected := types["security_VexNotAffectedVulnAssessmentRelationship"]
+	require.Equal(t, "doesNotAffect", notAffected["relationshipType"])
+	require.Equal(t, "componentNotPresent", notAffected["security_justificationType"])
+	require.Equal(t, "2023-01-01T00:00:00Z", notAffected["security_publishedTime"])
+	require.Equal(t, "upgrade", types["security_VexAffectedVulnAssessmentRelationship"]["security_actionStatement"])
+	require.Len(t, types["SpdxDocument"]["rootElement"], 5)
+
+	var b2 bytes.Buffer
+	require.NoError(t, WriteSPDX3(&b2, statements, SPDX3Options{Author: "Example", Created: t0}))
+	require.Equal(t, b.String(), b2.String())
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	vexctl := New(WithMetrics(metrics))
+
+	vexes, err := vexctl.VexesFromURIs(context.Background(), []string{"testdata/test.vex.json"})
+	require.NoError(t, err)
+	report, err := sarif.Open("testdata/nginx.sarif.json")
+	require.NoError(t, err)
+	_, err = vexctl.Apply(context.Background(), report, vexes)
+	require.NoError(t, err)
+
+	cache := newRegistryCache(Options{CacheDir: t.TempDir(), CacheTTL: time.Hour, Metrics: metrics})
+	var value string
+	cache.get("key", &value)
+	cache.set("key", "value")
+	cache.get("key", &value)
+
+	var b bytes.Buffer
+	require.NoError(t, metrics.WriteJSON(&b))
+	r := MetricsReport{}
+	require.NoError(t, json.Unmarshal(b.Bytes(), &r))
+	require.Equal(t, 1, r.Phases[MetricsPhaseFetch].Count)
+	require.Equal(t, 1, r.Phases[MetricsPhaseParse].Count)
+	require.Equal(t, 1, r.Phases[MetricsPhaseApply].Count)
+	require.Nil(t, r.Phases[MetricsPhasePush])
+	require.Equal(t, 1, r.Documents)
+	require.Equal(t, len(vexes[0].Statements), r.Statements)
+	require.Equal(t, 1, r.Cache.Hits)
+	require.Equal(t, 1, r.Cache.Misses)
+	require.Equal(t, 0.5, r.Cache.HitRate)
+
+	// A nil Metrics records nothing
+	var none *Metrics
+	none.Track(MetricsPhaseApply)()
+	none.AddDocuments(vexes)
+}
+
+func TestCredentialHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake credential helper is a shell script")
+	}
+	dir := t.TempDir()
+	helper := `#!/bin/sh
+read server
+case "$server" in
+  https://api.github.com) echo '{"ServerURL": "https://api.github.com", "Username": "octocat", "Secret": "token"}' ;;
+  registry.example.com) echo '{"ServerURL": "registry.example.com", "Username": "user", "Secret": "password"}' ;;
+  *) echo "credentials not found in native keychain"; exit 1 ;;
+esac
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker-credential-test"), []byte(helper), 0o755)) //nolint:gosec // the helper has to be executable
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	opts := Options{CredentialHelper: "test"}
+	secret, err := keychainSecret(opts, DefaultGitHubAPIURL)
+	require.NoError(t, err)
+	require.Equal(t, "token", secret)
+
+	secret, err = keychainSecret(opts, "https://ghe.example.com/api/v3")
+	require.NoError(t, err)
+	require.Empty(t, secret)
+
+	secret, err = keychainSecret(Options{}, DefaultGitHubAPIURL)
+	require.NoError(t, err)
+	require.Empty(t, secret)
+
+	require.Nil(t, registryKeychain(Options{}))
+	reg, err := name.NewRegistry("registry.example.com")
+	require.NoError(t, err)
+	auth, err := registryKeychain(opts).Resolve(reg)
+	require.NoError(t, err)
+	cfg, err := auth.Authorization()
+	require.NoError(t, err)
+	require.Equal(t, "user", cfg.Username)
+	require.Equal(t, "password", cfg.Password)
+}
+
+func TestCACertificates(t *testing.T) {
+	data, err := os.ReadFile("testdata/test.vex.json")
+	require.NoError(t, err)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data) //nolint:errcheck
+	}))
+	defer server.Close()
+
+	// The certificate of the test server is not trusted by default
+	_, err = New().VexesFromURIs(context.Background(), []string{server.URL + "/test.vex.json"})
+	require.Error(t, err)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: server.Certificate().Raw,
+	}), 0o600))
+	vexes, err := New(WithCACertificates([]string{caFile})).VexesFromURIs(
+		context.Background(), []string{server.URL + "/test.vex.json"},
+	)
+	require.NoError(t, err)
+	require.Len(t, vexes, 1)
+
+	_, err = httpClient(Options{CACertificates: []string{"testdata/test.vex.json"}})
+	require.Error(t, err)
+}
+
+func TestResolveReferences(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/upstream.vex.json":
+			fmt.Fprint(w, `{"@context": "https://openvex.dev/ns", "author": "Upstream", "statements": [
+				{"vulnerability": "CVE-2023-0001", "status": "not_affected",
+				 "justification": "vulnerable_code_not_present", "products": ["pkg:golang/example.com/lib"]}]}`)
+		case "/osv/GHSA-aaaa-bbbb-cccc":
+			fmt.Fprint(w, `{"id": "GHSA-aaaa-bbbb-cccc", "summary": "Path traversal in lib", "details": "long details"}`)
+		case "/advisory":
+			fmt.Fprint(w, "<html><head><title>Security &amp; advisory</title></head></html>")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	doc := vex.New()
+	doc.Statements = []vex.Statement{
+		{
+			Vulnerability: "CVE-2023-0001", Status: vex.StatusNotAffected, Products: []string{"pkg:oci/app"},
+			Justification: vex.VulnerableCodeNotPresent,
+			StatusNotes:   fmt.Sprintf("as stated upstream (%s/upstream.vex.json), see %s/advisory.", server.URL, server.URL),
+		},
+		{Vulnerability: server.URL + "/osv/GHSA-aaaa-bbbb-cccc", Status: vex.StatusAffected, ActionStatement: "see " + server.URL + "/missing"},
+	}
+	require.Equal(t, []string{server.URL + "/upstream.vex.json", server.URL + "/advisory"}, StatementReferences(&doc.Statements[0]))
+
+	vexctl := New(WithCache(t.TempDir(), time.Hour))
+	refs, err := vexctl.ResolveReferences(context.Background(), []*vex.VEX{&doc})
+	require.NoError(t, err)
+	require.Len(t, refs, 4)
+	require.Equal(t, []string{
+		"OpenVEX document by Upstream",
+		"CVE-2023-0001 not_affected (vulnerable_code_not_present) in pkg:golang/example.com/lib",
+	}, refs[server.URL+"/upstream.vex.json"].Summary)
+	require.Equal(t, []string{"Path traversal in lib"}, refs[server.URL+"/osv/GHSA-aaaa-bbbb-cccc"].Summary)
+	require.Equal(t, []string{"Security & advisory"}, refs[server.URL+"/advisory"].Summary)
+	require.Contains(t, refs[server.URL+"/missing"].Error, "404")
+
+	var b bytes.Buffer
+	require.NoError(t, WriteDocument(&b, &doc, ShowOptions{References: refs}))
+	require.Contains(t, b.String(), "       ref: "+server.URL+"/advisory\n         Security & advisory\n")
+
+	// Resolved documents are read from the cache
+	server.Close()
+	cached, err := vexctl.ResolveReferences(context.Background(), []*vex.VEX{&doc})
+	require.NoError(t, err)
+	require.Equal(t, refs[server.URL+"/advisory"], cached[server.URL+"/advisory"])
+	require.NotEmpty(t, cached[server.URL+"/missing"].Error)
+}
+
+func TestLenientScannerReports(t *testing.T) {
+	for format, report := range map[string]string{
+		ReportFormatGrype: `{"descriptor": {"name": "grype"}, "matches": [
+			{"vulnerability": {"id": "CVE-2023-0001"}, "artifact": {"name": "a"}},
+			{"vulnerability": {"id": 42}, "artifact": {"name": "b"}}]}`,
+		ReportFormatTrivy: `{"SchemaVersion": 2, "Results": [
+			{"Target": "app", "Vulnerabilities": [
+				{"VulnerabilityID": "CVE-2023-0001", "PkgName": "a"},
+				{"VulnerabilityID": "CVE-2023-0002", "PkgName": ["b"]}]},
+			{"Target": 7}]}`,
+		ReportFormatSnyk: `{"projectName": "app", "packageManager": "npm", "vulnerabilities": [
+			{"id": "SNYK-1", "packageName": "a", "identifiers": {"CVE": ["CVE-2023-0001"]}},
+			{"id": "SNYK-2", "packageName": "b", "identifiers": {"CVE": "CVE-2023-0002"}}]}`,
+	} {
+		_, err := ParseReport([]byte(report))
+		require.Error(t, err, format)
+
+		warnings := &ParseWarnings{}
+		r, err := ParseReportLenient([]byte(report), warnings)
+		require.NoError(t, err, format)
+		require.Len(t, r.Runs[0].Results, 1, format)
+		require.Equal(t, "CVE-2023-0001", *r.Runs[0].Results[0].RuleID, format)
+		require.NotEmpty(t, warnings.Warnings(), format)
+	}
+}
+
+func TestLenientParsing(t *testing.T) {
+	dir := t.TempDir()
+	docPath := filepath.Join(dir, "feed.vex.json")
+	require.NoError(t, os.WriteFile(docPath, []byte(`{"@context": "https://openvex.dev/ns", "@id": "feed", "statements": [
+		{"vulnerability": "CVE-2023-0001", "status": "not_affected", "justification": "component_not_present"},
+		{"vulnerability": "CVE-2023-0002", "status": "fixed", "timestamp": "yesterday"},
+		{"vulnerability": "CVE-2023-0003", "status": "affected", "products": "pkg:oci/app"}]}`), 0o600))
+
+	_, err := New().VexesFromURIs(context.Background(), []string{docPath})
+	require.Error(t, err)
+
+	warnings := &ParseWarnings{}
+	vexes, err := New(WithLenient(warnings)).VexesFromURIs(context.Background(), []string{docPath})
+	require.NoError(t, err)
+	require.Len(t, vexes, 1)
+	require.Len(t, vexes[0].Statements, 1)
+	require.Equal(t, "CVE-2023-0001", vexes[0].Statements[0].Vulnerability)
+	require.Len(t, warnings.Warnings(), 2)
+	require.Contains(t, warnings.Warnings()[0], "skipped statement 1")
+
+	report := []byte(`{"version": "2.1.0", "runs": [{"tool": {"driver": {"name": "grype"}}, "results": [
+		{"ruleId": "CVE-2023-0001", "message": {"text": "ok"}},
+		{"ruleId": 42, "message": {"text": "bad"}}]}]}`)
+	_, err = ParseReport(report)
+	require.Error(t, err)
+	warnings = &ParseWarnings{}
+	r, err := ParseReportLenient(report, warnings)
+	require.NoError(t, err)
+	require.Len(t, r.Runs[0].Results, 1)
+	require.Equal(t, "grype", r.Runs[0].Tool.Driver.Name)
+	require.Equal(t, []string{"skipped result 1 of run 0: json: cannot unmarshal number into Go struct field Result.ruleId of type string"}, warnings.Warnings())
+
+	var b bytes.Buffer
+	warnings = &ParseWarnings{}
+	remaining, err := New(WithLenient(warnings)).ApplyStream(context.Background(), bytes.NewReader(report), &b, []*vex.VEX{})
+	require.NoError(t, err)
+	require.Equal(t, 1, remaining)
+	require.Len(t, warnings.Warnings(), 1)
+	require.NotContains(t, b.String(), "bad")
+
+	csaf := []byte(`{"document": {"csaf_version": "2.0", "tracking": {"id": "ADV-1"}},
+		"product_tree": {"full_product_names": [{"product_id": "P1", "name": "app"}]},
+		"vulnerabilities": [{"cve": "CVE-2023-0001", "product_status": {"fixed": ["P1"]}},
+			{"product_status": {"fixed": ["P1"]}}, {"cve": 1}]}`)
+	_, err = ParseCSAF(csaf, nil)
+	require.Error(t, err)
+	warnings = &ParseWarnings{}
+	doc, err := ParseCSAFLenient(csaf, nil, warnings)
+	require.NoError(t, err)
+	require.Len(t, doc.Statements, 1)
+	require.Len(t, warnings.Warnings(), 2)
+}
+
+func TestPinnedSources(t *testing.T) {
+	data, err := os.ReadFile("testdata/test.vex.json")
+	require.NoError(t, err)
+	sum := sha256.Sum256(data)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	wrong := "sha256:" + strings.Repeat("0", 64)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data) //nolint:errcheck
+	}))
+	defer server.Close()
+
+	path, pin := splitPinnedURI(server.URL + "/test.vex.json@" + digest)
+	require.Equal(t, server.URL+"/test.vex.json", path)
+	require.NotNil(t, pin)
+	_, pin = splitPinnedURI("cgr.dev/image@sha256:abc")
+	require.Nil(t, pin)
+
+	vexctl := New()
+	for _, uri := range []string{"testdata/test.vex.json@" + digest, server.URL + "/test.vex.json@" + digest} {
+		vexes, err := vexctl.VexesFromURIs(context.Background(), []string{uri})
+		require.NoError(t, err, uri)
+		require.Len(t, vexes, 1)
+	}
+
+	for _, uri := range []string{"testdata/test.vex.json@" + wrong, server.URL + "/test.vex.json@" + wrong} {
+		source, err := vexctl.ResolveSource(uri)
+		require.NoError(t, err)
+		_, err = source.Read(context.Background(), vexctl.Options, uri)
+		require.ErrorIs(t, err, ErrDigestMismatch, uri)
+	}
+
+	// Pinned paths to missing files fail as such, not as image references
+	for _, uri := range []string{"testdata/missing.vex.json@" + digest, "./missing@" + digest} {
+		sourceType, err := vexctl.SourceType(uri)
+		require.NoError(t, err)
+		require.Equal(t, "file", sourceType, uri)
+		_, err = vexctl.VexesFromURIs(context.Background(), []string{uri})
+		require.ErrorContains(t, err, "VEX file not found", uri)
+	}
+	sourceType, err := vexctl.SourceType("cgr.dev/image@" + digest)
+	require.NoError(t, err)
+	require.Equal(t, "image", sourceType)
+}
+
+func TestAttestationValidity(t *testing.T) {
+	notBefore := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	att := attestation.New()
+	att.Predicate.ID = "expiring-doc"
+	att.Validity = &attestation.Validity{NotBefore: &notBefore, NotAfter: &notAfter}
+
+	var b bytes.Buffer
+	require.NoError(t, att.ToJSON(&b))
+	require.Contains(t, b.String(), `"notAfter": "2023-02-01T00:00:00Z"`)
+
+	// The statement keeps the in-toto schema, the window is in the predicate
+	fields := map[string]json.RawMessage{}
+	require.NoError(t, json.Unmarshal(b.Bytes(), &fields))
+	require.Len(t, fields, 4)
+	for _, f := range []string{"_type", "subject", "predicateType", "predicate"} {
+		require.Contains(t, fields, f)
+	}
+	statement := &ImageStatement{}
+	require.NoError(t, json.Unmarshal(b.Bytes(), statement))
+	predicate := &attestation.Predicate{}
+	require.NoError(t, json.Unmarshal(statement.Predicate, predicate))
+	require.Equal(t, "expiring-doc", predicate.ID)
+	require.NoError(t, predicate.Validity.Check(notBefore.Add(24*time.Hour)))
+	require.Error(t, predicate.Validity.Check(notBefore.Add(-time.Hour)))
+	doc := &vex.VEX{}
+	require.NoError(t, json.Unmarshal(statement.Predicate, doc))
+	require.Equal(t, "expiring-doc", doc.ID)
+
+	now := notAfter.Add(time.Hour)
+	res, err := verifyStatements(Options{}, "nginx", "sha256:abc", nil, []*ImageStatement{statement}, now)
+	require.NoError(t, err)
+	require.Equal(t, []string{"expiring-doc: expired on 2023-02-01T00:00:00Z"}, res.Expired)
+	require.Equal(t, 1, res.VEXDocuments)
+
+	res, err = verifyStatements(Options{RejectExpired: true}, "nginx", "sha256:abc", nil, []*ImageStatement{statement}, now)
+	require.NoError(t, err)
+	require.Len(t, res.Expired, 1)
+	require.Equal(t, 0, res.VEXDocuments)
+}
+
+func TestApplyWithPatch(t *testing.T) {
+	vexDoc, err := vex.OpenJSON("testdata/test.vex.json")
+	require.NoError(t, err)
+	report, err := sarif.Open("testdata/nginx.sarif.json")
+	require.NoError(t, err)
+	original := report.Runs[0].Results
+
+	final, patch, err := New().ApplyWithPatch(context.Background(), report, []*vex.VEX{vexDoc})
+	require.NoError(t, err)
+	require.Len(t, final.Runs[0].Results, len(original)-1)
+	require.Len(t, patch, 2)
+	require.Equal(t, "test", patch[0].Op)
+	require.Equal(t, "remove", patch[1].Op)
+	require.Equal(t, patch[0].Path, patch[1].Path)
+
+	var idx int
+	_, err = fmt.Sscanf(patch[1].Path, "/runs/0/results/%d", &idx)
+	require.NoError(t, err)
+	require.Equal(t, "CVE-2009-4487", *original[idx].RuleID)
+	require.Same(t, original[idx], patch[0].Value)
+
+	var b bytes.Buffer
+	require.NoError(t, patch.WriteJSON(&b))
+	require.Contains(t, b.String(), `"op": "remove"`)
+}
+
+func TestReportProducts(t *testing.T) {
+	digest := "sha256:e4cf37d568d195b4b5af4c36a8e7ad0e3a7d9fa0ad1dc4d5a5e0b71d5cf6a2f1"
+	report, err := sarif.Open("testdata/nginx.sarif.json")
+	require.NoError(t, err)
+	report.Runs[0].Properties = map[string]interface{}{
+		"imageName":   "cgr.dev/chainguard/nginx:latest",
+		"repoDigests": []interface{}{"cgr.dev/chainguard/nginx@" + digest},
+	}
+
+	doc, err := New().GenerateFromReport(report, &GenerateOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"pkg:oci/nginx@sha256%3A" + digest[7:] + "?repository_url=cgr.dev/chainguard/nginx",
+	}, doc.Statements[0].Products)
+
+	doc, err = New().GenerateFromReport(report, &GenerateOptions{Products: []string{"pkg:oci/app"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"pkg:oci/app"}, doc.Statements[0].Products)
+
+	purl, err := ImagePackageURL("nginx:1.25")
+	require.NoError(t, err)
+	require.Equal(t, "pkg:oci/nginx?repository_url=index.docker.io/library/nginx&tag=1.25", purl)
+}
+
+func TestExpandGlobs(t *testing.T) {
+	data, err := os.ReadFile("testdata/document1.vex.json")
+	require.NoError(t, err)
+	dir := t.TempDir()
+	for _, p := range []string{"b.openvex.json", "a/c.openvex.json", "a/d/e.openvex.json", "a/notes.txt"} {
+		path := filepath.Join(dir, filepath.FromSlash(p))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.FileMode(0o755)))
+		require.NoError(t, os.WriteFile(path, data, os.FileMode(0o644)))
+	}
+
+	uris, err := ExpandGlobs([]string{
+		filepath.Join(dir, "**", "*.openvex.json"), "https://example.com/a?b=*", "testdata/test.vex.json",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "a", "c.openvex.json"),
+		filepath.Join(dir, "a", "d", "e.openvex.json"),
+		filepath.Join(dir, "b.openvex.json"),
+		"https://example.com/a?b=*",
+		"testdata/test.vex.json",
+	}, uris)
+
+	_, err = ExpandGlobs([]string{filepath.Join(dir, "*.yaml")})
+	require.Error(t, err)
+
+	impl := defaultVexCtlImplementation{}
+	vexes, err := impl.LoadFiles(context.Background(), []string{filepath.Join(dir, "a", "*", "*.json"), dir})
+	require.NoError(t, err)
+	require.Len(t, vexes, 2)
+}
+
+func TestMergeURIsFiltered(t *testing.T) {
+	dir := t.TempDir()
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 50; i++ {
+		doc := vex.New()
+		doc.ID = fmt.Sprintf("advisory-%02d", i)
+		doc.Timestamp = &ts
+		doc.Statements = []vex.Statement{{
+			Vulnerability:   fmt.Sprintf("CVE-2023-%04d", i),
+			Products:        []string{"pkg:oci/app"},
+			Status:          vex.StatusNotAffected,
+			Justification:   vex.ComponentNotPresent,
+			ImpactStatement: strings.Repeat("x", 1024),
+		}}
+		f, err := os.Create(filepath.Join(dir, doc.ID+".json"))
+		require.NoError(t, err)
+		require.NoError(t, doc.ToJSON(f))
+		require.NoError(t, f.Close())
+	}
+
+	opts := &MergeOptions{Vulnerabilities: []string{"CVE-2023-0001", "CVE-2023-0042"}}
+	vexctl := New()
+	merged, err := vexctl.MergeURIs(context.Background(), opts, []string{dir})
+	require.NoError(t, err)
+	docs, err := vexctl.VexesFromURIs(context.Background(), []string{dir})
+	require.NoError(t, err)
+	eager, err := vexctl.Merge(context.Background(), opts, docs)
+	require.NoError(t, err)
+
+	require.Equal(t, eager.ID, merged.ID)
+	require.Len(t, merged.Statements, 2)
+	require.Equal(t, eager.Statements, merged.Statements)
+
+	h := transitionHistory(docs[0])
+	require.Equal(t, docs[0].ID, h.ID)
+	require.Empty(t, h.Statements[0].ImpactStatement)
+	require.Equal(t, docs[0].Statements[0].Status, h.Statements[0].Status)
+
+	// Changing the document afterwards doesn't rewrite the history
+	docs[0].Statements[0].Products[0] = "pkg:oci/other"
+	*docs[0].Timestamp = ts.Add(time.Hour)
+	require.Equal(t, "pkg:oci/app", h.Statements[0].Products[0])
+	require.Equal(t, ts, *h.Timestamp)
+}
+
+// testReportFormat converts reports listing vulnerability IDs to SARIF
+type testReportFormat struct{}
+
+func (trf *testReportFormat) Name() string { return "test-scanner" }
+
+func (trf *testReportFormat) Detect(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(`{"testScanner"`))
+}
+
+func (trf *testReportFormat) Parse(data []byte) (*sarif.Report, error) {
+	report := struct {
+		Vulnerabilities []string `json:"testScanner"`
+	}{}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	converted := sarif.New()
+	run := gosarif.NewRun("test-scanner", "https://example.com")
+	for _, id := range report.Vulnerabilities {
+		run.AddResult(id)
+	}
+	converted.AddRun(run)
+	return converted, nil
+}
+
+func TestRegisterReportFormat(t *testing.T) {
+	formats.Register(&testReportFormat{})
+	data := []byte(`{"testScanner":["CVE-2009-4487","CVE-2023-0001"]}`)
+	format, err := DetectReportFormat(data)
+	require.NoError(t, err)
+	require.Equal(t, "test-scanner", format)
+
+	report, err := ParseReport(data)
+	require.NoError(t, err)
+	require.Len(t, report.Runs[0].Results, 2)
+
+	vexDoc, err := vex.OpenJSON("testdata/test.vex.json")
+	require.NoError(t, err)
+	report, err = New().Apply(context.Background(), report, []*vex.VEX{vexDoc})
+	require.NoError(t, err)
+	require.Len(t, report.Runs[0].Results, 1)
+
+	sc, err := ScanContextFromReport(data)
+	require.NoError(t, err)
+	require.Equal(t, "test-scanner", sc.Scanner)
+
+	// Built-in formats are still detected
+	format, err = DetectReportFormat([]byte(`{"matches":[],"descriptor":{"name":"grype"}}`))
+	require.NoError(t, err)
+	require.Equal(t, ReportFormatGrype, format)
+}
+
+func TestDiscover(t *testing.T) {
+	reg := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer reg.Close()
+	ref, digest := pushTestImage(t, reg.URL)
+	repo := ref.Context()
+
+	// A second tag of the same image and an image without VEX
+	img, err := remote.Image(digest)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(repo.Tag("v1"), img))
+	other, err := random.Image(512, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(repo.Tag("other"), other))
+
+	vexctl := New(WithAttestationVerification(AttestationVerification{Insecure: true}))
+	discovery, err := vexctl.Discover(context.Background(), repo.String())
+	require.NoError(t, err)
+	require.Len(t, discovery.Images, 2)
+	require.Equal(t, 1, discovery.Covered())
+	for _, img := range discovery.Images {
+		if img.Digest == digest.DigestStr() {
+			require.Equal(t, []string{"latest", "v1"}, img.Tags)
+			require.Equal(t, 2, img.Documents)
+		} else {
+			require.Equal(t, []string{"other"}, img.Tags)
+			require.Zero(t, img.Documents)
+		}
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, discovery.Write(&b))
+	require.Contains(t, b.String(), "Images:     2, 1 with VEX attestations")
+
+	_, err = vexctl.Discover(context.Background(), ref.String())
+	require.Error(t, err)
+}
+
+func TestRequirementsEvaluate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "requirements.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`signers:
+  - security@example.com
+maxStatementAge: 720h
+disallowedJustifications:
+  - inline_mitigations_already_exist
+`), 0o600))
+	reqs, err := LoadRequirements(path)
+	require.NoError(t, err)
+	require.Equal(t, 720*time.Hour, reqs.MaxStatementAge)
+
+	now := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	recent := now.Add(-24 * time.Hour)
+	old := now.Add(-60 * 24 * time.Hour)
+	good := &vex.VEX{
+		Metadata: vex.Metadata{ID: "good", Author: "security@example.com", Timestamp: &recent},
+		Statements: []vex.Statement{
+			{Vulnerability: "CVE-2023-0001", Status: vex.StatusNotAffected, Justification: vex.ComponentNotPresent},
+		},
+	}
+	res := reqs.Evaluate([]*vex.VEX{good}, []string{"security@example.com"}, now)
+	require.True(t, res.Passed)
+	require.Empty(t, res.Violations)
+
+	// The self-asserted author is not trusted, only the verified signer
+	bad := &vex.VEX{
+		Metadata: vex.Metadata{ID: "bad", Author: "security@example.com", Timestamp: &recent},
+		Statements: []vex.Statement{
+			{Vulnerability: "CVE-2023-0002", Status: vex.StatusNotAffected, Justification: vex.InlineMitigationsAlreadyExist},
+			{Vulnerability: "CVE-2023-0003", Status: vex.StatusFixed, Timestamp: &old},
+		},
+	}
+	res = reqs.Evaluate([]*vex.VEX{good, bad}, []string{"security@example.com", "key:attacker.pub"}, now)
+	require.False(t, res.Passed)
+	require.Equal(t, 2, res.Documents)
+	require.Len(t, res.Violations, 3)
+	require.Equal(t, `bad: signer "key:attacker.pub" is not allowed`, res.Violations[0].String())
+	require.Equal(t, "CVE-2023-0002", res.Violations[1].Vulnerability)
+	require.Equal(t, "CVE-2023-0003", res.Violations[2].Vulnerability)
+
+	// Documents read without verifying their signature fail the signers
+	res = reqs.Evaluate([]*vex.VEX{good}, []string{""}, now)
+	require.False(t, res.Passed)
+	require.Equal(t, "good: the signature of the document was not verified", res.Violations[0].String())
+
+	statements := []*ImageStatement{{Signer: "security@example.com"}}
+	statements[0].PredicateType = vex.TypeURI
+	statements[0].Predicate = json.RawMessage(`{"@id":"signed"}`)
+	verification, err := verifyStatements(Options{}, "nginx", "sha256:abc", nil, statements, now)
+	require.NoError(t, err)
+	require.Equal(t, []string{"security@example.com"}, verification.Signers)
+
+	require.NoError(t, os.WriteFile(path, []byte("disallowedJustifications: [because]\n"), 0o600))
+	_, err = LoadRequirements(path)
+	require.Error(t, err)
+
+	// Unknown requirements are not silently ignored
+	require.NoError(t, os.WriteFile(path, []byte("authors: [security@example.com]\n"), 0o600))
+	_, err = LoadRequirements(path)
+	require.Error(t, err)
+}
+
+func TestParseGrypeReport(t *testing.T) {
+	data, err := os.ReadFile("testdata/nginx.grype.json")
+	require.NoError(t, err)
+	format, err := DetectReportFormat(data)
+	require.NoError(t, err)
+	require.Equal(t, ReportFormatGrype, format)
+
+	report, err := ParseReport(data)
+	require.NoError(t, err)
+	require.Len(t, report.Runs, 1)
+	run := report.Runs[0]
+	require.Equal(t, "grype", run.Tool.Driver.Name)
+	require.Equal(t, "0.56.0", *run.Tool.Driver.Version)
+	require.Len(t, run.Results, 2)
+	require.Equal(t, "CVE-2009-4487", *run.Results[0].RuleID)
+	require.Equal(t, "note", *run.Results[0].Level)
+	require.Equal(t, "/var/lib/dpkg/status", *run.Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+
+	// Advisories are recorded under their related CVE
+	require.Equal(t, "CVE-2022-27664", *run.Results[1].RuleID)
+	require.Equal(t, "GHSA-69cg-p879-7622", run.Results[1].Properties["advisory"])
+	require.Equal(t, "pkg:golang/golang.org/x/net@v0.0.0-20220722155237-a158d28d115b", run.Results[1].Properties["purl"])
+	require.Equal(t, []string{
+		"nginx@sha256:e4cf37d568d195b4b5af4c36a7dfc5fdc3ab29a5a15d2e1fc0fa5d4d1cbd2e29",
+	}, ReportImages(report))
+
+	vexDoc, err := vex.OpenJSON("testdata/test.vex.json")
+	require.NoError(t, err)
+	filtered, err := New().Apply(context.Background(), report, []*vex.VEX{vexDoc})
+	require.NoError(t, err)
+	require.Len(t, filtered.Runs[0].Results, 1)
+	require.Equal(t, "CVE-2022-27664", *filtered.Runs[0].Results[0].RuleID)
+}
+
+func TestParseTrivyReport(t *testing.T) {
+	data := []byte(`{
+  "SchemaVersion": 2,
+  "ArtifactName": "cgr.dev/chainguard/nginx:latest",
+  "ArtifactType": "container_image",
+  "Metadata": {"RepoDigests": ["cgr.dev/chainguard/nginx@sha256:e4cf37d568d195b4b5af4c36a7dfc5fdc3ab29a5a15d2e1fc0fa5d4d1cbd2e29"]},
+  "Results": [
+    {
+      "Target": "cgr.dev/chainguard/nginx:latest (wolfi 20230201)",
+      "Class": "os-pkgs",
+      "Type": "wolfi",
+      "Vulnerabilities": [
+        {"VulnerabilityID": "CVE-2023-0286", "PkgName": "libcrypto3", "InstalledVersion": "3.0.7-r0", "Severity": "HIGH",
+         "PkgIdentifier": {"PURL": "pkg:apk/wolfi/libcrypto3@3.0.7-r0"}}
+      ]
+    },
+    {
+      "Target": "usr/bin/app",
+      "Class": "lang-pkgs",
+      "Type": "gobinary",
+      "Vulnerabilities": [
+        {"VulnerabilityID": "CVE-2022-41717", "PkgName": "golang.org/x/net", "Severity": "MEDIUM"},
+        {"VulnerabilityID": "CVE-2023-0286", "PkgName": "libcrypto3", "Severity": "HIGH"}
+      ]
+    }
+  ]
+}`)
+	require.True(t, trivyjson.Format{}.Detect(data))
+	report, err := trivyjson.Format{}.Parse(data)
+	require.NoError(t, err)
+	detected, err := ParseReport(data)
+	require.NoError(t, err)
+	require.Equal(t, report, detected)
+	require.Len(t, report.Runs, 1)
+	run := report.Runs[0]
+	require.Equal(t, "Trivy", run.Tool.Driver.Name)
+	require.Len(t, run.Tool.Driver.Rules, 2)
+	require.Len(t, run.Results, 3)
+	require.Equal(t, "CVE-2023-0286", *run.Results[0].RuleID)
+	require.Equal(t, "error", *run.Results[0].Level)
+	require.Equal(t, "pkg:apk/wolfi/libcrypto3@3.0.7-r0", run.Results[0].Properties["purl"])
+	require.Equal(t, "lang-pkgs", run.Results[1].Properties["class"])
+	require.Equal(t, "usr/bin/app", *run.Results[1].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	require.EqualValues(t, 0, *run.Results[2].RuleIndex)
+	require.Equal(t, []string{
+		"cgr.dev/chainguard/nginx@sha256:e4cf37d568d195b4b5af4c36a7dfc5fdc3ab29a5a15d2e1fc0fa5d4d1cbd2e29",
+	}, ReportImages(report))
+
+	vexDoc := &vex.VEX{Statements: []vex.Statement{
+		{Vulnerability: "CVE-2023-0286", Status: vex.StatusNotAffected, Justification: vex.ComponentNotPresent},
+	}}
+	filtered, err := New().Apply(context.Background(), report, []*vex.VEX{vexDoc})
+	require.NoError(t, err)
+	require.Len(t, filtered.Runs[0].Results, 1)
+	require.Equal(t, "CVE-2022-41717", *filtered.Runs[0].Results[0].RuleID)
+
+	_, err = ParseReport([]byte(`{"SchemaVersion":1,"Results":[]}`))
+	require.Error(t, err)
+}
+
+func TestParseSnykReport(t *testing.T) {
+	project := `{
+  "projectName": "app",
+  "displayTargetFile": "package-lock.json",
+  "packageManager": "npm",
+  "vulnerabilities": [
+    {"id": "SNYK-JS-LODASH-567746", "title": "Prototype Pollution", "severity": "high",
+     "packageName": "lodash", "version": "4.17.15", "fixedIn": ["4.17.16"],
+     "identifiers": {"CVE": ["CVE-2020-8203"]}, "from": ["app@1.0.0", "lodash@4.17.15"]},
+    {"id": "SNYK-JS-LODASH-567746", "title": "Prototype Pollution", "severity": "high",
+     "packageName": "lodash", "version": "4.17.15", "fixedIn": ["4.17.16"],
+     "identifiers": {"CVE": ["CVE-2020-8203"]}, "from": ["app@1.0.0", "other@1.0.0", "lodash@4.17.15"]},
+    {"id": "SNYK-JS-MINIMIST-559764", "title": "Prototype Pollution", "severity": "medium",
+     "packageName": "minimist", "version": "1.2.0", "identifiers": {"CVE": []}}
+  ]
+}`
+	for _, data := range []string{project, "[" + project + "]"} {
+		format, err := DetectReportFormat([]byte(data))
+		require.NoError(t, err)
+		require.Equal(t, ReportFormatSnyk, format)
+	}
+
+	report, err := ParseReport([]byte("[" + project + "," + project + "]"))
+	require.NoError(t, err)
+	require.Len(t, report.Runs, 2)
+	run := report.Runs[0]
+	require.Equal(t, "Snyk", run.Tool.Driver.Name)
+	require.Len(t, run.Results, 2)
+	require.Equal(t, "CVE-2020-8203", *run.Results[0].RuleID)
+	require.Equal(t, "error", *run.Results[0].Level)
+	require.Equal(t, "pkg:npm/lodash@4.17.15", run.Results[0].Properties["purl"])
+	require.Equal(t, "package-lock.json", *run.Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	require.Equal(t, "SNYK-JS-MINIMIST-559764", *run.Results[1].RuleID)
+
+	vexDoc := &vex.VEX{Statements: []vex.Statement{
+		{Vulnerability: "CVE-2020-8203", Status: vex.StatusNotAffected, Justification: vex.VulnerableCodeNotInExecutePath},
+	}}
+	filtered, err := New().Apply(context.Background(), report, []*vex.VEX{vexDoc})
+	require.NoError(t, err)
+	require.Len(t, filtered.Runs[0].Results, 1)
+	require.Len(t, filtered.Runs[1].Results, 1)
+
+	// Maven packages are named group:artifact
+	report, err = snykjson.Format{}.Parse([]byte(`{"projectName": "app", "packageManager": "maven", "vulnerabilities": [
+		{"id": "SNYK-JAVA-ORGAPACHELOGGINGLOG4J-2314719", "packageName": "org.apache.logging.log4j:log4j-core",
+		 "version": "2.14.1", "identifiers": {"CVE": ["CVE-2021-44228"]}}]}`))
+	require.NoError(t, err)
+	require.Equal(t, "pkg:maven/org.apache.logging.log4j/log4j-core@2.14.1", report.Runs[0].Results[0].Properties["purl"])
+}
+
+func TestRecommendJustifications(t *testing.T) {
+	report := []byte(`{"descriptor": {"name": "grype"}, "matches": [
+		{"vulnerability": {"id": "CVE-2023-0001"}, "artifact": {"name": "libcurl", "version": "7.88.1"},
+			"matchDetails": [{"type": "cpe-match", "searchedBy": {"cpes": ["cpe:2.3:a:haxx:curl:7.88.1:*:*:*:*:*:*:*"]}}]},
+		{"vulnerability": {"id": "CVE-2023-0002"}, "artifact": {"name": "libssl3", "version": "3.0.8", "purl": "pkg:apk/wolfi/libssl3@3.0.8"},
+			"matchDetails": [{"type": "exact-indirect-match", "searchedBy": {"package": {"name": "openssl", "version": "3.0.8"}}}]},
+		{"vulnerability": {"id": "CVE-2023-0003"}, "artifact": {"name": "openssl", "version": "3.0.8"},
+			"matchDetails": [{"type": "exact-direct-match", "searchedBy": {"package": {"name": "openssl"}}}]},
+		{"vulnerability": {"id": "CVE-2023-0004"}, "artifact": {"name": "zlib", "version": "1.2.13"},
+			"matchDetails": [
+				{"type": "cpe-match", "searchedBy": {"cpes": ["cpe:2.3:a:zlib:zlib:1.2.13:*:*:*:*:*:*:*"]}},
+				{"type": "exact-indirect-match", "searchedBy": {"package": {"name": "zlib-src"}}}]},
+		{"vulnerability": {"id": "CVE-2023-0005"}, "artifact": {"name": "busybox"}, "matchDetails": []}
+	]}`)
+
+	recommendations, err := RecommendJustifications(report)
+	require.NoError(t, err)
+	require.Len(t, recommendations, 2)
+
+	require.Equal(t, "CVE-2023-0001", recommendations[0].Vulnerability)
+	require.Equal(t, vex.ComponentNotPresent, recommendations[0].Justification)
+	require.Contains(t, recommendations[0].Reason, "cpe:2.3:a:haxx:curl")
+
+	require.Equal(t, "CVE-2023-0002", recommendations[1].Vulnerability)
+	require.Equal(t, "pkg:apk/wolfi/libssl3@3.0.8", recommendations[1].PURL)
+	require.Equal(t, vex.VulnerableCodeNotPresent, recommendations[1].Justification)
+	require.Contains(t, recommendations[1].Reason, "openssl source package")
+
+	// Reports without match data cannot be used
+	_, err = RecommendJustifications([]byte(`{"version": "2.1.0", "runs": []}`))
+	require.Error(t, err)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/oci"
+)
+
+// DetachOptions select the attestations removed by Detach. An
+// attestation is removed if it matches any of the criteria.
+type DetachOptions struct {
+	Digests        []string // Digests of the attestation layers (sha256:...)
+	PredicateTypes []string // Predicate types of the attestations
+	DocumentIDs    []string // IDs of the VEX documents in the attestations
+}
+
+// Empty returns true when no selection criteria are set
+func (do *DetachOptions) Empty() bool {
+	return len(do.Digests) == 0 && len(do.PredicateTypes) == 0 && len(do.DocumentIDs) == 0
+}
+
+// Detach removes attestations from an image, for example to revoke a VEX
+// document attached by mistake. It returns the digests of the attestations
+// removed.
+func (vexctl *VexCtl) Detach(ctx context.Context, imageRef string, opts DetachOptions) ([]string, error) {
+	if opts.Empty() {
+		return nil, errors.New("at least one digest, predicate type or document ID is required to select attestations")
+	}
+	defer vexctl.Options.Metrics.Track(MetricsPhasePush)()
+	removed, err := vexctl.impl.Detach(ctx, vexctl.Options, imageRef, opts)
+	if err != nil {
+		return nil, fmt.Errorf("detaching attestations: %w", err)
+	}
+	return removed, nil
+}
+
+// matches returns true if the attestation is selected by the options
+func (do *DetachOptions) matches(att oci.Signature) (bool, error) {
+	digest, err := att.Digest()
+	if err != nil {
+		return false, fmt.Errorf("reading attestation digest: %w", err)
+	}
+	for _, d := range do.Digests {
+		if d == digest.String() {
+			return true, nil
+		}
+	}
+
+	if len(do.PredicateTypes) == 0 && len(do.DocumentIDs) == 0 {
+		return false, nil
+	}
+
+	payload, err := att.Payload()
+	if err != nil {
+		return false, fmt.Errorf("reading attestation payload: %w", err)
+	}
+	env := struct {
+		Payload string `json:"payload"`
+	}{}
+	if err := json.Unmarshal(payload, &env); err != nil {
+		return false, fmt.Errorf("decoding attestation envelope: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return false, fmt.Errorf("decoding attestation payload: %w", err)
+	}
+	statement := struct {
+		PredicateType string `json:"predicateType"`
+		Predicate     struct {
+			ID string `json:"@id"`
+		} `json:"predicate"`
+	}{}
+	if err := json.Unmarshal(data, &statement); err != nil {
+		return false, fmt.Errorf("decoding attestation statement: %w", err)
+	}
+
+	for _, pt := range do.PredicateTypes {
+		if pt == statement.PredicateType {
+			return true, nil
+		}
+	}
+	for _, id := range do.DocumentIDs {
+		if id != "" && id == statement.Predicate.ID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// attestedEntity overrides the attestations of a signed entity
+// so that a modified set can be written back to the registry
+type attestedEntity struct {
+	oci.SignedEntity
+	digest       v1.Hash
+	attestations oci.Signatures
+}
+
+func (ae *attestedEntity) Attestations() (oci.Signatures, error) {
+	return ae.attestations, nil
+}
+
+func (ae *attestedEntity) Digest() (v1.Hash, error) {
+	return ae.digest, nil
+}
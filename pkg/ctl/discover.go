@@ -0,0 +1,182 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sirupsen/logrus"
+)
+
+// cosignTagRegexp matches the tags cosign stores signatures, attestations
+// and SBOMs under, named after the digest of the image they are about
+var cosignTagRegexp = regexp.MustCompile(`^(sha256)-([a-f0-9]{64})\.(att|sig|sbom)$`)
+
+// DiscoveredImage describes the VEX attestations of an image of a repository
+type DiscoveredImage struct {
+	Digest    string   `json:"digest"`          // Digest of the image
+	Tags      []string `json:"tags"`            // Tags pointing to the image, if any
+	Documents int      `json:"documents"`       // Number of VEX attestations
+	Authors   []string `json:"authors"`         // Authors of the attested VEX documents
+	Error     string   `json:"error,omitempty"` // Why the attestations could not be read
+}
+
+// Discovery lists the images of a repository and the VEX attached to them
+type Discovery struct {
+	Repository string            `json:"repository"`
+	Images     []DiscoveredImage `json:"images"`
+}
+
+// Covered returns the number of images with VEX attestations
+func (d *Discovery) Covered() int {
+	n := 0
+	for i := range d.Images {
+		if d.Images[i].Documents > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Write prints the discovery as a table, one image per line
+func (d *Discovery) Write(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Repository: %s\n", d.Repository)
+	fmt.Fprintf(&sb, "Images:     %d, %d with VEX attestations\n\n", len(d.Images), d.Covered())
+	for i := range d.Images {
+		img := &d.Images[i]
+		tags := strings.Join(img.Tags, ", ")
+		if tags == "" {
+			tags = "(untagged)"
+		}
+		switch {
+		case img.Error != "":
+			fmt.Fprintf(&sb, "%s  %s  error: %s\n", img.Digest, tags, img.Error)
+		case img.Documents == 0:
+			fmt.Fprintf(&sb, "%s  %s  no VEX\n", img.Digest, tags)
+		default:
+			fmt.Fprintf(&sb, "%s  %s  %d VEX by %s\n", img.Digest, tags, img.Documents, strings.Join(img.Authors, ", "))
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Discover walks the tags of a repository and reports which image digests
+// have VEX attestations attached and who authored them. Images only known
+// by the cosign tags of their attestations are included as untagged.
+// Attestations are read with the verification settings of the client.
+func (vexctl *VexCtl) Discover(ctx context.Context, repository string) (*Discovery, error) {
+	if _, err := name.NewRepository(repository); err != nil {
+		return nil, fmt.Errorf("parsing repository: %w", err)
+	}
+	if !vexctl.Options.Verification.Insecure {
+		if err := vexctl.Options.Verification.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	tags, err := listTags(ctx, vexctl.Options, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	// Group the tags by the digest they point to
+	byDigest := map[string][]string{}
+	imageTags := []string{}
+	for _, tag := range tags {
+		if m := cosignTagRegexp.FindStringSubmatch(tag); m != nil {
+			digest := m[1] + ":" + m[2]
+			if _, ok := byDigest[digest]; !ok {
+				byDigest[digest] = []string{}
+			}
+			continue
+		}
+		imageTags = append(imageTags, tag)
+	}
+	digests := make([]string, len(imageTags))
+	vexctl.reportProgress("Resolving tags", 0, len(imageTags))
+	if err := parallelDo(ctx, len(imageTags), func(i int) (err error) {
+		digests[i], err = vexctl.impl.ResolveImageDigest(ctx, vexctl.Options, repository+":"+imageTags[i])
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("resolving tags: %w", err)
+	}
+	vexctl.reportProgress("Resolving tags", len(imageTags), len(imageTags))
+	for i, digest := range digests {
+		byDigest[digest] = append(byDigest[digest], imageTags[i])
+	}
+
+	discovery := &Discovery{Repository: repository, Images: make([]DiscoveredImage, 0, len(byDigest))}
+	for digest, tags := range byDigest {
+		discovery.Images = append(discovery.Images, DiscoveredImage{Digest: digest, Tags: tags, Authors: []string{}})
+	}
+	sort.Slice(discovery.Images, func(i, j int) bool {
+		return discovery.Images[i].Digest < discovery.Images[j].Digest
+	})
+
+	// Images failing to read are reported, not fatal, so a
+	// single broken image doesn't spoil the audit
+	vexctl.reportProgress("Reading attestations", 0, len(discovery.Images))
+	if err := parallelDo(ctx, len(discovery.Images), func(i int) error {
+		img := &discovery.Images[i]
+		sort.Strings(img.Tags)
+		docs, err := vexctl.impl.ReadImageAttestations(ctx, vexctl.Options, repository+"@"+img.Digest)
+		if errors.Is(err, cosign.ErrNoMatchingAttestations) {
+			// Without verified attestations the image has no VEX to trust
+			return nil
+		}
+		if err != nil {
+			logrus.Warnf("Reading the attestations of %s: %v", img.Digest, err)
+			img.Error = err.Error()
+			return nil
+		}
+		img.Documents = len(docs)
+		seen := map[string]struct{}{}
+		for _, doc := range docs {
+			if _, ok := seen[doc.Author]; ok || doc.Author == "" {
+				continue
+			}
+			seen[doc.Author] = struct{}{}
+			img.Authors = append(img.Authors, doc.Author)
+		}
+		sort.Strings(img.Authors)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("reading attestations: %w", err)
+	}
+	vexctl.reportProgress("Reading attestations", len(discovery.Images), len(discovery.Images))
+	return discovery, nil
+}
+
+// listTags returns the tags of a repository
+func listTags(ctx context.Context, opts Options, repository string) ([]string, error) {
+	// Parsing the repository as a reference applies the registry mirrors
+	ref, err := parseReference(opts, repository)
+	if err != nil {
+		return nil, err
+	}
+	clientOpts, err := registryClientOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	if err := withRetry(ctx, opts, "listing tags", func() (err error) {
+		tags, err = remote.List(ref.Context(), append(clientOpts, remote.WithContext(ctx))...)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("listing tags of %s: %w", repository, err)
+	}
+	return tags, nil
+}
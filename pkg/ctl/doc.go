@@ -0,0 +1,33 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+/*
+Package ctl implements the operations of the vexctl command line tool as
+a Go library. Programs can embed vexctl to apply VEX data to scanner
+results, merge documents and generate attestations without invoking the
+CLI:
+
+	vexctl := ctl.New(ctl.WithAllowPartial(true))
+
+	vexes, err := vexctl.VexesFromURIs(ctx, []string{"data.vex.json"})
+	if err != nil {
+		return err
+	}
+
+	report, err = vexctl.Apply(ctx, report, vexes)
+	if err != nil {
+		return err
+	}
+
+Reports of scanners without SARIF output can be filtered too by
+registering a parser that converts them, see package formats. Registered
+formats take part in the format detection of ParseReport:
+
+	formats.Register(&myScannerFormat{})
+
+The client never writes to stdout; progress information is logged through
+logrus and all data is returned to the caller.
+*/
+package ctl
@@ -0,0 +1,109 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// FindStatement returns the index of the statement of a document about a
+// vulnerability and, if not empty, a product. It fails if there is no such
+// statement or if there are several, as the choice would be ambiguous.
+func FindStatement(doc *vex.VEX, vulnID, product string) (int, error) {
+	found := -1
+	for i := range doc.Statements {
+		if doc.Statements[i].Vulnerability != vulnID {
+			continue
+		}
+		if product != "" && !matchesAnyProduct(doc.Statements[i].Products, product) {
+			continue
+		}
+		if found != -1 {
+			return -1, fmt.Errorf("more than one statement about %s, select a product or a statement number", vulnID)
+		}
+		found = i
+	}
+	if found == -1 {
+		return -1, fmt.Errorf("no statement about %s found", vulnID)
+	}
+	return found, nil
+}
+
+// StatementYAML returns a statement as YAML, keeping the order of the
+// fields in its JSON representation
+func StatementYAML(s *vex.Statement) ([]byte, error) {
+	data, err := marshalYAML(s)
+	if err != nil {
+		return nil, fmt.Errorf("converting statement to YAML: %w", err)
+	}
+	return data, nil
+}
+
+// blockStyle clears the flow style inherited from JSON in a YAML tree
+func blockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle
+	for _, n := range node.Content {
+		blockStyle(n)
+	}
+}
+
+// ReplaceStatement returns a copy of a document with the statement at index
+// i replaced by the one parsed from YAML data. The new statement is
+// validated and its timestamp set to now, the document timestamp is updated
+// and its version incremented when numeric.
+func ReplaceStatement(doc *vex.VEX, i int, data []byte, now time.Time) (*vex.VEX, error) {
+	if i < 0 || i >= len(doc.Statements) {
+		return nil, fmt.Errorf("statement %d does not exist", i)
+	}
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing statement YAML: %w", err)
+	}
+	if raw == nil {
+		return nil, errors.New("the statement is empty")
+	}
+	jsonData, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("converting statement to JSON: %w", err)
+	}
+	s := vex.Statement{}
+	dec := json.NewDecoder(bytes.NewReader(jsonData))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("parsing statement: %w", err)
+	}
+	if s.Vulnerability == "" {
+		return nil, errors.New("the statement has no vulnerability")
+	}
+	if len(s.Products) == 0 {
+		return nil, errors.New("the statement has no products")
+	}
+	if err := s.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid statement: %w", err)
+	}
+
+	ts := now
+	s.Timestamp = &ts
+	newDoc := &vex.VEX{
+		Metadata:   doc.Metadata,
+		Statements: append([]vex.Statement{}, doc.Statements...),
+	}
+	newDoc.Statements[i] = s
+	newDoc.Timestamp = &ts
+	if v, err := strconv.Atoi(newDoc.Version); err == nil {
+		newDoc.Version = strconv.Itoa(v + 1)
+	}
+	return newDoc, nil
+}
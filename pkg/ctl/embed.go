@@ -0,0 +1,107 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+const (
+	// DefaultEmbedLabel is the image label where embedded VEX documents are stored
+	DefaultEmbedLabel = "dev.openvex.document"
+
+	// DefaultEmbedPath is the path in the image filesystem where the layer
+	// with the embedded VEX document is written
+	DefaultEmbedPath = "/usr/share/openvex/vex.json"
+)
+
+// EmbedOptions control how a VEX document is embedded in an image
+type EmbedOptions struct {
+	// Label stores the document in the image configuration as a label
+	Label bool
+
+	// LabelName is the name of the label, defaults to DefaultEmbedLabel
+	LabelName string
+
+	// Layer adds a layer to the image with the document at Path
+	Layer bool
+
+	// Path is where the document is written in the new layer,
+	// defaults to DefaultEmbedPath
+	Path string
+
+	// Destination is the reference the new image is pushed to. When
+	// empty, the new image replaces the original tag.
+	Destination string
+}
+
+// Embed injects a VEX document into an image as a label and/or a layer
+// and pushes the resulting image. Unlike attestations, embedded documents
+// are part of the image contents so they change the image digest, which
+// is returned.
+func (vexctl *VexCtl) Embed(ctx context.Context, vexDataPath, imageRef string, opts EmbedOptions) (string, error) {
+	if !opts.Label && !opts.Layer {
+		return "", errors.New("VEX data has to be embedded as a label, a layer or both")
+	}
+	if opts.LabelName == "" {
+		opts.LabelName = DefaultEmbedLabel
+	}
+	if opts.Path == "" {
+		opts.Path = DefaultEmbedPath
+	}
+
+	doc, err := vex.Load(vexDataPath)
+	if err != nil {
+		return "", fmt.Errorf("loading VEX document: %w", err)
+	}
+
+	vexctl.reportProgress("Embedding VEX document", 0, 1)
+	defer vexctl.Options.Metrics.Track(MetricsPhasePush)()
+	digest, err := vexctl.impl.EmbedVEX(ctx, vexctl.Options, doc, imageRef, opts)
+	if err != nil {
+		return "", fmt.Errorf("embedding VEX document: %w", err)
+	}
+	vexctl.reportProgress("Embedding VEX document", 1, 1)
+	return digest, nil
+}
+
+// embedLayer returns an image layer with the document written at path
+func embedLayer(data []byte, path string, modTime time.Time, mediaType types.MediaType) (v1.Layer, error) {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     strings.TrimPrefix(path, "/"),
+		Mode:     0o644,
+		Size:     int64(len(data)),
+		ModTime:  modTime,
+	}); err != nil {
+		return nil, fmt.Errorf("writing layer header: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, fmt.Errorf("writing document to layer: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("closing layer: %w", err)
+	}
+
+	return tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b.Bytes())), nil
+	}, tarball.WithMediaType(mediaType))
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// DocumentDecision records how a VEX document affects the
+// results about a vulnerability
+type DocumentDecision struct {
+	Document   string
+	Statement  *vex.Statement
+	Match      string // How the statement was matched to the products of the results
+	Suppresses bool
+	Reason     string
+}
+
+// ResultGroup gathers the results about a vulnerability identified by
+// the same products, which VEX statements are resolved for
+type ResultGroup struct {
+	Products   []string
+	Results    int
+	Decisions  []DocumentDecision
+	Suppressed bool
+}
+
+// Explanation describes why the results about a vulnerability
+// are kept or suppressed when applying VEX documents to a report
+type Explanation struct {
+	Vulnerability     string
+	Rules             []string
+	Results           int
+	SuppressedResults int
+	Groups            []ResultGroup
+	Suppressed        bool // True if all the results are suppressed
+}
+
+// Explain returns why the results about a vulnerability are kept or
+// suppressed by the VEX documents. Statements are resolved for the
+// products of each result, as when applying the documents. Like Coverage,
+// it has to be called before applying the documents to the report.
+func (vexctl *VexCtl) Explain(report *sarif.Report, vexDocs []*vex.VEX, vulnID string) *Explanation {
+	exp := &Explanation{
+		Vulnerability: vulnID,
+		Rules:         []string{},
+		Groups:        []ResultGroup{},
+	}
+
+	rules := map[string]struct{}{}
+	groups := map[string]int{}
+	for _, run := range report.Runs {
+		for _, res := range run.Results {
+			if res.RuleID == nil {
+				continue
+			}
+			if m := cveRegexp.FindStringSubmatch(*res.RuleID); len(m) == 2 && m[1] == vulnID {
+				exp.Results++
+				if _, ok := rules[*res.RuleID]; !ok {
+					rules[*res.RuleID] = struct{}{}
+					exp.Rules = append(exp.Rules, *res.RuleID)
+				}
+				products := resultProducts(res.Properties, vexctl.Options.Products)
+				key := strings.Join(products, "\x00")
+				if _, ok := groups[key]; !ok {
+					groups[key] = len(exp.Groups)
+					exp.Groups = append(exp.Groups, ResultGroup{Products: products})
+				}
+				exp.Groups[groups[key]].Results++
+			}
+		}
+	}
+	if len(exp.Groups) == 0 {
+		exp.Groups = append(exp.Groups, ResultGroup{Products: append([]string{}, vexctl.Options.Products...)})
+	}
+
+	// Sort a copy, the documents passed by the caller keep their order
+	sorted := vexctl.impl.Sort(append([]*vex.VEX{}, vexDocs...))
+	exp.Suppressed = true
+	for i := range exp.Groups {
+		g := &exp.Groups[i]
+		g.Decisions = []DocumentDecision{}
+		for _, doc := range sorted {
+			d := vexctl.decide(doc, vulnID, g.Products)
+			if d.Suppresses {
+				g.Suppressed = true
+			}
+			g.Decisions = append(g.Decisions, d)
+		}
+		if g.Suppressed {
+			exp.SuppressedResults += g.Results
+		} else {
+			exp.Suppressed = false
+		}
+	}
+	return exp
+}
+
+// decide resolves the statement of a document applying to the results of
+// a vulnerability identified by products, like ApplySingleVEX does after
+// dropping the statements with justifications that are not allowed
+func (vexctl *VexCtl) decide(doc *vex.VEX, vulnID string, products []string) DocumentDecision {
+	d := DocumentDecision{Document: doc.ID}
+	var rejected *vex.Statement
+	for i := range doc.Statements {
+		s := &doc.Statements[i]
+		if s.Vulnerability != vulnID || !statementAppliesTo(s, products) {
+			continue
+		}
+		if vexctl.honored(s) {
+			d.Statement = s
+			break
+		}
+		if rejected == nil {
+			rejected = s
+		}
+	}
+
+	if d.Statement == nil && rejected == nil {
+		s := statementFromID(doc, vulnID)
+		if s == nil {
+			d.Reason = "the document has no statement about the vulnerability"
+			return d
+		}
+		m := matchProducts(s, products)
+		d.Match = fmt.Sprintf("%s does not match %s", m.Statement, m.Result)
+		d.Reason = "no statement about the vulnerability applies to the products of the results"
+		return d
+	}
+
+	if d.Statement == nil {
+		d.Statement = rejected
+	}
+	if m := matchProducts(d.Statement, products); m != nil {
+		d.Match = fmt.Sprintf("%s matches %s", m.Statement, m.Result)
+	} else {
+		d.Match = "by vulnerability, the statement does not list the package of the results"
+	}
+	switch {
+	case d.Statement == rejected:
+		d.Reason = fmt.Sprintf("justification %q is not allowed", d.Statement.Justification)
+	case d.Statement.Status == vex.StatusNotAffected || d.Statement.Status == vex.StatusFixed:
+		d.Suppresses = true
+		d.Reason = fmt.Sprintf("status %s suppresses the results", d.Statement.Status)
+	default:
+		d.Reason = fmt.Sprintf("status %s does not suppress the results", d.Statement.Status)
+	}
+	return d
+}
+
+// Write prints the explanation in human readable form
+func (exp *Explanation) Write(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Vulnerability: %s\n", exp.Vulnerability)
+	if exp.Results == 0 {
+		sb.WriteString("Results:       none found in the report\n")
+	} else {
+		fmt.Fprintf(&sb, "Results:       %d (rules %s)\n", exp.Results, strings.Join(exp.Rules, ", "))
+	}
+
+	for gi := range exp.Groups {
+		g := &exp.Groups[gi]
+		if len(g.Products) == 0 {
+			fmt.Fprintf(&sb, "Products:      none recorded (%d results)\n", g.Results)
+		} else {
+			fmt.Fprintf(&sb, "Products:      %s (%d results)\n", strings.Join(g.Products, ", "), g.Results)
+		}
+		sb.WriteString("Documents, applied in chronological order:\n")
+		for i, d := range g.Decisions {
+			id := d.Document
+			if id == "" {
+				id = "(no id)"
+			}
+			fmt.Fprintf(&sb, "  %d. %s\n", i+1, id)
+			if d.Statement != nil {
+				fmt.Fprintf(&sb, "     statement: status %s", d.Statement.Status)
+				if d.Statement.Justification != "" {
+					fmt.Fprintf(&sb, ", justification %s", d.Statement.Justification)
+				}
+				if d.Statement.Timestamp != nil {
+					fmt.Fprintf(&sb, ", issued %s", d.Statement.Timestamp.Format(time.RFC3339))
+				}
+				sb.WriteString("\n")
+			}
+			if d.Match != "" {
+				fmt.Fprintf(&sb, "     match:     %s\n", d.Match)
+			}
+			fmt.Fprintf(&sb, "     decision:  %s\n", d.Reason)
+		}
+	}
+
+	switch {
+	case exp.Results == 0:
+		sb.WriteString("Outcome:       nothing to filter\n")
+	case exp.Suppressed:
+		sb.WriteString("Outcome:       SUPPRESSED, the documents state the vulnerability is not exploitable in any of the products\n")
+	case exp.SuppressedResults > 0:
+		fmt.Fprintf(&sb, "Outcome:       PARTIALLY SUPPRESSED, %d of %d results kept\n",
+			exp.Results-exp.SuppressedResults, exp.Results)
+	default:
+		sb.WriteString("Outcome:       KEPT, no document states the vulnerability is not exploitable in the products\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// Formats written by export: scanner ignore files and SPDX 3.0 documents
+const (
+	ExportFormatGrype = "grype"
+	ExportFormatTrivy = "trivy"
+	ExportFormatSPDX3 = "spdx3"
+)
+
+// ProductStatement is the latest statement about a vulnerability in a product
+type ProductStatement struct {
+	Product   string
+	Statement vex.Statement
+}
+
+// SuppressedStatement is the latest statement about a vulnerability
+// in a product, when it suppresses the scanner results about it
+type SuppressedStatement = ProductStatement
+
+// LatestStatements replays the statements of the documents in
+// chronological order and returns the latest statement about each
+// vulnerability and product, sorted by vulnerability and product. If
+// products are passed, only the statements about them are considered.
+func (vexctl *VexCtl) LatestStatements(ctx context.Context, docs []*vex.VEX, products []string) ([]ProductStatement, error) {
+	merged, err := vexctl.Merge(ctx, &MergeOptions{}, docs)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := map[string]ProductStatement{}
+	for _, s := range merged.Statements { //nolint:gocritic // statements are copied on purpose
+		for _, p := range s.Products {
+			if len(products) > 0 && !productSelected(p, products) {
+				continue
+			}
+			latest[s.Vulnerability+"\x00"+p] = ProductStatement{Product: p, Statement: s}
+		}
+	}
+
+	res := make([]ProductStatement, 0, len(latest))
+	for _, ps := range latest {
+		res = append(res, ps)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Statement.Vulnerability != res[j].Statement.Vulnerability {
+			return res[i].Statement.Vulnerability < res[j].Statement.Vulnerability
+		}
+		return res[i].Product < res[j].Product
+	})
+	return res, nil
+}
+
+// productSelected returns true if a statement product
+// applies to any of the products selected
+func productSelected(statementProduct string, products []string) bool {
+	for _, p := range products {
+		if productMatches(statementProduct, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Suppressions returns, for each vulnerability and product, the latest
+// statement when its status suppresses the results (not_affected or
+// fixed). If products are passed, only the statements about them are
+// considered.
+func (vexctl *VexCtl) Suppressions(ctx context.Context, docs []*vex.VEX, products []string) ([]SuppressedStatement, error) {
+	latest, err := vexctl.LatestStatements(ctx, docs, products)
+	if err != nil {
+		return nil, err
+	}
+	suppressed := []SuppressedStatement{}
+	for _, ss := range latest {
+		if ss.Statement.Status == vex.StatusNotAffected || ss.Statement.Status == vex.StatusFixed {
+			suppressed = append(suppressed, ss)
+		}
+	}
+	return suppressed, nil
+}
+
+// grypeTypesFromPurl maps purl types to the package types of grype
+var grypeTypesFromPurl = map[string]string{}
+
+func init() {
+	for grypeType, purlType := range grypePurlTypes {
+		grypeTypesFromPurl[purlType] = grypeType
+	}
+}
+
+// WriteGrypeIgnore writes the suppressions as the ignore rules of a grype
+// configuration file. Products identified by a package URL are matched by
+// package type, name and version, other products only by vulnerability.
+func WriteGrypeIgnore(w io.Writer, suppressed []SuppressedStatement) error {
+	rules := []GrypeIgnoreRule{}
+	seen := map[GrypeIgnoreRule]struct{}{}
+	for i := range suppressed {
+		s := &suppressed[i].Statement
+		// The vex-status fields are not set, as grype only applies
+		// rules with them to the results of its own VEX processing
+		r := GrypeIgnoreRule{
+			Vulnerability: s.Vulnerability,
+			Reason:        exportReason(s),
+		}
+		if purl, ok := parsePackageURL(suppressed[i].Product); ok {
+			if grypeType, ok := grypeTypesFromPurl[purl.Type]; ok {
+				r.Package = GrypeIgnorePackage{Name: purl.Name, Version: purl.Version, Type: grypeType}
+			}
+		}
+		if _, ok := seen[r]; ok {
+			continue
+		}
+		seen[r] = struct{}{}
+		rules = append(rules, r)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string]interface{}{"ignore": rules}); err != nil {
+		return fmt.Errorf("encoding grype ignore rules: %w", err)
+	}
+	return enc.Close()
+}
+
+// exportReason returns the rationale of a statement recorded in the
+// ignore files
+func exportReason(s *vex.Statement) string {
+	reason := string(s.Status)
+	if s.Justification != "" {
+		reason += " (" + string(s.Justification) + ")"
+	}
+	if s.ImpactStatement != "" {
+		reason += ": " + s.ImpactStatement
+	} else if s.StatusNotes != "" {
+		reason += ": " + s.StatusNotes
+	}
+	return strings.ReplaceAll(reason, "\n", " ")
+}
+
+// WriteTrivyIgnore writes the suppressions as a .trivyignore file. Trivy
+// ignores vulnerabilities regardless of the package, so each one is listed
+// once with a comment recording the products and the rationale.
+func WriteTrivyIgnore(w io.Writer, suppressed []SuppressedStatement) error {
+	var sb strings.Builder
+	for i := 0; i < len(suppressed); {
+		vuln := suppressed[i].Statement.Vulnerability
+		for ; i < len(suppressed) && suppressed[i].Statement.Vulnerability == vuln; i++ {
+			fmt.Fprintf(&sb, "# %s: %s\n", suppressed[i].Product, exportReason(&suppressed[i].Statement))
+		}
+		sb.WriteString(vuln + "\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
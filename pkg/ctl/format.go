@@ -0,0 +1,72 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// VEX document formats. The zero value means the format is detected.
+const (
+	DocumentFormatOpenVEX   = "vex"
+	DocumentFormatYAML      = "yaml"
+	DocumentFormatCSAF      = "csaf"
+	DocumentFormatCycloneDX = "cyclonedx"
+)
+
+// DetectDocumentFormat returns the format of the VEX document in data:
+// OpenVEX in JSON or YAML, or CSAF
+func DetectDocumentFormat(data []byte) (string, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return "", errors.New("document is empty")
+	}
+
+	if trimmed[0] != '{' {
+		probe := map[string]interface{}{}
+		if err := yaml.Unmarshal(trimmed, &probe); err != nil {
+			return "", fmt.Errorf("document is neither JSON nor YAML: %w", err)
+		}
+		return DocumentFormatYAML, nil
+	}
+
+	probe := struct {
+		Document *struct {
+			CSAFVersion string `json:"csaf_version"`
+		} `json:"document"`
+		BOMFormat string `json:"bomFormat"`
+	}{}
+	if err := json.Unmarshal(trimmed, &probe); err != nil {
+		return "", fmt.Errorf("parsing JSON document: %w", err)
+	}
+	switch {
+	case probe.Document != nil && probe.Document.CSAFVersion != "":
+		return DocumentFormatCSAF, nil
+	case probe.BOMFormat == "CycloneDX":
+		return DocumentFormatCycloneDX, nil
+	default:
+		return DocumentFormatOpenVEX, nil
+	}
+}
+
+// detectFileFormat returns the format of the VEX document in a file
+func detectFileFormat(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading document: %w", err)
+	}
+	format, err := DetectDocumentFormat(data)
+	if err != nil {
+		return "", fmt.Errorf("detecting format of %s: %w", path, err)
+	}
+	return format, nil
+}
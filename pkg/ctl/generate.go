@@ -0,0 +1,128 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// GenerateOptions control the document generated from a scanner report
+type GenerateOptions struct {
+	DocumentID string
+	Author     string
+	AuthorRole string
+
+	// Products listed in the statements. When empty, they are derived
+	// from the images recorded as scanned in the report.
+	Products        []string
+	Status          vex.Status
+	Justification   vex.Justification
+	ImpactStatement string
+	ActionStatement string
+}
+
+// GenerateFromReport returns a new VEX document with a statement for each
+// vulnerability found in a SARIF report. All statements get the same
+// status, by default under_investigation, to produce an initial document
+// that is refined later as the vulnerabilities are triaged.
+func (vexctl *VexCtl) GenerateFromReport(report *sarif.Report, opts *GenerateOptions) (*vex.VEX, error) {
+	products := opts.Products
+	if len(products) == 0 {
+		var err error
+		products, err = ReportProducts(report)
+		if err != nil {
+			return nil, err
+		}
+		if len(products) == 0 {
+			return nil, errors.New(
+				"at least one product is required to generate statements, the report does not record the scanned image",
+			)
+		}
+		logrus.Infof("Using the scanned images as products: %s", strings.Join(products, ", "))
+	}
+	status := opts.Status
+	if status == "" {
+		status = vex.StatusUnderInvestigation
+	}
+
+	vulns := map[string]struct{}{}
+	for _, run := range report.Runs {
+		for _, res := range run.Results {
+			if res.RuleID == nil {
+				continue
+			}
+			m := cveRegexp.FindStringSubmatch(*res.RuleID)
+			if len(m) != 2 {
+				logrus.WithField("rule", *res.RuleID).Warn(
+					"Invalid rulename in sarif report, expected CVE identifier",
+				)
+				continue
+			}
+			vulns[m[1]] = struct{}{}
+		}
+	}
+
+	ids := make([]string, 0, len(vulns))
+	for id := range vulns {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	doc := vex.New()
+	doc.ID = opts.DocumentID
+	if opts.Author != "" {
+		doc.Author = opts.Author
+	}
+	if opts.AuthorRole != "" {
+		doc.AuthorRole = opts.AuthorRole
+	}
+
+	for _, id := range ids {
+		statement := vex.Statement{
+			Vulnerability:   id,
+			Products:        products,
+			Status:          status,
+			Justification:   opts.Justification,
+			ImpactStatement: opts.ImpactStatement,
+			ActionStatement: opts.ActionStatement,
+		}
+		if err := statement.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid statement for %s: %w", id, err)
+		}
+		doc.Statements = append(doc.Statements, statement)
+	}
+
+	if _, err := doc.GenerateCanonicalID(); err != nil {
+		return nil, fmt.Errorf("generating document id: %w", err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"statements": len(doc.Statements),
+		"status":     status,
+	}).Info("Generated VEX document from report")
+	return &doc, nil
+}
+
+// ReportProducts returns the OCI package URLs of the
+// images recorded as scanned in a report
+func ReportProducts(report *sarif.Report) ([]string, error) {
+	products := []string{}
+	for _, image := range ReportImages(report) {
+		purl, err := ImagePackageURL(image)
+		if err != nil {
+			return nil, fmt.Errorf("deriving product of %s: %w", image, err)
+		}
+		products = append(products, purl)
+	}
+	return products, nil
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// DefaultGitHubAPIURL is the endpoint of the GitHub REST API
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+// GitHubImportOptions control which dismissed GitHub alerts are imported
+type GitHubImportOptions struct {
+	Repository   string   // Repository to read the alerts from, as owner/name
+	Token        string   // Token to authenticate to the GitHub API, read from the keychain if empty
+	APIURL       string   // URL of the API, defaults to DefaultGitHubAPIURL
+	Products     []string // Products of the statements, defaults to the repository purl
+	Dependabot   bool     // Import the dismissed Dependabot alerts
+	CodeScanning bool     // Import the dismissed code scanning alerts
+}
+
+// githubUser is the user that dismissed an alert
+type githubUser struct {
+	Login string `json:"login"`
+}
+
+// dependabotAlert holds the fields of a Dependabot alert used by vexctl
+type dependabotAlert struct {
+	Number           int         `json:"number"`
+	HTMLURL          string      `json:"html_url"`
+	DismissedAt      *time.Time  `json:"dismissed_at"`
+	DismissedBy      *githubUser `json:"dismissed_by"`
+	DismissedReason  string      `json:"dismissed_reason"`
+	DismissedComment string      `json:"dismissed_comment"`
+	Dependency       struct {
+		Package struct {
+			Ecosystem string `json:"ecosystem"`
+			Name      string `json:"name"`
+		} `json:"package"`
+	} `json:"dependency"`
+	SecurityAdvisory struct {
+		GHSAID string `json:"ghsa_id"`
+		CVEID  string `json:"cve_id"`
+	} `json:"security_advisory"`
+}
+
+// codeScanningAlert holds the fields of a code scanning alert used by vexctl
+type codeScanningAlert struct {
+	Number           int         `json:"number"`
+	HTMLURL          string      `json:"html_url"`
+	DismissedAt      *time.Time  `json:"dismissed_at"`
+	DismissedBy      *githubUser `json:"dismissed_by"`
+	DismissedReason  string      `json:"dismissed_reason"`
+	DismissedComment string      `json:"dismissed_comment"`
+	Rule             struct {
+		ID string `json:"id"`
+	} `json:"rule"`
+}
+
+// githubDismissal is how a GitHub dismissal reason translates to VEX
+type githubDismissal struct {
+	status        vex.Status
+	justification vex.Justification
+	statement     string // Impact or action statement when there is no comment
+}
+
+// githubDismissals maps the dismissal reasons of Dependabot
+// and code scanning alerts to VEX statuses
+var githubDismissals = map[string]githubDismissal{
+	// Dependabot
+	"not_used":       {vex.StatusNotAffected, vex.VulnerableCodeNotInExecutePath, ""},
+	"inaccurate":     {vex.StatusNotAffected, "", "The alert was dismissed as inaccurate"},
+	"tolerable_risk": {vex.StatusAffected, "", "The risk was accepted as tolerable"},
+	"no_bandwidth":   {vex.StatusAffected, "", "There is no bandwidth to fix the vulnerability yet"},
+	"fix_started":    {vex.StatusAffected, "", "A fix has been started"},
+	// Code scanning
+	"false positive": {vex.StatusNotAffected, "", "The alert was dismissed as a false positive"},
+	"used in tests":  {vex.StatusNotAffected, vex.VulnerableCodeNotInExecutePath, ""},
+	"won't fix":      {vex.StatusAffected, "", "The vulnerability will not be fixed"},
+}
+
+// githubEcosystems maps Dependabot ecosystems to purl types
+var githubEcosystems = map[string]string{
+	"npm":      "npm",
+	"pip":      "pypi",
+	"maven":    "maven",
+	"nuget":    "nuget",
+	"rubygems": "gem",
+	"composer": "composer",
+	"go":       "golang",
+	"rust":     "cargo",
+	"pub":      "pub",
+	"actions":  "github",
+}
+
+// githubNextLink extracts the URL of the next page from a Link header
+var githubNextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// ImportGitHubDismissals reads the dismissed Dependabot and code scanning
+// alerts of a repository and converts them into VEX statements. The
+// dismissal reason sets the status of each statement, its timestamp is
+// the time of the dismissal and the status notes record who dismissed
+// the alert and their comment.
+func (vexctl *VexCtl) ImportGitHubDismissals(ctx context.Context, opts GitHubImportOptions) ([]vex.Statement, error) {
+	if strings.Count(opts.Repository, "/") != 1 {
+		return nil, fmt.Errorf("invalid repository %q, expected owner/name", opts.Repository)
+	}
+	apiURL := strings.TrimSuffix(opts.APIURL, "/")
+	if apiURL == "" {
+		apiURL = DefaultGitHubAPIURL
+	}
+	products := opts.Products
+	if len(products) == 0 {
+		products = []string{"pkg:github/" + opts.Repository}
+	}
+	if opts.Token == "" {
+		token, err := keychainSecret(vexctl.Options, apiURL)
+		if err != nil {
+			return nil, err
+		}
+		opts.Token = token
+	}
+	client, err := httpClient(vexctl.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := []vex.Statement{}
+	if opts.Dependabot {
+		alerts := []dependabotAlert{}
+		if err := githubList(ctx, client, opts.Token, apiURL+"/repos/"+opts.Repository+"/dependabot/alerts", &alerts); err != nil {
+			return nil, fmt.Errorf("listing Dependabot alerts: %w", err)
+		}
+		for i := range alerts {
+			a := &alerts[i]
+			vuln := a.SecurityAdvisory.CVEID
+			if vuln == "" {
+				vuln = a.SecurityAdvisory.GHSAID
+			}
+			s, err := githubStatement(vuln, products, a.DismissedReason, a.DismissedComment, a.DismissedBy, a.DismissedAt, a.HTMLURL)
+			if err != nil {
+				return nil, fmt.Errorf("converting Dependabot alert #%d: %w", a.Number, err)
+			}
+			if purlType, ok := githubEcosystems[a.Dependency.Package.Ecosystem]; ok && a.Dependency.Package.Name != "" {
+				s.Subcomponents = []string{fmt.Sprintf("pkg:%s/%s", purlType, a.Dependency.Package.Name)}
+			}
+			statements = append(statements, s)
+		}
+	}
+	if opts.CodeScanning {
+		alerts := []codeScanningAlert{}
+		if err := githubList(ctx, client, opts.Token, apiURL+"/repos/"+opts.Repository+"/code-scanning/alerts", &alerts); err != nil {
+			return nil, fmt.Errorf("listing code scanning alerts: %w", err)
+		}
+		for i := range alerts {
+			a := &alerts[i]
+			s, err := githubStatement(a.Rule.ID, products, a.DismissedReason, a.DismissedComment, a.DismissedBy, a.DismissedAt, a.HTMLURL)
+			if err != nil {
+				return nil, fmt.Errorf("converting code scanning alert #%d: %w", a.Number, err)
+			}
+			statements = append(statements, s)
+		}
+	}
+	logrus.WithField("statements", len(statements)).Info("Imported dismissed GitHub alerts")
+	return statements, nil
+}
+
+// githubStatement builds the statement recording the dismissal of an alert
+func githubStatement(
+	vuln string, products []string, reason, comment string, by *githubUser, at *time.Time, alertURL string,
+) (vex.Statement, error) {
+	dismissal, ok := githubDismissals[reason]
+	if !ok {
+		return vex.Statement{}, fmt.Errorf("unknown dismissal reason %q", reason)
+	}
+	if vuln == "" {
+		return vex.Statement{}, errors.New("the alert has no vulnerability identifier")
+	}
+	s := vex.Statement{
+		Vulnerability: vuln,
+		Timestamp:     at,
+		Products:      products,
+		Status:        dismissal.status,
+		Justification: dismissal.justification,
+	}
+	statement := comment
+	if statement == "" {
+		statement = dismissal.statement
+	}
+	if s.Status == vex.StatusAffected {
+		s.ActionStatement = statement
+	} else {
+		s.ImpactStatement = statement
+	}
+	notes := fmt.Sprintf("Dismissed on GitHub as %q", reason)
+	if by != nil && by.Login != "" {
+		notes += " by @" + by.Login
+	}
+	if alertURL != "" {
+		notes += ", see " + alertURL
+	}
+	s.StatusNotes = notes
+	return s, nil
+}
+
+// githubList fetches all the pages of dismissed alerts from a GitHub API
+// listing endpoint, decoding them into list
+func githubList[T any](ctx context.Context, client *http.Client, token, endpoint string, list *[]T) error {
+	next := endpoint + "?state=dismissed&per_page=100"
+	for next != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, http.NoBody)
+		if err != nil {
+			return fmt.Errorf("creating request: %w", err)
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("querying GitHub API: %w", err)
+		}
+		page := []T{}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("querying GitHub API: HTTP %s", resp.Status)
+		}
+		if err != nil {
+			return fmt.Errorf("decoding alerts: %w", err)
+		}
+		*list = append(*list, page...)
+
+		next = ""
+		if m := githubNextLink.FindStringSubmatch(resp.Header.Get("Link")); len(m) == 2 {
+			next = m[1]
+		}
+	}
+	return nil
+}
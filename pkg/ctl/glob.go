@@ -0,0 +1,145 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/release-utils/util"
+)
+
+// globChars are the characters that make a path a glob pattern
+const globChars = "*?["
+
+// isGlob returns true if a VEX source is a local glob pattern. URLs,
+// git and image references are never expanded.
+func isGlob(uri string) bool {
+	if strings.Contains(uri, "://") || strings.HasPrefix(uri, "git+") {
+		return false
+	}
+	return strings.ContainsAny(uri, globChars)
+}
+
+// ExpandGlobs replaces the glob patterns in a list of VEX sources with
+// the files they match, sorted by path. Besides the syntax of
+// filepath.Match, a ** segment matches any number of directories,
+// eg vex/**/*.openvex.json. Other sources are returned as they are.
+// It is an error for a pattern to match no files.
+func ExpandGlobs(uris []string) ([]string, error) {
+	expanded := make([]string, 0, len(uris))
+	for _, uri := range uris {
+		if !isGlob(uri) || util.Exists(uri) {
+			expanded = append(expanded, uri)
+			continue
+		}
+		matches, err := globFiles(uri)
+		if err != nil {
+			return nil, fmt.Errorf("expanding %s: %w", uri, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", uri)
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+// expandFiles expands the glob patterns in a list of local paths and
+// replaces the directories with the VEX documents they contain
+func expandFiles(paths []string) ([]string, error) {
+	paths, err := ExpandGlobs(paths)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(paths))
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		docs, err := dirDocuments(p)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, docs...)
+	}
+	return files, nil
+}
+
+// globFiles returns the files matching a pattern. The directory tree is
+// walked from the longest leading path without glob characters.
+func globFiles(pattern string) ([]string, error) {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	for _, s := range segments {
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	base := 0
+	for base < len(segments) && !strings.ContainsAny(segments[base], globChars) {
+		base++
+	}
+	root := strings.Join(segments[:base], "/")
+	switch {
+	case root == "" && base > 0:
+		root = "/"
+	case root == "":
+		root = "."
+	}
+
+	matches := []string{}
+	err := filepath.WalkDir(filepath.FromSlash(root), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(root), p)
+		if err != nil {
+			return err
+		}
+		if matchSegments(segments[base:], strings.Split(filepath.ToSlash(rel), "/")) {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("walking %s: %w", root, err)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// matchSegments matches the segments of a path against those of a
+// pattern, where a ** segment matches zero or more path segments
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
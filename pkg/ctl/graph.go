@@ -0,0 +1,172 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// Lineage records which statements of a set of source documents ended up
+// in a merged document and which statements supersede others
+type Lineage struct {
+	Sources    []*vex.VEX
+	Merged     *vex.VEX
+	Statements []LineageStatement
+}
+
+// LineageStatement is a statement of a source document
+type LineageStatement struct {
+	Source     int            // Index of the document in Sources
+	Statement  *vex.Statement // The statement in the source document
+	Merged     bool           // True if the statement is part of the merged document
+	Supersedes []int          // Statements about the same vulnerability and product replaced by this one
+}
+
+// Lineage computes how the statements of the source documents flow into
+// a document merged from them. Statements about the same vulnerability and
+// product supersede the earlier ones, in chronological order.
+func (vexctl *VexCtl) Lineage(sources []*vex.VEX, merged *vex.VEX) *Lineage {
+	lineage := &Lineage{Sources: sources, Merged: merged}
+
+	inMerged := map[string]struct{}{}
+	for i := range merged.Statements {
+		inMerged[statementKey(&merged.Statements[i], nil)] = struct{}{}
+	}
+
+	type chainEntry struct {
+		index int
+		ts    time.Time
+	}
+	chains := map[string][]chainEntry{}
+	for d, doc := range sources {
+		for i := range doc.Statements {
+			s := &doc.Statements[i]
+			_, ok := inMerged[statementKey(s, doc)]
+			lineage.Statements = append(lineage.Statements, LineageStatement{
+				Source: d, Statement: s, Merged: ok,
+			})
+			var ts time.Time
+			if t := statementTime(s, doc); t != nil {
+				ts = *t
+			}
+			for _, p := range s.Products {
+				key := s.Vulnerability + "\x00" + p
+				chains[key] = append(chains[key], chainEntry{len(lineage.Statements) - 1, ts})
+			}
+		}
+	}
+
+	for _, chain := range chains {
+		sort.SliceStable(chain, func(i, j int) bool { return chain[i].ts.Before(chain[j].ts) })
+		for i := 1; i < len(chain); i++ {
+			s := &lineage.Statements[chain[i].index]
+			if !containsInt(s.Supersedes, chain[i-1].index) {
+				s.Supersedes = append(s.Supersedes, chain[i-1].index)
+			}
+		}
+	}
+	for i := range lineage.Statements {
+		sort.Ints(lineage.Statements[i].Supersedes)
+	}
+	return lineage
+}
+
+// statementKey identifies a statement when matching it across documents
+func statementKey(s *vex.Statement, doc *vex.VEX) string {
+	ts := ""
+	if t := statementTime(s, doc); t != nil {
+		ts = t.UTC().Format(time.RFC3339Nano)
+	}
+	products := append([]string{}, s.Products...)
+	sort.Strings(products)
+	return strings.Join([]string{
+		s.Vulnerability, string(s.Status), string(s.Justification), ts, strings.Join(products, ","),
+	}, "\x00")
+}
+
+// statementTime returns the timestamp of a statement, falling back
+// to the timestamp of its document when it has none
+func statementTime(s *vex.Statement, doc *vex.VEX) *time.Time {
+	if s.Timestamp != nil || doc == nil {
+		return s.Timestamp
+	}
+	return doc.Timestamp
+}
+
+func containsInt(list []int, n int) bool {
+	for _, i := range list {
+		if i == n {
+			return true
+		}
+	}
+	return false
+}
+
+// documentLabel returns the text identifying a document in the graphs
+func documentLabel(doc *vex.VEX) string {
+	label := doc.ID
+	if label == "" {
+		label = "(no id)"
+	}
+	if doc.Author != "" {
+		label += "\n" + doc.Author
+	}
+	return label
+}
+
+// WriteDOT writes the lineage as a graphviz DOT graph
+func (l *Lineage) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph lineage {\n  rankdir=LR;\n  node [fontname=\"sans-serif\"];\n")
+	for d, doc := range l.Sources {
+		fmt.Fprintf(&sb, "  d%d [shape=folder, label=%q];\n", d, documentLabel(doc))
+	}
+	fmt.Fprintf(&sb, "  merged [shape=folder, style=bold, label=%q];\n", documentLabel(l.Merged))
+	for i, s := range l.Statements {
+		fmt.Fprintf(&sb, "  s%d [shape=box, label=%q];\n", i, s.Statement.Vulnerability+"\n"+string(s.Statement.Status))
+		fmt.Fprintf(&sb, "  d%d -> s%d;\n", s.Source, i)
+		if s.Merged {
+			fmt.Fprintf(&sb, "  s%d -> merged;\n", i)
+		}
+		for _, old := range s.Supersedes {
+			fmt.Fprintf(&sb, "  s%d -> s%d [style=dashed, label=\"superseded by\"];\n", old, i)
+		}
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteMermaid writes the lineage as a mermaid flowchart
+func (l *Lineage) WriteMermaid(w io.Writer) error {
+	label := func(s string) string {
+		return strings.ReplaceAll(strings.ReplaceAll(s, "\n", "<br>"), `"`, "#quot;")
+	}
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+	for d, doc := range l.Sources {
+		fmt.Fprintf(&sb, "  d%d[\"%s\"]\n", d, label(documentLabel(doc)))
+	}
+	fmt.Fprintf(&sb, "  merged[[\"%s\"]]\n", label(documentLabel(l.Merged)))
+	for i, s := range l.Statements {
+		fmt.Fprintf(&sb, "  s%d(\"%s<br>%s\")\n", i, label(s.Statement.Vulnerability), s.Statement.Status)
+		fmt.Fprintf(&sb, "  d%d --> s%d\n", s.Source, i)
+		if s.Merged {
+			fmt.Fprintf(&sb, "  s%d --> merged\n", i)
+		}
+		for _, old := range s.Supersedes {
+			fmt.Fprintf(&sb, "  s%d -. superseded by .-> s%d\n", old, i)
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
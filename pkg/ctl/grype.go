@@ -0,0 +1,308 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	gosarif "github.com/owenrumney/go-sarif/sarif"
+	"gopkg.in/yaml.v3"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+	"github.com/openvex/go-vex/pkg/vex"
+
+	"github.com/openvex/vexctl/pkg/formats"
+)
+
+// GrypeIgnoreRule is a rule of the ignore list in a grype configuration
+type GrypeIgnoreRule struct {
+	Vulnerability    string             `yaml:"vulnerability,omitempty"`
+	FixState         string             `yaml:"fix-state,omitempty"`
+	Package          GrypeIgnorePackage `yaml:"package,omitempty"`
+	Reason           string             `yaml:"reason,omitempty"`
+	VexStatus        string             `yaml:"vex-status,omitempty"`
+	VexJustification string             `yaml:"vex-justification,omitempty"`
+}
+
+// GrypeIgnorePackage selects the packages an ignore rule applies to
+type GrypeIgnorePackage struct {
+	Name     string `yaml:"name,omitempty"`
+	Version  string `yaml:"version,omitempty"`
+	Type     string `yaml:"type,omitempty"`
+	Location string `yaml:"location,omitempty"`
+}
+
+// grypePurlTypes maps the package types of grype to purl types
+var grypePurlTypes = map[string]string{
+	"apk":           "apk",
+	"deb":           "deb",
+	"rpm":           "rpm",
+	"npm":           "npm",
+	"python":        "pypi",
+	"go-module":     "golang",
+	"java-archive":  "maven",
+	"gem":           "gem",
+	"rust-crate":    "cargo",
+	"dotnet":        "nuget",
+	"php-composer":  "composer",
+	"github-action": "github",
+}
+
+// ParseGrypeIgnore reads the ignore rules of a grype configuration file
+func ParseGrypeIgnore(data []byte) ([]GrypeIgnoreRule, error) {
+	config := struct {
+		Ignore []GrypeIgnoreRule `yaml:"ignore"`
+	}{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing grype configuration: %w", err)
+	}
+	return config.Ignore, nil
+}
+
+// PackageURL returns the purl of the package matched by the rule. It is
+// empty if the rule does not identify a package by type and name.
+func (r *GrypeIgnoreRule) PackageURL() string {
+	purlType, ok := grypePurlTypes[r.Package.Type]
+	if !ok || r.Package.Name == "" {
+		return ""
+	}
+	purl := fmt.Sprintf("pkg:%s/%s", purlType, r.Package.Name)
+	if r.Package.Version != "" {
+		purl += "@" + r.Package.Version
+	}
+	return purl
+}
+
+// GrypeImportOptions control how grype ignore rules are converted
+type GrypeImportOptions struct {
+	// Products are used in the statements of the rules that
+	// do not identify a package
+	Products []string
+
+	// Decide is called to get the status and justification of the rules
+	// that do not record them. If it is nil, the import fails on them.
+	Decide func(*GrypeIgnoreRule) (vex.Status, vex.Justification, error)
+}
+
+// ImportGrypeIgnore converts grype ignore rules into VEX statements. The
+// VEX status and justification recorded in a rule are used when present,
+// otherwise they are obtained from opts.Decide. The reason of the rule
+// is kept as the impact statement of not_affected statements, or as the
+// status notes of the rest.
+func (vexctl *VexCtl) ImportGrypeIgnore(rules []GrypeIgnoreRule, opts GrypeImportOptions) ([]vex.Statement, error) {
+	statements := []vex.Statement{}
+	for i := range rules {
+		r := &rules[i]
+		if r.Vulnerability == "" {
+			return nil, fmt.Errorf("ignore rule #%d has no vulnerability, only rules about a vulnerability can be imported", i+1)
+		}
+		products := opts.Products
+		if purl := r.PackageURL(); purl != "" {
+			products = []string{purl}
+		}
+		if len(products) == 0 {
+			return nil, fmt.Errorf("ignore rule #%d (%s) does not identify a package, a product is required", i+1, r.Vulnerability)
+		}
+
+		status, justification := vex.Status(r.VexStatus), vex.Justification(r.VexJustification)
+		if status == "" {
+			if opts.Decide == nil {
+				return nil, fmt.Errorf("ignore rule #%d (%s) has no VEX status", i+1, r.Vulnerability)
+			}
+			var err error
+			if status, justification, err = opts.Decide(r); err != nil {
+				return nil, fmt.Errorf("deciding the status of %s: %w", r.Vulnerability, err)
+			}
+		}
+
+		s := vex.Statement{
+			Vulnerability: r.Vulnerability,
+			Products:      products,
+			Status:        status,
+			Justification: justification,
+		}
+		if status == vex.StatusNotAffected {
+			s.ImpactStatement = r.Reason
+		} else {
+			s.StatusNotes = r.Reason
+		}
+		if err := s.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid statement for ignore rule #%d (%s): %w", i+1, r.Vulnerability, err)
+		}
+		statements = append(statements, s)
+	}
+	return statements, nil
+}
+
+// grypeReport is the part of a grype JSON report needed to apply VEX
+// data to it
+type grypeReport struct {
+	Matches []json.RawMessage `json:"matches"`
+	Source  struct {
+		Type   string          `json:"type"`
+		Target json.RawMessage `json:"target"`
+	} `json:"source"`
+	Descriptor struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"descriptor"`
+}
+
+// grypeMatch is a vulnerability found in a package
+type grypeMatch struct {
+	Vulnerability struct {
+		ID          string `json:"id"`
+		DataSource  string `json:"dataSource"`
+		Severity    string `json:"severity"`
+		Description string `json:"description"`
+		Fix         struct {
+			Versions []string `json:"versions"`
+			State    string   `json:"state"`
+		} `json:"fix"`
+	} `json:"vulnerability"`
+	RelatedVulnerabilities []struct {
+		ID string `json:"id"`
+	} `json:"relatedVulnerabilities"`
+	Artifact struct {
+		Name      string   `json:"name"`
+		Version   string   `json:"version"`
+		Type      string   `json:"type"`
+		PURL      string   `json:"purl"`
+		CPEs      []string `json:"cpes"`
+		Locations []struct {
+			Path string `json:"path"`
+		} `json:"locations"`
+	} `json:"artifact"`
+}
+
+// grypeLevels maps the severities of grype to SARIF levels
+var grypeLevels = map[string]string{
+	"critical":   "error",
+	"high":       "error",
+	"medium":     "warning",
+	"low":        "note",
+	"negligible": "note",
+	"unknown":    "note",
+}
+
+// vulnerabilityID returns the ID the result of a match is recorded under.
+// Matches on advisories other than CVEs, eg GHSA, use their related CVE
+// when there is one, as VEX statements are usually about CVEs.
+func (m *grypeMatch) vulnerabilityID() string {
+	if cveRegexp.MatchString(m.Vulnerability.ID) {
+		return m.Vulnerability.ID
+	}
+	for _, r := range m.RelatedVulnerabilities {
+		if cveRegexp.MatchString(r.ID) {
+			return r.ID
+		}
+	}
+	return m.Vulnerability.ID
+}
+
+// parseGrypeReport converts a grype JSON report to SARIF. Each match
+// becomes a result located where the package was found, with the package
+// URL and the advisory matched in its properties. When an image was
+// scanned, it is recorded in the run properties so ReportImages finds it.
+// Malformed matches are skipped in lenient mode, when warnings is set.
+func parseGrypeReport(data []byte, warnings *ParseWarnings) (*sarif.Report, error) {
+	gr := &grypeReport{}
+	if err := json.Unmarshal(data, gr); err != nil {
+		return nil, fmt.Errorf("unmarshalling grype report: %w", err)
+	}
+
+	name := gr.Descriptor.Name
+	if name == "" {
+		name = "grype"
+	}
+	run := gosarif.NewRun(name, "https://github.com/anchore/grype")
+	if gr.Descriptor.Version != "" {
+		version := gr.Descriptor.Version
+		run.Tool.Driver.Version = &version
+	}
+	run.Properties = gosarif.Properties{}
+	target := ""
+	if gr.Source.Type == "image" {
+		image := struct {
+			UserInput   string   `json:"userInput"`
+			RepoDigests []string `json:"repoDigests"`
+		}{}
+		if err := json.Unmarshal(gr.Source.Target, &image); err != nil {
+			return nil, fmt.Errorf("unmarshalling scanned image: %w", err)
+		}
+		target = image.UserInput
+		run.Properties["imageName"] = image.UserInput
+		digests := make([]interface{}, 0, len(image.RepoDigests))
+		for _, d := range image.RepoDigests {
+			digests = append(digests, d)
+		}
+		run.Properties["repoDigests"] = digests
+	} else if err := json.Unmarshal(gr.Source.Target, &target); err != nil {
+		// Directories and files are scanned by path, results of
+		// other kinds of sources are located by package only
+		target = ""
+	}
+
+	if err := formats.DecodeRecords(gr.Matches, warnings, "grype match", func(data []byte) error {
+		m := &grypeMatch{}
+		if err := json.Unmarshal(data, m); err != nil {
+			return err
+		}
+		addGrypeResult(run, m, target)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return formats.NewReport(run), nil
+}
+
+// addGrypeResult adds the result of a grype match to a run
+func addGrypeResult(run *gosarif.Run, m *grypeMatch, target string) {
+	id := m.vulnerabilityID()
+	level, ok := grypeLevels[strings.ToLower(m.Vulnerability.Severity)]
+	if !ok {
+		level = "note"
+	}
+	rule := run.AddRule(id).
+		WithShortDescription(gosarif.NewMultiformatMessageString(id))
+	if m.Vulnerability.Description != "" {
+		rule.WithFullDescription(gosarif.NewMultiformatMessageString(m.Vulnerability.Description))
+	}
+	if m.Vulnerability.DataSource != "" {
+		rule.WithHelpURI(m.Vulnerability.DataSource)
+	}
+
+	uri := target
+	if len(m.Artifact.Locations) > 0 && m.Artifact.Locations[0].Path != "" {
+		uri = m.Artifact.Locations[0].Path
+	}
+	props := gosarif.Properties{"advisory": m.Vulnerability.ID}
+	if m.Artifact.PURL != "" {
+		props["purl"] = m.Artifact.PURL
+	}
+	if len(m.Artifact.CPEs) > 0 {
+		cpes := make([]interface{}, 0, len(m.Artifact.CPEs))
+		for _, c := range m.Artifact.CPEs {
+			cpes = append(cpes, c)
+		}
+		props["cpes"] = cpes
+	}
+	run.AddResult(id).
+		WithRuleIndex(formats.RuleIndex(run, id)).
+		WithLevel(level).
+		WithMessage(gosarif.NewTextMessage(fmt.Sprintf(
+			"Package: %s\nInstalled Version: %s\nVulnerability %s\nSeverity: %s\nFixed Version: %s",
+			m.Artifact.Name, m.Artifact.Version, m.Vulnerability.ID, m.Vulnerability.Severity,
+			strings.Join(m.Vulnerability.Fix.Versions, ", "),
+		))).
+		WithLocation(gosarif.NewLocationWithPhysicalLocation(
+			gosarif.NewPhysicalLocation().WithArtifactLocation(gosarif.NewSimpleArtifactLocation(uri)),
+		)).
+		WithProperties(props)
+}
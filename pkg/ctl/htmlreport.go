@@ -0,0 +1,209 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// FilterReport summarizes the outcome of applying VEX documents to a
+// scanner report, for people reviewing it without tooling
+type FilterReport struct {
+	Generated  time.Time
+	Documents  []*vex.VEX
+	Suppressed []FilterReportEntry
+	Remaining  []FilterReportEntry
+}
+
+// FilterReportEntry is a vulnerability found in the report along with
+// the statement deciding whether its results are suppressed. When only
+// the results of some products are suppressed, the vulnerability has an
+// entry in both lists, each counting its own results.
+type FilterReportEntry struct {
+	Vulnerability string
+	URL           string // Link to the advisory of the vulnerability, if known
+	Results       int
+	Document      string         // Document of the deciding statement
+	Statement     *vex.Statement // Deciding statement, nil if there is none
+}
+
+// FilterReport computes which results of a report are suppressed by the
+// VEX documents and which remain, deciding each result as Apply does.
+// Like Coverage, it has to be called before applying the documents to
+// the report.
+func (vexctl *VexCtl) FilterReport(report *sarif.Report, vexDocs []*vex.VEX) *FilterReport {
+	fr := &FilterReport{
+		Generated:  time.Now().UTC(),
+		Documents:  vexctl.impl.Sort(append([]*vex.VEX{}, vexDocs...)),
+		Suppressed: []FilterReportEntry{},
+		Remaining:  []FilterReportEntry{},
+	}
+	docs := vexctl.impl.Sort(vexctl.honoredDocuments(vexDocs))
+
+	suppressed := map[string]*FilterReportEntry{}
+	remaining := map[string]*FilterReportEntry{}
+	for _, run := range report.Runs {
+		for _, res := range run.Results {
+			if res.RuleID == nil {
+				continue
+			}
+			m := cveRegexp.FindStringSubmatch(*res.RuleID)
+			if len(m) != 2 {
+				continue
+			}
+			products := resultProducts(res.Properties, vexctl.Options.Products)
+
+			// The deciding statement is the last suppressing one, or the
+			// last one found when the result is kept
+			var document string
+			var statement *vex.Statement
+			suppresses := false
+			for _, doc := range docs {
+				if vexSuppresses(doc, *res.RuleID, products) {
+					suppresses = true
+					document, statement = doc.ID, statementForProducts(doc, m[1], products)
+				} else if s := statementForProducts(doc, m[1], products); s != nil && !suppresses {
+					document, statement = doc.ID, s
+				}
+			}
+
+			entries := remaining
+			if suppresses {
+				entries = suppressed
+			}
+			entry, ok := entries[m[1]]
+			if !ok {
+				entry = &FilterReportEntry{Vulnerability: m[1], URL: advisoryURL(m[1])}
+				entries[m[1]] = entry
+			}
+			entry.Results++
+			if statement != nil {
+				entry.Document, entry.Statement = document, statement
+			}
+		}
+	}
+
+	fr.Suppressed = sortedEntries(suppressed)
+	fr.Remaining = sortedEntries(remaining)
+	return fr
+}
+
+// sortedEntries returns the entries of the filter report sorted by
+// vulnerability
+func sortedEntries(entries map[string]*FilterReportEntry) []FilterReportEntry {
+	sorted := make([]FilterReportEntry, 0, len(entries))
+	for _, e := range entries {
+		sorted = append(sorted, *e)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Vulnerability < sorted[j].Vulnerability
+	})
+	return sorted
+}
+
+// advisoryURL returns the link to the public advisory of a vulnerability
+func advisoryURL(id string) string {
+	switch {
+	case strings.HasPrefix(id, "CVE-"):
+		return "https://nvd.nist.gov/vuln/detail/" + id
+	case strings.HasPrefix(id, "GHSA-"):
+		return "https://github.com/advisories/" + id
+	default:
+		return ""
+	}
+}
+
+// filterReportTemplate renders the report as a standalone HTML page
+var filterReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"status": func(s *vex.Statement) string { return statusLabel(s.Status) },
+	"justification": func(s *vex.Statement) string {
+		if prose, ok := justificationProse[s.Justification]; ok {
+			return prose
+		}
+		return ""
+	},
+	"time": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>VEX filter report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.4em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+.suppressed { color: #2a7a2a; }
+.remaining { color: #b22; }
+.muted { color: #777; }
+</style>
+</head>
+<body>
+<h1>VEX filter report</h1>
+<p class="muted">Generated {{ .Generated.Format "2006-01-02 15:04:05 MST" }}</p>
+<p><span class="suppressed">{{ len .Suppressed }} vulnerabilities suppressed</span>,
+<span class="remaining">{{ len .Remaining }} remaining</span>,
+using {{ len .Documents }} VEX documents.</p>
+{{ define "vuln" }}{{ if .URL }}<a href="{{ .URL }}">{{ .Vulnerability }}</a>{{ else }}{{ .Vulnerability }}{{ end }}{{ end }}
+<h2 class="remaining">Remaining vulnerabilities</h2>
+{{ if .Remaining }}<table>
+<tr><th>Vulnerability</th><th>Results</th><th>Latest statement</th><th>Document</th></tr>
+{{ range .Remaining }}<tr>
+<td>{{ template "vuln" . }}</td>
+<td>{{ .Results }}</td>
+<td>{{ with .Statement }}{{ status . }}{{ if .ActionStatement }}: {{ .ActionStatement }}{{ end }}{{ else }}<span class="muted">No statement</span>{{ end }}</td>
+<td>{{ .Document }}</td>
+</tr>
+{{ end }}</table>
+{{ else }}<p>None.</p>
+{{ end }}
+<h2 class="suppressed">Suppressed vulnerabilities</h2>
+{{ if .Suppressed }}<table>
+<tr><th>Vulnerability</th><th>Results</th><th>Status</th><th>Justification</th><th>Document</th></tr>
+{{ range .Suppressed }}<tr>
+<td>{{ template "vuln" . }}</td>
+<td>{{ .Results }}</td>
+<td>{{ status .Statement }}</td>
+<td>{{ justification .Statement }}{{ with .Statement.ImpactStatement }} {{ . }}{{ end }}</td>
+<td>{{ .Document }}</td>
+</tr>
+{{ end }}</table>
+{{ else }}<p>None.</p>
+{{ end }}
+<h2>VEX documents</h2>
+<table>
+<tr><th>Document</th><th>Author</th><th>Issued</th><th>Statements</th></tr>
+{{ range .Documents }}<tr>
+<td>{{ if .ID }}{{ .ID }}{{ else }}<span class="muted">(no id)</span>{{ end }}</td>
+<td>{{ .Author }}</td>
+<td>{{ time .Timestamp }}</td>
+<td>{{ len .Statements }}</td>
+</tr>
+{{ end }}</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes the report as a standalone HTML page
+func (fr *FilterReport) WriteHTML(w io.Writer) error {
+	if err := filterReportTemplate.Execute(w, fr); err != nil {
+		return fmt.Errorf("rendering HTML report: %w", err)
+	}
+	return nil
+}
@@ -8,7 +8,6 @@ package ctl
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -19,35 +18,47 @@ import (
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	gcrmutate "github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	gcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	gosarif "github.com/owenrumney/go-sarif/sarif"
 	ssldsse "github.com/secure-systems-lab/go-securesystemslib/dsse"
-	"github.com/sigstore/cosign/cmd/cosign/cli/options"
-	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/oci"
+	"github.com/sigstore/cosign/pkg/oci/empty"
 	"github.com/sigstore/cosign/pkg/oci/mutate"
 	ociremote "github.com/sigstore/cosign/pkg/oci/remote"
 	"github.com/sigstore/cosign/pkg/oci/static"
 	"github.com/sigstore/cosign/pkg/types"
 	"github.com/sirupsen/logrus"
-	"sigs.k8s.io/release-utils/util"
 
 	"github.com/openvex/go-vex/pkg/sarif"
 	"github.com/openvex/go-vex/pkg/vex"
 	"github.com/openvex/vexctl/pkg/attestation"
 )
 
+// IntotoPayloadType is the DSSE payload type of in-toto attestations
 const IntotoPayloadType = "application/vnd.in-toto+json"
 
+// Implementation is the set of low level operations backing VexCtl. The
+// default implementation can be replaced using WithImplementation.
 type Implementation interface {
-	ApplySingleVEX(*sarif.Report, *vex.VEX) (*sarif.Report, error)
+	ApplySingleVEX(context.Context, Options, *sarif.Report, *vex.VEX) (*sarif.Report, error)
 	SortDocuments([]*vex.VEX) []*vex.VEX
-	OpenVexData(Options, []string) ([]*vex.VEX, error)
+	OpenVexData(context.Context, Options, []string) ([]*vex.VEX, error)
 	Sort(docs []*vex.VEX) []*vex.VEX
 	AttestationBytes(*attestation.Attestation) ([]byte, error)
-	Attach(context.Context, *attestation.Attestation, string) error
-	SourceType(uri string) (string, error)
+	Attach(context.Context, Options, *attestation.Attestation, string) error
 	ReadImageAttestations(context.Context, Options, string) ([]*vex.VEX, error)
 	Merge(context.Context, *MergeOptions, []*vex.VEX) (*vex.VEX, error)
 	LoadFiles(context.Context, []string) ([]*vex.VEX, error)
+	ResolveImageDigest(context.Context, Options, string) (string, error)
+	ResolvePlatformDigests(context.Context, Options, string) ([]string, error)
+	ReadImageStatements(context.Context, Options, string) ([]*ImageStatement, error)
+	EmbedVEX(context.Context, Options, *vex.VEX, string, EmbedOptions) (string, error)
+	Detach(context.Context, Options, string, DetachOptions) ([]string, error)
+	ListVEXAttestations(context.Context, Options, string) (string, []string, error)
 }
 
 type defaultVexCtlImplementation struct{}
@@ -62,36 +73,37 @@ func (impl *defaultVexCtlImplementation) SortDocuments(docs []*vex.VEX) []*vex.V
 	return vex.SortDocuments(docs)
 }
 
-func (impl *defaultVexCtlImplementation) ApplySingleVEX(report *sarif.Report, vexDoc *vex.VEX) (*sarif.Report, error) {
+func (impl *defaultVexCtlImplementation) ApplySingleVEX(
+	ctx context.Context, opts Options, report *sarif.Report, vexDoc *vex.VEX,
+) (*sarif.Report, error) {
 	newReport := *report
-	logrus.Infof("VEX document contains %d statements", len(vexDoc.Statements))
-	logrus.Infof("+%v Runs: %d\n", report, len(report.Runs))
+	logrus.WithFields(logrus.Fields{
+		"document":   vexDoc.ID,
+		"statements": len(vexDoc.Statements),
+		"runs":       len(report.Runs),
+	}).Info("Applying VEX document to report")
 	// Search for negative VEX statements, that is those that cancel a CVE
 	for i := range report.Runs {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("applying VEX document: %w", err)
+		}
 		newResults := []*gosarif.Result{}
-		logrus.Infof("Inspecting run #%d containing %d results", i, len(report.Runs[i].Results))
+		logrus.WithFields(logrus.Fields{
+			"run":     i,
+			"results": len(report.Runs[i].Results),
+		}).Debug("Inspecting run")
 		for _, res := range report.Runs[i].Results {
 			// Normalize the CVE IDs
-			m := cveRegexp.FindStringSubmatch(*res.RuleID)
-			if len(m) != 2 {
-				logrus.Errorf(
-					"Invalid rulename in sarif report, expected CVE identifier, got %s",
-					*res.RuleID,
+			if !cveRegexp.MatchString(*res.RuleID) {
+				logrus.WithField("rule", *res.RuleID).Warn(
+					"Invalid rulename in sarif report, expected CVE identifier",
 				)
 				newResults = append(newResults, res)
 				continue
 			}
-			id := m[1]
-			// TODO: Trim rule ID to CVE as Grype adds junk to the CVE ID
-			statement := vexDoc.StatementFromID(id)
-			logrus.Infof("Checking %s", id)
-			if statement != nil {
-				logrus.Infof("Statement is for %s and status is %s", statement.Vulnerability, statement.Status)
-				if statement.Status == vex.StatusNotAffected ||
-					statement.Status == vex.StatusFixed {
-					logrus.Infof("Found VEX Statement for %s: %s", id, statement.Status)
-					continue
-				}
+			if vexSuppresses(vexDoc, *res.RuleID, resultProducts(res.Properties, opts.Products)) {
+				logrus.WithField("rule", *res.RuleID).Debug("Result suppressed by VEX statement")
+				continue
 			}
 			newResults = append(newResults, res)
 		}
@@ -100,20 +112,63 @@ func (impl *defaultVexCtlImplementation) ApplySingleVEX(report *sarif.Report, ve
 	return &newReport, nil
 }
 
+// statementFromID returns the first statement in the document about
+// a vulnerability or nil if there is none
+func statementFromID(vexDoc *vex.VEX, id string) *vex.Statement {
+	for i := range vexDoc.Statements {
+		if vexDoc.Statements[i].Vulnerability == id {
+			return &vexDoc.Statements[i]
+		}
+	}
+	return nil
+}
+
+// statementForProducts returns the first statement in the document about
+// a vulnerability that applies to the products of a result, or nil if
+// there is none
+func statementForProducts(vexDoc *vex.VEX, id string, products []string) *vex.Statement {
+	for i := range vexDoc.Statements {
+		if vexDoc.Statements[i].Vulnerability == id && statementAppliesTo(&vexDoc.Statements[i], products) {
+			return &vexDoc.Statements[i]
+		}
+	}
+	return nil
+}
+
 // OpenVexData returns a set of vex documents from the paths received
-func (impl *defaultVexCtlImplementation) OpenVexData(opts Options, paths []string) ([]*vex.VEX, error) {
+func (impl *defaultVexCtlImplementation) OpenVexData(ctx context.Context, opts Options, paths []string) ([]*vex.VEX, error) {
+	defer opts.Metrics.Track(MetricsPhaseParse)()
 	vexes := []*vex.VEX{}
 	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("opening documents: %w", err)
+		}
+		path, cleanup, err := decompressedPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("opening document: %w", err)
+		}
 		var v *vex.VEX
-		var err error
-		switch opts.Format {
-		case "vex", "json", "":
-			v, err = vex.OpenJSON(path)
-		case "yaml":
-			v, err = vex.OpenYAML(path)
-		case "csaf":
-			v, err = vex.OpenCSAF(path, opts.Products)
+		format := opts.Format
+		if format == "" {
+			format, err = detectFileFormat(path)
 		}
+		if err == nil {
+			switch format {
+			case DocumentFormatOpenVEX, "json", DocumentFormatYAML:
+				if opts.ParseWarnings != nil {
+					v, err = openVEXLenient(path, format, opts.ParseWarnings)
+				} else if format == DocumentFormatYAML {
+					v, err = vex.OpenYAML(path)
+				} else {
+					v, err = vex.OpenJSON(path)
+				}
+			case DocumentFormatCSAF:
+				v, err = openCSAF(path, opts.Products, opts.ParseWarnings)
+			default:
+				err = fmt.Errorf("reading %s documents is not supported", format)
+			}
+		}
+		cleanup()
 		if err != nil {
 			return nil, fmt.Errorf("opening document: %w", err)
 		}
@@ -134,14 +189,16 @@ func (impl *defaultVexCtlImplementation) AttestationBytes(att *attestation.Attes
 	return b.Bytes(), nil
 }
 
-func (impl *defaultVexCtlImplementation) Attach(ctx context.Context, att *attestation.Attestation, imageRef string) error {
+func (impl *defaultVexCtlImplementation) Attach(
+	ctx context.Context, vexOpts Options, att *attestation.Attestation, imageRef string,
+) error {
 	env := ssldsse.Envelope{}
-	regOpts := options.RegistryOptions{}
-	remoteOpts, err := regOpts.ClientOpts(ctx)
+	remoteOpts, err := remoteOptions(ctx, vexOpts)
 	if err != nil {
-		return fmt.Errorf("getting OCI remote options: %w", err)
+		return err
 	}
 
+	annotations := att.Annotations
 	var b bytes.Buffer
 	if err := att.ToJSON(&b); err != nil {
 		return fmt.Errorf("getting attestation JSON")
@@ -161,11 +218,11 @@ func (impl *defaultVexCtlImplementation) Attach(ctx context.Context, att *attest
 			return fmt.Errorf("invalid payloadType %s on envelope. Expected %s", env.PayloadType, types.IntotoPayloadType)
 		}
 
-		ref, err := name.ParseReference(imageRef)
+		ref, err := parseReference(vexOpts, imageRef)
 		if err != nil {
 			return err
 		}
-		digest, err := ociremote.ResolveDigest(ref, remoteOpts...)
+		digest, err := resolveDigest(ctx, vexOpts, ref)
 		if err != nil {
 			return err
 		}
@@ -174,217 +231,669 @@ func (impl *defaultVexCtlImplementation) Attach(ctx context.Context, att *attest
 		// each access.
 		ref = digest //nolint:ineffassign
 
-		opts := []static.Option{static.WithLayerMediaType(types.DssePayloadType)}
-		att, err := static.NewAttestation(payload, opts...)
-		if err != nil {
+		var se oci.SignedEntity
+		if err := withRetry(ctx, vexOpts, "reading image", func() (err error) {
+			se, err = ociremote.SignedEntity(digest, remoteOpts...)
+			return err
+		}); err != nil {
 			return err
 		}
 
-		se, err := ociremote.SignedEntity(digest, remoteOpts...)
+		attAnnotations := annotations
+		signOpts := []mutate.SignOption{}
+		if vexOpts.ReplaceAttestations {
+			superseded, err := vexAttestationDigests(se)
+			if err != nil {
+				return err
+			}
+			attAnnotations = supersedeAnnotations(annotations, superseded)
+			signOpts = append(signOpts, mutate.WithReplaceOp(&supersedeOp{DetachOptions{Digests: superseded}}))
+			logrus.WithFields(logrus.Fields{
+				"image":      digest.String(),
+				"superseded": len(superseded),
+			}).Info("Replacing VEX attestations")
+		}
+
+		opts := []static.Option{static.WithLayerMediaType(types.DssePayloadType)}
+		if len(attAnnotations) > 0 {
+			opts = append(opts, static.WithAnnotations(attAnnotations))
+		}
+		att, err := static.NewAttestation(payload, opts...)
 		if err != nil {
 			return err
 		}
 
-		newSE, err := mutate.AttachAttestationToEntity(se, att)
+		newSE, err := mutate.AttachAttestationToEntity(se, att, signOpts...)
 		if err != nil {
 			return err
 		}
 
 		// Publish the signatures associated with this entity
-		err = ociremote.WriteAttestations(digest.Repository, newSE, remoteOpts...)
-		if err != nil {
+		if err := withRetry(ctx, vexOpts, "writing attestations", func() error {
+			return ociremote.WriteAttestations(digest.Repository, newSE, remoteOpts...)
+		}); err != nil {
 			return err
 		}
+		newRegistryCache(vexOpts).invalidate(attestationsCacheKey(digest))
 	}
 
 	return nil
 }
 
-// SourceType returns a string indicating what kind of vex
-// source a URI points to
-func (impl *defaultVexCtlImplementation) SourceType(uri string) (string, error) {
-	if util.Exists(uri) {
-		return "file", nil
-	}
-
-	_, err := name.ParseReference(uri)
-	if err == nil {
-		return "image", nil
-	}
-
-	return "", errors.New("unable to resolve the vex source location")
-}
-
-// DownloadAttestation
+// ReadImageAttestations returns the VEX documents attested to an image.
+// Attestations with other predicate types, like SBOMs or provenance, are
+// skipped.
 func (impl *defaultVexCtlImplementation) ReadImageAttestations(
 	ctx context.Context, opts Options, refString string,
 ) (vexes []*vex.VEX, err error) {
-	// Parsae the image reference
-	ref, err := name.ParseReference(refString)
-	if err != nil {
-		return nil, fmt.Errorf("parsing image reference: %w", err)
-	}
-	regOpts := options.RegistryOptions{}
-	remoteOpts, err := regOpts.ClientOpts(ctx)
+	statements, err := impl.ReadImageStatements(ctx, opts, refString)
 	if err != nil {
-		return nil, fmt.Errorf("getting OCI remote options: %w", err)
-	}
-	payloads, err := cosign.FetchAttestationsForReference(ctx, ref, remoteOpts...)
-	if err != nil {
-		return nil, fmt.Errorf("fetching attached attestation: %w", err)
+		return nil, err
 	}
 	vexes = []*vex.VEX{}
-	for _, dssePayload := range payloads {
-		vexData, err := impl.ReadSignedVEX(dssePayload)
-		if err != nil {
-			return nil, fmt.Errorf("opening dsse payload: %w", err)
+	for _, s := range statements {
+		if s.PredicateType != vex.TypeURI {
+			logrus.WithField("predicateType", s.PredicateType).Debug("Skipping non-VEX attestation")
+			continue
+		}
+		predicate := &attestation.Predicate{}
+		if err := json.Unmarshal(s.Predicate, predicate); err != nil {
+			return nil, fmt.Errorf("unmarshalling VEX predicate: %w", err)
 		}
-		vexes = append(vexes, vexData)
+		if !checkValidity(opts, predicate, time.Now()) {
+			continue
+		}
+		vexes = append(vexes, &predicate.VEX)
 	}
+	logrus.WithFields(logrus.Fields{
+		"image":      refString,
+		"statements": len(statements),
+		"documents":  len(vexes),
+	}).Debug("Read VEX attestations from image")
 	return vexes, nil
 }
 
-// ReadSignedVEX returns the vex data inside a signed envelope
-func (impl *defaultVexCtlImplementation) ReadSignedVEX(dssePayload cosign.AttestationPayload) (*vex.VEX, error) {
-	if dssePayload.PayloadType != IntotoPayloadType {
-		logrus.Info("Signed envelope does not contain an in-toto attestation")
-		return nil, nil
-	}
-
-	data, err := base64.StdEncoding.DecodeString(dssePayload.PayLoad)
-	if err != nil {
-		return nil, fmt.Errorf("decoding signed attestation: %w", err)
-	}
-	fmt.Printf("%s\n", string(data))
-
-	// Unmarshall the attestation
-	att := &attestation.Attestation{}
-	if err := json.Unmarshal(data, att); err != nil {
-		return nil, fmt.Errorf("unmarshalling attestation JSON: %w", err)
-	}
-
-	if att.PredicateType != vex.TypeURI {
-		return nil, nil
-	}
-
-	return &att.Predicate, nil
-}
-
+// MergeOptions control how documents are combined by Merge
 type MergeOptions struct {
 	DocumentID      string   // ID to use in the new document
 	Author          string   // Author to use in the new document
 	AuthorRole      string   // Role of the document author
 	Products        []string // Product IDs to consider
 	Vulnerabilities []string // IDs of vulnerabilities to merge
+
+	// Since and Until limit the merged statements to those issued in a
+	// time range. Zero values leave the range open on that side.
+	Since time.Time
+	Until time.Time
+
+	// SourceAuthors and SourceRoles limit the merge to the statements
+	// of documents issued by these authors or author roles
+	SourceAuthors []string
+	SourceRoles   []string
+
+	// StrictTransitions makes Merge fail when a status change is not
+	// allowed by the VEX status graph instead of only warning about it
+	StrictTransitions bool
+
+	// Consolidate combines the statements that only differ in their
+	// products into a single statement listing all of them. Statements
+	// are combined when their timestamps are at most ConsolidateWindow
+	// apart from the first one, which sets the timestamp of the result.
+	Consolidate       bool
+	ConsolidateWindow time.Duration
 }
 
 // Merge combines the statements from a number of documents into
 // a new one, preserving time context from each of them.
 func (impl *defaultVexCtlImplementation) Merge(
-	_ context.Context, mergeOpts *MergeOptions, docs []*vex.VEX,
+	ctx context.Context, mergeOpts *MergeOptions, docs []*vex.VEX,
 ) (*vex.VEX, error) {
-	if len(docs) == 0 {
-		return nil, fmt.Errorf("at least one vex document is required to merge")
-	}
-
-	docID := mergeOpts.DocumentID
-	// If no document id is specified we compute a
-	// deterministic ID using the merged docs
-	if docID == "" {
-		ids := []string{}
-		for i, d := range docs {
-			if d.ID == "" {
-				ids = append(ids, fmt.Sprintf("VEX-DOC-%d", i))
-			} else {
-				ids = append(ids, d.ID)
-			}
-		}
-
-		sort.Strings(ids)
-		h := sha256.New()
-		h.Write([]byte(strings.Join(ids, ":")))
-		// Hash the sorted IDs list
-		docID = fmt.Sprintf("merged-vex-%x", h.Sum(nil))
+	m := newMergeSet(mergeOpts)
+
+	// Extract the statements of each document in parallel. Results are
+	// collected per document so that the final sort is deterministic.
+	docStatements := make([][]vex.Statement, len(docs))
+	if err := parallelDo(ctx, len(docs), func(i int) (err error) {
+		docStatements[i], err = m.filter.statements(docs[i])
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("merging documents: %w", err)
 	}
-	now := time.Now()
-	newDoc := &vex.VEX{
-		Metadata: vex.Metadata{
-			ID:         docID, // TODO
-			Author:     mergeOpts.Author,
-			AuthorRole: mergeOpts.AuthorRole,
-			Timestamp:  &now,
-		},
+	for i, doc := range docs {
+		m.ids = append(m.ids, doc.ID)
+		m.ss = append(m.ss, docStatements[i]...)
+		m.history = append(m.history, transitionHistory(doc))
 	}
+	return m.document()
+}
 
-	t, err := vex.DateFromEnv()
-	if err != nil {
-		return nil, fmt.Errorf("reading date from env: %w", err)
+// consolidateStatements combines sorted statements sharing everything but
+// their products, if their timestamps are no more than window apart from
+// the first statement of the group. Statements about different
+// subcomponents are kept apart, combining them would claim a status for
+// subcomponents of products no statement was about.
+func consolidateStatements(ss []vex.Statement, window time.Duration) []vex.Statement {
+	consolidated := []vex.Statement{}
+	groups := map[string][]int{}
+	for _, s := range ss { //nolint:gocritic // statements are copied on purpose
+		subcomponents := append([]string{}, s.Subcomponents...)
+		sort.Strings(subcomponents)
+		key := strings.Join([]string{
+			s.Vulnerability, s.VulnDescription, string(s.Status), s.StatusNotes,
+			string(s.Justification), s.ImpactStatement, s.ActionStatement,
+			strings.Join(subcomponents, "\x01"),
+		}, "\x00")
+
+		target := -1
+		for _, i := range groups[key] {
+			if s.Timestamp.Sub(*consolidated[i].Timestamp) <= window {
+				target = i
+				break
+			}
+		}
+		if target == -1 {
+			s.Products = append([]string{}, s.Products...)
+			s.Subcomponents = append([]string{}, s.Subcomponents...)
+			groups[key] = append(groups[key], len(consolidated))
+			consolidated = append(consolidated, s)
+			continue
+		}
+		c := &consolidated[target]
+		c.Products = appendMissing(c.Products, s.Products...)
+	}
+	for i := range consolidated {
+		if len(consolidated[i].Subcomponents) == 0 {
+			consolidated[i].Subcomponents = nil
+		}
 	}
+	return consolidated
+}
 
-	if t != nil {
-		newDoc.Metadata.Timestamp = t
+// appendMissing appends the values not already in a list
+func appendMissing(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, e := range list {
+			if e == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
 	}
+	return list
+}
 
-	ss := []vex.Statement{}
+// statementFilter selects the statements included in a merged document
+type statementFilter struct {
+	products map[string]struct{}
+	vulns    map[string]struct{}
+	authors  map[string]struct{}
+	roles    map[string]struct{}
+	since    time.Time
+	until    time.Time
+}
 
-	iProds := map[string]struct{}{}
-	iVulns := map[string]struct{}{}
+// newStatementFilter returns a filter configured from the merge options
+func newStatementFilter(mergeOpts *MergeOptions) *statementFilter {
+	f := &statementFilter{
+		products: map[string]struct{}{},
+		vulns:    map[string]struct{}{},
+		authors:  map[string]struct{}{},
+		roles:    map[string]struct{}{},
+		since:    mergeOpts.Since,
+		until:    mergeOpts.Until,
+	}
 	for _, id := range mergeOpts.Products {
-		iProds[id] = struct{}{}
+		f.products[id] = struct{}{}
 	}
 	for _, id := range mergeOpts.Vulnerabilities {
-		iVulns[id] = struct{}{}
+		f.vulns[id] = struct{}{}
 	}
+	for _, a := range mergeOpts.SourceAuthors {
+		f.authors[a] = struct{}{}
+	}
+	for _, r := range mergeOpts.SourceRoles {
+		f.roles[r] = struct{}{}
+	}
+	return f
+}
 
-	for _, doc := range docs {
-	LOOP_STATEMENTS:
-		for _, s := range doc.Statements { //nolint:gocritic // this IS supposed to copy
-			if len(iProds) > 0 {
-				for _, pid := range s.Products {
-					if _, ok := iProds[pid]; !ok {
-						continue LOOP_STATEMENTS
-					}
-				}
-			}
+// hasProduct returns true if a statement product applies
+// to any of the products of the filter
+func (f *statementFilter) hasProduct(statementProduct string) bool {
+	if _, ok := f.products[statementProduct]; ok {
+		return true
+	}
+	for p := range f.products {
+		if productMatches(statementProduct, p) {
+			return true
+		}
+	}
+	return false
+}
 
-			if len(iVulns) > 0 {
-				if _, ok := iProds[s.Vulnerability]; !ok {
+// statements returns the statements of a document matching the
+// filter, with their timestamps cascaded from the document
+func (f *statementFilter) statements(doc *vex.VEX) ([]vex.Statement, error) {
+	ss := []vex.Statement{}
+	if _, ok := f.authors[doc.Author]; len(f.authors) > 0 && !ok {
+		return ss, nil
+	}
+	if _, ok := f.roles[doc.AuthorRole]; len(f.roles) > 0 && !ok {
+		return ss, nil
+	}
+LOOP_STATEMENTS:
+	for _, s := range doc.Statements { //nolint:gocritic // this IS supposed to copy
+		if len(f.products) > 0 {
+			for _, pid := range s.Products {
+				if !f.hasProduct(pid) {
 					continue LOOP_STATEMENTS
 				}
 			}
+		}
 
-			// If statement does not have a timestamp, cascade
-			// the timestamp down from the document.
-			// See https://github.com/chainguard-dev/vex/issues/49
-			if s.Timestamp == nil {
-				if doc.Timestamp == nil {
-					return nil, errors.New("unable to cascade timestamp from doc to timeless statement")
-				}
-				s.Timestamp = doc.Timestamp
+		if len(f.vulns) > 0 {
+			if _, ok := f.vulns[s.Vulnerability]; !ok {
+				continue LOOP_STATEMENTS
 			}
-
-			ss = append(ss, s)
 		}
-	}
 
-	vex.SortStatements(ss, *newDoc.Metadata.Timestamp)
+		// If statement does not have a timestamp, cascade
+		// the timestamp down from the document.
+		// See https://github.com/chainguard-dev/vex/issues/49
+		if s.Timestamp == nil {
+			if doc.Timestamp == nil {
+				return nil, errors.New("unable to cascade timestamp from doc to timeless statement")
+			}
+			s.Timestamp = doc.Timestamp
+		}
 
-	newDoc.Statements = ss
+		if !f.since.IsZero() && s.Timestamp.Before(f.since) {
+			continue
+		}
+		if !f.until.IsZero() && s.Timestamp.After(f.until) {
+			continue
+		}
 
-	return newDoc, nil
+		ss = append(ss, s)
+	}
+	return ss, nil
 }
 
-// LoadFiles loads multiple vex files from disk
+// LoadFiles loads multiple vex files from disk. Glob patterns are expanded
+// and directories replaced by the documents in them, in a stable order.
 func (impl *defaultVexCtlImplementation) LoadFiles(
-	_ context.Context, filePaths []string,
+	ctx context.Context, filePaths []string,
 ) ([]*vex.VEX, error) {
+	filePaths, err := expandFiles(filePaths)
+	if err != nil {
+		return nil, err
+	}
 	vexes := make([]*vex.VEX, len(filePaths))
-	for i, path := range filePaths {
-		doc, err := vex.Load(path)
+	if err := parallelDo(ctx, len(filePaths), func(i int) (err error) {
+		path, cleanup, err := decompressedPath(filePaths[i])
+		if err != nil {
+			return fmt.Errorf("error loading file: %w", err)
+		}
+		defer cleanup()
+		vexes[i], err = vex.Load(path)
 		if err != nil {
-			return nil, fmt.Errorf("error loading file: %w", err)
+			return fmt.Errorf("error loading file: %w", err)
 		}
-		vexes[i] = doc
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 	return vexes, nil
 }
+
+// ImageStatement is an in-toto statement read from an image attestation. The
+// predicate is kept raw as its type depends on the statement's PredicateType.
+type ImageStatement struct {
+	intoto.StatementHeader
+	Predicate json.RawMessage `json:"predicate"`
+
+	// Signer is the verified identity that signed the attestation,
+	// empty if its signature was not verified
+	Signer string `json:"-"`
+}
+
+// ResolveImageDigest returns the digest an image reference points to
+func (impl *defaultVexCtlImplementation) ResolveImageDigest(
+	ctx context.Context, opts Options, refString string,
+) (string, error) {
+	ref, err := parseReference(opts, refString)
+	if err != nil {
+		return "", err
+	}
+	digest, err := resolveDigest(ctx, opts, ref)
+	if err != nil {
+		return "", err
+	}
+	return digest.DigestStr(), nil
+}
+
+// ResolvePlatformDigests returns the digests of the per-platform images
+// listed in an image index. If the reference points to a single image,
+// the list is empty.
+func (impl *defaultVexCtlImplementation) ResolvePlatformDigests(
+	ctx context.Context, opts Options, refString string,
+) ([]string, error) {
+	ref, err := parseReference(opts, refString)
+	if err != nil {
+		return nil, err
+	}
+	clientOpts, err := registryClientOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	var desc *remote.Descriptor
+	if err := withRetry(ctx, opts, "reading image", func() (err error) {
+		desc, err = remote.Get(ref, clientOpts...)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("reading image: %w", err)
+	}
+	digests := []string{}
+	if !desc.MediaType.IsIndex() {
+		return digests, nil
+	}
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("reading image index: %w", err)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("reading index manifest: %w", err)
+	}
+	for _, m := range manifest.Manifests {
+		// Skip the attestation manifests added to indexes by buildkit
+		if m.Platform != nil && m.Platform.OS == "unknown" {
+			continue
+		}
+		digests = append(digests, m.Digest.String())
+	}
+	return digests, nil
+}
+
+// checkValidity warns about VEX attestations outside of their validity
+// window and returns false when they are to be skipped
+func checkValidity(opts Options, predicate *attestation.Predicate, now time.Time) bool {
+	err := predicate.Validity.Check(now)
+	if err == nil {
+		return true
+	}
+	l := logrus.WithField("document", predicate.ID)
+	if opts.RejectExpired {
+		l.Warnf("Skipping VEX attestation: %v", err)
+		return false
+	}
+	l.Warnf("VEX attestation %v", err)
+	return true
+}
+
+// ReadImageStatements returns all the in-toto statements attested
+// to an image, regardless of their predicate type
+func (impl *defaultVexCtlImplementation) ReadImageStatements(
+	ctx context.Context, opts Options, refString string,
+) ([]*ImageStatement, error) {
+	payloads, err := fetchAttestationPayloads(ctx, opts, refString)
+	if err != nil {
+		return nil, err
+	}
+	statements := []*ImageStatement{}
+	for _, dssePayload := range payloads {
+		if dssePayload.PayloadType != IntotoPayloadType {
+			logrus.WithField("payloadType", dssePayload.PayloadType).Debug(
+				"Signed envelope does not contain an in-toto attestation",
+			)
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(dssePayload.PayLoad)
+		if err != nil {
+			return nil, fmt.Errorf("decoding signed attestation: %w", err)
+		}
+		s := &ImageStatement{Signer: dssePayload.Signer}
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, fmt.Errorf("unmarshalling attestation JSON: %w", err)
+		}
+		statements = append(statements, s)
+	}
+	return statements, nil
+}
+
+// EmbedVEX writes a VEX document into an image and pushes it to the
+// registry, returning the digest of the new image
+func (impl *defaultVexCtlImplementation) EmbedVEX(
+	ctx context.Context, opts Options, doc *vex.VEX, imageRef string, embedOpts EmbedOptions,
+) (string, error) {
+	ref, err := parseReference(opts, imageRef)
+	if err != nil {
+		return "", err
+	}
+
+	dst := ref
+	if embedOpts.Destination != "" {
+		dst, err = parseReference(opts, embedOpts.Destination)
+		if err != nil {
+			return "", fmt.Errorf("parsing destination reference: %w", err)
+		}
+	}
+	if _, ok := dst.(name.Digest); ok {
+		return "", errors.New("cannot push the new image to a digest, specify a destination tag")
+	}
+
+	var b bytes.Buffer
+	if err := doc.ToJSON(&b); err != nil {
+		return "", fmt.Errorf("serializing VEX document: %w", err)
+	}
+	data := bytes.TrimSpace(b.Bytes())
+
+	clientOpts, err := registryClientOptions(ctx, opts)
+	if err != nil {
+		return "", err
+	}
+	var desc *remote.Descriptor
+	if err := withRetry(ctx, opts, "reading image", func() (err error) {
+		desc, err = remote.Get(ref, clientOpts...)
+		return err
+	}); err != nil {
+		return "", fmt.Errorf("fetching image: %w", err)
+	}
+	if desc.MediaType.IsIndex() {
+		return "", errors.New("embedding VEX data in image indexes is not supported, use the reference of a single platform image")
+	}
+	img, err := desc.Image()
+	if err != nil {
+		return "", fmt.Errorf("reading image: %w", err)
+	}
+
+	if embedOpts.Layer {
+		modTime := time.Time{}
+		if doc.Timestamp != nil {
+			modTime = *doc.Timestamp
+		}
+		layerType := gcrtypes.DockerLayer
+		if desc.MediaType == gcrtypes.OCIManifestSchema1 {
+			layerType = gcrtypes.OCILayer
+		}
+		layer, err := embedLayer(data, embedOpts.Path, modTime, layerType)
+		if err != nil {
+			return "", fmt.Errorf("building VEX layer: %w", err)
+		}
+		img, err = gcrmutate.Append(img, gcrmutate.Addendum{
+			Layer: layer,
+			History: v1.History{
+				CreatedBy: "vexctl embed",
+				Comment:   fmt.Sprintf("OpenVEX document %s", doc.ID),
+			},
+		})
+		if err != nil {
+			return "", fmt.Errorf("appending VEX layer: %w", err)
+		}
+	}
+
+	if embedOpts.Label {
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			return "", fmt.Errorf("reading image configuration: %w", err)
+		}
+		cfg = cfg.DeepCopy()
+		if cfg.Config.Labels == nil {
+			cfg.Config.Labels = map[string]string{}
+		}
+		cfg.Config.Labels[embedOpts.LabelName] = string(data)
+		img, err = gcrmutate.ConfigFile(img, cfg)
+		if err != nil {
+			return "", fmt.Errorf("setting VEX label: %w", err)
+		}
+	}
+
+	if err := withRetry(ctx, opts, "pushing image", func() error {
+		return remote.Write(dst, img, clientOpts...)
+	}); err != nil {
+		return "", fmt.Errorf("pushing image: %w", err)
+	}
+	newRegistryCache(opts).invalidate("digest:" + dst.Name())
+
+	digest, err := img.Digest()
+	if err != nil {
+		return "", fmt.Errorf("computing image digest: %w", err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"image":  dst.Name(),
+		"digest": digest.String(),
+	}).Info("Embedded VEX document in image")
+	return digest.String(), nil
+}
+
+// Detach rewrites the attestations of an image without the ones selected
+// by the options. If no attestations remain, the attestation tag is deleted.
+func (impl *defaultVexCtlImplementation) Detach(
+	ctx context.Context, opts Options, imageRef string, detachOpts DetachOptions,
+) ([]string, error) {
+	ref, err := parseReference(opts, imageRef)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := resolveDigest(ctx, opts, ref)
+	if err != nil {
+		return nil, err
+	}
+	remoteOpts, err := remoteOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var se oci.SignedEntity
+	if err := withRetry(ctx, opts, "reading image", func() (err error) {
+		se, err = ociremote.SignedEntity(digest, remoteOpts...)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("reading image: %w", err)
+	}
+	atts, err := se.Attestations()
+	if err != nil {
+		return nil, fmt.Errorf("reading attestations: %w", err)
+	}
+	current, err := atts.Get()
+	if err != nil {
+		return nil, fmt.Errorf("reading attestations: %w", err)
+	}
+
+	removed := []string{}
+	keep := []oci.Signature{}
+	for _, att := range current {
+		match, err := detachOpts.matches(att)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			keep = append(keep, att)
+			continue
+		}
+		d, err := att.Digest()
+		if err != nil {
+			return nil, fmt.Errorf("reading attestation digest: %w", err)
+		}
+		removed = append(removed, d.String())
+	}
+	if len(removed) == 0 {
+		return removed, nil
+	}
+
+	if len(keep) == 0 {
+		tag, err := ociremote.AttestationTag(digest, remoteOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("getting attestation tag: %w", err)
+		}
+		clientOpts, err := registryClientOptions(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := withRetry(ctx, opts, "deleting attestations", func() error {
+			return remote.Delete(tag, clientOpts...)
+		}); err != nil {
+			return nil, fmt.Errorf("deleting attestations: %w", err)
+		}
+	} else {
+		newAtts, err := mutate.AppendSignatures(empty.Signatures(), keep...)
+		if err != nil {
+			return nil, fmt.Errorf("building new attestation set: %w", err)
+		}
+		hash, err := v1.NewHash(digest.DigestStr())
+		if err != nil {
+			return nil, fmt.Errorf("parsing image digest: %w", err)
+		}
+		entity := &attestedEntity{SignedEntity: se, digest: hash, attestations: newAtts}
+		if err := withRetry(ctx, opts, "writing attestations", func() error {
+			return ociremote.WriteAttestations(digest.Repository, entity, remoteOpts...)
+		}); err != nil {
+			return nil, fmt.Errorf("writing attestations: %w", err)
+		}
+	}
+	newRegistryCache(opts).invalidate(attestationsCacheKey(digest))
+
+	logrus.WithFields(logrus.Fields{
+		"image":     digest.String(),
+		"removed":   len(removed),
+		"remaining": len(keep),
+	}).Info("Detached attestations from image")
+	return removed, nil
+}
+
+// ListVEXAttestations returns the digest of an image and the digests of
+// the VEX attestations attached to it. The attestations are not verified,
+// the list is only used to notice when they change.
+func (impl *defaultVexCtlImplementation) ListVEXAttestations(
+	ctx context.Context, opts Options, imageRef string,
+) (string, []string, error) {
+	ref, err := parseReference(opts, imageRef)
+	if err != nil {
+		return "", nil, err
+	}
+	digest, err := resolveDigest(ctx, opts, ref)
+	if err != nil {
+		return "", nil, err
+	}
+	remoteOpts, err := remoteOptions(ctx, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var se oci.SignedEntity
+	if err := withRetry(ctx, opts, "reading image", func() (err error) {
+		se, err = ociremote.SignedEntity(digest, remoteOpts...)
+		return err
+	}); err != nil {
+		return "", nil, fmt.Errorf("reading image: %w", err)
+	}
+	attestations, err := vexAttestationDigests(se)
+	if err != nil {
+		return "", nil, err
+	}
+	return digest.DigestStr(), attestations, nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// WithAllowedJustifications limits the not_affected statements honored
+// when applying VEX data to those with one of the justifications
+func WithAllowedJustifications(justifications []string) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.AllowedJustifications = justifications
+	}
+}
+
+// honoredDocuments returns the documents without the not_affected
+// statements whose justification is not in Options.AllowedJustifications.
+// Documents are only copied when statements are dropped from them.
+func (vexctl *VexCtl) honoredDocuments(docs []*vex.VEX) []*vex.VEX {
+	if len(vexctl.Options.AllowedJustifications) == 0 {
+		return docs
+	}
+
+	honored := make([]*vex.VEX, 0, len(docs))
+	for _, doc := range docs {
+		statements := []vex.Statement{}
+		for _, s := range doc.Statements { //nolint:gocritic // statements are copied on purpose
+			if !vexctl.honored(&s) {
+				logrus.WithFields(logrus.Fields{
+					"document":      doc.ID,
+					"vulnerability": s.Vulnerability,
+					"justification": s.Justification,
+				}).Info("Ignoring not_affected statement with a justification not allowed")
+				continue
+			}
+			statements = append(statements, s)
+		}
+		if len(statements) == len(doc.Statements) {
+			honored = append(honored, doc)
+			continue
+		}
+		honored = append(honored, &vex.VEX{Metadata: doc.Metadata, Statements: statements})
+	}
+	return honored
+}
+
+// honored returns false if a statement is a not_affected statement
+// whose justification is not allowed in the options
+func (vexctl *VexCtl) honored(s *vex.Statement) bool {
+	if s.Status != vex.StatusNotAffected || len(vexctl.Options.AllowedJustifications) == 0 {
+		return true
+	}
+	for _, j := range vexctl.Options.AllowedJustifications {
+		if vex.Justification(j) == s.Justification {
+			return true
+		}
+	}
+	return false
+}
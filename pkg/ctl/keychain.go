@@ -0,0 +1,74 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// DefaultCredentialHelper returns the docker credential helper reading
+// the keychain of the OS: the macOS Keychain, the Windows Credential
+// Manager or the Secret Service on other systems
+func DefaultCredentialHelper() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "osxkeychain"
+	case "windows":
+		return "wincred"
+	default:
+		return "secretservice"
+	}
+}
+
+// credentialHelper reads credentials with a docker credential helper,
+// the docker-credential-<name> program found in the PATH
+type credentialHelper struct {
+	name string
+}
+
+// Get returns the username and secret stored for a server
+func (h credentialHelper) Get(serverURL string) (string, string, error) {
+	creds, err := client.Get(client.NewShellProgramFunc("docker-credential-"+h.name), serverURL)
+	if err != nil {
+		return "", "", err
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+// registryKeychain returns the keychain resolving the registry credentials:
+// the docker configuration first and the credential helper as a fallback.
+// It returns nil, to use the default keychain, when no helper is set.
+func registryKeychain(opts Options) authn.Keychain {
+	if opts.CredentialHelper == "" {
+		return nil
+	}
+	return authn.NewMultiKeychain(
+		authn.DefaultKeychain,
+		authn.NewKeychainFromHelper(credentialHelper{name: opts.CredentialHelper}),
+	)
+}
+
+// keychainSecret reads the secret stored for a server with the credential
+// helper. It returns an empty string when there is no helper set or no
+// credentials stored for the server.
+func keychainSecret(opts Options, serverURL string) (string, error) {
+	if opts.CredentialHelper == "" {
+		return "", nil
+	}
+	_, secret, err := credentialHelper{name: opts.CredentialHelper}.Get(serverURL)
+	if err != nil {
+		if credentials.IsErrCredentialsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("reading credentials for %s from the keychain: %w", serverURL, err)
+	}
+	return secret, nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	gosarif "github.com/owenrumney/go-sarif/sarif"
+	"gopkg.in/yaml.v3"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+	"github.com/openvex/go-vex/pkg/vex"
+
+	"github.com/openvex/vexctl/pkg/formats"
+)
+
+// ParseWarnings collects the malformed records skipped when parsing
+// documents and reports in lenient mode, see formats.Warnings
+type ParseWarnings = formats.Warnings
+
+// openVEXLenient reads an OpenVEX document in JSON or YAML, skipping the
+// statements that cannot be decoded
+func openVEXLenient(path, format string, warnings *ParseWarnings) (*vex.VEX, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening VEX file: %w", err)
+	}
+	doc := vex.New()
+	if format == DocumentFormatYAML {
+		// Same shape as vex.VEX, so the document decodes as with vex.OpenYAML
+		raw := struct {
+			vex.Metadata
+			Statements []yaml.Node
+		}{Metadata: doc.Metadata}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("unmarshalling VEX data: %w", err)
+		}
+		doc.Metadata = raw.Metadata
+		for i := range raw.Statements {
+			s := vex.Statement{}
+			if err := raw.Statements[i].Decode(&s); err != nil {
+				warnings.Add("%s: skipped statement %d: %v", path, i, err)
+				continue
+			}
+			doc.Statements = append(doc.Statements, s)
+		}
+		return &doc, nil
+	}
+
+	raw := struct {
+		vex.Metadata
+		Statements []json.RawMessage `json:"statements"`
+	}{Metadata: doc.Metadata}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("unmarshalling VEX data: %w", err)
+	}
+	doc.Metadata = raw.Metadata
+	for i, rs := range raw.Statements {
+		s := vex.Statement{}
+		if err := json.Unmarshal(rs, &s); err != nil {
+			warnings.Add("%s: skipped statement %d: %v", path, i, err)
+			continue
+		}
+		doc.Statements = append(doc.Statements, s)
+	}
+	return &doc, nil
+}
+
+// parseSARIFLenient parses a SARIF report, skipping the results that
+// cannot be decoded
+func parseSARIFLenient(data []byte, warnings *ParseWarnings) (*sarif.Report, error) {
+	raw := struct {
+		gosarif.Report
+		Runs []map[string]json.RawMessage `json:"runs"`
+	}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("unmarshalling SARIF report: %w", err)
+	}
+	report := sarif.New()
+	report.Report = raw.Report
+	report.Runs = []*gosarif.Run{}
+	for i, rawRun := range raw.Runs {
+		results := []json.RawMessage{}
+		if rr, ok := rawRun["results"]; ok {
+			if err := json.Unmarshal(rr, &results); err != nil {
+				return nil, fmt.Errorf("unmarshalling results of run %d: %w", i, err)
+			}
+			delete(rawRun, "results")
+		}
+		runData, err := json.Marshal(rawRun)
+		if err != nil {
+			return nil, fmt.Errorf("marshalling run %d: %w", i, err)
+		}
+		run := &gosarif.Run{}
+		if err := json.Unmarshal(runData, run); err != nil {
+			return nil, fmt.Errorf("unmarshalling run %d: %w", i, err)
+		}
+		run.Results = []*gosarif.Result{}
+		for j, rr := range results {
+			res := &gosarif.Result{}
+			if err := json.Unmarshal(rr, res); err != nil {
+				warnings.Add("skipped result %d of run %d: %v", j, i, err)
+				continue
+			}
+			run.Results = append(run.Results, res)
+		}
+		report.Runs = append(report.Runs, run)
+	}
+	return report, nil
+}
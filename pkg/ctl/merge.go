@@ -0,0 +1,197 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// mergeSet accumulates the documents being merged. Only the IDs of the
+// documents and their statements matching the merge options are kept,
+// along with what is needed to check the status transitions, so each
+// document can be released as soon as it is added.
+type mergeSet struct {
+	opts   *MergeOptions
+	filter *statementFilter
+
+	ids     []string
+	ss      []vex.Statement
+	history []*vex.VEX
+}
+
+func newMergeSet(opts *MergeOptions) *mergeSet {
+	return &mergeSet{
+		opts:    opts,
+		filter:  newStatementFilter(opts),
+		ids:     []string{},
+		ss:      []vex.Statement{},
+		history: []*vex.VEX{},
+	}
+}
+
+// add filters the statements of a document into the set
+func (m *mergeSet) add(doc *vex.VEX) error {
+	ss, err := m.filter.statements(doc)
+	if err != nil {
+		return err
+	}
+	m.ids = append(m.ids, doc.ID)
+	m.ss = append(m.ss, ss...)
+	m.history = append(m.history, transitionHistory(doc))
+	return nil
+}
+
+// transitionHistory returns a copy of a document with only the fields
+// checked when validating the status transitions. Nothing is shared with
+// the document, so changes to it don't alter the recorded history.
+func transitionHistory(doc *vex.VEX) *vex.VEX {
+	h := &vex.VEX{
+		Metadata: vex.Metadata{
+			ID:        doc.ID,
+			Version:   doc.Version,
+			Timestamp: copyTime(doc.Timestamp),
+		},
+		Statements: make([]vex.Statement, len(doc.Statements)),
+	}
+	for i := range doc.Statements {
+		s := &doc.Statements[i]
+		h.Statements[i] = vex.Statement{
+			Vulnerability: s.Vulnerability,
+			Products:      append([]string{}, s.Products...),
+			Status:        s.Status,
+			Timestamp:     copyTime(s.Timestamp),
+		}
+	}
+	return h
+}
+
+// copyTime returns a pointer to a copy of a time, or nil
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+// document returns the merged document with the statements of the set
+func (m *mergeSet) document() (*vex.VEX, error) {
+	if len(m.ids) == 0 {
+		return nil, fmt.Errorf("at least one vex document is required to merge")
+	}
+
+	violations := ValidateTransitions(m.history)
+	for i := range violations {
+		logrus.Warnf("Invalid status transition: %s", violations[i].String())
+	}
+	if m.opts.StrictTransitions && len(violations) > 0 {
+		return nil, fmt.Errorf("found %d invalid status transitions", len(violations))
+	}
+
+	docID := m.opts.DocumentID
+	// If no document id is specified we compute a
+	// deterministic ID using the merged docs
+	if docID == "" {
+		ids := []string{}
+		for i, id := range m.ids {
+			if id == "" {
+				ids = append(ids, fmt.Sprintf("VEX-DOC-%d", i))
+			} else {
+				ids = append(ids, id)
+			}
+		}
+
+		sort.Strings(ids)
+		h := sha256.New()
+		h.Write([]byte(strings.Join(ids, ":")))
+		// Hash the sorted IDs list
+		docID = fmt.Sprintf("merged-vex-%x", h.Sum(nil))
+	}
+	now := time.Now()
+	newDoc := &vex.VEX{
+		Metadata: vex.Metadata{
+			ID:         docID,
+			Author:     m.opts.Author,
+			AuthorRole: m.opts.AuthorRole,
+			Timestamp:  &now,
+		},
+	}
+
+	t, err := vex.DateFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("reading date from env: %w", err)
+	}
+
+	if t != nil {
+		newDoc.Metadata.Timestamp = t
+	}
+
+	ss := m.ss
+	vex.SortStatements(ss, *newDoc.Metadata.Timestamp)
+
+	if m.opts.Consolidate {
+		consolidated := consolidateStatements(ss, m.opts.ConsolidateWindow)
+		logrus.Debugf("Consolidated %d statements into %d", len(ss), len(consolidated))
+		ss = consolidated
+	}
+
+	newDoc.Statements = ss
+	return newDoc, nil
+}
+
+// MergeURIs is like Merge but reads the documents from any source supported
+// by VexesFromURIs, such as files, directories, URLs or image references.
+// Documents are filtered as each source is read and directories are read
+// file by file, so the statements left out of the merge are dropped early.
+// This does not bound memory: every document is still decoded whole and
+// the fields needed to check the status transitions are kept for all the
+// statements read.
+func (vexctl *VexCtl) MergeURIs(ctx context.Context, opts *MergeOptions, uris []string) (*vex.VEX, error) {
+	uris, err := expandFiles(uris)
+	if err != nil {
+		return nil, fmt.Errorf("reading VEX data: %w", err)
+	}
+
+	// Sources are fetched concurrently, each one gets its own set
+	// so that they are combined in the order of the URIs
+	sets := make([]*mergeSet, len(uris))
+	if err := vexctl.fetchSources(ctx, uris, func(i int, docs []*vex.VEX) error {
+		set := newMergeSet(opts)
+		for _, doc := range docs {
+			if err := set.add(doc); err != nil {
+				return err
+			}
+		}
+		sets[i] = set
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("reading VEX data: %w", err)
+	}
+
+	merged := newMergeSet(opts)
+	for _, set := range sets {
+		if set == nil {
+			continue
+		}
+		merged.ids = append(merged.ids, set.ids...)
+		merged.ss = append(merged.ss, set.ss...)
+		merged.history = append(merged.history, set.history...)
+	}
+	doc, err := merged.document()
+	if err != nil {
+		return nil, fmt.Errorf("merging %d documents: %w", len(merged.ids), err)
+	}
+	return doc, nil
+}
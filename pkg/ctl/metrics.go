@@ -0,0 +1,141 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// Phases of the operations timed by Metrics
+const (
+	MetricsPhaseFetch = "fetch" // Reading VEX data from its sources
+	MetricsPhaseParse = "parse" // Parsing documents and reports
+	MetricsPhaseApply = "apply" // Applying VEX data to reports
+	MetricsPhasePush  = "push"  // Writing attestations and images to registries
+)
+
+// Metrics records the time spent in each phase of a run, the documents
+// processed and the use of the registry cache, to track the performance
+// of recurring jobs. A nil Metrics records nothing.
+type Metrics struct {
+	mu          sync.Mutex
+	started     time.Time
+	phases      map[string]*PhaseMetrics
+	documents   int
+	statements  int
+	cacheHits   int
+	cacheMisses int
+}
+
+// PhaseMetrics are the times a phase ran and the total time it took
+type PhaseMetrics struct {
+	Count   int     `json:"count"`
+	Seconds float64 `json:"seconds"`
+}
+
+// MetricsReport is the summary of the metrics of a run
+type MetricsReport struct {
+	Seconds    float64                  `json:"seconds"`
+	Phases     map[string]*PhaseMetrics `json:"phases"`
+	Documents  int                      `json:"documents"`
+	Statements int                      `json:"statements"`
+	Cache      struct {
+		Hits    int     `json:"hits"`
+		Misses  int     `json:"misses"`
+		HitRate float64 `json:"hit_rate"`
+	} `json:"cache"`
+}
+
+// NewMetrics returns metrics for a run starting now
+func NewMetrics() *Metrics {
+	return &Metrics{started: time.Now(), phases: map[string]*PhaseMetrics{}}
+}
+
+// Track starts timing a phase, the returned function stops it. Phases
+// running concurrently or nested in others are timed independently.
+func (m *Metrics) Track(phase string) func() {
+	if m == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		p, ok := m.phases[phase]
+		if !ok {
+			p = &PhaseMetrics{}
+			m.phases[phase] = p
+		}
+		p.Count++
+		p.Seconds += elapsed.Seconds()
+	}
+}
+
+// AddDocuments counts the documents read and their statements
+func (m *Metrics) AddDocuments(docs []*vex.VEX) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, doc := range docs {
+		m.documents++
+		m.statements += len(doc.Statements)
+	}
+}
+
+// cacheLookup counts a lookup in the registry cache
+func (m *Metrics) cacheLookup(hit bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hit {
+		m.cacheHits++
+	} else {
+		m.cacheMisses++
+	}
+}
+
+// Report returns the summary of the metrics recorded so far
+func (m *Metrics) Report() *MetricsReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := &MetricsReport{
+		Seconds:    time.Since(m.started).Seconds(),
+		Phases:     map[string]*PhaseMetrics{},
+		Documents:  m.documents,
+		Statements: m.statements,
+	}
+	for name, p := range m.phases {
+		pm := *p
+		r.Phases[name] = &pm
+	}
+	r.Cache.Hits = m.cacheHits
+	r.Cache.Misses = m.cacheMisses
+	if lookups := m.cacheHits + m.cacheMisses; lookups > 0 {
+		r.Cache.HitRate = float64(m.cacheHits) / float64(lookups)
+	}
+	return r
+}
+
+// WriteJSON writes the summary of the metrics as JSON
+func (m *Metrics) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m.Report()); err != nil {
+		return fmt.Errorf("encoding metrics: %w", err)
+	}
+	return nil
+}
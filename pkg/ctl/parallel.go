@@ -0,0 +1,52 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// parallelDo calls fn for every index in [0, n) using one worker per CPU.
+// It returns the first error found or the context error if it is canceled.
+func parallelDo(ctx context.Context, n int, fn func(i int) error) error {
+	workers := runtime.NumCPU()
+	if workers > n {
+		workers = n
+	}
+
+	indexes := make(chan int)
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := fn(i); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+
+	var ctxErr error
+	for i := 0; i < n; i++ {
+		if ctxErr = ctx.Err(); ctxErr != nil {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	close(errs)
+
+	if ctxErr != nil {
+		return ctxErr
+	}
+	return <-errs
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	gosarif "github.com/owenrumney/go-sarif/sarif"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// PatchOperation is an operation of an RFC 6902 JSON Patch
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// ReportPatch is an RFC 6902 JSON Patch describing the changes VEX data
+// made to a report. Each removed result is preceded by a test operation
+// holding it, so the patch fails on a different report and records what
+// was removed, which is enough to revert it.
+type ReportPatch []PatchOperation
+
+// WriteJSON writes the patch as indented JSON
+func (p ReportPatch) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(p); err != nil {
+		return fmt.Errorf("encoding report patch: %w", err)
+	}
+	return nil
+}
+
+// ApplyWithPatch applies the VEX documents to the report like Apply and
+// returns the JSON Patch that turns the original report into the result
+func (vexctl *VexCtl) ApplyWithPatch(
+	ctx context.Context, r *sarif.Report, vexDocs []*vex.VEX,
+) (*sarif.Report, ReportPatch, error) {
+	// Apply replaces the results of each run, so the original
+	// slices can be compared with the final ones
+	before := make([][]*gosarif.Result, len(r.Runs))
+	for i, run := range r.Runs {
+		before[i] = run.Results
+	}
+	final, err := vexctl.Apply(ctx, r, vexDocs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return final, reportPatch(before, final), nil
+}
+
+// reportPatch returns the operations removing the results of each run
+// that are missing from the final report. They are listed from the last
+// result to the first so that the indexes of the paths stay valid.
+func reportPatch(before [][]*gosarif.Result, final *sarif.Report) ReportPatch {
+	patch := ReportPatch{}
+	for i := range before {
+		kept := map[*gosarif.Result]struct{}{}
+		if i < len(final.Runs) {
+			for _, res := range final.Runs[i].Results {
+				kept[res] = struct{}{}
+			}
+		}
+		for j := len(before[i]) - 1; j >= 0; j-- {
+			if _, ok := kept[before[i][j]]; ok {
+				continue
+			}
+			path := fmt.Sprintf("/runs/%d/results/%d", i, j)
+			patch = append(patch,
+				PatchOperation{Op: "test", Path: path, Value: before[i][j]},
+				PatchOperation{Op: "remove", Path: path},
+			)
+		}
+	}
+	return patch
+}
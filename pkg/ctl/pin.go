@@ -0,0 +1,96 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"path/filepath"
+	"strings"
+)
+
+// ErrDigestMismatch is returned when the content of a VEX source pinned
+// to a digest doesn't match it
+var ErrDigestMismatch = errors.New("VEX source does not match its pinned digest")
+
+// pinnedDigestLengths are the algorithms accepted to pin sources and
+// the length of their hex digests
+var pinnedDigestLengths = map[string]int{
+	"sha256": sha256.Size * 2,
+	"sha512": sha512.Size * 2,
+}
+
+// sourcePin is the digest expected for the content of a VEX source
+type sourcePin struct {
+	algorithm string
+	digest    string
+}
+
+// splitPinnedURI splits a file path or URL pinned to a digest, such as
+// https://example.com/doc.vex.json@sha256:abc..., into the location and
+// the expected digest. URIs without a valid digest suffix are returned
+// unchanged with a nil pin.
+func splitPinnedURI(uri string) (string, *sourcePin) {
+	i := strings.LastIndex(uri, "@")
+	if i <= 0 {
+		return uri, nil
+	}
+	algorithm, digest, ok := strings.Cut(uri[i+1:], ":")
+	if !ok {
+		return uri, nil
+	}
+	length, ok := pinnedDigestLengths[algorithm]
+	if !ok || len(digest) != length {
+		return uri, nil
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return uri, nil
+	}
+	return uri[:i], &sourcePin{algorithm: algorithm, digest: strings.ToLower(digest)}
+}
+
+// hash returns a new hash of the pin algorithm
+func (p *sourcePin) hash() hash.Hash {
+	if p.algorithm == "sha512" {
+		return sha512.New()
+	}
+	return sha256.New()
+}
+
+// check compares the digest computed in h with the pinned one
+func (p *sourcePin) check(location string, h hash.Hash) error {
+	got := hex.EncodeToString(h.Sum(nil))
+	if got != p.digest {
+		return fmt.Errorf(
+			"%w: %s has digest %s:%s, expected %s:%s",
+			ErrDigestMismatch, location, p.algorithm, got, p.algorithm, p.digest,
+		)
+	}
+	return nil
+}
+
+// looksLikeFilePath returns true if the location of a pinned source is
+// a local path rather than an image reference: it is relative to the
+// current or home directory, absolute, or names a VEX document file.
+func looksLikeFilePath(location string) bool {
+	if strings.Contains(location, "://") || strings.HasPrefix(location, "git+") {
+		return false
+	}
+	if filepath.IsAbs(location) || strings.HasPrefix(location, ".") || strings.HasPrefix(location, "~") {
+		return true
+	}
+	fileName := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(location), ".gz"), ".zst")
+	for _, ext := range dirSourceExtensions {
+		if strings.HasSuffix(fileName, ext) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"strings"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// productMatches returns true if a statement product applies to a
+// product. Besides being equal, a package URL whose version is a vers
+// range matches the package URLs of the same package with a version
+// in the range, and a CPE name matches the CPE names it contains with
+// its ANY attributes, in either CPE 2.2 or 2.3 form.
+func productMatches(statementProduct, product string) bool {
+	if statementProduct == product {
+		return true
+	}
+	if sc, ok := parseCPE(statementProduct); ok {
+		pc, ok := parseCPE(product)
+		return ok && cpeMatches(sc, pc)
+	}
+	sp, ok := parsePackageURL(statementProduct)
+	if !ok || !strings.HasPrefix(sp.Version, versPrefix) {
+		return false
+	}
+	p, ok := parsePackageURL(product)
+	if !ok || p.Version == "" || p.Type != sp.Type || p.Namespace != sp.Namespace || p.Name != sp.Name {
+		return false
+	}
+	constraints, err := parseVers(sp.Version)
+	if err != nil {
+		return false
+	}
+	return versContains(constraints, p.Version)
+}
+
+// matchesAnyProduct returns true if any of the
+// statement products applies to a product
+func matchesAnyProduct(statementProducts []string, product string) bool {
+	for _, sp := range statementProducts {
+		if productMatches(sp, product) {
+			return true
+		}
+	}
+	return false
+}
+
+// versionMatch compares a statement product with the product of a scan
+// result. related is true if both name the same package, by package URL
+// type, namespace and name, or the same CPE part, vendor and product.
+// matches is true if the statement product applies to the version of
+// the result: a product without version or a result of unknown version
+// always does, qualifiers are ignored.
+func versionMatch(statementProduct, product string) (related, matches bool) {
+	if productMatches(statementProduct, product) {
+		return true, true
+	}
+	if sc, ok := parseCPE(statementProduct); ok {
+		pc, ok := parseCPE(product)
+		if !ok || sc[0] != pc[0] || sc[1] != pc[1] || sc[2] != pc[2] {
+			return false, false
+		}
+		return true, cpeMatches(sc, pc)
+	}
+	sp, ok := parsePackageURL(statementProduct)
+	if !ok {
+		return false, false
+	}
+	p, ok := parsePackageURL(product)
+	if !ok || p.Type != sp.Type || p.Namespace != sp.Namespace || p.Name != sp.Name {
+		return false, false
+	}
+	if sp.Version == "" || p.Version == "" {
+		return true, true
+	}
+	if !strings.HasPrefix(sp.Version, versPrefix) {
+		return true, sp.Version == p.Version
+	}
+	constraints, err := parseVers(sp.Version)
+	if err != nil {
+		return false, false
+	}
+	return true, versContains(constraints, p.Version)
+}
+
+// productMatch pairs a product or subcomponent listed in a statement
+// with the product of a scan result it was compared to
+type productMatch struct {
+	Statement string
+	Result    string
+	Matches   bool
+}
+
+// matchProducts compares the products and subcomponents of a statement
+// with the products of a scan result. It returns the first pair that
+// matches or, when none does, the first listing the package of the result
+// with versions that exclude it. It returns nil if the statement does not
+// list the package of the result at all.
+func matchProducts(s *vex.Statement, products []string) *productMatch {
+	var excluded *productMatch
+	for _, product := range products {
+		for _, ids := range [][]string{s.Products, s.Subcomponents} {
+			for _, id := range ids {
+				related, matches := versionMatch(id, product)
+				if matches {
+					return &productMatch{Statement: id, Result: product, Matches: true}
+				}
+				if related && excluded == nil {
+					excluded = &productMatch{Statement: id, Result: product}
+				}
+			}
+		}
+	}
+	return excluded
+}
+
+// statementAppliesTo returns true if a statement applies to a scan result
+// identified by products, its package URL or CPE names and the products
+// selected by the user. A statement listing the package of the result,
+// as a product or subcomponent, only with versions or ranges that exclude
+// it does not apply. Statements about other products, like the image the
+// package was found in, and results without products are matched by
+// vulnerability alone.
+func statementAppliesTo(s *vex.Statement, products []string) bool {
+	m := matchProducts(s, products)
+	return m == nil || m.Matches
+}
+
+// resultProducts returns the products identifying a SARIF result: the
+// package URL and CPE names recorded in its properties by the scanner
+// converters and the products selected by the user
+func resultProducts(props map[string]interface{}, selected []string) []string {
+	products := []string{}
+	if purl, ok := props["purl"].(string); ok && purl != "" {
+		products = append(products, purl)
+	}
+	if cpes, ok := props["cpes"].([]interface{}); ok {
+		for _, c := range cpes {
+			if cs, ok := c.(string); ok && cs != "" {
+				products = append(products, cs)
+			}
+		}
+	}
+	return append(products, selected...)
+}
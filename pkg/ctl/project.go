@@ -0,0 +1,92 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// Locations of the VEX files scaffolded in a repository by InitProject
+const (
+	ProjectDir          = ".vex"
+	ProjectConfigFile   = "config.yaml"
+	ProjectDocumentFile = "main.vex.json"
+)
+
+// ProjectConfig holds the defaults used when authoring
+// VEX documents in a repository
+type ProjectConfig struct {
+	Author     string   `yaml:"author"`
+	AuthorRole string   `yaml:"role"`
+	Products   []string `yaml:"products,omitempty"`
+}
+
+// InitProject scaffolds VEX authoring in a repository: it creates the .vex
+// directory under dir with a configuration file holding the defaults and a
+// starter OpenVEX document. It returns the path of the document and fails
+// if the repository already has a configuration.
+func (vexctl *VexCtl) InitProject(dir string, config *ProjectConfig) (string, error) {
+	vexDir := filepath.Join(dir, ProjectDir)
+	configPath := filepath.Join(vexDir, ProjectConfigFile)
+	if _, err := os.Stat(configPath); err == nil {
+		return "", fmt.Errorf("%s already exists", configPath)
+	}
+	if err := os.MkdirAll(vexDir, 0o755); err != nil {
+		return "", fmt.Errorf("creating VEX directory: %w", err)
+	}
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("marshalling configuration: %w", err)
+	}
+	if err := os.WriteFile(configPath, data, 0o644); err != nil { //nolint:gosec // the config is not secret
+		return "", fmt.Errorf("writing configuration: %w", err)
+	}
+
+	docPath := filepath.Join(vexDir, ProjectDocumentFile)
+	if _, err := os.Stat(docPath); err == nil {
+		return docPath, nil
+	}
+	doc := vex.New()
+	doc.Author = config.Author
+	doc.AuthorRole = config.AuthorRole
+	if _, err := doc.GenerateCanonicalID(); err != nil {
+		return "", fmt.Errorf("generating document id: %w", err)
+	}
+	f, err := os.Create(docPath)
+	if err != nil {
+		return "", fmt.Errorf("creating VEX document: %w", err)
+	}
+	defer f.Close()
+	if err := doc.ToJSON(f); err != nil {
+		return "", fmt.Errorf("writing VEX document: %w", err)
+	}
+	return docPath, nil
+}
+
+// LoadProjectConfig reads the VEX configuration of the repository in dir.
+// If the repository has none, it returns nil without error.
+func LoadProjectConfig(dir string) (*ProjectConfig, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ProjectDir, ProjectConfigFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading VEX configuration: %w", err)
+	}
+	config := &ProjectConfig{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("parsing VEX configuration: %w", err)
+	}
+	return config, nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// PruneReport lists the changes made to a document by Prune
+type PruneReport struct {
+	// Removed are the statements dropped as all their products were pruned
+	Removed []vex.Statement
+
+	// Modified are the statements which still have products
+	// left, as they are in the pruned document
+	Modified []vex.Statement
+}
+
+// Changed returns true if any statement was removed or modified
+func (pr *PruneReport) Changed() bool {
+	return len(pr.Removed) > 0 || len(pr.Modified) > 0
+}
+
+// Prune returns a copy of a document without the statements about the
+// specified products. Statements that also apply to other products are
+// kept, with the pruned products removed from their list. If the document
+// changes and its version is numeric, it is incremented.
+func (vexctl *VexCtl) Prune(doc *vex.VEX, products []string) (*vex.VEX, *PruneReport) {
+	prune := map[string]struct{}{}
+	for _, p := range products {
+		prune[p] = struct{}{}
+	}
+
+	report := &PruneReport{
+		Removed:  []vex.Statement{},
+		Modified: []vex.Statement{},
+	}
+	newDoc := &vex.VEX{
+		Metadata:   doc.Metadata,
+		Statements: []vex.Statement{},
+	}
+	for _, s := range doc.Statements { //nolint:gocritic // statements are copied on purpose
+		keep := []string{}
+		for _, p := range s.Products {
+			if _, ok := prune[p]; !ok {
+				keep = append(keep, p)
+			}
+		}
+		switch {
+		case len(keep) == len(s.Products):
+			newDoc.Statements = append(newDoc.Statements, s)
+		case len(keep) == 0:
+			report.Removed = append(report.Removed, s)
+		default:
+			s.Products = keep
+			newDoc.Statements = append(newDoc.Statements, s)
+			report.Modified = append(report.Modified, s)
+		}
+	}
+
+	if report.Changed() {
+		if v, err := strconv.Atoi(newDoc.Version); err == nil {
+			newDoc.Version = strconv.Itoa(v + 1)
+		}
+	}
+	logrus.WithFields(logrus.Fields{
+		"removed":  len(report.Removed),
+		"modified": len(report.Modified),
+	}).Info("Pruned VEX document")
+	return newDoc, report
+}
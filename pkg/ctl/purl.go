@@ -0,0 +1,69 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// packageURL holds the parts of a package URL used by vexctl
+type packageURL struct {
+	Type      string
+	Namespace string
+	Name      string
+	Version   string
+}
+
+// parsePackageURL splits a package URL (pkg:type/namespace/name@version)
+// into its parts. Qualifiers and subpaths are ignored. It returns false
+// if the string is not a package URL.
+func parsePackageURL(s string) (packageURL, bool) {
+	if !strings.HasPrefix(s, "pkg:") {
+		return packageURL{}, false
+	}
+	rest := strings.TrimPrefix(s, "pkg:")
+	if i := strings.IndexAny(rest, "?#"); i != -1 {
+		rest = rest[:i]
+	}
+	p := packageURL{}
+	if i := strings.LastIndex(rest, "@"); i != -1 {
+		p.Version, _ = url.PathUnescape(rest[i+1:])
+		rest = rest[:i]
+	}
+	parts := strings.Split(strings.Trim(rest, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[len(parts)-1] == "" {
+		return packageURL{}, false
+	}
+	p.Type = strings.ToLower(parts[0])
+	p.Name, _ = url.PathUnescape(parts[len(parts)-1])
+	p.Namespace, _ = url.PathUnescape(strings.Join(parts[1:len(parts)-1], "/"))
+	return p, true
+}
+
+// ImagePackageURL returns the OCI package URL identifying a container
+// image, eg pkg:oci/nginx@sha256%3Aabc...?repository_url=cgr.dev/chainguard/nginx
+// Images referenced by tag get it as a qualifier instead of a digest.
+func ImagePackageURL(image string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", fmt.Errorf("parsing image reference: %w", err)
+	}
+	repo := ref.Context()
+	purl := "pkg:oci/" + path.Base(repo.RepositoryStr())
+	qualifiers := "?repository_url=" + repo.RegistryStr() + "/" + repo.RepositoryStr()
+	switch r := ref.(type) {
+	case name.Digest:
+		purl += "@" + url.QueryEscape(r.DigestStr())
+	case name.Tag:
+		qualifiers += "&tag=" + url.QueryEscape(r.TagStr())
+	}
+	return purl + qualifiers, nil
+}
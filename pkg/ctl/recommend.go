@@ -0,0 +1,143 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// Types of the match details recorded by grype
+const (
+	grypeMatchExactIndirect = "exact-indirect-match"
+	grypeMatchCPE           = "cpe-match"
+)
+
+// Recommendation is a justification suggested for a match of a scanner
+// report, to be confirmed before a not_affected statement is issued
+type Recommendation struct {
+	Vulnerability string            `json:"vulnerability"`
+	Package       string            `json:"package"`
+	Version       string            `json:"version,omitempty"`
+	PURL          string            `json:"purl,omitempty"`
+	Justification vex.Justification `json:"justification"`
+	Reason        string            `json:"reason"`
+}
+
+// grypeMatchDetail is how grype found a match
+type grypeMatchDetail struct {
+	Type       string `json:"type"`
+	SearchedBy struct {
+		Package struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"package"`
+		CPEs []string `json:"cpes"`
+	} `json:"searchedBy"`
+}
+
+// RecommendJustifications suggests justifications for the matches of a
+// grype JSON report, based on how they were matched. Matches found only
+// by CPE may be about another component than the package, and those
+// found through the source package of a distro package may be about code
+// not built into it. Matches no heuristic applies to are not returned.
+//
+// Other report formats do not record how the matches were found, so they
+// are rejected.
+func RecommendJustifications(data []byte) ([]Recommendation, error) {
+	format, err := DetectReportFormat(data)
+	if err != nil {
+		return nil, err
+	}
+	if format != ReportFormatGrype {
+		return nil, fmt.Errorf(
+			"justifications can only be recommended from grype JSON reports, %s reports do not record how vulnerabilities were matched",
+			format,
+		)
+	}
+
+	gr := &grypeReport{}
+	if err := json.Unmarshal(data, gr); err != nil {
+		return nil, fmt.Errorf("unmarshalling grype report: %w", err)
+	}
+
+	recommendations := []Recommendation{}
+	for i, data := range gr.Matches {
+		m := struct {
+			grypeMatch
+			MatchDetails []json.RawMessage `json:"matchDetails"`
+		}{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("unmarshalling grype match %d: %w", i, err)
+		}
+		// The searches differ between matchers, details that do not
+		// decode are treated as a match of an unknown type
+		details := make([]grypeMatchDetail, len(m.MatchDetails))
+		for j := range m.MatchDetails {
+			if err := json.Unmarshal(m.MatchDetails[j], &details[j]); err != nil {
+				details[j] = grypeMatchDetail{}
+			}
+		}
+		justification, reason := recommendJustification(&m.grypeMatch, details)
+		if justification == "" {
+			continue
+		}
+		recommendations = append(recommendations, Recommendation{
+			Vulnerability: m.vulnerabilityID(),
+			Package:       m.Artifact.Name,
+			Version:       m.Artifact.Version,
+			PURL:          m.Artifact.PURL,
+			Justification: justification,
+			Reason:        reason,
+		})
+	}
+	return recommendations, nil
+}
+
+// recommendJustification returns the justification suggested for a
+// match and why, or an empty justification if none can be suggested
+func recommendJustification(m *grypeMatch, details []grypeMatchDetail) (vex.Justification, string) {
+	if len(details) == 0 {
+		return "", ""
+	}
+
+	cpes := []string{}
+	upstreams := []string{}
+	for i := range details {
+		switch details[i].Type {
+		case grypeMatchCPE:
+			cpes = append(cpes, details[i].SearchedBy.CPEs...)
+		case grypeMatchExactIndirect:
+			if name := details[i].SearchedBy.Package.Name; name != "" && name != m.Artifact.Name {
+				upstreams = append(upstreams, name)
+			}
+		default:
+			// A direct match on the package itself, or of an unknown type
+			return "", ""
+		}
+	}
+
+	if len(upstreams) == 0 {
+		if len(cpes) == 0 {
+			return "", ""
+		}
+		return vex.ComponentNotPresent, fmt.Sprintf(
+			"only matched by CPE (%s), which may identify another component than the %s package",
+			strings.Join(cpes, ", "), m.Artifact.Name,
+		)
+	}
+	if len(cpes) > 0 {
+		// Matched both ways, neither heuristic is conclusive
+		return "", ""
+	}
+	return vex.VulnerableCodeNotPresent, fmt.Sprintf(
+		"only matched through the %s source package, the vulnerable code may not be built into the %s package",
+		strings.Join(upstreams, ", "), m.Artifact.Name,
+	)
+}
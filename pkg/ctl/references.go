@@ -0,0 +1,189 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/openvex/go-vex/pkg/vex"
+	"github.com/sirupsen/logrus"
+)
+
+// maxReferenceSize is the maximum size of a referenced document read
+const maxReferenceSize = 4 << 20
+
+// referenceURLRegexp matches the URLs referenced in the text of statements
+var referenceURLRegexp = regexp.MustCompile(`https?://[^\s<>"'()\[\]]+`)
+
+// htmlTitleRegexp extracts the title of an HTML page
+var htmlTitleRegexp = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// Reference is an upstream advisory or source document referenced by a
+// statement, with a summary of its contents
+type Reference struct {
+	URL     string   `json:"url"`
+	Summary []string `json:"summary,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// StatementReferences returns the URLs referenced by a statement, in its
+// vulnerability ID and in the text of its description, notes, impact and
+// action statements
+func StatementReferences(s *vex.Statement) []string {
+	refs := []string{}
+	seen := map[string]struct{}{}
+	for _, text := range []string{s.Vulnerability, s.VulnDescription, s.StatusNotes, s.ImpactStatement, s.ActionStatement} {
+		for _, u := range referenceURLRegexp.FindAllString(text, -1) {
+			u = strings.TrimRight(u, ".,;:!?")
+			if _, ok := seen[u]; ok {
+				continue
+			}
+			seen[u] = struct{}{}
+			refs = append(refs, u)
+		}
+	}
+	return refs
+}
+
+// ResolveReferences fetches the documents referenced by the statements of
+// the VEX documents and summarizes them. The returned map is keyed by URL.
+// Documents that fail to load are returned with the error instead of a
+// summary. Fetched documents are kept in the registry cache when enabled.
+func (vexctl *VexCtl) ResolveReferences(ctx context.Context, docs []*vex.VEX) (map[string]*Reference, error) {
+	urls := []string{}
+	seen := map[string]struct{}{}
+	for _, doc := range docs {
+		for i := range doc.Statements {
+			for _, u := range StatementReferences(&doc.Statements[i]) {
+				if _, ok := seen[u]; !ok {
+					seen[u] = struct{}{}
+					urls = append(urls, u)
+				}
+			}
+		}
+	}
+
+	client, err := httpClient(vexctl.Options)
+	if err != nil {
+		return nil, err
+	}
+	cache := newRegistryCache(vexctl.Options)
+	refs := map[string]*Reference{}
+	for i, u := range urls {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("resolving references: %w", err)
+		}
+		vexctl.reportProgress(fmt.Sprintf("Resolving %s", u), i, len(urls))
+		cached := &Reference{}
+		if cache.get("reference:"+u, cached) {
+			refs[u] = cached
+			continue
+		}
+		ref, err := fetchReference(ctx, client, u)
+		if err != nil {
+			logrus.WithField("url", u).Warnf("Could not resolve reference: %v", err)
+			refs[u] = &Reference{URL: u, Error: err.Error()}
+			continue
+		}
+		cache.set("reference:"+u, ref)
+		refs[u] = ref
+	}
+	return refs, nil
+}
+
+// fetchReference downloads a referenced document and summarizes it
+func fetchReference(ctx context.Context, client *http.Client, u string) (*Reference, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading document: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading document: HTTP %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxReferenceSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading document: %w", err)
+	}
+	return &Reference{URL: u, Summary: summarizeReference(data)}, nil
+}
+
+// summarizeReference returns the lines summarizing a referenced document:
+// the statements of OpenVEX documents, the title or summary of JSON
+// advisories (OSV, CSAF), the title of HTML pages or the first line of text
+func summarizeReference(data []byte) []string {
+	doc := vex.VEX{}
+	if err := json.Unmarshal(data, &doc); err == nil && strings.HasPrefix(doc.Context, "https://openvex.dev/ns") {
+		lines := []string{}
+		if doc.Author != "" {
+			lines = append(lines, "OpenVEX document by "+doc.Author)
+		}
+		for i := range doc.Statements {
+			s := &doc.Statements[i]
+			line := fmt.Sprintf("%s %s", s.Vulnerability, s.Status)
+			if s.Justification != "" {
+				line += " (" + string(s.Justification) + ")"
+			}
+			if len(s.Products) > 0 {
+				line += " in " + strings.Join(s.Products, ", ")
+			}
+			lines = append(lines, line)
+		}
+		return lines
+	}
+
+	advisory := struct {
+		ID       string `json:"id"`
+		Summary  string `json:"summary"`
+		Details  string `json:"details"`
+		Document struct {
+			Title string `json:"title"`
+		} `json:"document"`
+	}{}
+	if err := json.Unmarshal(data, &advisory); err == nil {
+		for _, text := range []string{advisory.Summary, advisory.Document.Title, advisory.Details} {
+			if line := firstLine(text); line != "" {
+				return []string{line}
+			}
+		}
+		return []string{}
+	}
+
+	if m := htmlTitleRegexp.FindSubmatch(data); m != nil {
+		return []string{firstLine(html.UnescapeString(string(m[1])))}
+	}
+	if line := firstLine(string(data)); line != "" {
+		return []string{line}
+	}
+	return []string{}
+}
+
+// firstLine returns the first non blank line of a text, truncated
+// to keep summaries short
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			continue
+		}
+		if len(line) > 120 {
+			line = line[:117] + "..."
+		}
+		return line
+	}
+	return ""
+}
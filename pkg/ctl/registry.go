@@ -0,0 +1,184 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/cosign/cmd/cosign/cli/options"
+	"github.com/sigstore/cosign/pkg/cosign"
+	ociremote "github.com/sigstore/cosign/pkg/oci/remote"
+	"github.com/sirupsen/logrus"
+)
+
+// remoteOptions returns the options used in all calls to the registry
+func remoteOptions(ctx context.Context, opts Options) ([]ociremote.Option, error) {
+	regOpts := options.RegistryOptions{Keychain: registryKeychain(opts)}
+	remoteOpts, err := regOpts.ClientOpts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting OCI remote options: %w", err)
+	}
+	clientOpts, err := registryClientOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	// The remote options passed last replace the ones set by cosign
+	return append(remoteOpts, ociremote.WithRemoteOptions(clientOpts...)), nil
+}
+
+// registryClientOptions returns the options used to read and write images
+// with go-containerregistry directly. They are built from the same
+// settings as remoteOptions.
+func registryClientOptions(ctx context.Context, opts Options) ([]remote.Option, error) {
+	regOpts := options.RegistryOptions{Keychain: registryKeychain(opts)}
+	t, err := httpTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	return append(regOpts.GetRegistryClientOpts(ctx), remote.WithTransport(t)), nil
+}
+
+// parseReference parses an image reference, rewriting it to point to a
+// mirror when one is configured for its registry. Mirrors can include a
+// repository prefix, eg gcr.io=registry.internal/gcr rewrites gcr.io/app
+// to registry.internal/gcr/app.
+func parseReference(opts Options, refString string) (name.Reference, error) {
+	ref, err := name.ParseReference(refString)
+	if err != nil {
+		return nil, fmt.Errorf("parsing image reference: %w", err)
+	}
+	mirror := ""
+	for registry, m := range opts.RegistryMirrors {
+		reg, err := name.NewRegistry(registry)
+		if err != nil {
+			return nil, fmt.Errorf("parsing mirrored registry %q: %w", registry, err)
+		}
+		if reg.RegistryStr() == ref.Context().RegistryStr() {
+			mirror = strings.TrimSuffix(m, "/")
+			break
+		}
+	}
+	if mirror == "" {
+		return ref, nil
+	}
+
+	separator := ":"
+	if _, ok := ref.(name.Digest); ok {
+		separator = "@"
+	}
+	mirrored, err := name.ParseReference(
+		mirror + "/" + ref.Context().RepositoryStr() + separator + ref.Identifier(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("parsing mirrored image reference: %w", err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"reference": ref.String(),
+		"mirror":    mirrored.String(),
+	}).Debug("Rewrote image reference to registry mirror")
+	return mirrored, nil
+}
+
+// resolveDigest returns the digest an image reference points to. Tag
+// lookups are cached when the registry cache is enabled.
+func resolveDigest(ctx context.Context, opts Options, ref name.Reference) (name.Digest, error) {
+	if d, ok := ref.(name.Digest); ok {
+		return d, nil
+	}
+
+	cache := newRegistryCache(opts)
+	key := "digest:" + ref.Name()
+	var digestString string
+	if cache.get(key, &digestString) {
+		return ref.Context().Digest(digestString), nil
+	}
+
+	remoteOpts, err := remoteOptions(ctx, opts)
+	if err != nil {
+		return name.Digest{}, err
+	}
+	var digest name.Digest
+	if err := withRetry(ctx, opts, "resolving image digest", func() (err error) {
+		digest, err = ociremote.ResolveDigest(ref, remoteOpts...)
+		return err
+	}); err != nil {
+		return name.Digest{}, fmt.Errorf("resolving image digest: %w", err)
+	}
+	cache.set(key, digest.DigestStr())
+	return digest, nil
+}
+
+// attestationsCacheKey returns the key of the attestations cached for a digest
+func attestationsCacheKey(digest name.Digest) string {
+	return "attestations:" + digest.Name()
+}
+
+// attestationPayload is a DSSE envelope attached to an image and
+// the identity that signed it, empty if it was not verified
+type attestationPayload struct {
+	cosign.AttestationPayload
+	Signer string
+}
+
+// fetchAttestationPayloads returns the DSSE envelopes attached to an image.
+// Unless the options allow insecure reads, only attestations whose signatures
+// pass verification are returned. Unverified results are cached by image
+// digest when the registry cache is enabled.
+func fetchAttestationPayloads(
+	ctx context.Context, opts Options, refString string,
+) ([]attestationPayload, error) {
+	ref, err := parseReference(opts, refString)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := resolveDigest(ctx, opts, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verified attestations are not cached, the signatures
+	// are checked every time the image is read
+	if !opts.Verification.Insecure {
+		if err := opts.Verification.Validate(); err != nil {
+			return nil, err
+		}
+		return fetchVerifiedAttestationPayloads(ctx, opts, digest)
+	}
+	logrus.WithField("image", digest.String()).Warn("Reading image attestations without verifying their signatures")
+
+	cache := newRegistryCache(opts)
+	payloads := []cosign.AttestationPayload{}
+	if cache.get(attestationsCacheKey(digest), &payloads) {
+		return unverifiedPayloads(payloads), nil
+	}
+
+	remoteOpts, err := remoteOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := withRetry(ctx, opts, "fetching attestations", func() (err error) {
+		payloads, err = cosign.FetchAttestationsForReference(ctx, digest, remoteOpts...)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("fetching attached attestations: %w", err)
+	}
+	cache.set(attestationsCacheKey(digest), payloads)
+	return unverifiedPayloads(payloads), nil
+}
+
+// unverifiedPayloads wraps envelopes whose signatures were not verified
+func unverifiedPayloads(payloads []cosign.AttestationPayload) []attestationPayload {
+	res := make([]attestationPayload, 0, len(payloads))
+	for _, p := range payloads {
+		res = append(res, attestationPayload{AttestationPayload: p})
+	}
+	return res
+}
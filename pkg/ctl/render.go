@@ -0,0 +1,143 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// statusLabels are the names of the VEX statuses shown to people
+var statusLabels = map[vex.Status]string{
+	vex.StatusNotAffected:        "Not affected",
+	vex.StatusAffected:           "Affected",
+	vex.StatusFixed:              "Fixed",
+	vex.StatusUnderInvestigation: "Under investigation",
+}
+
+// justificationProse explains the not_affected justifications in prose
+var justificationProse = map[vex.Justification]string{
+	vex.ComponentNotPresent:                         "The vulnerable component is not included in the product.",
+	vex.VulnerableCodeNotPresent:                    "The vulnerable code is not included in the product.",
+	vex.VulnerableCodeNotInExecutePath:              "The vulnerable code cannot be executed by the product.",
+	vex.VulnerableCodeCannotBeControlledByAdversary: "The vulnerable code cannot be controlled by an attacker.",
+	vex.InlineMitigationsAlreadyExist:               "The product already includes mitigations that prevent exploitation.",
+}
+
+// statusLabel returns the name of a status shown to people
+func statusLabel(s vex.Status) string {
+	if l, ok := statusLabels[s]; ok {
+		return l
+	}
+	return string(s)
+}
+
+// markdownCell escapes text for a markdown table cell
+func markdownCell(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "|", "\\|"), "\n", " ")
+}
+
+// statementGroup is a statement about a vulnerability and the
+// products it is the latest statement for
+type statementGroup struct {
+	statement vex.Statement
+	products  []string
+}
+
+// groupStatements groups the latest statements of each vulnerability by
+// disposition, so products sharing the same statement are listed together.
+// The statements must be sorted by vulnerability.
+func groupStatements(statements []ProductStatement) (vulns []string, groups map[string][]*statementGroup) {
+	groups = map[string][]*statementGroup{}
+	for i := range statements {
+		s := &statements[i].Statement
+		if len(vulns) == 0 || vulns[len(vulns)-1] != s.Vulnerability {
+			vulns = append(vulns, s.Vulnerability)
+		}
+		var group *statementGroup
+		for _, g := range groups[s.Vulnerability] {
+			if g.statement.Status == s.Status && g.statement.Justification == s.Justification &&
+				g.statement.ImpactStatement == s.ImpactStatement && g.statement.ActionStatement == s.ActionStatement &&
+				g.statement.StatusNotes == s.StatusNotes {
+				group = g
+				break
+			}
+		}
+		if group == nil {
+			group = &statementGroup{statement: *s}
+			groups[s.Vulnerability] = append(groups[s.Vulnerability], group)
+		}
+		group.products = append(group.products, statements[i].Product)
+	}
+	return vulns, groups
+}
+
+// WriteMarkdown writes a summary of the latest VEX statements for people,
+// suitable for release notes or advisories: a table with the status of
+// each vulnerability followed by a section explaining each of them.
+func WriteMarkdown(w io.Writer, title string, statements []ProductStatement) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "# %s\n\n", title)
+	if len(statements) == 0 {
+		fmt.Fprintln(out, "No vulnerabilities have been assessed.")
+		return out.Flush()
+	}
+
+	vulns, groups := groupStatements(statements)
+	fmt.Fprintln(out, "| Vulnerability | Status | Products |")
+	fmt.Fprintln(out, "| --- | --- | --- |")
+	for _, v := range vulns {
+		for _, g := range groups[v] {
+			fmt.Fprintf(out, "| [%s](#%s) | %s | %d |\n",
+				markdownCell(v), markdownAnchor(v), statusLabel(g.statement.Status), len(g.products))
+		}
+	}
+
+	for _, v := range vulns {
+		fmt.Fprintf(out, "\n## %s\n", v)
+		for _, g := range groups[v] {
+			s := &g.statement
+			fmt.Fprintf(out, "\n**%s**", statusLabel(s.Status))
+			if prose, ok := justificationProse[s.Justification]; ok {
+				fmt.Fprintf(out, ": %s", prose)
+			}
+			fmt.Fprint(out, "\n\n")
+			if s.ImpactStatement != "" {
+				fmt.Fprintf(out, "%s\n\n", s.ImpactStatement)
+			}
+			if s.ActionStatement != "" && s.ActionStatement != vex.NoActionStatementMsg {
+				fmt.Fprintf(out, "Recommended action: %s\n\n", s.ActionStatement)
+			}
+			if s.StatusNotes != "" {
+				fmt.Fprintf(out, "%s\n\n", s.StatusNotes)
+			}
+			fmt.Fprintln(out, "Products:")
+			fmt.Fprintln(out)
+			for _, p := range g.products {
+				fmt.Fprintf(out, "- `%s`\n", p)
+			}
+		}
+	}
+	return out.Flush()
+}
+
+// markdownAnchor returns the anchor rendered for a heading
+func markdownAnchor(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
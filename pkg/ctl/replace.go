@@ -0,0 +1,99 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openvex/go-vex/pkg/vex"
+	"github.com/sigstore/cosign/pkg/oci"
+	"github.com/sigstore/cosign/pkg/oci/empty"
+	"github.com/sigstore/cosign/pkg/oci/mutate"
+)
+
+// AnnotationSupersedes records in a VEX attestation the digests of the
+// attestations it replaced on the image
+const AnnotationSupersedes = "dev.openvex.supersedes"
+
+// WithReplaceAttestations makes the attestations attached by the client
+// replace the VEX attestations already attached to the images. The digests
+// of the replaced attestations are recorded in the new one.
+func WithReplaceAttestations(replace bool) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.ReplaceAttestations = replace
+	}
+}
+
+// vexAttestationDigests returns the digests of the VEX
+// attestations attached to a signed entity
+func vexAttestationDigests(se oci.SignedEntity) ([]string, error) {
+	atts, err := se.Attestations()
+	if err != nil {
+		return nil, fmt.Errorf("reading attestations: %w", err)
+	}
+	current, err := atts.Get()
+	if err != nil {
+		return nil, fmt.Errorf("reading attestations: %w", err)
+	}
+	selector := DetachOptions{PredicateTypes: []string{vex.TypeURI}}
+	digests := []string{}
+	for _, att := range current {
+		match, err := selector.matches(att)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			continue
+		}
+		d, err := att.Digest()
+		if err != nil {
+			return nil, fmt.Errorf("reading attestation digest: %w", err)
+		}
+		digests = append(digests, d.String())
+	}
+	return digests, nil
+}
+
+// supersedeAnnotations returns the annotations of a new attestation with
+// the digests of the attestations it supersedes
+func supersedeAnnotations(annotations map[string]string, superseded []string) map[string]string {
+	if len(superseded) == 0 {
+		return annotations
+	}
+	res := map[string]string{}
+	for k, v := range annotations {
+		res[k] = v
+	}
+	res[AnnotationSupersedes] = strings.Join(superseded, ",")
+	return res
+}
+
+// supersedeOp is the cosign replace operation dropping the
+// superseded attestations when attaching a new one
+type supersedeOp struct {
+	superseded DetachOptions
+}
+
+// Replace returns the attestations of the image without the
+// superseded ones, plus the new attestation
+func (so *supersedeOp) Replace(atts oci.Signatures, att oci.Signature) (oci.Signatures, error) {
+	current, err := atts.Get()
+	if err != nil {
+		return nil, fmt.Errorf("reading attestations: %w", err)
+	}
+	keep := []oci.Signature{}
+	for _, a := range current {
+		match, err := so.superseded.matches(a)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			keep = append(keep, a)
+		}
+	}
+	return mutate.AppendSignatures(empty.Signatures(), append(keep, att)...)
+}
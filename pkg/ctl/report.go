@@ -0,0 +1,169 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+
+	"github.com/openvex/vexctl/pkg/formats"
+	"github.com/openvex/vexctl/pkg/formats/snykjson"
+	"github.com/openvex/vexctl/pkg/formats/trivyjson"
+)
+
+// Scanner report formats recognized by vexctl
+const (
+	ReportFormatSARIF = "sarif"
+	ReportFormatGrype = "grype"
+	ReportFormatTrivy = trivyjson.Name
+	ReportFormatSnyk  = snykjson.Name
+)
+
+// ReportFormat is a parser of scanner reports, see formats.Format
+type ReportFormat = formats.Format
+
+// RegisterReportFormat adds a scanner report format.
+//
+// Deprecated: use formats.Register.
+func RegisterReportFormat(f ReportFormat) {
+	formats.Register(f)
+}
+
+// builtinReportFormats are the formats parsed by the subpackages of
+// formats, detected after the registered ones
+var builtinReportFormats = []formats.Format{trivyjson.Format{}, snykjson.Format{}}
+
+// reportFormat returns the registered or built-in format with a name
+func reportFormat(name string) formats.Format {
+	if f := formats.Lookup(name); f != nil {
+		return f
+	}
+	for _, f := range builtinReportFormats {
+		if f.Name() == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// DetectReportFormat returns the format of the scanner report in data
+func DetectReportFormat(data []byte) (string, error) {
+	for _, f := range append(formats.Registered(), builtinReportFormats...) {
+		if f.Detect(data) {
+			return f.Name(), nil
+		}
+	}
+
+	// Only snyk writes arrays of reports, when testing several projects
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return "", errors.New("unable to recognize the scanner report format")
+	}
+
+	probe := struct {
+		Runs       json.RawMessage `json:"runs"`
+		Version    string          `json:"version"`
+		Matches    json.RawMessage `json:"matches"`
+		Descriptor json.RawMessage `json:"descriptor"`
+	}{}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return "", fmt.Errorf("unable to parse report as JSON: %w", err)
+	}
+	switch {
+	case probe.Runs != nil && probe.Version != "":
+		return ReportFormatSARIF, nil
+	case probe.Matches != nil && probe.Descriptor != nil:
+		return ReportFormatGrype, nil
+	default:
+		return "", errors.New("unable to recognize the scanner report format")
+	}
+}
+
+// ParseReport parses the data of a scanner report, detecting its format.
+// Grype, trivy and snyk JSON reports and those of registered formats are
+// converted to SARIF so VEX data can be applied to them.
+func ParseReport(data []byte) (*sarif.Report, error) {
+	return parseReport(data, nil)
+}
+
+// ParseReportLenient parses a scanner report like ParseReport, skipping
+// the results that cannot be decoded and recording them in warnings
+func ParseReportLenient(data []byte, warnings *ParseWarnings) (*sarif.Report, error) {
+	return parseReport(data, warnings)
+}
+
+// parseReport parses a scanner report, in lenient mode when warnings is set
+func parseReport(data []byte, warnings *ParseWarnings) (*sarif.Report, error) {
+	format, err := DetectReportFormat(data)
+	if err != nil {
+		return nil, err
+	}
+	if f := reportFormat(format); f != nil {
+		var report *sarif.Report
+		if lf, ok := f.(formats.LenientFormat); ok && warnings != nil {
+			report, err = lf.ParseLenient(data, warnings)
+		} else {
+			report, err = f.Parse(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s report: %w", format, err)
+		}
+		return report, nil
+	}
+	switch format {
+	case ReportFormatSARIF:
+		if warnings != nil {
+			return parseSARIFLenient(data, warnings)
+		}
+		report := sarif.New()
+		if err := json.Unmarshal(data, report); err != nil {
+			return nil, fmt.Errorf("unmarshalling SARIF report: %w", err)
+		}
+		return report, nil
+	case ReportFormatGrype:
+		return parseGrypeReport(data, warnings)
+	default:
+		return nil, fmt.Errorf("unsupported report format %s", format)
+	}
+}
+
+// ReportImages returns the container images recorded as scanned in the
+// runs of a report. Scanners like trivy store the image name and its
+// repository digests in the run properties, digests are preferred when
+// available.
+func ReportImages(report *sarif.Report) []string {
+	images := []string{}
+	seen := map[string]struct{}{}
+	add := func(image string) {
+		if _, ok := seen[image]; ok || image == "" {
+			return
+		}
+		seen[image] = struct{}{}
+		images = append(images, image)
+	}
+	for _, run := range report.Runs {
+		if run.Properties == nil {
+			continue
+		}
+		found := false
+		if digests, ok := run.Properties["repoDigests"].([]interface{}); ok {
+			for _, d := range digests {
+				if ds, ok := d.(string); ok && strings.Contains(ds, "@sha256:") {
+					add(ds)
+					found = true
+				}
+			}
+		}
+		if name, ok := run.Properties["imageName"].(string); ok && !found {
+			add(name)
+		}
+	}
+	return images
+}
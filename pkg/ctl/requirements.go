@@ -0,0 +1,172 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// Requirements lists the fixed set of checks the VEX documents attested to
+// an image must pass to be trusted by an admission controller or a CI gate.
+// It is not a policy language, rules that need one are better written with
+// an engine like OPA on the verified documents. An empty field does not
+// restrict anything.
+type Requirements struct {
+	// Signers are the identities allowed to sign the attestations of the
+	// VEX data, as verified from their signature: the identity in the
+	// signing certificate or key:<reference> for attestations verified
+	// with a public key. The self-asserted author of the documents is not
+	// checked, anyone can write any name there.
+	Signers []string `yaml:"signers,omitempty"`
+
+	// MaxStatementAge is the maximum time since a statement, or its
+	// document if it has no timestamp of its own, was issued, eg 720h
+	MaxStatementAge time.Duration `yaml:"maxStatementAge,omitempty"`
+
+	// DisallowedJustifications are the not_affected justifications
+	// that are not accepted as proof of being unaffected
+	DisallowedJustifications []string `yaml:"disallowedJustifications,omitempty"`
+}
+
+// RequirementViolation is a requirement a VEX document fails
+type RequirementViolation struct {
+	Document      string `json:"document"`
+	Vulnerability string `json:"vulnerability,omitempty"`
+	Reason        string `json:"reason"`
+}
+
+// String returns a one line description of the violation
+func (v RequirementViolation) String() string {
+	if v.Vulnerability == "" {
+		return fmt.Sprintf("%s: %s", v.Document, v.Reason)
+	}
+	return fmt.Sprintf("%s: %s: %s", v.Document, v.Vulnerability, v.Reason)
+}
+
+// RequirementsResult is the outcome of checking VEX documents against
+// the requirements
+type RequirementsResult struct {
+	Passed     bool                   `json:"passed"`
+	Documents  int                    `json:"documents"`
+	Violations []RequirementViolation `json:"violations"`
+}
+
+// WriteJSON writes the result as indented JSON
+func (r *RequirementsResult) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("encoding requirements result: %w", err)
+	}
+	return nil
+}
+
+// LoadRequirements reads the requirements from a YAML or JSON file
+func LoadRequirements(path string) (*Requirements, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading requirements: %w", err)
+	}
+	// Unknown fields are rejected so that a misspelled
+	// requirement is not silently left unchecked
+	reqs := &Requirements{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(reqs); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing requirements: %w", err)
+	}
+	if reqs.MaxStatementAge < 0 {
+		return nil, fmt.Errorf("invalid maxStatementAge %s, must be positive", reqs.MaxStatementAge)
+	}
+	for _, j := range reqs.DisallowedJustifications {
+		if !vex.Justification(j).Valid() {
+			return nil, fmt.Errorf("invalid justification %q in requirements", j)
+		}
+	}
+	return reqs, nil
+}
+
+// Evaluate checks the VEX documents against the requirements at now and
+// returns every requirement they fail, so the reasons can be reported
+// all at once instead of one run at a time. signers holds the verified
+// identity that signed each document, empty if it was not verified.
+func (r *Requirements) Evaluate(docs []*vex.VEX, signers []string, now time.Time) *RequirementsResult {
+	res := &RequirementsResult{Documents: len(docs), Violations: []RequirementViolation{}}
+	allowed := map[string]struct{}{}
+	for _, s := range r.Signers {
+		allowed[s] = struct{}{}
+	}
+	disallowed := map[vex.Justification]struct{}{}
+	for _, j := range r.DisallowedJustifications {
+		disallowed[vex.Justification(j)] = struct{}{}
+	}
+
+	for i, doc := range docs {
+		if len(allowed) > 0 {
+			signer := ""
+			if i < len(signers) {
+				signer = signers[i]
+			}
+			if signer == "" {
+				res.Violations = append(res.Violations, RequirementViolation{
+					Document: doc.ID,
+					Reason:   "the signature of the document was not verified",
+				})
+			} else if _, ok := allowed[signer]; !ok {
+				res.Violations = append(res.Violations, RequirementViolation{
+					Document: doc.ID,
+					Reason:   fmt.Sprintf("signer %q is not allowed", signer),
+				})
+			}
+		}
+		for i := range doc.Statements {
+			s := &doc.Statements[i]
+			if _, ok := disallowed[s.Justification]; ok && s.Status == vex.StatusNotAffected {
+				res.Violations = append(res.Violations, RequirementViolation{
+					Document:      doc.ID,
+					Vulnerability: s.Vulnerability,
+					Reason:        fmt.Sprintf("justification %q is not allowed", s.Justification),
+				})
+			}
+			if r.MaxStatementAge == 0 {
+				continue
+			}
+			issued := s.Timestamp
+			if issued == nil {
+				issued = doc.Timestamp
+			}
+			switch {
+			case issued == nil:
+				res.Violations = append(res.Violations, RequirementViolation{
+					Document:      doc.ID,
+					Vulnerability: s.Vulnerability,
+					Reason:        "statement has no timestamp to check its age",
+				})
+			case now.Sub(*issued) > r.MaxStatementAge:
+				res.Violations = append(res.Violations, RequirementViolation{
+					Document:      doc.ID,
+					Vulnerability: s.Vulnerability,
+					Reason: fmt.Sprintf(
+						"statement issued on %s is older than %s",
+						issued.Format(time.RFC3339), r.MaxStatementAge,
+					),
+				})
+			}
+		}
+	}
+	res.Passed = len(res.Violations) == 0
+	return res
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRetryAttempts = 3
+	defaultRetryBackoff  = time.Second
+)
+
+// DefaultRetryStatusCodes are the HTTP status codes returned by registries
+// that are considered transient and retried by default
+var DefaultRetryStatusCodes = []int{429, 500, 502, 503, 504}
+
+// retryable returns true if err is a transient registry failure
+func retryable(err error, statusCodes []int) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		for _, code := range statusCodes {
+			if terr.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+// withRetry runs a registry operation retrying it with exponential
+// backoff when it fails with a transient error
+func withRetry(ctx context.Context, opts Options, operation string, fn func() error) error {
+	attempts := opts.RetryAttempts
+	if attempts <= 0 {
+		attempts = defaultRetryAttempts
+	}
+	backoff := opts.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	statusCodes := opts.RetryStatusCodes
+	if statusCodes == nil {
+		statusCodes = DefaultRetryStatusCodes
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= attempts || !retryable(err, statusCodes) {
+			return err
+		}
+		logrus.WithFields(logrus.Fields{
+			"operation": operation,
+			"attempt":   attempt,
+			"wait":      backoff,
+		}).Warnf("Transient registry error, retrying: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", operation, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Annotations recording the scan behind the VEX data of an attestation
+const (
+	AnnotationScannerName    = "dev.openvex.scanner.name"
+	AnnotationScannerVersion = "dev.openvex.scanner.version"
+	AnnotationScannerDBTime  = "dev.openvex.scanner.db-timestamp"
+	AnnotationReportDigest   = "dev.openvex.scanner.report-digest"
+)
+
+// ScanContext describes the scan that produced the results
+// assessed in a VEX document
+type ScanContext struct {
+	Scanner        string     // Name of the scanner
+	ScannerVersion string     // Version of the scanner
+	DBTimestamp    *time.Time // Time the vulnerability database was built
+	ReportDigest   string     // Digest of the scanner report, as sha256:hex
+}
+
+// ScanContextFromReport reads the scanner details recorded in a report.
+// SARIF reports record the scanner name and version, grype JSON reports
+// also record when their vulnerability database was built.
+func ScanContextFromReport(data []byte) (*ScanContext, error) {
+	format, err := DetectReportFormat(data)
+	if err != nil {
+		return nil, err
+	}
+	sc := &ScanContext{ReportDigest: fmt.Sprintf("sha256:%x", sha256.Sum256(data))}
+	switch format {
+	case ReportFormatGrype:
+		probe := struct {
+			Descriptor struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+				DB      struct {
+					Built *time.Time `json:"built"`
+				} `json:"db"`
+			} `json:"descriptor"`
+		}{}
+		if err := json.Unmarshal(data, &probe); err != nil {
+			return nil, fmt.Errorf("unmarshalling grype report: %w", err)
+		}
+		sc.Scanner = probe.Descriptor.Name
+		sc.ScannerVersion = probe.Descriptor.Version
+		sc.DBTimestamp = probe.Descriptor.DB.Built
+	case ReportFormatTrivy:
+		sc.Scanner = "Trivy"
+	default:
+		// SARIF reports and those of registered formats, converted to SARIF
+		report, err := ParseReport(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(report.Runs) > 0 && report.Runs[0].Tool.Driver != nil {
+			sc.Scanner = report.Runs[0].Tool.Driver.Name
+			if v := report.Runs[0].Tool.Driver.Version; v != nil {
+				sc.ScannerVersion = *v
+			}
+		}
+	}
+	return sc, nil
+}
+
+// WithScanContext records the scan behind the VEX data in the
+// annotations of the attestations generated by the client
+func WithScanContext(sc *ScanContext) OptionFunc {
+	return func(vexctl *VexCtl) {
+		vexctl.Options.ScanContext = sc
+	}
+}
+
+// Annotations returns the scan context as attestation annotations,
+// leaving out the unknown details
+func (sc *ScanContext) Annotations() map[string]string {
+	ann := map[string]string{}
+	if sc.Scanner != "" {
+		ann[AnnotationScannerName] = sc.Scanner
+	}
+	if sc.ScannerVersion != "" {
+		ann[AnnotationScannerVersion] = sc.ScannerVersion
+	}
+	if sc.DBTimestamp != nil {
+		ann[AnnotationScannerDBTime] = sc.DBTimestamp.UTC().Format(time.RFC3339)
+	}
+	if sc.ReportDigest != "" {
+		ann[AnnotationReportDigest] = sc.ReportDigest
+	}
+	return ann
+}
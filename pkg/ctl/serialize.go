@@ -0,0 +1,82 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// Serializations of the documents written by vexctl
+const (
+	OutputFormatJSON = "json"
+	OutputFormatYAML = "yaml"
+)
+
+// OutputFormats are the serializations documents can be written in
+var OutputFormats = []string{OutputFormatJSON, OutputFormatYAML}
+
+// SerializeOptions control how SerializeDocument writes a VEX document
+type SerializeOptions struct {
+	Format  string // Output format, defaults to JSON
+	Compact bool   // Write JSON in a single line instead of indented
+}
+
+// SerializeDocument writes a VEX document in the output format. YAML is
+// always written in block style, with the fields in the same order as in
+// the JSON representation.
+func SerializeDocument(w io.Writer, doc *vex.VEX, opts SerializeOptions) error {
+	switch opts.Format {
+	case OutputFormatJSON, "":
+		if !opts.Compact {
+			return doc.ToJSON(w)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(doc); err != nil {
+			return fmt.Errorf("encoding vex document: %w", err)
+		}
+		return nil
+	case OutputFormatYAML:
+		data, err := marshalYAML(doc)
+		if err != nil {
+			return fmt.Errorf("encoding vex document: %w", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("writing vex document: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q", opts.Format)
+	}
+}
+
+// marshalYAML returns the YAML representation of the JSON
+// serialization of v, so the field names and order are the same
+func marshalYAML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling to JSON: %w", err)
+	}
+	node := &yaml.Node{}
+	if err := yaml.Unmarshal(data, node); err != nil {
+		return nil, fmt.Errorf("converting to YAML: %w", err)
+	}
+	blockStyle(node)
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, fmt.Errorf("encoding YAML: %w", err)
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// ShowOptions control how WriteDocument renders a VEX document
+type ShowOptions struct {
+	Color bool      // Color the statuses with ANSI escape codes
+	Now   time.Time // Time relative timestamps are computed from, defaults to now
+
+	// References are the resolved documents referenced by the statements,
+	// rendered below them when set
+	References map[string]*Reference
+}
+
+// statusColors are the ANSI colors used to render each status
+var statusColors = map[vex.Status]string{
+	vex.StatusNotAffected:        "\033[32m",
+	vex.StatusFixed:              "\033[36m",
+	vex.StatusAffected:           "\033[31m",
+	vex.StatusUnderInvestigation: "\033[33m",
+}
+
+// noProduct groups the statements that don't list any product
+const noProduct = "(no product)"
+
+// WriteDocument renders a VEX document in human readable form, with its
+// statements grouped by product and timestamps relative to now
+func WriteDocument(w io.Writer, doc *vex.VEX, opts ShowOptions) error {
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	status := func(s vex.Status) string {
+		if c, ok := statusColors[s]; ok && opts.Color {
+			return c + string(s) + "\033[0m"
+		}
+		return string(s)
+	}
+	when := func(t *time.Time) string {
+		if t == nil {
+			return "unknown"
+		}
+		return fmt.Sprintf("%s (%s)", t.Format(time.RFC3339), relativeTime(*t, opts.Now))
+	}
+
+	var sb strings.Builder
+	id := doc.ID
+	if id == "" {
+		id = "(no id)"
+	}
+	fmt.Fprintf(&sb, "Document:   %s\n", id)
+	if doc.Author != "" {
+		author := doc.Author
+		if doc.AuthorRole != "" {
+			author += " (" + doc.AuthorRole + ")"
+		}
+		fmt.Fprintf(&sb, "Author:     %s\n", author)
+	}
+	fmt.Fprintf(&sb, "Issued:     %s\n", when(doc.Timestamp))
+	if doc.Version != "" {
+		fmt.Fprintf(&sb, "Version:    %s\n", doc.Version)
+	}
+	fmt.Fprintf(&sb, "Statements: %d\n", len(doc.Statements))
+
+	byProduct := map[string][]*vex.Statement{}
+	for i := range doc.Statements {
+		s := &doc.Statements[i]
+		products := s.Products
+		if len(products) == 0 {
+			products = []string{noProduct}
+		}
+		for _, p := range products {
+			byProduct[p] = append(byProduct[p], s)
+		}
+	}
+	products := make([]string, 0, len(byProduct))
+	for p := range byProduct {
+		products = append(products, p)
+	}
+	sort.Strings(products)
+
+	for _, p := range products {
+		statements := byProduct[p]
+		sort.SliceStable(statements, func(i, j int) bool {
+			return statements[i].Vulnerability < statements[j].Vulnerability
+		})
+		fmt.Fprintf(&sb, "\n%s\n", p)
+		for i, s := range statements {
+			branch, indent := "├─", "│ "
+			if i == len(statements)-1 {
+				branch, indent = "└─", "  "
+			}
+			fmt.Fprintf(&sb, "  %s %s  %s", branch, s.Vulnerability, status(s.Status))
+			if s.Justification != "" {
+				fmt.Fprintf(&sb, "  %s", s.Justification)
+			}
+			if s.Timestamp != nil {
+				fmt.Fprintf(&sb, "  (%s)", relativeTime(*s.Timestamp, opts.Now))
+			}
+			sb.WriteString("\n")
+			if len(s.Subcomponents) > 0 {
+				fmt.Fprintf(&sb, "  %s   subcomponents: %s\n", indent, strings.Join(s.Subcomponents, ", "))
+			}
+			if s.ImpactStatement != "" {
+				fmt.Fprintf(&sb, "  %s   impact: %s\n", indent, s.ImpactStatement)
+			}
+			if s.ActionStatement != "" {
+				fmt.Fprintf(&sb, "  %s   action: %s\n", indent, s.ActionStatement)
+			}
+			if s.StatusNotes != "" {
+				fmt.Fprintf(&sb, "  %s   notes: %s\n", indent, s.StatusNotes)
+			}
+			if opts.References != nil {
+				for _, u := range StatementReferences(s) {
+					ref, ok := opts.References[u]
+					if !ok {
+						continue
+					}
+					fmt.Fprintf(&sb, "  %s   ref: %s\n", indent, u)
+					if ref.Error != "" {
+						fmt.Fprintf(&sb, "  %s     (unresolved: %s)\n", indent, ref.Error)
+					}
+					for _, line := range ref.Summary {
+						fmt.Fprintf(&sb, "  %s     %s\n", indent, line)
+					}
+				}
+			}
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// relativeTime describes the time elapsed between t and now, eg 3 days ago
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	suffix := "ago"
+	if d < 0 {
+		d = -d
+		suffix = "from now"
+	}
+	var n int
+	var unit string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		n, unit = int(d/time.Minute), "minute"
+	case d < 24*time.Hour:
+		n, unit = int(d/time.Hour), "hour"
+	case d < 30*24*time.Hour:
+		n, unit = int(d/(24*time.Hour)), "day"
+	case d < 365*24*time.Hour:
+		n, unit = int(d/(30*24*time.Hour)), "month"
+	default:
+		n, unit = int(d/(365*24*time.Hour)), "year"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s %s", n, unit, suffix)
+}
@@ -0,0 +1,339 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"sigs.k8s.io/release-utils/util"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// Source is a provider of VEX documents. vexctl ships with sources to read
+// VEX data from files, directories, git repositories, HTTP servers and
+// image attestations.
+// Programs embedding vexctl can add their own with RegisterSource.
+type Source interface {
+	// Name returns a short identifier of the source type (eg file, image)
+	Name() string
+
+	// Handles returns true if the source can read VEX data from uri
+	Handles(uri string) bool
+
+	// Read returns the VEX documents found at uri
+	Read(ctx context.Context, opts Options, uri string) ([]*vex.VEX, error)
+}
+
+var (
+	sourcesMutex      sync.RWMutex
+	registeredSources = []Source{}
+)
+
+// RegisterSource adds a new VEX source provider. Registered sources take
+// precedence over the built-in ones, in the order they were registered.
+func RegisterSource(s Source) {
+	sourcesMutex.Lock()
+	defer sourcesMutex.Unlock()
+	registeredSources = append(registeredSources, s)
+}
+
+// Sources returns the source providers known to the client, in the
+// order they are tried when resolving a URI
+func (vexctl *VexCtl) Sources() []Source {
+	sourcesMutex.RLock()
+	defer sourcesMutex.RUnlock()
+	sources := make([]Source, 0, len(registeredSources)+5)
+	sources = append(sources, registeredSources...)
+	return append(sources,
+		&dirSource{impl: vexctl.impl},
+		&fileSource{impl: vexctl.impl},
+		&gitSource{impl: vexctl.impl},
+		&httpSource{impl: vexctl.impl},
+		&imageSource{impl: vexctl.impl},
+	)
+}
+
+// ResolveSource returns the provider that will read VEX data from uri
+func (vexctl *VexCtl) ResolveSource(uri string) (Source, error) {
+	for _, s := range vexctl.Sources() {
+		if s.Handles(uri) {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to resolve the vex source location of %s", uri)
+}
+
+// SourceType returns the name of the provider that handles uri
+func (vexctl *VexCtl) SourceType(uri string) (string, error) {
+	s, err := vexctl.ResolveSource(uri)
+	if err != nil {
+		return "", err
+	}
+	return s.Name(), nil
+}
+
+// fileSource reads VEX documents from the local filesystem. Paths can be
+// pinned to the digest of the file, eg doc.vex.json@sha256:abc...
+type fileSource struct {
+	impl Implementation
+}
+
+func (fs *fileSource) Name() string { return "file" }
+
+func (fs *fileSource) Handles(uri string) bool {
+	if util.Exists(uri) {
+		return true
+	}
+	path, pin := splitPinnedURI(uri)
+	if pin == nil {
+		return false
+	}
+	// Pinned paths to missing files are handled here too, so that
+	// they fail as such instead of being looked up in a registry
+	info, err := os.Stat(path)
+	if err != nil {
+		return looksLikeFilePath(path)
+	}
+	return !info.IsDir()
+}
+
+func (fs *fileSource) Read(ctx context.Context, opts Options, uri string) ([]*vex.VEX, error) {
+	path, pin := uri, (*sourcePin)(nil)
+	if !util.Exists(uri) {
+		path, pin = splitPinnedURI(uri)
+	}
+	if pin != nil {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("VEX file not found: %s", path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("opening VEX file: %w", err)
+		}
+		defer f.Close()
+		h := pin.hash()
+		if _, err := io.Copy(h, f); err != nil {
+			return nil, fmt.Errorf("hashing VEX file: %w", err)
+		}
+		if err := pin.check(path, h); err != nil {
+			return nil, err
+		}
+	}
+	return fs.impl.OpenVexData(ctx, opts, []string{path})
+}
+
+// dirSourceExtensions are the extensions of the files read from directories
+var dirSourceExtensions = []string{".json", ".yaml", ".yml"}
+
+// dirSource reads all the VEX documents in a local directory. Only the
+// files directly in the directory are read, subdirectories are ignored.
+type dirSource struct {
+	impl Implementation
+}
+
+func (ds *dirSource) Name() string { return "directory" }
+
+func (ds *dirSource) Handles(uri string) bool {
+	info, err := os.Stat(uri)
+	return err == nil && info.IsDir()
+}
+
+func (ds *dirSource) Read(ctx context.Context, opts Options, uri string) ([]*vex.VEX, error) {
+	paths, err := dirDocuments(uri)
+	if err != nil {
+		return nil, err
+	}
+	return ds.impl.OpenVexData(ctx, opts, paths)
+}
+
+// dirDocuments returns the paths of the VEX documents directly in a
+// directory, sorted by name. Hidden files are skipped.
+func dirDocuments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory: %w", err)
+	}
+	paths := []string{}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		// Compressed documents are matched by their inner extension
+		fileName := strings.TrimSuffix(strings.TrimSuffix(e.Name(), ".gz"), ".zst")
+		for _, ext := range dirSourceExtensions {
+			if strings.HasSuffix(fileName, ext) {
+				paths = append(paths, filepath.Join(dir, e.Name()))
+				break
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no VEX documents found in directory %s", dir)
+	}
+	return paths, nil
+}
+
+// httpSource downloads VEX documents from an HTTP(S) URL. URLs can be
+// pinned to the digest of the document, eg https://.../doc.json@sha256:abc...
+type httpSource struct {
+	impl Implementation
+}
+
+func (hs *httpSource) Name() string { return "http" }
+
+func (hs *httpSource) Handles(uri string) bool {
+	return strings.HasPrefix(uri, "https://") || strings.HasPrefix(uri, "http://")
+}
+
+func (hs *httpSource) Read(ctx context.Context, opts Options, uri string) ([]*vex.VEX, error) {
+	uri, pin := splitPinnedURI(uri)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	client, err := httpClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading VEX data: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading VEX data: HTTP %s", resp.Status)
+	}
+
+	tmp, err := os.CreateTemp("", "vex-*.json")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var w io.Writer = tmp
+	var h hash.Hash
+	if pin != nil {
+		h = pin.hash()
+		w = io.MultiWriter(tmp, h)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return nil, fmt.Errorf("writing VEX data to disk: %w", err)
+	}
+	if pin != nil {
+		if err := pin.check(uri, h); err != nil {
+			return nil, err
+		}
+	}
+	return hs.impl.OpenVexData(ctx, opts, []string{tmp.Name()})
+}
+
+// gitSource reads a VEX document from a git repository. URIs are expected
+// in the form git+https://github.com/org/repo.git#path/to/doc.vex.json
+type gitSource struct {
+	impl Implementation
+}
+
+func (gs *gitSource) Name() string { return "git" }
+
+func (gs *gitSource) Handles(uri string) bool {
+	return strings.HasPrefix(uri, "git+")
+}
+
+func (gs *gitSource) Read(ctx context.Context, opts Options, uri string) ([]*vex.VEX, error) {
+	repo, path, ok := strings.Cut(strings.TrimPrefix(uri, "git+"), "#")
+	if !ok || path == "" {
+		return nil, errors.New("git sources must specify the document path after a #")
+	}
+	// A repository starting with a dash would be parsed by git as an option
+	if repo == "" || strings.HasPrefix(repo, "-") {
+		return nil, fmt.Errorf("invalid git repository %q", repo)
+	}
+
+	dir, err := os.MkdirTemp("", "vex-git-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	//nolint:gosec // the repository can't start with a dash and follows --
+	cmd := exec.CommandContext(ctx, "git", "clone", "--quiet", "--depth=1", "--", repo, dir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("cloning %s: %w: %s", repo, err, strings.TrimSpace(string(out)))
+	}
+
+	docPath, err := clonedPath(dir, path)
+	if err != nil {
+		return nil, err
+	}
+	return gs.impl.OpenVexData(ctx, opts, []string{docPath})
+}
+
+// clonedPath returns the location of a document in a cloned repository.
+// Paths leaving the clone, directly or through symbolic links, are
+// rejected so that a source can't read arbitrary files.
+func clonedPath(dir, path string) (string, error) {
+	docPath := filepath.Join(dir, filepath.FromSlash(path))
+	if !withinDir(dir, docPath) {
+		return "", fmt.Errorf("document path %s is outside of the repository", path)
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("resolving repository directory: %w", err)
+	}
+	realPath, err := filepath.EvalSymlinks(docPath)
+	if err != nil {
+		return "", fmt.Errorf("reading %s from the repository: %w", path, err)
+	}
+	if !withinDir(realDir, realPath) {
+		return "", fmt.Errorf("document path %s is outside of the repository", path)
+	}
+	return realPath, nil
+}
+
+// withinDir returns true if path is dir or is under it
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// imageSource reads VEX documents from the attestations of a container image
+type imageSource struct {
+	impl Implementation
+}
+
+func (is *imageSource) Name() string { return "image" }
+
+func (is *imageSource) Handles(uri string) bool {
+	_, err := name.ParseReference(uri)
+	return err == nil
+}
+
+func (is *imageSource) Read(ctx context.Context, opts Options, uri string) ([]*vex.VEX, error) {
+	vexes, err := is.impl.ReadImageAttestations(ctx, opts, uri)
+	if err != nil {
+		return nil, err
+	}
+	if len(vexes) == 0 {
+		return nil, errors.New("no attestations found in image")
+	}
+	return vexes, nil
+}
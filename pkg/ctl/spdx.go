@@ -0,0 +1,229 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// SPDX 3.0 document constants
+const (
+	spdx3Context     = "https://spdx.org/rdf/3.0.1/spdx-context.jsonld"
+	spdx3Version     = "3.0.1"
+	spdx3CreationID  = "_:creationinfo"
+	spdx3TimeLayout  = "2006-01-02T15:04:05Z"
+	spdx3IDNamespace = "https://openvex.dev/docs/public/spdx-"
+)
+
+// spdx3Relationships are the relationship class and type of the VEX
+// assessments of SPDX 3.0 for each status
+var spdx3Relationships = map[vex.Status][2]string{
+	vex.StatusNotAffected:        {"security_VexNotAffectedVulnAssessmentRelationship", "doesNotAffect"},
+	vex.StatusAffected:           {"security_VexAffectedVulnAssessmentRelationship", "affects"},
+	vex.StatusFixed:              {"security_VexFixedVulnAssessmentRelationship", "fixedIn"},
+	vex.StatusUnderInvestigation: {"security_VexUnderInvestigationVulnAssessmentRelationship", "underInvestigationFor"},
+}
+
+// spdx3Justifications maps the OpenVEX justifications
+// to the justification types of SPDX 3.0
+var spdx3Justifications = map[vex.Justification]string{
+	vex.ComponentNotPresent:                         "componentNotPresent",
+	vex.VulnerableCodeNotPresent:                    "vulnerableCodeNotPresent",
+	vex.VulnerableCodeNotInExecutePath:              "vulnerableCodeNotInExecutePath",
+	vex.VulnerableCodeCannotBeControlledByAdversary: "vulnerableCodeCannotBeControlledByAdversary",
+	vex.InlineMitigationsAlreadyExist:               "inlineMitigationsAlreadyExist",
+}
+
+// SPDX3Options control the document written by WriteSPDX3
+type SPDX3Options struct {
+	Author  string    // Organization recorded as the creator of the document
+	Created time.Time // Creation time of the document, defaults to now
+}
+
+// spdx3Element is an element of the @graph of an SPDX 3.0 JSON-LD document
+type spdx3Element map[string]interface{}
+
+// WriteSPDX3 writes the statements as an SPDX 3.0 JSON-LD document using
+// the VEX assessment relationships of its security profile. Each statement
+// relates the vulnerability to its product, a package identified by its
+// package URL or CPE. The element IDs are derived from the statements, so
+// exporting the same statements produces the same IDs.
+func WriteSPDX3(w io.Writer, statements []ProductStatement, opts SPDX3Options) error {
+	if opts.Created.IsZero() {
+		opts.Created = time.Now()
+	}
+	if opts.Author == "" {
+		opts.Author = vex.DefaultAuthor
+	}
+
+	h := sha256.New()
+	for i := range statements {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\n", statements[i].Statement.Vulnerability, statements[i].Product, statements[i].Statement.Status)
+	}
+	ns := fmt.Sprintf("%s%x#", spdx3IDNamespace, h.Sum(nil)[:16])
+	timestamp := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(spdx3TimeLayout)
+	}
+
+	agentID := ns + "author"
+	graph := []spdx3Element{
+		{
+			"type":        "CreationInfo",
+			"@id":         spdx3CreationID,
+			"specVersion": spdx3Version,
+			"created":     timestamp(&opts.Created),
+			"createdBy":   []string{agentID},
+		},
+		{
+			"type":         "Organization",
+			"spdxId":       agentID,
+			"creationInfo": spdx3CreationID,
+			"name":         opts.Author,
+		},
+	}
+
+	elements := []string{}
+	vulns := map[string]string{}
+	products := map[string]string{}
+	for i := range statements {
+		s := &statements[i].Statement
+		rel, ok := spdx3Relationships[s.Status]
+		if !ok {
+			return fmt.Errorf("statement about %s has an invalid status %q", s.Vulnerability, s.Status)
+		}
+
+		vulnID, ok := vulns[s.Vulnerability]
+		if !ok {
+			vulnID = fmt.Sprintf("%svulnerability-%d", ns, len(vulns)+1)
+			vulns[s.Vulnerability] = vulnID
+			graph = append(graph, spdx3Vulnerability(vulnID, s.Vulnerability))
+			elements = append(elements, vulnID)
+		}
+		productID, ok := products[statements[i].Product]
+		if !ok {
+			productID = fmt.Sprintf("%spackage-%d", ns, len(products)+1)
+			products[statements[i].Product] = productID
+			graph = append(graph, spdx3Package(productID, statements[i].Product))
+			elements = append(elements, productID)
+		}
+
+		a := spdx3Element{
+			"type":             rel[0],
+			"spdxId":           fmt.Sprintf("%svex-%d", ns, i+1),
+			"creationInfo":     spdx3CreationID,
+			"relationshipType": rel[1],
+			"from":             vulnID,
+			"to":               []string{productID},
+		}
+		if t := timestamp(s.Timestamp); t != "" {
+			a["security_publishedTime"] = t
+		}
+		if s.StatusNotes != "" {
+			a["security_statusNotes"] = s.StatusNotes
+		}
+		switch s.Status {
+		case vex.StatusNotAffected:
+			if j, ok := spdx3Justifications[s.Justification]; ok {
+				a["security_justificationType"] = j
+			}
+			if s.ImpactStatement != "" {
+				a["security_impactStatement"] = s.ImpactStatement
+			}
+		case vex.StatusAffected:
+			if s.ActionStatement != "" {
+				a["security_actionStatement"] = s.ActionStatement
+			}
+		}
+		graph = append(graph, a)
+		elements = append(elements, a["spdxId"].(string))
+	}
+
+	graph = append(graph, spdx3Element{
+		"type":         "SpdxDocument",
+		"spdxId":       ns + "document",
+		"creationInfo": spdx3CreationID,
+		"dataLicense":  "https://spdx.org/licenses/CC0-1.0",
+		"profileConformance": []string{
+			"core", "software", "security",
+		},
+		"element":     elements,
+		"rootElement": elements,
+	})
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(map[string]interface{}{
+		"@context": spdx3Context,
+		"@graph":   graph,
+	}); err != nil {
+		return fmt.Errorf("encoding SPDX document: %w", err)
+	}
+	return nil
+}
+
+// spdx3Vulnerability returns the element of a vulnerability, with
+// its ID recorded as a CVE or as an identifier of another system
+func spdx3Vulnerability(spdxID, id string) spdx3Element {
+	idType := "securityOther"
+	if strings.HasPrefix(id, "CVE-") {
+		idType = "cve"
+	}
+	return spdx3Element{
+		"type":         "security_Vulnerability",
+		"spdxId":       spdxID,
+		"creationInfo": spdx3CreationID,
+		"name":         id,
+		"externalIdentifier": []spdx3Element{{
+			"type":                   "ExternalIdentifier",
+			"externalIdentifierType": idType,
+			"identifier":             id,
+		}},
+	}
+}
+
+// spdx3Package returns the package element of a product, identified
+// by its package URL or CPE when the product is one
+func spdx3Package(spdxID, product string) spdx3Element {
+	e := spdx3Element{
+		"type":         "software_Package",
+		"spdxId":       spdxID,
+		"creationInfo": spdx3CreationID,
+		"name":         product,
+	}
+	if p, ok := parsePackageURL(product); ok {
+		e["name"] = p.Name
+		// Version ranges are not valid package URL versions
+		if !strings.HasPrefix(p.Version, versPrefix) {
+			if p.Version != "" {
+				e["software_packageVersion"] = p.Version
+			}
+			e["software_packageUrl"] = product
+		}
+	} else if attrs, ok := parseCPE(product); ok {
+		e["name"] = attrs[2]
+		idType := "cpe23"
+		if strings.HasPrefix(product, "cpe:/") {
+			idType = "cpe22"
+		}
+		e["externalIdentifier"] = []spdx3Element{{
+			"type":                   "ExternalIdentifier",
+			"externalIdentifierType": idType,
+			"identifier":             product,
+		}}
+	}
+	return e
+}
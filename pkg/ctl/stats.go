@@ -0,0 +1,148 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// ageBuckets are the ranges used to report the age of the statements
+var ageBuckets = []struct {
+	Name string
+	Max  time.Duration
+}{
+	{"<7d", 7 * 24 * time.Hour},
+	{"7-30d", 30 * 24 * time.Hour},
+	{"30-90d", 90 * 24 * time.Hour},
+	{"90-365d", 365 * 24 * time.Hour},
+	{">1y", 0},
+}
+
+// ageUnknown counts the statements without a timestamp
+const ageUnknown = "unknown"
+
+// DocumentStats summarizes a set of VEX documents
+type DocumentStats struct {
+	Documents      int            `json:"documents"`
+	Statements     int            `json:"statements"`
+	Size           int            `json:"size"` // Size in bytes of the documents in JSON
+	Statuses       map[string]int `json:"statuses"`
+	Justifications map[string]int `json:"justifications"`
+	Products       map[string]int `json:"products"`
+	Authors        map[string]int `json:"authors"`
+	Ages           map[string]int `json:"ages"` // Statements by age, see ageBuckets
+}
+
+// Stats computes summary metrics of the statements in a set of documents.
+// The age of the statements is computed relative to now, statements without
+// a timestamp take the one of their document.
+func (vexctl *VexCtl) Stats(docs []*vex.VEX, now time.Time) (*DocumentStats, error) {
+	stats := &DocumentStats{
+		Documents:      len(docs),
+		Statuses:       map[string]int{},
+		Justifications: map[string]int{},
+		Products:       map[string]int{},
+		Authors:        map[string]int{},
+		Ages:           map[string]int{},
+	}
+	for _, doc := range docs {
+		var b bytes.Buffer
+		if err := doc.ToJSON(&b); err != nil {
+			return nil, fmt.Errorf("serializing document: %w", err)
+		}
+		stats.Size += b.Len()
+
+		author := doc.Author
+		if author == "" {
+			author = "(unknown)"
+		}
+		for i := range doc.Statements {
+			s := &doc.Statements[i]
+			stats.Statements++
+			stats.Authors[author]++
+			stats.Statuses[string(s.Status)]++
+			if s.Justification != "" {
+				stats.Justifications[string(s.Justification)]++
+			}
+			for _, p := range s.Products {
+				stats.Products[p]++
+			}
+
+			ts := s.Timestamp
+			if ts == nil {
+				ts = doc.Timestamp
+			}
+			stats.Ages[ageBucket(ts, now)]++
+		}
+	}
+	return stats, nil
+}
+
+// ageBucket returns the name of the age range a timestamp falls in
+func ageBucket(ts *time.Time, now time.Time) string {
+	if ts == nil {
+		return ageUnknown
+	}
+	age := now.Sub(*ts)
+	for _, b := range ageBuckets {
+		if b.Max == 0 || age < b.Max {
+			return b.Name
+		}
+	}
+	return ageUnknown
+}
+
+// Write prints the statistics in human readable form
+func (ds *DocumentStats) Write(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Documents:  %d\n", ds.Documents)
+	fmt.Fprintf(&sb, "Statements: %d\n", ds.Statements)
+	fmt.Fprintf(&sb, "Size:       %d bytes\n", ds.Size)
+
+	writeCounts := func(title string, counts map[string]int, order []string) {
+		fmt.Fprintf(&sb, "\n%s:\n", title)
+		if len(counts) == 0 {
+			sb.WriteString("  none\n")
+			return
+		}
+		if order == nil {
+			for k := range counts {
+				order = append(order, k)
+			}
+			sort.Slice(order, func(i, j int) bool {
+				if counts[order[i]] != counts[order[j]] {
+					return counts[order[i]] > counts[order[j]]
+				}
+				return order[i] < order[j]
+			})
+		}
+		for _, k := range order {
+			if n, ok := counts[k]; ok {
+				fmt.Fprintf(&sb, "  %-40s %d\n", k, n)
+			}
+		}
+	}
+
+	ages := []string{}
+	for _, b := range ageBuckets {
+		ages = append(ages, b.Name)
+	}
+	writeCounts("Statuses", ds.Statuses, nil)
+	writeCounts("Justifications", ds.Justifications, nil)
+	writeCounts("Products", ds.Products, nil)
+	writeCounts("Authors", ds.Authors, nil)
+	writeCounts("Statement age", ds.Ages, append(ages, ageUnknown))
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
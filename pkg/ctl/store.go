@@ -0,0 +1,241 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// storeIndexFile is the index of the documents in a store
+const storeIndexFile = "index.json"
+
+// Store is a local directory of VEX documents indexed by the products
+// of their statements, used as a personal or team VEX database
+type Store struct {
+	Dir string
+}
+
+// StoreEntry describes a document in the store
+type StoreEntry struct {
+	Key        string     `json:"key"` // Digest of the stored document
+	ID         string     `json:"id"`
+	Author     string     `json:"author,omitempty"`
+	Timestamp  *time.Time `json:"timestamp,omitempty"`
+	Source     string     `json:"source,omitempty"`
+	Added      time.Time  `json:"added"`
+	Statements int        `json:"statements"`
+	Products   []string   `json:"products"`
+}
+
+type storeIndex struct {
+	Documents []StoreEntry `json:"documents"`
+}
+
+// DefaultStoreDir returns the directory of the store when none is
+// configured: vexctl/store under $XDG_DATA_HOME or ~/.local/share
+func DefaultStoreDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "vexctl", "store"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("determining store directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", "vexctl", "store"), nil
+}
+
+// NewStore returns the store in dir, or in the default directory
+// if dir is empty. The directory is created when adding documents.
+func NewStore(dir string) (*Store, error) {
+	if dir == "" {
+		var err error
+		if dir, err = DefaultStoreDir(); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{Dir: dir}, nil
+}
+
+// Exists returns true if documents were ever added to the store
+func (s *Store) Exists() bool {
+	_, err := os.Stat(filepath.Join(s.Dir, storeIndexFile))
+	return err == nil
+}
+
+func (s *Store) documentPath(key string) string {
+	return filepath.Join(s.Dir, key+".vex.json")
+}
+
+func (s *Store) readIndex() (*storeIndex, error) {
+	index := &storeIndex{Documents: []StoreEntry{}}
+	data, err := os.ReadFile(filepath.Join(s.Dir, storeIndexFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return index, nil
+		}
+		return nil, fmt.Errorf("reading store index: %w", err)
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("parsing store index: %w", err)
+	}
+	return index, nil
+}
+
+func (s *Store) writeIndex(index *storeIndex) error {
+	sort.Slice(index.Documents, func(i, j int) bool {
+		return index.Documents[i].Key < index.Documents[j].Key
+	})
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling store index: %w", err)
+	}
+	// Write the index atomically so a failure doesn't lose the store
+	tmp := filepath.Join(s.Dir, storeIndexFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil { //nolint:gosec // VEX data is public
+		return fmt.Errorf("writing store index: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.Dir, storeIndexFile)); err != nil {
+		return fmt.Errorf("writing store index: %w", err)
+	}
+	return nil
+}
+
+// Add stores a document read from source. Adding a document already in
+// the store replaces its entry, it returns true if it was new.
+func (s *Store) Add(doc *vex.VEX, source string) (StoreEntry, bool, error) {
+	var b bytes.Buffer
+	if err := doc.ToJSON(&b); err != nil {
+		return StoreEntry{}, false, fmt.Errorf("serializing document: %w", err)
+	}
+	entry := StoreEntry{
+		Key:        fmt.Sprintf("%x", sha256.Sum256(b.Bytes())),
+		ID:         doc.ID,
+		Author:     doc.Author,
+		Timestamp:  doc.Timestamp,
+		Source:     source,
+		Added:      time.Now().UTC(),
+		Statements: len(doc.Statements),
+		Products:   []string{},
+	}
+	for i := range doc.Statements {
+		entry.Products = appendMissing(entry.Products, doc.Statements[i].Products...)
+	}
+	sort.Strings(entry.Products)
+
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return StoreEntry{}, false, fmt.Errorf("creating store directory: %w", err)
+	}
+	index, err := s.readIndex()
+	if err != nil {
+		return StoreEntry{}, false, err
+	}
+	if err := os.WriteFile(s.documentPath(entry.Key), b.Bytes(), 0o644); err != nil { //nolint:gosec // VEX data is public
+		return StoreEntry{}, false, fmt.Errorf("writing document: %w", err)
+	}
+
+	added := true
+	for i := range index.Documents {
+		if index.Documents[i].Key == entry.Key {
+			index.Documents[i] = entry
+			added = false
+		}
+	}
+	if added {
+		index.Documents = append(index.Documents, entry)
+	}
+	return entry, added, s.writeIndex(index)
+}
+
+// List returns the entries of the documents with statements about any
+// of the products, or all of them if no products are passed, sorted by
+// document ID
+func (s *Store) List(products []string) ([]StoreEntry, error) {
+	index, err := s.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	entries := []StoreEntry{}
+	for _, e := range index.Documents { //nolint:gocritic // entries are copied on purpose
+		if len(products) > 0 && !storeEntryMatches(&e, products) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+// storeEntryMatches returns true if a stored document has statements about any of the products
+func storeEntryMatches(e *StoreEntry, products []string) bool {
+	for _, p := range products {
+		if matchesAnyProduct(e.Products, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove deletes the documents with an ID or a key (or a prefix of at
+// least 8 characters of the key) from the store. It returns the
+// entries removed.
+func (s *Store) Remove(ids []string) ([]StoreEntry, error) {
+	index, err := s.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	removed := []StoreEntry{}
+	kept := []StoreEntry{}
+	for _, e := range index.Documents { //nolint:gocritic // entries are copied on purpose
+		match := false
+		for _, id := range ids {
+			if e.ID == id || e.Key == id || (len(id) >= 8 && strings.HasPrefix(e.Key, id)) {
+				match = true
+			}
+		}
+		if !match {
+			kept = append(kept, e)
+			continue
+		}
+		if err := os.Remove(s.documentPath(e.Key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("removing document: %w", err)
+		}
+		removed = append(removed, e)
+	}
+	if len(removed) == 0 {
+		return removed, nil
+	}
+	index.Documents = kept
+	return removed, s.writeIndex(index)
+}
+
+// Documents opens the stored documents with statements about any of the
+// products, or all of them if no products are passed
+func (s *Store) Documents(products []string) ([]*vex.VEX, error) {
+	entries, err := s.List(products)
+	if err != nil {
+		return nil, err
+	}
+	docs := []*vex.VEX{}
+	for i := range entries {
+		doc, err := vex.OpenJSON(s.documentPath(entries[i].Key))
+		if err != nil {
+			return nil, fmt.Errorf("opening stored document %s: %w", entries[i].Key, err)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// ApplyStream applies VEX documents to a SARIF report read from r, writing
+// the filtered report to w. Unlike Apply, the report is never loaded fully
+// in memory: results are decoded and written one at a time, bounding memory
+// use to the size of the largest single result. It returns the number of
+// results left in the report.
+func (vexctl *VexCtl) ApplyStream(ctx context.Context, r io.Reader, w io.Writer, vexDocs []*vex.VEX) (int, error) {
+	defer vexctl.Options.Metrics.Track(MetricsPhaseApply)()
+	vexDocs = vexctl.impl.Sort(vexctl.honoredDocuments(vexDocs))
+
+	bw := bufio.NewWriter(w)
+	s := &sarifStreamer{
+		ctx:      ctx,
+		dec:      json.NewDecoder(bufio.NewReader(r)),
+		w:        bw,
+		docs:     vexDocs,
+		products: vexctl.Options.Products,
+		warnings: vexctl.Options.ParseWarnings,
+	}
+	if err := s.streamReport(); err != nil {
+		return 0, fmt.Errorf("streaming report: %w", err)
+	}
+	if _, err := bw.WriteString("\n"); err != nil {
+		return 0, fmt.Errorf("writing report: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, fmt.Errorf("writing report: %w", err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"results":    s.total,
+		"suppressed": s.suppressed,
+	}).Info("Streamed VEX data to report")
+	return s.total - s.suppressed, nil
+}
+
+// sarifStreamer copies a SARIF report token by token, filtering the
+// results of each run through the VEX documents
+type sarifStreamer struct {
+	ctx        context.Context
+	dec        *json.Decoder
+	w          *bufio.Writer
+	docs       []*vex.VEX
+	products   []string       // Products selected by the user
+	warnings   *ParseWarnings // Set in lenient mode to skip malformed results
+	runs       int
+	total      int
+	suppressed int
+}
+
+func (s *sarifStreamer) write(data []byte) error {
+	_, err := s.w.Write(data)
+	return err
+}
+
+// expectDelim reads the next token and checks it is the delimiter d
+func (s *sarifStreamer) expectDelim(d json.Delim) error {
+	t, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := t.(json.Delim); !ok || delim != d {
+		return fmt.Errorf("malformed report, expected %s got %v", d, t)
+	}
+	return nil
+}
+
+// streamObject copies a JSON object calling handler for each key. If the
+// handler returns false, the value is copied verbatim.
+func (s *sarifStreamer) streamObject(handler func(key string) (bool, error)) error {
+	if err := s.expectDelim('{'); err != nil {
+		return err
+	}
+	if err := s.write([]byte("{")); err != nil {
+		return err
+	}
+	first := true
+	for s.dec.More() {
+		t, err := s.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := t.(string)
+		if !ok {
+			return errors.New("malformed report, expected object key")
+		}
+		if !first {
+			if err := s.write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		first = false
+		keyData, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		if err := s.write(append(keyData, ':')); err != nil {
+			return err
+		}
+
+		handled, err := handler(key)
+		if err != nil {
+			return fmt.Errorf("processing %s: %w", key, err)
+		}
+		if handled {
+			continue
+		}
+		raw := json.RawMessage{}
+		if err := s.dec.Decode(&raw); err != nil {
+			return err
+		}
+		if err := s.write(raw); err != nil {
+			return err
+		}
+	}
+	if err := s.expectDelim('}'); err != nil {
+		return err
+	}
+	return s.write([]byte("}"))
+}
+
+// streamArray copies a JSON array calling element to process each item
+func (s *sarifStreamer) streamArray(element func(first bool) error) error {
+	if err := s.expectDelim('['); err != nil {
+		return err
+	}
+	if err := s.write([]byte("[")); err != nil {
+		return err
+	}
+	first := true
+	for s.dec.More() {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		if err := element(first); err != nil {
+			return err
+		}
+		first = false
+	}
+	if err := s.expectDelim(']'); err != nil {
+		return err
+	}
+	return s.write([]byte("]"))
+}
+
+func (s *sarifStreamer) streamReport() error {
+	return s.streamObject(func(key string) (bool, error) {
+		if key != "runs" {
+			return false, nil
+		}
+		return true, s.streamArray(func(first bool) error {
+			if !first {
+				if err := s.write([]byte(",")); err != nil {
+					return err
+				}
+			}
+			return s.streamRun()
+		})
+	})
+}
+
+func (s *sarifStreamer) streamRun() error {
+	return s.streamObject(func(key string) (bool, error) {
+		if key != "results" {
+			return false, nil
+		}
+		run := s.runs
+		s.runs++
+		index, written := 0, 0
+		return true, s.streamArray(func(bool) error {
+			raw := json.RawMessage{}
+			if err := s.dec.Decode(&raw); err != nil {
+				return err
+			}
+			index++
+			result := struct {
+				RuleID     string                 `json:"ruleId"`
+				Properties map[string]interface{} `json:"properties"`
+			}{}
+			if err := json.Unmarshal(raw, &result); err != nil {
+				if s.warnings != nil {
+					s.warnings.Add("skipped result %d of run %d: %v", index-1, run, err)
+					return nil
+				}
+				return fmt.Errorf("decoding result: %w", err)
+			}
+			s.total++
+			if suppressedByAny(s.docs, result.RuleID, resultProducts(result.Properties, s.products)) {
+				s.suppressed++
+				return nil
+			}
+			if written > 0 {
+				if err := s.write([]byte(",")); err != nil {
+					return err
+				}
+			}
+			written++
+			return s.write(raw)
+		})
+	})
+}
+
+// suppressedByAny returns true if any of the documents
+// suppresses results of the rule
+func suppressedByAny(docs []*vex.VEX, ruleID string, products []string) bool {
+	for _, doc := range docs {
+		if vexSuppresses(doc, ruleID, products) {
+			return true
+		}
+	}
+	return false
+}
+
+// vexSuppresses returns true if the VEX document states the
+// vulnerability of a SARIF rule is not exploitable in the
+// products of a result
+func vexSuppresses(vexDoc *vex.VEX, ruleID string, products []string) bool {
+	m := cveRegexp.FindStringSubmatch(ruleID)
+	if len(m) != 2 {
+		return false
+	}
+	statement := statementForProducts(vexDoc, m[1], products)
+	if statement == nil {
+		return false
+	}
+	return statement.Status == vex.StatusNotAffected ||
+		statement.Status == vex.StatusFixed
+}
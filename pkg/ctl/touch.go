@@ -0,0 +1,84 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// TouchOptions select the statements updated by Touch
+type TouchOptions struct {
+	Vulnerabilities []string  // Only touch statements about these vulnerabilities
+	Products        []string  // Only touch statements about any of these products
+	Now             time.Time // Time to record, defaults to the current time
+}
+
+// Touch returns a copy of a document with the timestamp of the selected
+// statements set to the current time, re-affirming them after a review.
+// Without vulnerabilities or products in the options all statements are
+// touched. If any statement is updated, the document timestamp is updated
+// too and its version incremented when it is numeric. The number of
+// touched statements is returned along with the new document.
+func (vexctl *VexCtl) Touch(doc *vex.VEX, opts TouchOptions) (*vex.VEX, int) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	vulns := map[string]struct{}{}
+	for _, v := range opts.Vulnerabilities {
+		vulns[v] = struct{}{}
+	}
+	products := map[string]struct{}{}
+	for _, p := range opts.Products {
+		products[p] = struct{}{}
+	}
+
+	newDoc := &vex.VEX{
+		Metadata:   doc.Metadata,
+		Statements: []vex.Statement{},
+	}
+	touched := 0
+	for _, s := range doc.Statements { //nolint:gocritic // statements are copied on purpose
+		if touchStatement(&s, vulns, products) {
+			ts := now
+			s.Timestamp = &ts
+			touched++
+		}
+		newDoc.Statements = append(newDoc.Statements, s)
+	}
+
+	if touched > 0 {
+		ts := now
+		newDoc.Timestamp = &ts
+		if v, err := strconv.Atoi(newDoc.Version); err == nil {
+			newDoc.Version = strconv.Itoa(v + 1)
+		}
+	}
+	logrus.WithField("statements", touched).Info("Touched VEX document")
+	return newDoc, touched
+}
+
+// touchStatement returns true if a statement is selected by the
+// vulnerability and product filters of TouchOptions
+func touchStatement(s *vex.Statement, vulns, products map[string]struct{}) bool {
+	if _, ok := vulns[s.Vulnerability]; len(vulns) > 0 && !ok {
+		return false
+	}
+	if len(products) == 0 {
+		return true
+	}
+	for p := range products {
+		if matchesAnyProduct(s.Products, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// allowedTransitions is the graph of status changes expected as the impact
+// of a vulnerability is assessed. Other changes, like moving from fixed back
+// to affected, are regressions which should be published in a new version
+// of the document that made the original claim.
+var allowedTransitions = map[vex.Status][]vex.Status{
+	vex.StatusUnderInvestigation: {
+		vex.StatusUnderInvestigation, vex.StatusAffected, vex.StatusNotAffected, vex.StatusFixed,
+	},
+	vex.StatusAffected:    {vex.StatusAffected, vex.StatusNotAffected, vex.StatusFixed},
+	vex.StatusNotAffected: {vex.StatusNotAffected, vex.StatusAffected},
+	vex.StatusFixed:       {vex.StatusFixed},
+}
+
+// TransitionViolation is a change of status of a vulnerability in a product
+// not allowed by the VEX status graph
+type TransitionViolation struct {
+	Vulnerability string
+	Product       string
+	From          vex.Status
+	To            vex.Status
+	FromDocument  string
+	ToDocument    string
+}
+
+func (tv *TransitionViolation) String() string {
+	return fmt.Sprintf(
+		"%s in %s moved from %s (%s) to %s (%s) without a new document version",
+		tv.Vulnerability, tv.Product, tv.From, tv.FromDocument, tv.To, tv.ToDocument,
+	)
+}
+
+// transitionAllowed returns true if the status graph permits the change
+func transitionAllowed(from, to vex.Status) bool {
+	for _, s := range allowedTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// isNewVersion returns true if next is a later version of the same document
+func isNewVersion(prev, next *vex.VEX) bool {
+	if prev.ID == "" || prev.ID != next.ID {
+		return false
+	}
+	pv, err := strconv.Atoi(prev.Version)
+	if err != nil {
+		return false
+	}
+	nv, err := strconv.Atoi(next.Version)
+	if err != nil {
+		return false
+	}
+	return nv > pv
+}
+
+// ValidateTransitions replays the statements of the documents in time order
+// and returns the status changes not allowed by the VEX status graph. A
+// disallowed change is accepted when it is published in a newer version of
+// the document that made the previous claim.
+func ValidateTransitions(docs []*vex.VEX) []TransitionViolation {
+	type entry struct {
+		doc       *vex.VEX
+		statement *vex.Statement
+		timestamp time.Time
+	}
+
+	entries := []entry{}
+	for _, doc := range docs {
+		for i := range doc.Statements {
+			e := entry{doc: doc, statement: &doc.Statements[i]}
+			switch {
+			case doc.Statements[i].Timestamp != nil:
+				e.timestamp = *doc.Statements[i].Timestamp
+			case doc.Timestamp != nil:
+				e.timestamp = *doc.Timestamp
+			}
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].timestamp.Before(entries[j].timestamp)
+	})
+
+	violations := []TransitionViolation{}
+	last := map[string]entry{}
+	for _, e := range entries {
+		for _, product := range e.statement.Products {
+			key := e.statement.Vulnerability + "\x00" + product
+			prev, ok := last[key]
+			last[key] = e
+			if !ok || transitionAllowed(prev.statement.Status, e.statement.Status) ||
+				isNewVersion(prev.doc, e.doc) {
+				continue
+			}
+			violations = append(violations, TransitionViolation{
+				Vulnerability: e.statement.Vulnerability,
+				Product:       product,
+				From:          prev.statement.Status,
+				To:            e.statement.Status,
+				FromDocument:  prev.doc.ID,
+				ToDocument:    e.doc.ID,
+			})
+		}
+	}
+	return violations
+}
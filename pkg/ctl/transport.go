@@ -0,0 +1,96 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/go-openapi/runtime"
+	httptransport "github.com/go-openapi/runtime/client"
+	"github.com/sigstore/cosign/cmd/cosign/cli/rekor"
+	"github.com/sigstore/rekor/pkg/generated/client"
+	"github.com/sirupsen/logrus"
+)
+
+// httpTransport returns the transport of all the connections made by
+// vexctl. Proxies are read from the HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+// environment variables and, when CA certificates are set in the options,
+// they are trusted in addition to the system roots.
+func httpTransport(opts Options) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	if len(opts.CACertificates) == 0 {
+		return t, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		logrus.Debugf("Could not load the system roots, trusting only the CA certificates passed: %v", err)
+		pool = x509.NewCertPool()
+	}
+	for _, path := range opts.CACertificates {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificates: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", path)
+		}
+	}
+	t.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return t, nil
+}
+
+// httpClient returns the client used for the HTTP requests to fetch
+// VEX data and query APIs
+func httpClient(opts Options) (*http.Client, error) {
+	t, err := httpTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: t}, nil
+}
+
+// rekorClient returns a client of the transparency log connecting
+// through the vexctl transport
+func rekorClient(opts Options, rekorURL string) (*client.Rekor, error) {
+	rekorClient, err := rekor.NewClient(rekorURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.CACertificates) == 0 {
+		return rekorClient, nil
+	}
+
+	u, err := url.Parse(rekorURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing rekor URL: %w", err)
+	}
+	if u.Host == "" {
+		return nil, errors.New("rekor URL has no host")
+	}
+	t, err := httpTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	// Same content types as the runtime of rekor.NewClient
+	rt := httptransport.New(u.Host, client.DefaultBasePath, []string{u.Scheme})
+	rt.Consumers["application/json"] = runtime.JSONConsumer()
+	rt.Consumers["application/x-pem-file"] = runtime.TextConsumer()
+	rt.Consumers["application/pem-certificate-chain"] = runtime.TextConsumer()
+	rt.Producers["application/json"] = runtime.JSONProducer()
+	rt.Producers["application/timestamp-query"] = runtime.ByteStreamProducer()
+	rt.Consumers["application/timestamp-reply"] = runtime.ByteStreamConsumer()
+	rt.Transport = t
+	rekorClient.SetTransport(rt)
+	return rekorClient, nil
+}
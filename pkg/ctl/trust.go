@@ -0,0 +1,161 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sigstore/cosign/cmd/cosign/cli/fulcio"
+	"github.com/sigstore/cosign/cmd/cosign/cli/options"
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/oci"
+	sigs "github.com/sigstore/cosign/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrUnverifiedAttestations is returned when attestations are read from an
+// image without a way to verify them and insecure reads are not allowed
+var ErrUnverifiedAttestations = errors.New(
+	"image attestations cannot be trusted without verification",
+)
+
+// AttestationVerification configures how the signatures of the attestations
+// read from images are verified. Attestations are verified either against
+// the identity in their sigstore certificate or against a public key.
+type AttestationVerification struct {
+	CertificateIdentity   string // Identity expected in the signing certificate
+	CertificateOIDCIssuer string // OIDC issuer expected in the signing certificate
+	Key                   string // Public key reference to verify the signatures with
+	RekorURL              string // Transparency log used to verify the signatures
+
+	// Insecure accepts attestations without verifying their signatures
+	Insecure bool
+}
+
+// Validate checks that the options are complete
+func (av *AttestationVerification) Validate() error {
+	if av.Insecure {
+		return nil
+	}
+	if av.Key != "" {
+		if av.CertificateIdentity != "" || av.CertificateOIDCIssuer != "" {
+			return errors.New("certificate identity and key verification are mutually exclusive")
+		}
+		return nil
+	}
+	if av.CertificateIdentity == "" && av.CertificateOIDCIssuer == "" {
+		return fmt.Errorf(
+			"%w: a certificate identity and OIDC issuer or a public key are required",
+			ErrUnverifiedAttestations,
+		)
+	}
+	if av.CertificateIdentity == "" || av.CertificateOIDCIssuer == "" {
+		return errors.New("both the certificate identity and OIDC issuer are required")
+	}
+	return nil
+}
+
+// checkOpts returns the cosign options used to verify attestations
+func (av *AttestationVerification) checkOpts(ctx context.Context, opts Options) (*cosign.CheckOpts, error) {
+	remoteOpts, err := remoteOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	rekorURL := av.RekorURL
+	if rekorURL == "" {
+		rekorURL = options.DefaultRekorURL
+	}
+	rekorClient, err := rekorClient(opts, rekorURL)
+	if err != nil {
+		return nil, fmt.Errorf("creating rekor client: %w", err)
+	}
+	co := &cosign.CheckOpts{
+		RegistryClientOpts: remoteOpts,
+		RekorClient:        rekorClient,
+		CertIdentity:       av.CertificateIdentity,
+		CertOidcIssuer:     av.CertificateOIDCIssuer,
+		ClaimVerifier:      cosign.IntotoSubjectClaimVerifier,
+	}
+
+	if av.Key != "" {
+		co.SigVerifier, err = sigs.PublicKeyFromKeyRef(ctx, av.Key)
+		if err != nil {
+			return nil, fmt.Errorf("loading public key: %w", err)
+		}
+		return co, nil
+	}
+
+	co.RootCerts, err = fulcio.GetRoots()
+	if err != nil {
+		return nil, fmt.Errorf("getting fulcio roots: %w", err)
+	}
+	co.IntermediateCerts, err = fulcio.GetIntermediates()
+	if err != nil {
+		return nil, fmt.Errorf("getting fulcio intermediates: %w", err)
+	}
+	return co, nil
+}
+
+// signerIdentity returns the identity a signature was verified against:
+// the subject alternative names of its signing certificate or, when it
+// was verified with a public key, the key reference prefixed with "key:"
+func (av *AttestationVerification) signerIdentity(cert *x509.Certificate) string {
+	if av.Key != "" || cert == nil {
+		return "key:" + av.Key
+	}
+	return strings.Join(cryptoutils.GetSubjectAlternateNames(cert), ", ")
+}
+
+// fetchVerifiedAttestationPayloads returns the DSSE envelopes attached to an
+// image whose signatures pass verification, with the identity that signed
+// them. Attestations failing verification are discarded, if none pass an
+// error is returned.
+func fetchVerifiedAttestationPayloads(
+	ctx context.Context, opts Options, digest name.Digest,
+) ([]attestationPayload, error) {
+	co, err := opts.Verification.checkOpts(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("building verification options: %w", err)
+	}
+
+	var verified []oci.Signature
+	if err := withRetry(ctx, opts, "verifying attestations", func() (err error) {
+		verified, _, err = cosign.VerifyImageAttestations(ctx, digest, co)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("verifying attestations of %s: %w", digest.String(), err)
+	}
+
+	payloads := []attestationPayload{}
+	for _, att := range verified {
+		data, err := att.Payload()
+		if err != nil {
+			return nil, fmt.Errorf("reading attestation payload: %w", err)
+		}
+		payload := attestationPayload{}
+		if err := json.Unmarshal(data, &payload.AttestationPayload); err != nil {
+			return nil, fmt.Errorf("decoding attestation envelope: %w", err)
+		}
+		cert, err := att.Cert()
+		if err != nil {
+			return nil, fmt.Errorf("reading signing certificate: %w", err)
+		}
+		payload.Signer = opts.Verification.signerIdentity(cert)
+		payloads = append(payloads, payload)
+	}
+	logrus.WithFields(logrus.Fields{
+		"image":        digest.String(),
+		"attestations": len(payloads),
+	}).Debug("Verified image attestations")
+	return payloads, nil
+}
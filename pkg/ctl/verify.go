@@ -0,0 +1,212 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+
+	"github.com/openvex/go-vex/pkg/vex"
+
+	"github.com/openvex/vexctl/pkg/attestation"
+	"github.com/openvex/vexctl/pkg/sbom"
+)
+
+// sbomPredicateTypes lists the predicate types recognized as SBOMs
+var sbomPredicateTypes = map[string]string{
+	intoto.PredicateSPDX:        sbom.FormatSPDX,
+	intoto.PredicateCycloneDX:   sbom.FormatCycloneDX,
+	"https://cyclonedx.org/bom": sbom.FormatCycloneDX,
+}
+
+// ImageVerification captures the result of checking the SBOM and
+// VEX attestations attached to an image against each other
+type ImageVerification struct {
+	Image                string   // Image reference as passed by the user
+	Digest               string   // Digest the reference resolved to
+	SBOMs                int      // Number of SBOM attestations found
+	VEXDocuments         int      // Number of VEX attestations found
+	PlatformDigests      []string // Digests of the per-platform images of an index
+	SubjectMismatches    []string // VEX attestations with no subject matching the image
+	ExtraSubjects        []string // Other subjects of the VEX attestations, for information
+	Subcomponents        []string // Subcomponents referenced in the VEX statements
+	MissingSubcomponents []string // Subcomponents not listed in any SBOM
+	Expired              []string // VEX documents outside of their validity window
+
+	Documents []*vex.VEX // VEX documents extracted from the verified attestations
+	Signers   []string   // Verified identity that signed each of the Documents
+}
+
+// Coverage returns the percentage of VEX subcomponents found in the SBOMs
+func (iv *ImageVerification) Coverage() float64 {
+	if len(iv.Subcomponents) == 0 {
+		return 100
+	}
+	found := len(iv.Subcomponents) - len(iv.MissingSubcomponents)
+	return float64(found) / float64(len(iv.Subcomponents)) * 100
+}
+
+// Passed returns true when the image has correlated SBOM and VEX data
+func (iv *ImageVerification) Passed() bool {
+	return iv.PassedWithCoverage(100)
+}
+
+// PassedWithCoverage returns true when the image has SBOM and VEX data, every
+// VEX attestation has a subject matching the image and at least minCoverage
+// percent of the VEX subcomponents are listed in the SBOM
+func (iv *ImageVerification) PassedWithCoverage(minCoverage float64) bool {
+	return iv.SBOMs > 0 && iv.VEXDocuments > 0 &&
+		len(iv.SubjectMismatches) == 0 && iv.Coverage() >= minCoverage
+}
+
+// VerifyImage fetches the SBOM and VEX attestations of an image, checks that
+// each VEX attestation has a subject matching the image, by its digest or the
+// digest of one of the platforms of an index, and that the subcomponents in
+// the VEX statements are listed in the SBOM.
+func (vexctl *VexCtl) VerifyImage(ctx context.Context, imageRef string) (*ImageVerification, error) {
+	vexctl.reportProgress("Fetching attestations", 0, 1)
+	defer vexctl.reportProgress("Fetching attestations", 1, 1)
+	digest, err := vexctl.impl.ResolveImageDigest(ctx, vexctl.Options, imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("resolving image digest: %w", err)
+	}
+	platformDigests, err := vexctl.impl.ResolvePlatformDigests(ctx, vexctl.Options, imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("resolving platform digests: %w", err)
+	}
+
+	statements, err := vexctl.impl.ReadImageStatements(ctx, vexctl.Options, imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("reading image attestations: %w", err)
+	}
+
+	return verifyStatements(vexctl.Options, imageRef, digest, platformDigests, statements, time.Now())
+}
+
+// verifyStatements correlates the SBOM and VEX statements attested to an
+// image. VEX attestations outside of their validity window at now are
+// recorded as expired and, with RejectExpired, left out of the checks.
+func verifyStatements(
+	opts Options, imageRef, digest string, platformDigests []string, statements []*ImageStatement, now time.Time,
+) (*ImageVerification, error) {
+	res := &ImageVerification{
+		Image:                imageRef,
+		Digest:               digest,
+		PlatformDigests:      platformDigests,
+		SubjectMismatches:    []string{},
+		ExtraSubjects:        []string{},
+		Subcomponents:        []string{},
+		MissingSubcomponents: []string{},
+		Expired:              []string{},
+		Signers:              []string{},
+	}
+
+	boms := []*sbom.SBOM{}
+	vexes := []*vex.VEX{}
+	for _, s := range statements {
+		switch {
+		case s.PredicateType == vex.TypeURI:
+			predicate := &attestation.Predicate{}
+			if err := json.Unmarshal(s.Predicate, predicate); err != nil {
+				return nil, fmt.Errorf("unmarshalling VEX predicate: %w", err)
+			}
+			if err := predicate.Validity.Check(now); err != nil {
+				res.Expired = append(res.Expired, fmt.Sprintf("%s: %v", predicate.ID, err))
+				if opts.RejectExpired {
+					continue
+				}
+			}
+			vexes = append(vexes, &predicate.VEX)
+			res.Signers = append(res.Signers, s.Signer)
+			// Attestations also carry the platforms of an index, the
+			// artifacts of an SBOM and files as subjects, only one of
+			// them has to be the image
+			matched := false
+			for _, sub := range s.Subject {
+				if subjectMatches(sub, append([]string{digest}, platformDigests...)) {
+					matched = true
+					continue
+				}
+				res.ExtraSubjects = append(res.ExtraSubjects, subjectString(sub))
+			}
+			if !matched {
+				id := predicate.ID
+				if id == "" {
+					id = "(no id)"
+				}
+				res.SubjectMismatches = append(res.SubjectMismatches, id)
+			}
+		case sbomPredicateTypes[s.PredicateType] != "":
+			bom, err := sbom.Parse(s.Predicate)
+			if err != nil {
+				return nil, fmt.Errorf("parsing SBOM predicate: %w", err)
+			}
+			boms = append(boms, bom)
+		}
+	}
+
+	res.SBOMs = len(boms)
+	res.VEXDocuments = len(vexes)
+	res.Documents = vexes
+
+	seen := map[string]struct{}{}
+	for _, doc := range vexes {
+		for _, s := range doc.Statements { //nolint:gocritic // rangeValCopy
+			for _, sc := range s.Subcomponents {
+				if _, ok := seen[sc]; ok {
+					continue
+				}
+				seen[sc] = struct{}{}
+				res.Subcomponents = append(res.Subcomponents, sc)
+				if !inAnySBOM(boms, sc) {
+					res.MissingSubcomponents = append(res.MissingSubcomponents, sc)
+				}
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// subjectMatches returns true if one of the digests of a subject is
+// among the image digests, in algorithm:hex form
+func subjectMatches(sub intoto.Subject, digests []string) bool {
+	for _, d := range digests {
+		algorithm, hex, ok := strings.Cut(d, ":")
+		if ok && sub.Digest[algorithm] == hex {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectString returns a subject as its name and first digest
+func subjectString(sub intoto.Subject) string {
+	algorithms := make([]string, 0, len(sub.Digest))
+	for a := range sub.Digest {
+		algorithms = append(algorithms, a)
+	}
+	if len(algorithms) == 0 {
+		return sub.Name
+	}
+	sort.Strings(algorithms)
+	return fmt.Sprintf("%s@%s:%s", sub.Name, algorithms[0], sub.Digest[algorithms[0]])
+}
+
+func inAnySBOM(boms []*sbom.SBOM, purl string) bool {
+	for _, bom := range boms {
+		if bom.HasComponent(purl) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// versPrefix starts the version range specifiers (vers) that can be used
+// as the version of a package URL in statement products, for example
+// pkg:npm/lodash@vers:npm/>=2.0.0|<2.4.7
+const versPrefix = "vers:"
+
+// versConstraint is a comparator and version of a version range
+type versConstraint struct {
+	comparator string
+	version    string
+}
+
+// versComparators are the comparators of the vers spec, the
+// two character ones first so they are matched before < and >
+var versComparators = []string{">=", "<=", "!=", "<", ">", "="}
+
+// parseVers parses a version range specifier (vers:scheme/constraints).
+// The constraints are returned sorted by version.
+func parseVers(s string) ([]versConstraint, error) {
+	if !strings.HasPrefix(s, versPrefix) {
+		return nil, errors.New("version range does not start with vers:")
+	}
+	i := strings.Index(s, "/")
+	if i == -1 || i == len(versPrefix) {
+		return nil, errors.New("version range has no scheme")
+	}
+	spec := strings.TrimSpace(s[i+1:])
+	if spec == "" {
+		return nil, errors.New("version range has no constraints")
+	}
+	if spec == "*" {
+		return []versConstraint{{comparator: "*"}}, nil
+	}
+
+	constraints := []versConstraint{}
+	for _, c := range strings.Split(spec, "|") {
+		c = strings.TrimSpace(c)
+		vc := versConstraint{comparator: "="}
+		for _, comp := range versComparators {
+			if strings.HasPrefix(c, comp) {
+				vc.comparator = comp
+				c = c[len(comp):]
+				break
+			}
+		}
+		if c == "" {
+			return nil, fmt.Errorf("constraint %q has no version", vc.comparator)
+		}
+		vc.version = c
+		constraints = append(constraints, vc)
+	}
+	sort.SliceStable(constraints, func(i, j int) bool {
+		return compareVersions(constraints[i].version, constraints[j].version) < 0
+	})
+	return constraints, nil
+}
+
+// versContains returns true if a version is in the range of the
+// constraints, following the algorithm of the vers spec
+func versContains(constraints []versConstraint, version string) bool {
+	ranges := []versConstraint{}
+	for _, c := range constraints {
+		switch c.comparator {
+		case "*":
+			return true
+		case "=":
+			if compareVersions(version, c.version) == 0 {
+				return true
+			}
+		case "!=":
+			if compareVersions(version, c.version) == 0 {
+				return false
+			}
+		default:
+			ranges = append(ranges, c)
+		}
+	}
+	if len(ranges) == 0 {
+		return false
+	}
+
+	below := func(c versConstraint) bool { return c.comparator == "<" || c.comparator == "<=" }
+	satisfies := func(c versConstraint) bool {
+		cmp := compareVersions(version, c.version)
+		switch c.comparator {
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		default:
+			return cmp >= 0
+		}
+	}
+
+	if first := ranges[0]; below(first) && satisfies(first) {
+		return true
+	}
+	if last := ranges[len(ranges)-1]; !below(last) && satisfies(last) {
+		return true
+	}
+	for i := 1; i < len(ranges); i++ {
+		lower, upper := ranges[i-1], ranges[i]
+		if !below(lower) && below(upper) && satisfies(lower) && satisfies(upper) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareVersions compares two versions segment by segment, numeric
+// segments numerically and the rest lexically. It is a generic order
+// that works for most schemes but does not know about the pre-release
+// conventions of specific ecosystems.
+func compareVersions(a, b string) int {
+	as, bs := versionSegments(a), versionSegments(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.ParseUint(as[i], 10, 64)
+		bn, bErr := strconv.ParseUint(bs[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case as[i] != bs[i]:
+			if as[i] < bs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// versionSegments splits a version in runs of digits and of letters,
+// dropping separators like dots and dashes
+func versionSegments(v string) []string {
+	segments := []string{}
+	start := -1
+	digits := false
+	for i, r := range v {
+		isDigit := r >= '0' && r <= '9'
+		isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if start != -1 && (!(isDigit || isLetter) || isDigit != digits) {
+			segments = append(segments, v[start:i])
+			start = -1
+		}
+		if start == -1 && (isDigit || isLetter) {
+			start = i
+			digits = isDigit
+		}
+	}
+	if start != -1 {
+		segments = append(segments, v[start:])
+	}
+	return segments
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WatchEvent describes a change in the VEX attestations of an image
+type WatchEvent struct {
+	Image        string   // Reference of the image being watched
+	Digest       string   // Digest the reference resolved to
+	Attestations []string // Digests of the VEX attestations attached to the image
+	Added        []string // Attestations attached since the last check
+	Removed      []string // Attestations removed since the last check
+}
+
+// imageWatcher keeps the VEX attestations last seen on an image
+type imageWatcher struct {
+	vexctl *VexCtl
+	opts   Options
+	image  string
+	digest string
+	seen   map[string]struct{}
+}
+
+// newImageWatcher returns a watcher for an image. Registry lookups are
+// never cached, so that a tag moving to a new image is noticed.
+func (vexctl *VexCtl) newImageWatcher(imageRef string) *imageWatcher {
+	opts := vexctl.Options
+	opts.CacheTTL = 0
+	return &imageWatcher{vexctl: vexctl, opts: opts, image: imageRef}
+}
+
+// poll checks the attestations of the image, returning an event if they
+// changed since the previous check. The first check only records them.
+func (w *imageWatcher) poll(ctx context.Context) (*WatchEvent, error) {
+	digest, attestations, err := w.vexctl.impl.ListVEXAttestations(ctx, w.opts, w.image)
+	if err != nil {
+		return nil, fmt.Errorf("listing VEX attestations: %w", err)
+	}
+	current := map[string]struct{}{}
+	for _, a := range attestations {
+		current[a] = struct{}{}
+	}
+
+	first := w.seen == nil
+	event := &WatchEvent{
+		Image:        w.image,
+		Digest:       digest,
+		Attestations: attestations,
+		Added:        []string{},
+		Removed:      []string{},
+	}
+	for _, a := range attestations {
+		if _, ok := w.seen[a]; !ok {
+			event.Added = append(event.Added, a)
+		}
+	}
+	for a := range w.seen {
+		if _, ok := current[a]; !ok {
+			event.Removed = append(event.Removed, a)
+		}
+	}
+	changed := digest != w.digest || len(event.Added) > 0 || len(event.Removed) > 0
+	w.digest = digest
+	w.seen = current
+
+	if first {
+		logrus.WithFields(logrus.Fields{
+			"image":        w.image,
+			"digest":       digest,
+			"attestations": len(attestations),
+		}).Info("Watching VEX attestations")
+		return nil, nil
+	}
+	if !changed {
+		return nil, nil
+	}
+	return event, nil
+}
+
+// Watch polls an image for changes in its VEX attestations every interval
+// and calls onChange when any are attached or removed, or when the image
+// reference moves to a new digest. Failed checks are logged and retried
+// on the next poll. Watch returns when the context is canceled or when
+// onChange returns an error.
+func (vexctl *VexCtl) Watch(
+	ctx context.Context, imageRef string, interval time.Duration, onChange func(*WatchEvent) error,
+) error {
+	if interval <= 0 {
+		return errors.New("the polling interval must be positive")
+	}
+	w := vexctl.newImageWatcher(imageRef)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		event, err := w.poll(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			logrus.Warnf("Checking %s: %v", imageRef, err)
+		case event != nil:
+			if err := onChange(event); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
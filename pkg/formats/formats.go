@@ -0,0 +1,140 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package formats holds the parsers of scanner reports. Reports of every
+// scanner are normalized to SARIF, the model vexctl applies VEX data to.
+// The parsers of the built-in formats live in the subpackages of formats,
+// programs embedding vexctl can add their own with Register.
+package formats
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	gosarif "github.com/owenrumney/go-sarif/sarif"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+)
+
+// Format is a parser of scanner reports, converting them to SARIF so VEX
+// data can be applied to them
+type Format interface {
+	// Name returns the identifier of the format (eg grype)
+	Name() string
+
+	// Detect returns true if data is a report in this format
+	Detect(data []byte) bool
+
+	// Parse converts a report in this format to SARIF
+	Parse(data []byte) (*sarif.Report, error)
+}
+
+// LenientFormat is a Format that can skip the malformed records of a
+// report instead of failing, recording them in warnings
+type LenientFormat interface {
+	Format
+
+	// ParseLenient converts a report to SARIF like Parse, skipping the
+	// records that cannot be decoded
+	ParseLenient(data []byte, warnings *Warnings) (*sarif.Report, error)
+}
+
+var (
+	registryMutex sync.RWMutex
+	registered    = []Format{}
+)
+
+// Register adds a scanner report format. Registered formats are detected
+// before the built-in ones, in the order they were registered, so they
+// can also replace them.
+func Register(f Format) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registered = append(registered, f)
+}
+
+// Registered returns the registered formats, in the order they were
+// registered
+func Registered() []Format {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	return append([]Format{}, registered...)
+}
+
+// Lookup returns the registered format with a name, if any
+func Lookup(name string) Format {
+	for _, f := range Registered() {
+		if f.Name() == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Warnings collects the malformed records skipped when parsing
+// documents and reports in lenient mode. Passing Warnings to the parsers
+// enables the lenient mode, a nil value makes them fail on the first
+// malformed record.
+type Warnings struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+// Add records a skipped record
+func (w *Warnings) Add(format string, args ...interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.warnings = append(w.warnings, fmt.Sprintf(format, args...))
+}
+
+// Warnings returns the records skipped so far
+func (w *Warnings) Warnings() []string {
+	if w == nil {
+		return []string{}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string{}, w.warnings...)
+}
+
+// DecodeRecords calls decode with each of the raw records of a report. In
+// lenient mode, when warnings is set, the records failing to decode are
+// skipped and recorded, otherwise the first one fails the parsing.
+func DecodeRecords(
+	records []json.RawMessage, warnings *Warnings, what string, decode func(data []byte) error,
+) error {
+	for i, r := range records {
+		if err := decode(r); err != nil {
+			if warnings == nil {
+				return fmt.Errorf("unmarshalling %s %d: %w", what, i, err)
+			}
+			warnings.Add("skipped %s %d: %v", what, i, err)
+		}
+	}
+	return nil
+}
+
+// NewReport returns a SARIF report holding the runs converted from a
+// scanner report
+func NewReport(runs ...*gosarif.Run) *sarif.Report {
+	report := sarif.New()
+	report.Version = string(gosarif.Version210)
+	report.Schema = "https://json.schemastore.org/sarif-2.1.0-rtm.5.json"
+	for _, run := range runs {
+		report.AddRun(run)
+	}
+	return report
+}
+
+// RuleIndex returns the index of a rule in the driver of a run
+func RuleIndex(run *gosarif.Run, id string) int {
+	for i, rule := range run.Tool.Driver.Rules {
+		if rule.ID == id {
+			return i
+		}
+	}
+	return -1
+}
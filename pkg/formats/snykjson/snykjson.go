@@ -0,0 +1,231 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package snykjson converts the output of snyk test --json to SARIF. The
+// issues snyk reports about a package are normalized to a result per CVE,
+// keeping the snyk ID and the package URL of the package in its properties.
+package snykjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	gosarif "github.com/owenrumney/go-sarif/sarif"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+
+	"github.com/openvex/vexctl/pkg/formats"
+)
+
+// Name is the identifier of the snyk JSON format
+const Name = "snyk"
+
+// Format parses the JSON output of snyk test, for a single project or
+// the array written with --all-projects
+type Format struct{}
+
+// Name returns the identifier of the format
+func (Format) Name() string { return Name }
+
+// Detect returns true if data is the output of snyk test --json
+func (Format) Detect(data []byte) bool {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return isReportList(data)
+	}
+	probe := struct {
+		Vulnerabilities json.RawMessage `json:"vulnerabilities"`
+		PackageManager  json.RawMessage `json:"packageManager"`
+	}{}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+	return probe.Vulnerabilities != nil && probe.PackageManager != nil
+}
+
+// Parse converts the output of snyk test --json to SARIF
+func (Format) Parse(data []byte) (*sarif.Report, error) {
+	return parse(data, nil)
+}
+
+// ParseLenient converts the output of snyk test --json to SARIF, skipping
+// the vulnerabilities that cannot be decoded
+func (Format) ParseLenient(data []byte, warnings *formats.Warnings) (*sarif.Report, error) {
+	return parse(data, warnings)
+}
+
+// project is the output of snyk test --json for a project. With
+// --all-projects snyk writes an array of them.
+type project struct {
+	ProjectName       string            `json:"projectName"`
+	DisplayTargetFile string            `json:"displayTargetFile"`
+	PackageManager    string            `json:"packageManager"`
+	Vulnerabilities   []json.RawMessage `json:"vulnerabilities"`
+}
+
+type vulnerability struct {
+	ID             string   `json:"id"`
+	Title          string   `json:"title"`
+	Severity       string   `json:"severity"`
+	PackageName    string   `json:"packageName"`
+	Version        string   `json:"version"`
+	PackageManager string   `json:"packageManager"`
+	FixedIn        []string `json:"fixedIn"`
+	Identifiers    struct {
+		CVE []string `json:"CVE"`
+	} `json:"identifiers"`
+}
+
+// purlTypes maps the package managers of snyk to purl types
+var purlTypes = map[string]string{
+	"npm":       "npm",
+	"yarn":      "npm",
+	"pip":       "pypi",
+	"poetry":    "pypi",
+	"pipenv":    "pypi",
+	"maven":     "maven",
+	"gradle":    "maven",
+	"sbt":       "maven",
+	"gomodules": "golang",
+	"golangdep": "golang",
+	"rubygems":  "gem",
+	"nuget":     "nuget",
+	"composer":  "composer",
+	"cargo":     "cargo",
+	"cocoapods": "cocoapods",
+	"apk":       "apk",
+	"deb":       "deb",
+	"rpm":       "rpm",
+	"hex":       "hex",
+	"swift":     "swift",
+}
+
+// levels maps the severities of snyk to SARIF levels
+var levels = map[string]string{
+	"critical": "error",
+	"high":     "error",
+	"medium":   "warning",
+	"low":      "note",
+}
+
+// isReportList returns true if data is the array of reports written
+// by snyk test --json when testing several projects
+func isReportList(data []byte) bool {
+	projects := []struct {
+		Vulnerabilities json.RawMessage `json:"vulnerabilities"`
+		PackageManager  json.RawMessage `json:"packageManager"`
+	}{}
+	if err := json.Unmarshal(data, &projects); err != nil || len(projects) == 0 {
+		return false
+	}
+	return projects[0].Vulnerabilities != nil && projects[0].PackageManager != nil
+}
+
+// PackageURL returns the purl of the vulnerable package, or an empty
+// string if its package manager has no purl type
+func (v *vulnerability) PackageURL() string {
+	purlType, ok := purlTypes[v.PackageManager]
+	if !ok || v.PackageName == "" {
+		return ""
+	}
+	// Maven packages are named group:artifact
+	purl := fmt.Sprintf("pkg:%s/%s", purlType, strings.ReplaceAll(v.PackageName, ":", "/"))
+	if v.Version != "" {
+		purl += "@" + v.Version
+	}
+	return purl
+}
+
+// parse converts the output of snyk test --json to SARIF, one run per
+// project. Snyk lists a vulnerability once per dependency path, each
+// vulnerable package version gets a single result per CVE. Issues without
+// a CVE keep their snyk ID as rule. Malformed vulnerabilities are skipped
+// in lenient mode, when warnings is set.
+func parse(data []byte, warnings *formats.Warnings) (*sarif.Report, error) {
+	projects := []project{}
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(trimmed, &projects); err != nil {
+			return nil, fmt.Errorf("unmarshalling snyk report: %w", err)
+		}
+	} else {
+		project := project{}
+		if err := json.Unmarshal(data, &project); err != nil {
+			return nil, fmt.Errorf("unmarshalling snyk report: %w", err)
+		}
+		projects = append(projects, project)
+	}
+
+	report := formats.NewReport()
+	for i := range projects {
+		p := &projects[i]
+		run := gosarif.NewRun("Snyk", "https://snyk.io")
+		run.Properties = gosarif.Properties{"projectName": p.ProjectName}
+		target := p.DisplayTargetFile
+		if target == "" {
+			target = p.ProjectName
+		}
+
+		seen := map[string]struct{}{}
+		if err := formats.DecodeRecords(p.Vulnerabilities, warnings, "vulnerability of "+p.ProjectName, func(data []byte) error {
+			v := &vulnerability{}
+			if err := json.Unmarshal(data, v); err != nil {
+				return err
+			}
+			if v.PackageManager == "" {
+				v.PackageManager = p.PackageManager
+			}
+			addResults(run, v, target, seen)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		report.AddRun(run)
+	}
+	return report, nil
+}
+
+// addResults adds a result per CVE of a vulnerability to a run, unless
+// it was already added for the same package version
+func addResults(run *gosarif.Run, v *vulnerability, target string, seen map[string]struct{}) {
+	ids := v.Identifiers.CVE
+	if len(ids) == 0 {
+		ids = []string{v.ID}
+	}
+	level, ok := levels[strings.ToLower(v.Severity)]
+	if !ok {
+		level = "note"
+	}
+	for _, id := range ids {
+		key := fmt.Sprintf("%s %s@%s", id, v.PackageName, v.Version)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		rule := run.AddRule(id).
+			WithShortDescription(gosarif.NewMultiformatMessageString(id)).
+			WithHelpURI("https://security.snyk.io/vuln/" + v.ID)
+		if v.Title != "" {
+			rule.WithFullDescription(gosarif.NewMultiformatMessageString(v.Title))
+		}
+
+		props := gosarif.Properties{"snykId": v.ID}
+		if purl := v.PackageURL(); purl != "" {
+			props["purl"] = purl
+		}
+		run.AddResult(id).
+			WithRuleIndex(formats.RuleIndex(run, id)).
+			WithLevel(level).
+			WithMessage(gosarif.NewTextMessage(fmt.Sprintf(
+				"Package: %s\nInstalled Version: %s\nVulnerability %s\nSeverity: %s\nFixed Version: %s",
+				v.PackageName, v.Version, id, v.Severity, strings.Join(v.FixedIn, ", "),
+			))).
+			WithLocation(gosarif.NewLocationWithPhysicalLocation(
+				gosarif.NewPhysicalLocation().WithArtifactLocation(gosarif.NewSimpleArtifactLocation(target)),
+			)).
+			WithProperties(props)
+	}
+}
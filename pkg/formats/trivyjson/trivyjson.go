@@ -0,0 +1,187 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package trivyjson converts trivy JSON reports (schema version 2) to
+// SARIF. Trivy groups the vulnerabilities of a scanned artifact by target,
+// eg the OS packages of an image or a lockfile, and class. The target and
+// class of each vulnerability are kept in the properties of its result.
+package trivyjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	gosarif "github.com/owenrumney/go-sarif/sarif"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+
+	"github.com/openvex/vexctl/pkg/formats"
+)
+
+// Name is the identifier of the trivy JSON format
+const Name = "trivy"
+
+// Format parses trivy JSON reports
+type Format struct{}
+
+// Name returns the identifier of the format
+func (Format) Name() string { return Name }
+
+// Detect returns true if data is a trivy JSON report
+func (Format) Detect(data []byte) bool {
+	probe := struct {
+		SchemaVersion json.RawMessage `json:"SchemaVersion"`
+		Results       json.RawMessage `json:"Results"`
+	}{}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+	return probe.SchemaVersion != nil && probe.Results != nil
+}
+
+// Parse converts a trivy JSON report to SARIF
+func (Format) Parse(data []byte) (*sarif.Report, error) {
+	return parse(data, nil)
+}
+
+// ParseLenient converts a trivy JSON report to SARIF, skipping the
+// targets and vulnerabilities that cannot be decoded
+func (Format) ParseLenient(data []byte, warnings *formats.Warnings) (*sarif.Report, error) {
+	return parse(data, warnings)
+}
+
+// report is the part of a trivy JSON report (schema version 2)
+// needed to apply VEX data to it
+type report struct {
+	SchemaVersion int    `json:"SchemaVersion"`
+	ArtifactName  string `json:"ArtifactName"`
+	ArtifactType  string `json:"ArtifactType"`
+	Metadata      struct {
+		RepoTags    []string `json:"RepoTags"`
+		RepoDigests []string `json:"RepoDigests"`
+	} `json:"Metadata"`
+	Results []json.RawMessage `json:"Results"`
+}
+
+// result holds the vulnerabilities found in a target of the scanned
+// artifact, eg the OS packages of an image or a lockfile
+type result struct {
+	Target          string            `json:"Target"`
+	Class           string            `json:"Class"`
+	Type            string            `json:"Type"`
+	Vulnerabilities []json.RawMessage `json:"Vulnerabilities"`
+}
+
+type vulnerability struct {
+	VulnerabilityID  string `json:"VulnerabilityID"`
+	PkgName          string `json:"PkgName"`
+	PkgPath          string `json:"PkgPath"`
+	InstalledVersion string `json:"InstalledVersion"`
+	FixedVersion     string `json:"FixedVersion"`
+	Severity         string `json:"Severity"`
+	Title            string `json:"Title"`
+	Description      string `json:"Description"`
+	PrimaryURL       string `json:"PrimaryURL"`
+	PkgIdentifier    struct {
+		PURL string `json:"PURL"`
+	} `json:"PkgIdentifier"`
+}
+
+// levels maps the severities of trivy to SARIF levels, the same way
+// trivy does when it writes SARIF reports
+var levels = map[string]string{
+	"CRITICAL": "error",
+	"HIGH":     "error",
+	"MEDIUM":   "warning",
+	"LOW":      "note",
+	"UNKNOWN":  "note",
+}
+
+// parse converts a trivy JSON report to SARIF. Each vulnerable package
+// becomes a result located in the target it was found in, with the class,
+// target and package URL of the match in its properties. The scanned
+// image is recorded in the run properties like trivy does, so vexctl finds
+// it. Malformed targets and vulnerabilities are skipped in lenient mode,
+// when warnings is set.
+func parse(data []byte, warnings *formats.Warnings) (*sarif.Report, error) {
+	tr := &report{}
+	if err := json.Unmarshal(data, tr); err != nil {
+		return nil, fmt.Errorf("unmarshalling trivy report: %w", err)
+	}
+	if tr.SchemaVersion != 2 {
+		return nil, fmt.Errorf("unsupported trivy report schema version %d", tr.SchemaVersion)
+	}
+
+	run := gosarif.NewRun("Trivy", "https://github.com/aquasecurity/trivy")
+	run.Properties = gosarif.Properties{}
+	if tr.ArtifactType == "container_image" {
+		run.Properties["imageName"] = tr.ArtifactName
+		digests := make([]interface{}, 0, len(tr.Metadata.RepoDigests))
+		for _, d := range tr.Metadata.RepoDigests {
+			digests = append(digests, d)
+		}
+		run.Properties["repoDigests"] = digests
+	}
+
+	if err := formats.DecodeRecords(tr.Results, warnings, "trivy result", func(data []byte) error {
+		target := &result{}
+		if err := json.Unmarshal(data, target); err != nil {
+			return err
+		}
+		return formats.DecodeRecords(target.Vulnerabilities, warnings, "vulnerability of "+target.Target, func(data []byte) error {
+			v := &vulnerability{}
+			if err := json.Unmarshal(data, v); err != nil {
+				return err
+			}
+			addResult(run, target, v)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return formats.NewReport(run), nil
+}
+
+// addResult adds the result of a vulnerability found in a target
+func addResult(run *gosarif.Run, target *result, v *vulnerability) {
+	level, ok := levels[strings.ToUpper(v.Severity)]
+	if !ok {
+		level = "note"
+	}
+	rule := run.AddRule(v.VulnerabilityID).
+		WithShortDescription(gosarif.NewMultiformatMessageString(v.VulnerabilityID))
+	description := v.Description
+	if description == "" {
+		description = v.Title
+	}
+	if description != "" {
+		rule.WithFullDescription(gosarif.NewMultiformatMessageString(description))
+	}
+	if v.PrimaryURL != "" {
+		rule.WithHelpURI(v.PrimaryURL)
+	}
+
+	uri := v.PkgPath
+	if uri == "" {
+		uri = target.Target
+	}
+	props := gosarif.Properties{"class": target.Class, "target": target.Target}
+	if v.PkgIdentifier.PURL != "" {
+		props["purl"] = v.PkgIdentifier.PURL
+	}
+	run.AddResult(v.VulnerabilityID).
+		WithRuleIndex(formats.RuleIndex(run, v.VulnerabilityID)).
+		WithLevel(level).
+		WithMessage(gosarif.NewTextMessage(fmt.Sprintf(
+			"Package: %s\nInstalled Version: %s\nVulnerability %s\nSeverity: %s\nFixed Version: %s\nLink: %s",
+			v.PkgName, v.InstalledVersion, v.VulnerabilityID, v.Severity, v.FixedVersion, v.PrimaryURL,
+		))).
+		WithLocation(gosarif.NewLocationWithPhysicalLocation(
+			gosarif.NewPhysicalLocation().WithArtifactLocation(gosarif.NewSimpleArtifactLocation(uri)),
+		)).
+		WithProperties(props)
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2023 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sbom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	FormatSPDX      = "spdx"
+	FormatCycloneDX = "cyclonedx"
+)
+
+// SBOM is a minimal, format agnostic view of a software bill of materials.
+// vexctl only needs to know which components are listed in the document
+// and which artifacts it describes.
+type SBOM struct {
+	Format     string
+	Components map[string]struct{} // Package URLs of the components in the SBOM
+	Described  []Artifact          // Artifacts the SBOM describes
+}
+
+// Artifact is an artifact described by an SBOM
+type Artifact struct {
+	Name    string
+	Digests map[string]string // Digest values keyed by algorithm (eg sha256)
+}
+
+// Open reads an SBOM from a file
+func Open(path string) (*SBOM, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading SBOM file: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse reads SBOM data in SPDX or CycloneDX JSON format
+func Parse(data []byte) (*SBOM, error) {
+	probe := struct {
+		SPDXVersion string `json:"spdxVersion"`
+		BOMFormat   string `json:"bomFormat"`
+	}{}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("unmarshalling SBOM data: %w", err)
+	}
+
+	switch {
+	case probe.SPDXVersion != "":
+		return parseSPDX(data)
+	case probe.BOMFormat == "CycloneDX":
+		return parseCycloneDX(data)
+	default:
+		return nil, errors.New("unable to recognize SBOM format (only SPDX and CycloneDX JSON are supported)")
+	}
+}
+
+// HasComponent returns true if the purl is listed in the SBOM. Qualifiers
+// and subpaths are ignored when an exact match is not found.
+func (s *SBOM) HasComponent(purl string) bool {
+	if _, ok := s.Components[purl]; ok {
+		return true
+	}
+	base := trimPurl(purl)
+	for c := range s.Components {
+		if trimPurl(c) == base {
+			return true
+		}
+	}
+	return false
+}
+
+// trimPurl removes the qualifiers and subpath from a package URL
+func trimPurl(purl string) string {
+	if i := strings.IndexAny(purl, "?#"); i != -1 {
+		return purl[:i]
+	}
+	return purl
+}
+
+// normalizeAlgorithm returns a digest algorithm name in the form used by
+// in-toto subjects, eg SHA-256 (CycloneDX) or SHA256 (SPDX) become sha256
+func normalizeAlgorithm(alg string) string {
+	return strings.ToLower(strings.ReplaceAll(alg, "-", ""))
+}
+
+// ociPurlDigest returns the digest in the version of an OCI package URL,
+// eg pkg:oci/nginx@sha256%3Aabc... returns sha256 and abc...
+func ociPurlDigest(purl string) (algorithm, value string, ok bool) {
+	if !strings.HasPrefix(purl, "pkg:oci/") {
+		return "", "", false
+	}
+	_, version, found := strings.Cut(trimPurl(purl), "@")
+	if !found {
+		return "", "", false
+	}
+	version, err := url.PathUnescape(version)
+	if err != nil {
+		return "", "", false
+	}
+	algorithm, value, ok = strings.Cut(version, ":")
+	return algorithm, value, ok
+}
+
+// newArtifact builds an artifact from its checksums, falling back to
+// the digest in its package URL for container images
+func newArtifact(name string, digests map[string]string, purls []string) (Artifact, bool) {
+	a := Artifact{Name: name, Digests: map[string]string{}}
+	for alg, value := range digests {
+		a.Digests[normalizeAlgorithm(alg)] = value
+	}
+	if len(a.Digests) == 0 {
+		for _, p := range purls {
+			if alg, value, ok := ociPurlDigest(p); ok {
+				a.Digests[alg] = value
+			}
+		}
+	}
+	return a, len(a.Digests) > 0
+}
+
+type spdxDocument struct {
+	ID            string        `json:"SPDXID"`
+	Describes     []string      `json:"documentDescribes"`
+	Packages      []spdxPackage `json:"packages"`
+	Relationships []struct {
+		Element string `json:"spdxElementId"`
+		Type    string `json:"relationshipType"`
+		Related string `json:"relatedSpdxElement"`
+	} `json:"relationships"`
+}
+
+type spdxPackage struct {
+	ID           string `json:"SPDXID"`
+	Name         string `json:"name"`
+	ExternalRefs []struct {
+		Type    string `json:"referenceType"`
+		Locator string `json:"referenceLocator"`
+	} `json:"externalRefs"`
+	Checksums []struct {
+		Algorithm string `json:"algorithm"`
+		Value     string `json:"checksumValue"`
+	} `json:"checksums"`
+}
+
+func parseSPDX(data []byte) (*SBOM, error) {
+	doc := spdxDocument{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshalling SPDX document: %w", err)
+	}
+	s := &SBOM{
+		Format:     FormatSPDX,
+		Components: map[string]struct{}{},
+	}
+	described := map[string]struct{}{}
+	for _, id := range doc.Describes {
+		described[id] = struct{}{}
+	}
+	for _, r := range doc.Relationships {
+		if r.Type == "DESCRIBES" && r.Element == doc.ID {
+			described[r.Related] = struct{}{}
+		}
+	}
+
+	for _, p := range doc.Packages {
+		purls := []string{}
+		for _, ref := range p.ExternalRefs {
+			if ref.Type == "purl" {
+				s.Components[ref.Locator] = struct{}{}
+				purls = append(purls, ref.Locator)
+			}
+		}
+		if _, ok := described[p.ID]; !ok {
+			continue
+		}
+		digests := map[string]string{}
+		for _, c := range p.Checksums {
+			digests[c.Algorithm] = c.Value
+		}
+		if a, ok := newArtifact(p.Name, digests, purls); ok {
+			s.Described = append(s.Described, a)
+		}
+	}
+	return s, nil
+}
+
+type cdxDocument struct {
+	Metadata struct {
+		Component *cdxComponent `json:"component"`
+	} `json:"metadata"`
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Name       string         `json:"name"`
+	Purl       string         `json:"purl"`
+	Components []cdxComponent `json:"components"`
+	Hashes     []struct {
+		Algorithm string `json:"alg"`
+		Content   string `json:"content"`
+	} `json:"hashes"`
+}
+
+func parseCycloneDX(data []byte) (*SBOM, error) {
+	doc := cdxDocument{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshalling CycloneDX document: %w", err)
+	}
+	s := &SBOM{
+		Format:     FormatCycloneDX,
+		Components: map[string]struct{}{},
+	}
+	var walk func([]cdxComponent)
+	walk = func(cs []cdxComponent) {
+		for i := range cs {
+			if cs[i].Purl != "" {
+				s.Components[cs[i].Purl] = struct{}{}
+			}
+			walk(cs[i].Components)
+		}
+	}
+	if c := doc.Metadata.Component; c != nil {
+		walk([]cdxComponent{*c})
+		digests := map[string]string{}
+		for _, h := range c.Hashes {
+			digests[h.Algorithm] = h.Content
+		}
+		if a, ok := newArtifact(c.Name, digests, []string{c.Purl}); ok {
+			s.Described = append(s.Described, a)
+		}
+	}
+	walk(doc.Components)
+	return s, nil
+}